@@ -0,0 +1,79 @@
+package gcache
+
+import (
+	"encoding/binary"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/cespare/xxhash/v2"
+)
+
+// Big values are stored with fastcache's SetBig: the value is split into
+// chunks keyed by [8-byte value hash][8-byte chunk index] and the key holds
+// [8-byte value hash][8-byte value length]. They are kept in a fastcache of
+// their own, so a small value's bytes can never be read as big value metadata
+// and the other way round. A key lives in one of the two stores at a time.
+
+// bigChunkSize is the payload of a SetBig chunk, mirroring fastcache
+const bigChunkSize = 64*1024 - 16 - 4 - 1
+
+// maxBigKeySize is the longest key SetBig stores
+const maxBigKeySize = bigChunkSize
+
+// bigMetaSize is the size of the metadata SetBig stores under the key
+const bigMetaSize = 16
+
+// WithBigValues lets Set store values past fastcache's per-entry limit of
+// about 64KB, which otherwise fail with ErrValueTooLarge. Such values are
+// split into chunks in a second fastcache of maxBytes, so the cache can use up
+// to twice maxBytes, and reads that miss the small values look them up there.
+// Keys holding identical big values share their chunks, so deleting or
+// overwriting one can make the other miss.
+func WithBigValues() Option {
+	return func(o *options) {
+		o.bigValues = true
+	}
+}
+
+// setBig stores value as a big value under skey, then deletes the chunks of
+// the value it replaces unless they are the same
+func setBig(big *fastcache.Cache, skey, value []byte) {
+	var buf [bigMetaSize]byte
+	old, _ := big.HasGet(buf[:0], skey)
+	big.SetBig(skey, value)
+	if len(old) == bigMetaSize && binary.BigEndian.Uint64(old) != xxhash.Sum64(value) {
+		delBigChunks(big, old)
+	}
+}
+
+// delBig deletes the big value stored under skey and its chunks
+func delBig(big *fastcache.Cache, skey []byte) {
+	var buf [bigMetaSize]byte
+	meta, ok := big.HasGet(buf[:0], skey)
+	if !ok {
+		return
+	}
+	big.Del(skey)
+	if len(meta) == bigMetaSize {
+		delBigChunks(big, meta)
+	}
+}
+
+func delBigChunks(big *fastcache.Cache, meta []byte) {
+	var sub [bigMetaSize]byte
+	for i := range bigChunks(meta) {
+		big.Del(bigChunkKey(sub[:], meta, i))
+	}
+}
+
+// bigChunks returns the number of chunks of the big value described by meta
+func bigChunks(meta []byte) uint64 {
+	n := binary.BigEndian.Uint64(meta[8:])
+	return (n + bigChunkSize - 1) / bigChunkSize
+}
+
+// bigChunkKey writes the key of chunk i of the big value described by meta to dst
+func bigChunkKey(dst, meta []byte, i uint64) []byte {
+	copy(dst[:8], meta[:8])
+	binary.BigEndian.PutUint64(dst[8:], i)
+	return dst[:bigMetaSize]
+}
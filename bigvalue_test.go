@@ -0,0 +1,190 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// randomBytes 返回 n 个随机字节，保证每个大 value 的分块互不相同
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rand.IntN(256))
+	}
+	return b
+}
+
+// entries 返回 fastcache 实例中的 entry 数量
+func entries(fc *fastcache.Cache) uint64 {
+	var s fastcache.Stats
+	fc.UpdateStats(&s)
+	return s.EntriesCount
+}
+
+// TestBigValues 测试开启 WithBigValues 后可以存取超过 64KB 的 value
+func TestBigValues(t *testing.T) {
+	// 每个 bucket 只有 maxBytes/512，太小时分块落入同一 bucket 会互相淘汰
+	cache := NewCache(512*1024*1024, WithBigValues())
+	defer cache.Close()
+
+	for _, size := range []int{100 * 1024, 2 * 1024 * 1024} {
+		value := randomBytes(size)
+		if err := cache.Set("page", value); err != nil {
+			t.Fatalf("Set(%d bytes) failed: %v", size, err)
+		}
+		if got := cache.Get("page"); !bytes.Equal(got, value) {
+			t.Fatalf("Get returned %d bytes, want the %d stored", len(got), size)
+		}
+		if !cache.Has("page") {
+			t.Error("Has = false, want true")
+		}
+		if got := cache.MGet([]string{"missing", "page"}); got[0] != nil || !bytes.Equal(got[1], value) {
+			t.Error("MGet should find the big value")
+		}
+		if got := cache.GetRange("page", size-3, -1); !bytes.Equal(got, value[size-3:]) {
+			t.Errorf("GetRange = %v, want %v", got, value[size-3:])
+		}
+	}
+
+	// 未开启时仍返回 ErrValueTooLarge
+	plain := NewCache(1024 * 1024)
+	defer plain.Close()
+	if err := plain.Set("page", randomBytes(100*1024)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Set without WithBigValues = %v, want %v", err, ErrValueTooLarge)
+	}
+}
+
+// TestBigValues_Delete 测试删除大 value 会删除它的所有分块
+func TestBigValues_Delete(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	cache.Set("page", randomBytes(300*1024))
+	if n := entries(c.big); n != 6 {
+		t.Fatalf("big store holds %d entries, want 5 chunks and the metadata", n)
+	}
+	if err := cache.Delete("page"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if n := entries(c.big); n != 0 {
+		t.Errorf("big store holds %d entries after Delete, want 0", n)
+	}
+	if cache.Has("page") || cache.Get("page") != nil {
+		t.Error("deleted big value should miss")
+	}
+
+	cache.Set("page", randomBytes(300*1024))
+	if got := cache.GetAndDelete("page"); len(got) != 300*1024 {
+		t.Errorf("GetAndDelete returned %d bytes, want %d", len(got), 300*1024)
+	}
+	if n := entries(c.big); n != 0 {
+		t.Errorf("big store holds %d entries after GetAndDelete, want 0", n)
+	}
+}
+
+// TestBigValues_Overwrite 测试同一个 key 在大小 value 之间来回覆盖不会读到旧数据
+func TestBigValues_Overwrite(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	small := []byte("small")
+	big1 := randomBytes(200 * 1024)
+	big2 := randomBytes(150 * 1024)
+
+	cache.Set("key", small)
+	cache.Set("key", big1)
+	if got := cache.Get("key"); !bytes.Equal(got, big1) {
+		t.Fatal("small overwritten with big should read the big value")
+	}
+	if c.fc().Has([]byte("key")) {
+		t.Error("small value should be deleted")
+	}
+
+	// 大覆盖大：旧分块被删除
+	cache.Set("key", big2)
+	if got := cache.Get("key"); !bytes.Equal(got, big2) {
+		t.Fatal("big overwritten with big should read the new value")
+	}
+	if n := entries(c.big); n != 4 {
+		t.Errorf("big store holds %d entries, want the 3 chunks of the new value and its metadata", n)
+	}
+
+	cache.Set("key", small)
+	if got := cache.Get("key"); !bytes.Equal(got, small) {
+		t.Fatalf("big overwritten with small = %d bytes, want %q", len(got), small)
+	}
+	if n := entries(c.big); n != 0 {
+		t.Errorf("big store holds %d entries, want 0", n)
+	}
+	if err := cache.Delete("key"); err != nil || cache.Has("key") {
+		t.Errorf("Delete = %v, Has = %v, want nil, false", err, cache.Has("key"))
+	}
+}
+
+// TestBigValues_Evicted 测试分块被淘汰后大 value 视为不存在
+func TestBigValues_Evicted(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	cache.Set("page", randomBytes(200*1024))
+	var meta [bigMetaSize]byte
+	c.big.Get(meta[:0], []byte("page"))
+	var sub [bigMetaSize]byte
+	c.big.Del(bigChunkKey(sub[:], meta[:], 1)) // 模拟淘汰
+
+	if cache.Has("page") || cache.Get("page") != nil {
+		t.Error("big value with a missing chunk should miss")
+	}
+}
+
+// TestBigValues_TTL 测试 CacheWithTTL 计入头部后按大小分流，并正常过期
+func TestBigValues_TTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	// fastcache 的 bucket 只有 maxBytes/512，太小时 1MB value 的 chunk 偶尔会挤在同一个 bucket 里被淘汰
+	cache := NewCacheWithTTL(256*1024*1024, WithClock(clock), WithBigValues(), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	hdr, _ := c.wrap([]byte{}, time.Minute)
+	fits := randomBytes(maxKeyValueSize - len("key") - len(hdr))
+	cache.Set("key", fits, time.Minute)
+	if !c.cache.fc().Has([]byte("key")) || entries(c.cache.big) != 0 {
+		t.Error("value fitting an entry with its header should be stored as a small value")
+	}
+	over := randomBytes(len(fits) + 1)
+	cache.Set("key", over, time.Minute)
+	if c.cache.fc().Has([]byte("key")) || entries(c.cache.big) == 0 {
+		t.Error("value past the limit with its header should be stored as a big value")
+	}
+	if got, ttl, ok := cache.GetWithTTL("key"); !ok || !bytes.Equal(got, over) || ttl != time.Minute {
+		t.Errorf("GetWithTTL = %d bytes, %v, %v, want %d bytes, 1m, true", len(got), ttl, ok, len(over))
+	}
+
+	cache.Set("page", randomBytes(1024*1024), time.Second)
+	if err := cache.Append("page", []byte("tail"), time.Second); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := cache.Get("page"); len(got) != 1024*1024+4 || !bytes.Equal(got[len(got)-4:], []byte("tail")) {
+		t.Errorf("Get after Append returned %d bytes", len(got))
+	}
+
+	clock.Advance(2 * time.Second)
+	if cache.Has("page") {
+		t.Error("expired big value should miss")
+	}
+	rep, err := cache.Compact()
+	if err != nil || rep.Retained != 1 {
+		t.Errorf("Compact = %+v, %v, want 1 retained", rep, err)
+	}
+	if !bytes.Equal(cache.Get("key"), over) {
+		t.Error("live big value should survive Compact")
+	}
+}
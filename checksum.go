@@ -0,0 +1,43 @@
+package gcache
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// With WithChecksum every value is stored as [4-byte big-endian CRC32C][value],
+// the value being the one fastcache would hold otherwise: with CacheWithTTL
+// the wrapped entry, header included, and for a hashed key its envelope.
+
+// checksumSize is the size of the checksum in front of a value
+const checksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// WithChecksum stores a CRC32C with every value and verifies it on reads, so
+// a value corrupted in memory reads as missing instead of being served. Such
+// reads are counted in Stats.CorruptReads, the entry stays until it is
+// overwritten, deleted or evicted. It costs 4 bytes per entry and hashing
+// every value on writes and reads.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// addChecksum returns value with its checksum in front
+func addChecksum(value []byte) []byte {
+	buf := make([]byte, checksumSize+len(value))
+	binary.BigEndian.PutUint32(buf, crc32.Checksum(value, castagnoli))
+	copy(buf[checksumSize:], value)
+	return buf
+}
+
+// checkChecksum returns the value of stored, false if it doesn't match its checksum
+func checkChecksum(stored []byte) ([]byte, bool) {
+	if len(stored) < checksumSize {
+		return nil, false
+	}
+	value := stored[checksumSize:]
+	return value, binary.BigEndian.Uint32(stored) == crc32.Checksum(value, castagnoli)
+}
@@ -0,0 +1,124 @@
+package gcache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corrupt 翻转 fastcache 中 skey 对应 entry 的最后一个字节，模拟内存损坏
+func corrupt(t *testing.T, c *Cache, skey []byte) {
+	t.Helper()
+	raw, ok := c.fc().HasGet(nil, skey)
+	if !ok {
+		t.Fatalf("no entry stored under %q", skey)
+	}
+	raw[len(raw)-1] ^= 0xff
+	c.fc().Set(skey, raw)
+}
+
+// TestChecksum 测试开启 WithChecksum 后读写透明，损坏的 entry 视为未命中并计数
+func TestChecksum(t *testing.T) {
+	cache := NewCache(1024*1024, WithChecksum())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	cache.Set("key", []byte("value"))
+	cache.Set("empty", []byte{})
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get = %q, want value", got)
+	}
+	if got, ok := cache.GetOK("empty"); !ok || len(got) != 0 {
+		t.Errorf("GetOK(empty) = %q, %v, want an empty hit", got, ok)
+	}
+	if n, err := cache.Incr("n", 3); err != nil || n != 3 {
+		t.Errorf("Incr = %d, %v, want 3, nil", n, err)
+	}
+	if raw := c.fc().Get(nil, []byte("key")); len(raw) != checksumSize+len("value") {
+		t.Errorf("stored %d bytes, want the value and its checksum", len(raw))
+	}
+
+	corrupt(t, c, []byte("key"))
+	if got, ok := cache.GetOK("key"); ok {
+		t.Errorf("GetOK of a corrupted entry = %q, true, want a miss", got)
+	}
+	if cache.Has("key") || cache.MGet([]string{"key"})[0] != nil {
+		t.Error("corrupted entry should miss")
+	}
+	if got := cache.Stats().CorruptReads; got != 3 {
+		t.Errorf("CorruptReads = %d, want 3", got)
+	}
+	cache.ResetStats()
+	if got := cache.Stats().CorruptReads; got != 0 {
+		t.Errorf("CorruptReads after ResetStats = %d, want 0", got)
+	}
+
+	// 覆盖后恢复正常
+	cache.Set("key", []byte("again"))
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("again")) {
+		t.Errorf("Get after overwrite = %q, want again", got)
+	}
+}
+
+// TestChecksum_Options 测试校验和与长 key 哈希、大 value 同时开启
+func TestChecksum_Options(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithChecksum(), WithKeyHashing(64), WithBigValues())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	long := strings.Repeat("k", 1024)
+	page := randomBytes(200 * 1024)
+	cache.Set(long, []byte("value"))
+	cache.Set("page", page)
+	if got := cache.Get(long); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get(long) = %q, want value", got)
+	}
+	if got := cache.Get("page"); !bytes.Equal(got, page) {
+		t.Errorf("Get(page) returned %d bytes, want the %d stored", len(got), len(page))
+	}
+
+	corrupt(t, c, c.storeKey(long))
+	if cache.Has(long) {
+		t.Error("corrupted hashed key should miss")
+	}
+	if got := cache.Stats().CorruptReads; got != 1 {
+		t.Errorf("CorruptReads = %d, want 1", got)
+	}
+}
+
+// TestChecksum_TTL 测试 CacheWithTTL 校验包含头部的整个 entry，压缩时丢弃损坏的 entry
+func TestChecksum_TTL(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithClock(NewFakeClock(time.Now())), WithChecksum(), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("key", []byte("value"), time.Minute)
+	cache.Set("other", []byte("value"), time.Minute)
+	if got, ttl, ok := cache.GetWithTTL("key"); !ok || !bytes.Equal(got, []byte("value")) || ttl != time.Minute {
+		t.Errorf("GetWithTTL = %q, %v, %v, want value, 1m, true", got, ttl, ok)
+	}
+
+	corrupt(t, c.cache, []byte("key"))
+	if cache.Get("key") != nil || cache.Has("key") {
+		t.Error("corrupted entry should miss")
+	}
+	if got := cache.Stats().CorruptReads; got != 2 {
+		t.Errorf("CorruptReads = %d, want 2", got)
+	}
+	if got := cache.AsICache(time.Minute).Stats().CorruptReads; got != 2 {
+		t.Errorf("CorruptReads of the ICache view = %d, want 2", got)
+	}
+
+	rep, err := cache.Compact()
+	if err != nil || rep.Retained != 1 || rep.Dropped != 1 {
+		t.Errorf("Compact = %+v, %v, want 1 retained and 1 dropped", rep, err)
+	}
+	if got := cache.Get("other"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Compact = %q, want value", got)
+	}
+	cache.ResetStats()
+	if got := cache.Stats().CorruptReads; got != 0 {
+		t.Errorf("CorruptReads after ResetStats = %d, want 0", got)
+	}
+}
@@ -0,0 +1,61 @@
+package gcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time for expiry, see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// Expiry is stored in unix millis so it keeps its meaning outside this process,
+// e.g. for entries written by a previous one, which are simply compared against
+// this process's clock. By default it is read from procClock: the wall time
+// taken once at start, advanced by the monotonic clock. Stepping the system
+// clock then neither expires live entries early nor keeps them around longer.
+
+// wallNow reads the wall clock, tests replace it to simulate a clock step
+var wallNow = time.Now
+
+var procClock = newClock()
+
+type clock struct {
+	wall  time.Time // wall time at start
+	start time.Time // carries the monotonic reading
+}
+
+func newClock() *clock {
+	return &clock{wall: wallNow().Round(0), start: time.Now()}
+}
+
+// Now returns the wall time at start plus the monotonic time elapsed since
+func (c *clock) Now() time.Time {
+	return c.wall.Add(time.Since(c.start))
+}
+
+// FakeClock is a Clock that only moves when told to,
+// for tests that need expiry without sleeping.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
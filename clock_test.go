@@ -0,0 +1,84 @@
+package gcache
+
+import (
+	"testing"
+	"time"
+)
+
+// stepWallClock 模拟系统时钟跳变，返回恢复函数
+func stepWallClock(step time.Duration) func() {
+	wallNow = func() time.Time { return time.Now().Add(step) }
+	return func() { wallNow = time.Now }
+}
+
+// TestClock_Step 测试时钟创建后系统时钟跳变不影响读数
+func TestClock_Step(t *testing.T) {
+	c := newClock()
+
+	for _, step := range []time.Duration{time.Hour, -time.Hour} {
+		restore := stepWallClock(step)
+		if d := c.Now().Sub(time.Now()); d < -time.Second || d > time.Second {
+			t.Errorf("clock moved by %v after a %v wall clock step", d, step)
+		}
+		restore()
+	}
+
+	// 创建时读取一次墙上时间
+	restore := stepWallClock(time.Hour)
+	defer restore()
+	if d := newClock().Now().Sub(time.Now()); d < time.Hour-time.Second {
+		t.Errorf("clock started %v from the wall clock, want about 1h", d)
+	}
+}
+
+// TestCacheWithTTL_ClockStep 测试时钟跳变不会提前过期或延长 entry
+func TestCacheWithTTL_ClockStep(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("long", []byte("value"), time.Minute)
+	cache.Set("short", []byte("value"), 50*time.Millisecond)
+
+	// 向前跳变不会让 entry 提前过期
+	restore := stepWallClock(time.Hour)
+	if !cache.Has("long") {
+		t.Error("forward clock step expired a live entry")
+	}
+	if ttl, ok := cache.TTL("long"); !ok || ttl < time.Minute-time.Second {
+		t.Errorf("TTL after forward step = %v, %v, want about 1m", ttl, ok)
+	}
+	restore()
+
+	// 向后跳变不会让 entry 存活更久
+	restore = stepWallClock(-time.Hour)
+	defer restore()
+	time.Sleep(100 * time.Millisecond)
+	if cache.Has("short") {
+		t.Error("backward clock step kept an expired entry alive")
+	}
+}
+
+// TestFakeClock 测试 FakeClock 只在 Advance 时前进
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now = %v, want %v", got, start)
+	}
+	clock.Advance(time.Hour)
+	if got := clock.Now(); !got.Equal(start.Add(time.Hour)) {
+		t.Errorf("Now after Advance = %v, want %v", got, start.Add(time.Hour))
+	}
+
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock))
+	defer cache.Close()
+	cache.Set("key", []byte("value"), time.Minute)
+	clock.Advance(time.Minute - time.Millisecond)
+	if !cache.Has("key") {
+		t.Error("key expired before its TTL")
+	}
+	clock.Advance(time.Millisecond)
+	if cache.Has("key") {
+		t.Error("key still live after its TTL")
+	}
+}
@@ -0,0 +1,106 @@
+package gcache
+
+import (
+	"errors"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// ErrNoKeyIndex is returned by CacheWithTTL.Compact for a cache that doesn't
+// track its keys, see WithKeyIndex.
+var ErrNoKeyIndex = errors.New("gcache: the cache keeps no key index")
+
+// CompactReport describes what CacheWithTTL.Compact kept and dropped. Bytes
+// count keys and stored values, headers included.
+type CompactReport struct {
+	Retained      int
+	RetainedBytes int64
+	Dropped       int // expired entries, and indexed keys fastcache had evicted
+	DroppedBytes  int64
+}
+
+// Compact copies the live entries into a fresh fastcache of the same capacity
+// and swaps it in, reclaiming the space of expired and deleted entries. Reads
+// keep using the old instance until the swap, writes wait for the copy to
+// finish. Entries are found through the key index, so it fails with
+// ErrNoKeyIndex unless the cache keeps one. Expired big values, see
+// WithBigValues, are deleted in place.
+func (c *CacheWithTTL) Compact() (CompactReport, error) {
+	if c.index == nil {
+		return CompactReport{}, ErrNoKeyIndex
+	}
+	// expired entries are counted once every lock is released
+	expired := 0
+	defer func() {
+		for range expired {
+			c.cache.expiredPurged()
+		}
+	}()
+	c.cache.locks.lockAll()
+	defer c.cache.locks.unlockAll()
+	if c.cache.closed.Load() {
+		return CompactReport{}, ErrClosed
+	}
+
+	// entries of every size pass through it
+	buf := c.cache.pool.getSize(maxKeyValueSize)
+	defer c.cache.pool.put(buf)
+
+	var rep CompactReport
+	old, fresh := c.cache.fc(), fastcache.New(c.cache.maxBytes)
+	now := c.now()
+	c.index.retain(func(key string) bool {
+		// entries are copied as stored, packed as put left them
+		skey := c.cache.storeKey(key)
+		raw, has := old.HasGet(buf.b[:0], skey)
+		big := !has && c.cache.big != nil
+		if big {
+			raw = c.cache.big.GetBig(raw, skey)
+			has = len(raw) > 0
+		}
+		buf.b = raw[:0]
+		size := int64(len(skey) + len(raw))
+		data := raw
+		if has && c.cache.packs(key) {
+			data, has = c.cache.unpack(raw, key)
+		}
+		h, n, ok := c.decode(data)
+		if !has || !ok || isExpired(h.deadline(), now) {
+			if big {
+				delBig(c.cache.big, skey)
+			}
+			if has && ok {
+				expired++
+			}
+			rep.Dropped++
+			rep.DroppedBytes += size
+			return false
+		}
+		// legacy entries are marked, see WithLegacyEntries, and kept as they
+		// are if their expiry or size doesn't fit the format the cache writes
+		if !marked(data) {
+			if wrapped, err := c.encode(h.payload(data, n), h); err == nil {
+				packed := c.cache.pack(key, wrapped)
+				if big {
+					setBig(c.cache.big, skey, packed)
+				} else if len(skey)+len(packed) <= maxKeyValueSize {
+					raw = packed
+				}
+			}
+		}
+		// big values stay in their own store, which Compact doesn't rebuild
+		if !big {
+			fresh.Set(skey, raw)
+		}
+		rep.Retained++
+		rep.RetainedBytes += size
+		return true
+	})
+
+	c.cache.cache.Store(fresh)
+	// reads that loaded the old instance before the swap finish before it is released
+	c.cache.reads.Lock()
+	c.cache.reads.Unlock()
+	old.Reset()
+	return rep, nil
+}
@@ -0,0 +1,107 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCompact 测试压缩只保留未过期的 entry
+func TestCompact(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("junk-%d", i), []byte("value"), time.Second)
+	}
+	cache.Set("live", []byte("value"), time.Hour)
+	cache.SetWithSoftTTL("stale", []byte("value"), time.Second, time.Hour)
+	cache.Set("evicted", []byte("value"), time.Hour)
+	c.cache.fc().Del([]byte("evicted")) // 模拟淘汰
+	clock.Advance(2 * time.Second)
+
+	rep, err := cache.Compact()
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if rep.Retained != 2 || rep.Dropped != 101 {
+		t.Errorf("report = %+v, want 2 retained, 101 dropped", rep)
+	}
+	if rep.RetainedBytes <= 0 || rep.DroppedBytes <= rep.RetainedBytes {
+		t.Errorf("report = %+v, want more bytes dropped than retained", rep)
+	}
+
+	// 保留的 entry 内容与 TTL 不变，软过期窗口也保留
+	if got, ttl, ok := cache.GetWithTTL("live"); !ok || !bytes.Equal(got, []byte("value")) || ttl != time.Hour-2*time.Second {
+		t.Errorf("GetWithTTL(live) = %q, %v, %v", got, ttl, ok)
+	}
+	if _, stale, ok := cache.GetStale("stale"); !ok || !stale {
+		t.Errorf("GetStale(stale) = %v, %v, want true, true", stale, ok)
+	}
+	if _, _, ok := cache.GetStale("junk-0"); ok {
+		t.Error("expired entry should be dropped")
+	}
+	if n := c.index.len(); n != 2 {
+		t.Errorf("index holds %d keys, want 2", n)
+	}
+
+	// 压缩后缓存可以继续正常读写
+	cache.Set("after", []byte("value"), time.Hour)
+	if !cache.Has("after") {
+		t.Error("cache should be usable after Compact")
+	}
+}
+
+// TestCompact_NoIndex 测试没有 key 索引时返回错误
+func TestCompact_NoIndex(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if _, err := cache.Compact(); !errors.Is(err, ErrNoKeyIndex) {
+		t.Errorf("Compact = %v, want ErrNoKeyIndex", err)
+	}
+}
+
+// TestCompact_Concurrent 测试压缩期间并发的读写不丢失
+func TestCompact_Concurrent(t *testing.T) {
+	cache := NewCacheWithTTL(4*1024*1024, WithKeyIndex())
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("base-%d", i), []byte("value"), time.Hour)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				cache.Set(fmt.Sprintf("w%d-%d", w, i), []byte("value"), time.Hour)
+				if !cache.Has(fmt.Sprintf("base-%d", i)) {
+					t.Errorf("base-%d missing during Compact", i)
+					return
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Compact(); err != nil {
+			t.Fatalf("Compact failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 500; i++ {
+			if !cache.Has(fmt.Sprintf("w%d-%d", w, i)) {
+				t.Fatalf("write w%d-%d lost by Compact", w, i)
+			}
+		}
+	}
+}
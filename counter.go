@@ -0,0 +1,66 @@
+package gcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// int64 counters are stored as 8-byte big-endian values. float64 counters
+// carry a tag byte before their 8-byte IEEE-754 payload so the two can't be
+// mistaken for each other.
+
+const (
+	counterSize      = 8
+	floatTag         = 'f'
+	floatCounterSize = 1 + counterSize
+)
+
+// ErrInvalidFloat is returned by IncrFloat for a NaN or infinite delta or result.
+var ErrInvalidFloat = errors.New("gcache: float counter delta or result is NaN or Inf")
+
+// counterEncoding names the encoding of value as reported by EncodingError
+func counterEncoding(value []byte) string {
+	switch {
+	case len(value) == counterSize:
+		return "int64"
+	case len(value) == floatCounterSize && value[0] == floatTag:
+		return "float64"
+	}
+	return "bytes"
+}
+
+// decodeCounter reads the int64 counter held by value
+func decodeCounter(key string, value []byte) (int64, error) {
+	if enc := counterEncoding(value); enc != "int64" {
+		return 0, EncodingError{Key: key, Want: "int64", Got: enc}
+	}
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
+
+// putCounter writes n over the int64 counter held by value
+func putCounter(value []byte, n int64) {
+	binary.BigEndian.PutUint64(value, uint64(n))
+}
+
+// decodeFloatCounter reads the float64 counter held by value
+func decodeFloatCounter(key string, value []byte) (float64, error) {
+	if enc := counterEncoding(value); enc != "float64" {
+		return 0, EncodingError{Key: key, Want: "float64", Got: enc}
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(value[1:])), nil
+}
+
+// putFloatCounter writes f as a float64 counter into value
+func putFloatCounter(value []byte, f float64) {
+	value[0] = floatTag
+	binary.BigEndian.PutUint64(value[1:], math.Float64bits(f))
+}
+
+// checkFloat rejects NaN and infinite values
+func checkFloat(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrInvalidFloat
+	}
+	return nil
+}
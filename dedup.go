@@ -0,0 +1,77 @@
+package gcache
+
+import "bytes"
+
+// WithSetDedup makes Set skip the write when key already holds the value, so
+// refreshing unchanged values doesn't churn fastcache's ring and evict other
+// entries. Set then reads the entry first, in the pooled read buffer, and
+// skipped writes are counted in Stats.SkippedWrites.
+//
+// CacheWithTTL compares the value only. If the entry would also keep its
+// header, the same ttl and an expiry equal once rounded to WithTTLPrecision,
+// which refreshes within the precision are, nothing is written. Otherwise only
+// the header is rewritten, with the new expiry, and the stored payload is
+// kept. Either way the entry keeps its creation time, see Age.
+func WithSetDedup() Option {
+	return func(o *options) {
+		o.setDedup = true
+	}
+}
+
+// unchanged reports whether key already holds value, see WithSetDedup
+func (c *Cache) unchanged(key string, value []byte) bool {
+	same := false
+	c.view(key, func(data []byte) {
+		same = bytes.Equal(data, value)
+	})
+	return same
+}
+
+// unchanged reports whether the live entry of key already holds value, and
+// whether it has the header Set would write with h too, but for its creation
+// time, see WithSetDedup
+func (c *CacheWithTTL) unchanged(key string, value []byte, h header) (same, sameHeader bool) {
+	var hdr [maxHeaderSize]byte
+	n, err := c.putHeader(hdr[:], h)
+	if err != nil {
+		return false, false
+	}
+	// decoded back, so both expiries went through the format's rounding
+	want, _, _ := c.decode(hdr[:n])
+	c.cache.view(key, func(data []byte) {
+		if !marked(data) {
+			return
+		}
+		got, m, ok := c.decode(data)
+		same = ok && !isExpired(got.deadline(), c.now()) && holds(got, data, m, value)
+		sameHeader = same && got.expireAt == want.expireAt && got.ttl == want.ttl &&
+			got.stale == 0 && got.tti == 0
+	})
+	return same, sameHeader
+}
+
+// holds reports whether the entry data, decoded as h and n, holds value
+func holds(h header, data []byte, n int, value []byte) bool {
+	return h.nilValue == (value == nil) && bytes.Equal(h.payload(data, n), value)
+}
+
+// rewriteHeader replaces the header of the live entry of key with h if it
+// still holds value, keeping its payload and creation time
+func (c *CacheWithTTL) rewriteHeader(key string, value []byte, h header) bool {
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	wrapped, _ := c.cache.load(buf, key)
+	old, n, ok := c.decode(wrapped)
+	if !ok || isExpired(old.deadline(), c.now()) || !holds(old, wrapped, n, value) {
+		return false
+	}
+	h.createdAt, h.nilValue = old.createdAt, old.nilValue
+	return c.replaceHeader(key, wrapped, n, h) == nil
+}
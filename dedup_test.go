@@ -0,0 +1,161 @@
+package gcache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// setCalls 返回 fastcache 收到的写入次数
+func setCalls(fc *fastcache.Cache) uint64 {
+	var s fastcache.Stats
+	fc.UpdateStats(&s)
+	return s.SetCalls
+}
+
+// TestSetDedup 测试 WithSetDedup 跳过相同 value 的写入并计数
+func TestSetDedup(t *testing.T) {
+	cache := NewCache(1024*1024, WithSetDedup())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	cache.Set("key", []byte("value"))
+	cache.Set("key", []byte("value"))
+	if got := setCalls(c.fc()); got != 1 {
+		t.Errorf("fastcache SetCalls = %d, want 1", got)
+	}
+	cache.Set("key", []byte("other"))
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("other")) {
+		t.Errorf("Get after a changed value = %q, want other", got)
+	}
+	// 空 value 与缺失的 key 不相同
+	cache.Set("empty", nil)
+	if _, ok := cache.GetOK("empty"); !ok {
+		t.Error("empty value should be stored")
+	}
+	cache.Delete("key")
+	cache.Set("key", []byte("other"))
+	if !cache.Has("key") {
+		t.Error("Set after Delete should write")
+	}
+	if got := cache.Stats().SkippedWrites; got != 1 {
+		t.Errorf("SkippedWrites = %d, want 1", got)
+	}
+
+	// 跳过的写入不分配内存
+	value := []byte("other")
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Set("key", value)
+	})
+	if allocs != 0 {
+		t.Errorf("skipped Set allocs = %v, want 0", allocs)
+	}
+
+	// 未开启时照常写入
+	plain := NewCache(1024 * 1024)
+	defer plain.Close()
+	plain.Set("key", []byte("value"))
+	plain.Set("key", []byte("value"))
+	if got := setCalls(plain.(*Cache).fc()); got != 2 || plain.Stats().SkippedWrites != 0 {
+		t.Errorf("fastcache SetCalls without dedup = %d, want 2", got)
+	}
+}
+
+// TestSetDedup_TTL 测试 CacheWithTTL 在 payload 与过期时间都不变时跳过写入，只有过期时间变化时只重写 header
+func TestSetDedup_TTL(t *testing.T) {
+	// 对齐到整秒，之后半秒内的写入过期时间相同
+	clock := NewFakeClock(time.Now().Truncate(time.Second).Add(time.Millisecond))
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithTTLPrecision(time.Second), WithSetDedup())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("key", []byte("value"), time.Minute)
+	clock.Advance(500 * time.Millisecond)
+	cache.Set("key", []byte("value"), time.Minute)
+	if got := setCalls(c.cache.fc()); got != 1 {
+		t.Errorf("fastcache SetCalls = %d, want 1", got)
+	}
+	// 创建时间保持第一次写入的时间
+	if age, ok := cache.Age("key"); !ok || age != 500*time.Millisecond {
+		t.Errorf("Age = %v, %v, want 500ms", age, ok)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value []byte
+		ttl   time.Duration
+	}{
+		{"changed value", []byte("other"), time.Minute},
+		{"nil value", nil, time.Minute},
+		{"empty value", []byte{}, time.Minute},
+		{"changed ttl", []byte{}, time.Hour},
+	} {
+		before := setCalls(c.cache.fc())
+		cache.Set("key", tc.value, tc.ttl)
+		if got := setCalls(c.cache.fc()); got != before+1 {
+			t.Errorf("%s: fastcache SetCalls = %d, want %d", tc.name, got, before+1)
+		}
+		if got, ok := cache.GetOK("key"); !ok || !bytes.Equal(got, tc.value) || (got == nil) != (tc.value == nil) {
+			t.Errorf("%s: GetOK = %q, %v, want %q", tc.name, got, ok, tc.value)
+		}
+	}
+
+	// 过期时间推后时重写 header
+	clock.Advance(time.Second)
+	before := setCalls(c.cache.fc())
+	cache.Set("key", []byte{}, time.Hour)
+	if got := setCalls(c.cache.fc()); got != before+1 {
+		t.Errorf("fastcache SetCalls after a second = %d, want %d", got, before+1)
+	}
+	// 过期时间向上取整到秒
+	if ttl, ok := cache.TTL("key"); !ok || ttl < time.Hour || ttl >= time.Hour+time.Second {
+		t.Errorf("TTL = %v, %v, want 1h rounded up to the second", ttl, ok)
+	}
+
+	// 带 soft TTL 的 entry 同样只重写 header
+	cache.SetWithSoftTTL("soft", []byte("value"), time.Second, time.Minute)
+	before = setCalls(c.cache.fc())
+	cache.Set("soft", []byte("value"), time.Minute)
+	if got := setCalls(c.cache.fc()); got != before+1 {
+		t.Errorf("Set over a soft TTL entry: fastcache SetCalls = %d, want %d", got, before+1)
+	}
+
+	// 相同 value 的写入都计入，包括只重写 header 的
+	if got := cache.Stats().SkippedWrites; got != 4 {
+		t.Errorf("SkippedWrites = %d, want 4", got)
+	}
+
+	// 跳过的写入不分配内存
+	value := []byte("value")
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Set("soft", value, time.Minute)
+	})
+	if allocs != 0 || cache.Stats().SkippedWrites != 105 {
+		t.Errorf("skipped Set allocs = %v after %d skipped writes, want 0 after 105", allocs, cache.Stats().SkippedWrites)
+	}
+}
+
+// TestSetDedup_TTLRefresh 测试一分钟后以相同 value 刷新只重写 header，过期时间推后，创建时间不变
+func TestSetDedup_TTLRefresh(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithSetDedup())
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Hour)
+	clock.Advance(time.Minute)
+	cache.Set("key", []byte("value"), time.Hour)
+	if got := cache.Stats().SkippedWrites; got != 1 {
+		t.Errorf("SkippedWrites = %d, want 1", got)
+	}
+	if ttl, ok := cache.TTL("key"); !ok || ttl != time.Hour {
+		t.Errorf("TTL = %v, %v, want 1h", ttl, ok)
+	}
+	if age, ok := cache.Age("key"); !ok || age != time.Minute {
+		t.Errorf("Age = %v, %v, want 1m", age, ok)
+	}
+	if got, ok := cache.GetOK("key"); !ok || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetOK = %q, %v, want value", got, ok)
+	}
+}
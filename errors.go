@@ -0,0 +1,131 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxKeyValueSize is the largest key+value fastcache stores: the entry plus its
+// 4-byte length header must stay below one 64KB chunk. Larger entries are
+// silently dropped by fastcache.
+const maxKeyValueSize = 64*1024 - 1 - 4
+
+// ErrInvalidMaxBytes is returned by NewCacheE and NewCacheWithTTLE, and what
+// NewCache and NewCacheWithTTL panic with, for a size fastcache can't allocate.
+var ErrInvalidMaxBytes = errors.New("gcache: invalid max bytes")
+
+// ErrClosed is returned by writes to a closed cache and by CacheWithTTL.GetE.
+var ErrClosed = errors.New("gcache: cache is closed")
+
+// ErrNotFound is returned by GetE for a key that is missing or expired.
+var ErrNotFound = errors.New("gcache: key not found")
+
+// ErrNotTTLEntry is returned by CacheWithTTL.GetE for a key holding a value it
+// didn't write, e.g. one stored by a plain Cache sharing its keys. The error
+// wrapping it tells the key.
+var ErrNotTTLEntry = errors.New("gcache: not a ttl entry")
+
+// ErrValueTooLarge is returned when an entry would exceed fastcache's per-entry
+// limit, which fastcache would silently drop. The error wrapping it tells the
+// entry's size and the limit.
+var ErrValueTooLarge = errors.New("gcache: value too large")
+
+// ErrTTLOutOfRange is returned by caches created with WithCompactTTL for
+// an expiry the compact format can't represent.
+var ErrTTLOutOfRange = errors.New("gcache: ttl out of range of the compact format")
+
+// checkEntrySize returns ErrValueTooLarge if a key of keyLen bytes and a value
+// of size bytes don't fit one entry
+func checkEntrySize(keyLen, size int) error {
+	if n := keyLen + size; n > maxKeyValueSize {
+		return fmt.Errorf("%w: key+value is %d bytes, limit is %d", ErrValueTooLarge, n, maxKeyValueSize)
+	}
+	return nil
+}
+
+// ErrNoTTL is returned by Touch for entries that have no TTL to refresh.
+var ErrNoTTL = errors.New("gcache: entry has no ttl to refresh")
+
+// ErrInvalidSoftTTL is returned by SetWithSoftTTL for a soft ttl that isn't
+// positive or exceeds the hard ttl.
+var ErrInvalidSoftTTL = errors.New("gcache: soft ttl must be positive and no longer than the hard ttl")
+
+// ErrInvalidTTI is returned by SetWithTTI for a tti that isn't positive.
+var ErrInvalidTTI = errors.New("gcache: tti must be positive")
+
+// EncodingError is returned by counter operations on a value stored in another encoding,
+// the value is left untouched.
+type EncodingError struct {
+	Key  string
+	Want string // encoding the operation needs
+	Got  string // encoding found in the cache
+}
+
+func (e EncodingError) Error() string {
+	return fmt.Sprintf("gcache: %q holds %s, not %s", e.Key, e.Got, e.Want)
+}
+
+// KeyError is the failure of a single key in a batch operation.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e KeyError) Error() string {
+	return fmt.Sprintf("%q: %v", e.Key, e.Err)
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError collects the per-key failures of a batch operation,
+// the keys not listed were applied.
+type BatchError struct {
+	Errors []KeyError
+}
+
+func (e *BatchError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "gcache: %d keys failed: ", len(e.Errors))
+	for i, ke := range e.Errors {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(ke.Error())
+	}
+	return sb.String()
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, ke := range e.Errors {
+		errs[i] = ke
+	}
+	return errs
+}
+
+// Keys returns the failed keys in the order they were reported.
+func (e *BatchError) Keys() []string {
+	keys := make([]string, len(e.Errors))
+	for i, ke := range e.Errors {
+		keys[i] = ke.Key
+	}
+	return keys
+}
+
+// add records err for key if it's not nil
+func (e *BatchError) add(key string, err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, KeyError{Key: key, Err: err})
+	}
+}
+
+// err returns nil when nothing failed, so callers don't return a typed nil
+func (e *BatchError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,140 @@
+package gcache
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ErrInvalidFilterRate is returned by NewCacheE and NewCacheWithTTLE for a
+// WithNegativeLookupFilter false positive rate outside (0, 1).
+var ErrInvalidFilterRate = errors.New("gcache: filter false positive rate must be between 0 and 1")
+
+// WithNegativeLookupFilter puts a counting bloom filter of the keys stored in
+// front of the cache, so reads of keys never written miss without a pool
+// buffer or a fastcache lookup. It is sized for expectedKeys keys at a false
+// positive rate of fpRate, at 4 bits per counter: about 1.2 bytes per key at
+// 1%, 1.8 at 0.1%. The filter only ever errs towards a lookup: false positives
+// read fastcache as without it.
+//
+// Writes count the keys they add and deletes the keys they remove, so deleted
+// keys leave the filter. Keys fastcache evicts to make room stay counted until
+// deleted or Reset, as do keys of a counter that saturated at 15, both only
+// adding false positives; see Stats.FilterSkips and Stats.FilterFalsePositives
+// to check the filter earns its memory. Writes then check whether the key is
+// stored first. A non-positive expectedKeys disables it, constructors fail with
+// ErrInvalidFilterRate for a rate outside (0, 1).
+func WithNegativeLookupFilter(expectedKeys int, fpRate float64) Option {
+	return func(o *options) {
+		o.filterKeys, o.filterRate = expectedKeys, fpRate
+	}
+}
+
+// checkFilterRate returns ErrInvalidFilterRate for a rate
+// WithNegativeLookupFilter doesn't accept
+func checkFilterRate(rate float64) error {
+	if !(rate > 0 && rate < 1) {
+		return ErrInvalidFilterRate
+	}
+	return nil
+}
+
+// bloomFilter is a counting bloom filter of 4-bit counters, 16 to a word. A
+// key's counters are incremented when it is stored and decremented when it is
+// deleted, both under the key's lock, so a stored key never reads as absent.
+// A saturated counter sticks.
+type bloomFilter struct {
+	words          []atomic.Uint64
+	m              uint64 // counters
+	k              uint64 // counters per key
+	skips          atomic.Int64
+	falsePositives atomic.Int64
+}
+
+func newBloomFilter(n int, rate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{
+		words: make([]atomic.Uint64, (m+15)/16),
+		m:     m,
+		k:     min(max(k, 1), 16),
+	}
+}
+
+// each calls fn with the word and shift of each counter of key
+func (f *bloomFilter) each(key string, fn func(w *atomic.Uint64, shift uint) bool) {
+	h := xxhash.Sum64String(key)
+	a, b := h&math.MaxUint32, h>>32
+	for i := range f.k {
+		j := (a + i*b) % f.m
+		if !fn(&f.words[j/16], uint(j%16)*4) {
+			return
+		}
+	}
+}
+
+// mayHold reports whether key may be stored, false if it certainly isn't
+func (f *bloomFilter) mayHold(key string) bool {
+	held := true
+	f.each(key, func(w *atomic.Uint64, shift uint) bool {
+		held = w.Load()>>shift&15 != 0
+		return held
+	})
+	return held
+}
+
+// add counts key in
+func (f *bloomFilter) add(key string) {
+	f.each(key, func(w *atomic.Uint64, shift uint) bool {
+		for {
+			old := w.Load()
+			if old>>shift&15 == 15 || w.CompareAndSwap(old, old+1<<shift) {
+				return true
+			}
+		}
+	})
+}
+
+// remove counts key out
+func (f *bloomFilter) remove(key string) {
+	f.each(key, func(w *atomic.Uint64, shift uint) bool {
+		for {
+			old := w.Load()
+			if n := old >> shift & 15; n == 0 || n == 15 || w.CompareAndSwap(old, old-1<<shift) {
+				return true
+			}
+		}
+	})
+}
+
+// clear zeroes every counter, the caller holds every key's lock
+func (f *bloomFilter) clear() {
+	for i := range f.words {
+		f.words[i].Store(0)
+	}
+}
+
+// filtered reports whether the filter rules key out, so a read can miss
+// without looking it up
+func (c *Cache) filtered(key string) bool {
+	if c.filter == nil || c.filter.mayHold(key) {
+		return false
+	}
+	c.filter.skips.Add(1)
+	return true
+}
+
+// passedFilter counts a lookup the filter let through, a miss being one of
+// its false positives. Only reads asking filtered first report it.
+func (c *Cache) passedFilter(has bool) {
+	if !has && c.filter != nil {
+		c.filter.falsePositives.Add(1)
+	}
+}
+
+// stored reports whether fastcache holds skey, in either store
+func (c *Cache) stored(skey []byte) bool {
+	return c.fc().Has(skey) || c.big != nil && c.big.Has(skey)
+}
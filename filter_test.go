@@ -0,0 +1,182 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestBloomFilter 测试 counting bloom filter 的误判率和计数
+func TestBloomFilter(t *testing.T) {
+	f := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !f.mayHold(fmt.Sprintf("key-%d", i)) {
+			t.Fatalf("key-%d added but not held", i)
+		}
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if f.mayHold(fmt.Sprintf("other-%d", i)) {
+			fp++
+		}
+	}
+	if fp > 200 {
+		t.Errorf("false positives = %d in 10000, want about 100", fp)
+	}
+
+	// 重复加入需要同样多次移除
+	g := newBloomFilter(100, 0.01)
+	g.add("key")
+	g.add("key")
+	g.remove("key")
+	if !g.mayHold("key") {
+		t.Error("key added twice and removed once should be held")
+	}
+	g.remove("key")
+	g.remove("key") // 计数不会小于 0
+	if g.mayHold("key") {
+		t.Error("key removed should not be held")
+	}
+	g.add("key")
+	if !g.mayHold("key") {
+		t.Error("key added again should be held")
+	}
+}
+
+// TestNegativeLookupFilter 测试从未写入的 key 不经 fastcache 直接未命中
+func TestNegativeLookupFilter(t *testing.T) {
+	cache := NewCache(1024*1024, WithNegativeLookupFilter(1000, 0.01))
+	defer cache.Close()
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		cache.Set(keys[i], []byte("value"))
+	}
+	// 写入的 key 都能读到
+	for _, key := range keys {
+		if !cache.Has(key) || cache.Get(key) == nil {
+			t.Fatalf("%s not found", key)
+		}
+	}
+	if got := cache.MGet(keys); got[99] == nil {
+		t.Error("MGet missed a stored key")
+	}
+	if got := cache.Stats(); got.FilterSkips != 0 || got.FilterFalsePositives != 0 {
+		t.Errorf("Stats after reading stored keys = %+v, want no filter counts", got)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if cache.Get(fmt.Sprintf("missing-%d", i)) != nil {
+			t.Fatal("Get of a missing key should miss")
+		}
+	}
+	s := cache.Stats()
+	if s.FilterSkips+s.FilterFalsePositives != 1000 || s.FilterSkips < 950 {
+		t.Errorf("FilterSkips = %d, FilterFalsePositives = %d, want about 990 and 10", s.FilterSkips, s.FilterFalsePositives)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Get("missing-0")
+	})
+	if allocs != 0 {
+		t.Errorf("filtered Get allocs = %v, want 0", allocs)
+	}
+
+	// 覆盖写不会重复计数，删除后 key 离开 filter
+	cache.Set("key-0", []byte("other"))
+	cache.Delete("key-0")
+	cache.ResetStats()
+	if cache.Has("key-0") || cache.Stats().FilterSkips != 1 {
+		t.Errorf("Has of a deleted key: FilterSkips = %d, want 1", cache.Stats().FilterSkips)
+	}
+	cache.Set("key-0", []byte("value"))
+	if !cache.Has("key-0") {
+		t.Error("key-0 written again should be found")
+	}
+
+	if err := cache.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Has("key-1") || cache.Stats().FilterSkips != 1 {
+		t.Errorf("Has after Reset: FilterSkips = %d, want 1", cache.Stats().FilterSkips)
+	}
+
+	if _, err := NewCacheE(1024*1024, WithNegativeLookupFilter(1000, 1)); !errors.Is(err, ErrInvalidFilterRate) {
+		t.Errorf("NewCacheE with a rate of 1 = %v, want ErrInvalidFilterRate", err)
+	}
+}
+
+// TestNegativeLookupFilter_TTL 测试 TTL 缓存清理过期 entry 后 key 离开 filter
+func TestNegativeLookupFilter_TTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithNegativeLookupFilter(1000, 0.01), WithBigValues())
+	defer cache.Close()
+
+	cache.Set("short", []byte("value"), time.Second)
+	cache.Set("big", make([]byte, 100*1024), time.Minute)
+	if !cache.Has("big") || cache.HasMulti([]string{"short"})[0] != true {
+		t.Fatal("stored keys should be found")
+	}
+	clock.Advance(2 * time.Second)
+	if cache.Has("short") {
+		t.Error("short should have expired")
+	}
+	// 过期 entry 被删除后直接由 filter 判定未命中
+	cache.ResetStats()
+	if _, ok := cache.GetInto(nil, "short"); ok || cache.Stats().FilterSkips != 1 {
+		t.Errorf("GetInto of a purged key: FilterSkips = %d, want 1", cache.Stats().FilterSkips)
+	}
+	if l, ok := cache.GetLease("missing"); ok || l != nil || cache.Stats().FilterSkips != 2 {
+		t.Errorf("GetLease of a missing key: FilterSkips = %d, want 2", cache.Stats().FilterSkips)
+	}
+}
+
+// TestNegativeLookupFilter_Writes 测试写入新 key 时的查找不计为 filter 的误判
+func TestNegativeLookupFilter_Writes(t *testing.T) {
+	cache := NewCache(1024*1024, WithNegativeLookupFilter(1000, 0.01))
+	defer cache.Close()
+	cache.Incr("counter", 1)
+	cache.IncrFloat("float", 1)
+	cache.Append("appended", []byte("value"))
+	cache.SetNX("nx", []byte("value"))
+	if got := cache.Stats().FilterFalsePositives; got != 0 {
+		t.Errorf("FilterFalsePositives after writing new keys = %d, want 0", got)
+	}
+
+	ttl := NewCacheWithTTL(1024*1024, WithNegativeLookupFilter(1000, 0.01))
+	defer ttl.Close()
+	ttl.Incr("counter", 1, time.Minute)
+	ttl.SetNX("nx", []byte("value"), time.Minute)
+	if got := ttl.Stats().FilterFalsePositives; got != 0 {
+		t.Errorf("TTL FilterFalsePositives after writing new keys = %d, want 0", got)
+	}
+}
+
+// BenchmarkCache_GetMissing 基准测试读取不存在的 key，开启 filter 前后
+func BenchmarkCache_GetMissing(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"filter", []Option{WithNegativeLookupFilter(100000, 0.01)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCache(100*1024*1024, bc.opts...)
+			defer cache.Close()
+			for i := 0; i < 10000; i++ {
+				cache.Set(fmt.Sprintf("key-%d", i), []byte("value"))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Get("missing-key")
+			}
+		})
+	}
+}
@@ -1,70 +1,806 @@
 package gcache
 
 import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 
 	"github.com/VictoriaMetrics/fastcache"
 )
 
 type Cache struct {
-	pool  *sync.Pool
-	cache *fastcache.Cache
+	pool *bufPool
+	// cache is swapped by CacheWithTTL.Compact, it is allocated on its own
+	// so the leak cleanup can hold it without holding the Cache
+	cache    *atomic.Pointer[fastcache.Cache]
+	big      *fastcache.Cache // values past maxKeyValueSize, nil without WithBigValues
+	maxBytes int
+	// keys longer than this are stored under their hash, 0 without WithKeyHashing
+	hashKeysOver int
+	checksum     bool            // values carry a CRC32C, see WithChecksum
+	corruptReads atomic.Int64    // reads that failed their checksum, see Stats
+	leaseDebug   bool            // leases are tracked, see WithLeaseDebug
+	setDedup     bool            // Set skips values already stored, see WithSetDedup
+	skipped      atomic.Int64    // writes skipped by WithSetDedup, see Stats
+	hot          *hotKeys        // nil without WithHotKeyTracking
+	filter       *bloomFilter    // nil without WithNegativeLookupFilter
+	counts       counters        // see Stats and TTLStats
+	metrics      MetricsRecorder // nil without WithMetricsRecorder
+	locks        keyLocks
+	reads        sync.RWMutex // held shared by reads, see enter
+	closed       atomic.Bool
+	cleanup      runtime.Cleanup
 }
 
-func newSyncPool() *sync.Pool {
-	return &sync.Pool{ // support memory 0 alloc
-		New: func() any {
-			b := make([]byte, 0, 1024)
-			return &b
-		},
+// fastcache spreads its capacity over buckets of whole chunks, so it rounds
+// maxBytes up to a multiple of fcBuckets*fcChunkSize, 32MB
+const (
+	fcBuckets        = 512
+	fcChunkSize      = 64 * 1024
+	fcMaxBucketBytes = 1 << 40
+)
+
+// checkMaxBytes returns ErrInvalidMaxBytes for a size fastcache would panic on
+func checkMaxBytes(maxBytes int) error {
+	if maxBytes <= 0 {
+		return fmt.Errorf("%w: %d is not positive", ErrInvalidMaxBytes, maxBytes)
+	}
+	if bucket := (uint64(maxBytes) + fcBuckets - 1) / fcBuckets; bucket >= fcMaxBucketBytes {
+		return fmt.Errorf("%w: %d exceeds the limit of %d", ErrInvalidMaxBytes, maxBytes, uint64(fcBuckets)*(fcMaxBucketBytes-1))
+	}
+	return nil
+}
+
+// effectiveMaxBytes returns the capacity fastcache allocates for maxBytes
+func effectiveMaxBytes(maxBytes int) int {
+	bucket := (maxBytes + fcBuckets - 1) / fcBuckets
+	return fcBuckets * ((bucket + fcChunkSize - 1) / fcChunkSize) * fcChunkSize
+}
+
+// NewCache based on fastcache, support small object < 64KB, see WithBigValues for larger ones.
+// It panics where NewCacheE fails.
+func NewCache(maxBytes int, opts ...Option) ICache {
+	c, err := NewCacheE(maxBytes, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewCacheE is NewCache returning an error, ErrInvalidMaxBytes, if fastcache
+// can't allocate maxBytes. fastcache rounds the capacity up to a multiple of
+// 32MB, see EffectiveMaxBytes.
+func NewCacheE(maxBytes int, opts ...Option) (ICache, error) {
+	if err := checkMaxBytes(maxBytes); err != nil {
+		return nil, err
 	}
+	o := newOptions(opts)
+	if err := o.checkCache(); err != nil {
+		return nil, err
+	}
+	return newCache(maxBytes, o), nil
+}
+
+func newCache(maxBytes int, o *options) *Cache {
+	c := &Cache{
+		pool:         newBufPool(cmp.Or(o.poolBufferSize, bufClasses[0]), o.maxPooledBuffer, o.poolBypass),
+		cache:        new(atomic.Pointer[fastcache.Cache]),
+		maxBytes:     maxBytes,
+		hashKeysOver: max(o.keyHashing, 0),
+		checksum:     o.checksum,
+		leaseDebug:   o.leaseDebug,
+		setDedup:     o.setDedup,
+		counts:       newCounters(),
+		metrics:      o.metrics,
+	}
+	c.cache.Store(fastcache.New(maxBytes))
+	if o.bigValues {
+		c.big = fastcache.New(maxBytes)
+	}
+	if o.filterKeys > 0 {
+		c.filter = newBloomFilter(o.filterKeys, o.filterRate)
+	}
+	if o.hotKeys > 0 {
+		c.hot = newHotKeys(o.hotKeys, o.hotKeyWindow, cmp.Or[Clock](o.clock, procClock))
+	}
+	if o.finalizerSafety {
+		registerLeakCleanup(c)
+	}
+	return c
 }
 
-// NewCache based on fastcache, support small object < 64KB
-func NewCache(maxBytes int) ICache {
-	return &Cache{
-		pool:  newSyncPool(),
-		cache: fastcache.New(maxBytes),
+// EffectiveMaxBytes returns the memory the cache allocates, maxBytes as
+// rounded up by fastcache, twice that with WithBigValues.
+func (c *Cache) EffectiveMaxBytes() int {
+	n := effectiveMaxBytes(c.maxBytes)
+	if c.big != nil {
+		n *= 2
 	}
+	return n
+}
+
+// fc returns the current fastcache instance
+func (c *Cache) fc() *fastcache.Cache {
+	return c.cache.Load()
 }
 
 func (c *Cache) Has(key string) bool {
-	return c.cache.Has([]byte(key))
+	if !c.enter() {
+		return false
+	}
+	defer c.leave()
+	return c.has(key)
+}
+
+// HasMulti reports the presence of each key, in input order.
+func (c *Cache) HasMulti(keys []string) []bool {
+	res := make([]bool, len(keys))
+	if !c.enter() {
+		return res
+	}
+	defer c.leave()
+	for i, key := range keys {
+		res[i] = c.has(key)
+	}
+	return res
 }
 
 func (c *Cache) Get(key string) []byte {
-	bkey := []byte(key)
+	out, _ := c.GetOK(key)
+	return out
+}
 
-	// get buffer from pool
-	buf := c.pool.Get().(*[]byte)
-	dst := (*buf)[:0]
-	has := true
+// GetInto appends the value of key to dst and returns the extended slice,
+// fastcache style, so callers reusing a buffer large enough read without
+// allocating. On a miss dst is returned as is. A nil dst is fine: the result
+// is then a fresh copy like Get returns, nil for an empty value.
+func (c *Cache) GetInto(dst []byte, key string) ([]byte, bool) {
+	start := c.observeStart()
+	if !c.enter() {
+		return dst, false
+	}
+	c.sample(key)
+	has := false
+	if !c.filtered(key) {
+		dst, has = c.hasGet(dst, key)
+		c.passedFilter(has)
+	}
+	c.leave()
+	c.countGet(has)
+	c.observeGet(start, has)
+	return dst, has
+}
+
+// GetFn calls fn with the value of key straight from the pooled read buffer,
+// without the copy Get makes, and reports whether key was found along with
+// fn's error. fn isn't called for a missing key.
+//
+// value is only valid during the call: fn must not retain it or any slice of
+// it, nor modify it, as the buffer is reused by other reads once fn returns.
+// Copy what has to outlive the call. fn runs while the read is in progress and
+// must not call the cache, which Close and Reset wait for.
+func (c *Cache) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	start := c.observeStart()
+	c.sample(key)
+	var err error
+	found := c.view(key, func(data []byte) {
+		err = fn(data)
+	})
+	c.countGet(found)
+	c.observeGet(start, found)
+	return found, err
+}
+
+// Peek returns a copy of the value of key like Get, but is meant for inspection:
+// it reads straight from the store and never has side effects on the entry.
+func (c *Cache) Peek(key string) []byte {
+	var res []byte
+	c.view(key, func(data []byte) {
+		res = append([]byte{}, data...)
+	})
+	return res
+}
+
+// GetOrDefault returns a copy of the value of key, or def itself if key is missing.
+// A stored empty value is returned as is, not replaced by def.
+func (c *Cache) GetOrDefault(key string, def []byte) []byte {
+	if value, ok := c.GetOK(key); ok {
+		return value
+	}
+	return def
+}
+
+// GetOK is Get that also reports whether the key was found,
+// so a stored empty value can be told apart from a missing key.
+func (c *Cache) GetOK(key string) ([]byte, bool) {
+	start := c.observeStart()
+	value, ok := c.getOK(key)
+	c.countGet(ok)
+	c.observeGet(start, ok)
+	return value, ok
+}
 
-	dst, has = c.cache.HasGet(dst, bkey)
+// getOK is GetOK without counting towards the stats, for the operations
+// reading a value on their way
+func (c *Cache) getOK(key string) ([]byte, bool) {
+	if !c.enter() {
+		return nil, false
+	}
+	defer c.leave()
+	c.sample(key)
+	if c.filtered(key) {
+		return nil, false
+	}
+	// get buffer from pool
+	buf := c.pool.get()
+	dst, has := c.load(buf, key)
+	c.passedFilter(has)
 	if !has || dst == nil {
-		c.pool.Put(buf)
-		return nil
+		c.pool.put(buf)
+		return nil, false
+	}
+	// a value too large to pool is handed over rather than copied,
+	// unless it would pin a buffer much larger than itself
+	if c.pool.take(buf) {
+		if cap(dst) > 2*len(dst) {
+			dst = bytes.Clone(dst)
+		}
+		return dst[:len(dst):len(dst)], true
 	}
 
 	// copy to new output buffer
 	out := make([]byte, len(dst))
 	copy(out, dst)
 
-	c.pool.Put(buf)
-	return out
+	c.pool.put(buf)
+	return out, true
 }
 
+// MGet returns the values of keys by position, nil for missing keys.
+func (c *Cache) MGet(keys []string) [][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+	values, _ := c.mget(keys, nil)
+	return values
+}
+
+// MGetMap returns the values of the keys found and the missing keys,
+// in input order without duplicates.
+func (c *Cache) MGetMap(keys []string) (map[string][]byte, []string) {
+	values, found := c.mget(keys, nil)
+	return splitHits(keys, values, found)
+}
+
+// splitHits sorts the results of mget into hits by key and deduplicated misses
+func splitHits(keys []string, values [][]byte, found []bool) (map[string][]byte, []string) {
+	hits := make(map[string][]byte, len(keys))
+	var misses []string
+	var seen map[string]struct{}
+	for i, key := range keys {
+		if found[i] {
+			hits[key] = values[i]
+			continue
+		}
+		if seen == nil {
+			seen = make(map[string]struct{})
+		}
+		if _, dup := seen[key]; !dup {
+			seen[key] = struct{}{}
+			misses = append(misses, key)
+		}
+	}
+	return hits, misses
+}
+
+// mget looks all keys up through one pooled scratch buffer and copies the hits
+// into a single allocation, found reports which keys hit. unwrap, if set, trims
+// each hit in place or drops it, a nil value it returns stays nil.
+func (c *Cache) mget(keys []string, unwrap func(data []byte) ([]byte, bool)) (res [][]byte, found []bool) {
+	start := c.observeStart()
+	res = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	if !c.enter() {
+		return res, found
+	}
+
+	buf := c.pool.getBatch(len(keys))
+	scratch := buf.b[:0]
+	size := 0
+	for i, key := range keys {
+		c.sample(key)
+		if c.filtered(key) {
+			c.countGet(false)
+			continue
+		}
+		start := len(scratch)
+		var has bool
+		scratch, has = c.hasGet(scratch, key)
+		c.passedFilter(has)
+		if !has {
+			c.countGet(false)
+			continue
+		}
+
+		// when scratch grows, earlier hits keep pointing into the old
+		// backing array, which is never written again
+		value := scratch[start:]
+		if unwrap != nil {
+			if value, has = unwrap(value); !has {
+				scratch = scratch[:start]
+				c.countGet(false)
+				continue
+			}
+		}
+		c.countGet(true)
+		res[i], found[i] = value, true
+		size += len(value)
+	}
+	c.leave()
+
+	arena := make([]byte, size)
+	off := 0
+	for i, value := range res {
+		if value == nil {
+			continue
+		}
+		n := copy(arena[off:], value)
+		res[i] = arena[off : off+n : off+n]
+		off += n
+	}
+
+	// keep the grown scratch, a batch is likely to need as much next time
+	buf.b = scratch[:0]
+	c.pool.put(buf)
+	c.observeGets(start, found)
+	return res, found
+}
+
+// GetRange returns a copy of length bytes of the value of key starting at offset,
+// only the window is allocated. A negative length reads to the end, a window
+// running past the end is cut short. It returns nil if key is missing or offset
+// is out of range.
+func (c *Cache) GetRange(key string, offset, length int) []byte {
+	var res []byte
+	c.view(key, func(data []byte) {
+		res = copyRange(data, offset, length)
+	})
+	return res
+}
+
+// copyRange copies the window of data described as in GetRange
+func copyRange(data []byte, offset, length int) []byte {
+	if offset < 0 || offset > len(data) {
+		return nil
+	}
+	data = data[offset:]
+	if length >= 0 && length < len(data) {
+		data = data[:length]
+	}
+	return append([]byte{}, data...)
+}
+
+// view calls fn with the stored value while it still sits in the pooled buffer,
+// fn must not retain data. It reports whether the key was found.
+func (c *Cache) view(key string, fn func(data []byte)) bool {
+	if !c.enter() {
+		return false
+	}
+	defer c.leave()
+	if c.filtered(key) {
+		return false
+	}
+	buf := c.pool.get()
+	dst, has := c.load(buf, key)
+	c.passedFilter(has)
+	if has {
+		fn(dst)
+	}
+	c.pool.put(buf)
+	return has
+}
+
+// Set stores value for key. It fails with ErrValueTooLarge if key and value
+// exceed fastcache's per-entry limit, instead of fastcache dropping the entry,
+// unless the cache stores big values, see WithBigValues.
 func (c *Cache) Set(key string, value []byte) error {
-	c.cache.Set([]byte(key), value)
+	c.counts.add(countSets)
+	defer c.observeSet(c.observeStart(), len(value))
+	if err := c.checkSize(key, len(value)); err != nil {
+		return err
+	}
+	if c.setDedup && c.unchanged(key, value) {
+		c.skipped.Add(1)
+		return nil
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	c.put(key, value)
+	mu.Unlock()
 	return nil
 }
 
+// GetOrSet returns the existing value of key, or stores value and returns it.
+// stored reports whether value was written.
+func (c *Cache) GetOrSet(key string, value []byte) (actual []byte, stored bool, err error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return nil, false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer mu.Unlock()
+
+	if old, ok := c.getOK(key); ok {
+		return old, false, nil
+	}
+	c.put(key, value)
+	return value, true, nil
+}
+
+// MSet writes every entry, continuing past failures, which are returned as a *BatchError.
+func (c *Cache) MSet(entries map[string][]byte) error {
+	var errs BatchError
+	for key, value := range entries {
+		errs.add(key, c.Set(key, value))
+	}
+	sort.Slice(errs.Errors, func(i, j int) bool {
+		return errs.Errors[i].Key < errs.Errors[j].Key
+	})
+	return errs.err()
+}
+
+// SetNX stores value only if key doesn't exist and reports whether it did.
+func (c *Cache) SetNX(key string, value []byte) (bool, error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if c.has(key) {
+		return false, nil
+	}
+	c.put(key, value)
+	return true, nil
+}
+
+// SetXX stores value only if key already exists and reports whether it did.
+func (c *Cache) SetXX(key string, value []byte) (bool, error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.has(key) {
+		return false, nil
+	}
+	c.put(key, value)
+	return true, nil
+}
+
+// SetReplaced stores value and reports whether it replaced an existing entry.
+func (c *Cache) SetReplaced(key string, value []byte) (bool, error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	replaced := c.has(key)
+	c.put(key, value)
+	return replaced, nil
+}
+
+// Swap stores value and returns a copy of the previous value, existed
+// reports whether there was one.
+func (c *Cache) Swap(key string, value []byte) (old []byte, existed bool, err error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return nil, false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer mu.Unlock()
+
+	old, existed = c.getOK(key)
+	c.put(key, value)
+	return old, existed, nil
+}
+
+// CompareAndSwap stores value only if key currently holds exactly expected,
+// a nil expected matching a missing key, and reports whether it did.
+func (c *Cache) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	if err := c.checkSize(key, len(value)); err != nil {
+		return false, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.holds(key, expected) {
+		return false, nil
+	}
+	c.put(key, value)
+	return true, nil
+}
+
+// CompareAndDelete deletes key only if it currently holds exactly expected
+// and reports whether it did. A missing key never matches, a nil expected
+// matches an empty value.
+func (c *Cache) CompareAndDelete(key string, expected []byte) (bool, error) {
+	if expected == nil {
+		expected = []byte{}
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.holds(key, expected) {
+		return false, nil
+	}
+	c.del(key)
+	return true, nil
+}
+
+// holds reports whether key's value equals expected, nil expected meaning missing
+func (c *Cache) holds(key string, expected []byte) bool {
+	matched := expected == nil
+	c.view(key, func(data []byte) {
+		matched = expected != nil && bytes.Equal(data, expected)
+	})
+	return matched
+}
+
+// Append appends data to the value of key, creating it if missing.
+// It fails with ErrValueTooLarge rather than truncating.
+func (c *Cache) Append(key string, data []byte) error {
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+
+	buf := c.pool.get()
+	defer c.pool.put(buf)
+
+	value, _ := c.load(buf, key)
+	if err := c.checkSize(key, len(value)+len(data)); err != nil {
+		return err
+	}
+	c.put(key, append(value, data...))
+	return nil
+}
+
+// Incr adds delta to the int64 counter at key and returns the new value,
+// a missing key counts from zero. It fails with EncodingError if key holds
+// anything but a counter.
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
+
+	var buf [counterSize]byte
+	value, has := c.hasGet(buf[:0], key)
+	var n int64
+	if has {
+		var err error
+		if n, err = decodeCounter(key, value); err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+	putCounter(buf[:], n)
+	c.put(key, buf[:])
+	return n, nil
+}
+
+// Decr subtracts delta from the int64 counter at key, see Incr.
+func (c *Cache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+// IncrFloat adds delta to the float64 counter at key and returns the new value,
+// a missing key counts from zero. It fails with EncodingError if key holds
+// anything but a float64 counter, and with ErrInvalidFloat if delta or the
+// result is NaN or infinite.
+func (c *Cache) IncrFloat(key string, delta float64) (float64, error) {
+	if err := checkFloat(delta); err != nil {
+		return 0, err
+	}
+
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
+
+	var buf [floatCounterSize]byte
+	value, has := c.hasGet(buf[:0], key)
+	var f float64
+	if has {
+		var err error
+		if f, err = decodeFloatCounter(key, value); err != nil {
+			return 0, err
+		}
+	}
+	f += delta
+	if err := checkFloat(f); err != nil {
+		return 0, err
+	}
+	putFloatCounter(buf[:], f)
+	c.put(key, buf[:])
+	return f, nil
+}
+
 func (c *Cache) Delete(key string) error {
-	c.cache.Del([]byte(key))
+	c.counts.add(countDels)
+	defer c.observeDelete(c.observeStart())
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	c.del(key)
+	mu.Unlock()
 	return nil
 }
 
+// GetAndDelete returns the value of key and deletes it in one step,
+// so only one caller can observe a given value.
+func (c *Cache) GetAndDelete(key string) []byte {
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return nil
+	}
+	defer mu.Unlock()
+
+	value, ok := c.getOK(key)
+	if ok {
+		c.del(key)
+	}
+	return value
+}
+
+// MDelete deletes keys and returns how many of them existed.
+func (c *Cache) MDelete(keys ...string) (int, error) {
+	n := 0
+	for _, key := range keys {
+		c.counts.add(countDels)
+		start := c.observeStart()
+		mu, err := c.lockOpen(key)
+		if err != nil {
+			c.observeDelete(start)
+			return n, err
+		}
+		if c.has(key) {
+			c.del(key)
+			n++
+		}
+		mu.Unlock()
+		c.observeDelete(start)
+	}
+	return n, nil
+}
+
+// Reset removes every entry and zeroes the stats, leaving the cache usable. It
+// waits for the reads and writes in progress, later reads miss until keys are
+// written again. It fails with ErrClosed on a closed cache.
+func (c *Cache) Reset() error {
+	return c.reset(nil)
+}
+
+// reset clears the stores and the stats, calling also, if set, while reads
+// and writes are held off
+func (c *Cache) reset(also func()) error {
+	c.locks.lockAll()
+	defer c.locks.unlockAll()
+	c.reads.Lock()
+	defer c.reads.Unlock()
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.fc().Reset()
+	if c.big != nil {
+		c.big.Reset()
+	}
+	if c.filter != nil {
+		c.filter.clear()
+	}
+	c.ResetStats()
+	if also != nil {
+		also()
+	}
+	return nil
+}
+
+// Close releases the cache's memory for good: afterwards reads miss and writes
+// fail with ErrClosed. It waits for the reads and writes in progress, and is a
+// no-op on a closed cache.
 func (c *Cache) Close() error {
-	c.cache.Reset()
+	if c.closed.Load() {
+		return nil
+	}
+	c.locks.lockAll()
+	defer c.locks.unlockAll()
+	c.reads.Lock()
+	defer c.reads.Unlock()
+	if c.closed.Load() {
+		return nil
+	}
+	c.closed.Store(true)
+	c.cleanup.Stop()
+	c.fc().Reset()
+	if c.big != nil {
+		c.big.Reset()
+	}
 	return nil
 }
+
+// lockOpen locks the stripe of key for a write, failing with ErrClosed once
+// the cache is closed. Close marks the cache closed holding every stripe,
+// so no write can land after it.
+func (c *Cache) lockOpen(key string) (*sync.Mutex, error) {
+	mu := c.locks.lock(key)
+	if c.closed.Load() {
+		mu.Unlock()
+		return nil, ErrClosed
+	}
+	return mu, nil
+}
+
+// enter starts a read, false once the cache is closed, otherwise the caller
+// calls leave when done with the stores. Close and Compact take reads
+// exclusively to wait for the reads in progress before releasing memory they
+// may be copying from. A read must not enter again or lock a stripe before
+// leaving: Close waits for it holding every stripe.
+func (c *Cache) enter() bool {
+	c.reads.RLock()
+	if c.closed.Load() {
+		c.reads.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (c *Cache) leave() {
+	c.reads.RUnlock()
+}
+
+// keyBytes views key as a byte slice without copying, only for
+// fastcache calls that don't retain or modify the key.
+func keyBytes(key string) []byte {
+	return unsafe.Slice(unsafe.StringData(key), len(key))
+}
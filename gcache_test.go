@@ -2,113 +2,1109 @@ package gcache
 
 import (
 	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/fastcache"
 )
 
-// TestNewCache 测试创建缓存
-func TestNewCache(t *testing.T) {
-	cache := NewCache(1024 * 1024) // 1MB
-	if cache == nil {
-		t.Fatal("NewCache returned nil")
+// TestNewCache 测试创建缓存
+func TestNewCache(t *testing.T) {
+	cache := NewCache(1024 * 1024) // 1MB
+	if cache == nil {
+		t.Fatal("NewCache returned nil")
+	}
+	defer cache.Close()
+}
+
+// TestNewCacheE 测试非法容量返回错误，以及 fastcache 向上取整后的实际容量
+func TestNewCacheE(t *testing.T) {
+	for _, maxBytes := range []int{0, -1, math.MaxInt} {
+		if c, err := NewCacheE(maxBytes); !errors.Is(err, ErrInvalidMaxBytes) || c != nil {
+			t.Errorf("NewCacheE(%d) = %v, %v, want nil, %v", maxBytes, c, err, ErrInvalidMaxBytes)
+		}
+	}
+
+	func() {
+		defer func() {
+			if r, _ := recover().(error); !errors.Is(r, ErrInvalidMaxBytes) {
+				t.Errorf("NewCache(0) panicked with %v, want %v", r, ErrInvalidMaxBytes)
+			}
+		}()
+		NewCache(0)
+	}()
+
+	const mb = 1024 * 1024
+	tests := []struct {
+		maxBytes, want int
+	}{
+		{1, 32 * mb},
+		{1 * mb, 32 * mb},
+		{32 * mb, 32 * mb},
+		{32*mb + 1, 64 * mb},
+		{100 * mb, 128 * mb},
+	}
+	for _, tt := range tests {
+		cache, err := NewCacheE(tt.maxBytes)
+		if err != nil {
+			t.Fatalf("NewCacheE(%d) failed: %v", tt.maxBytes, err)
+		}
+		if got := cache.EffectiveMaxBytes(); got != tt.want {
+			t.Errorf("NewCacheE(%d).EffectiveMaxBytes() = %d, want %d", tt.maxBytes, got, tt.want)
+		}
+		cache.Close()
+	}
+
+	big := NewCache(mb, WithBigValues())
+	defer big.Close()
+	if got := big.EffectiveMaxBytes(); got != 64*mb {
+		t.Errorf("EffectiveMaxBytes with WithBigValues = %d, want %d", got, 64*mb)
+	}
+}
+
+// TestCache_SetAndGet 测试基本的 Set 和 Get 操作
+func TestCache_SetAndGet(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := []byte("test-value")
+
+	// 测试 Set
+	err := cache.Set(key, value)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// 测试 Get
+	got := cache.Get(key)
+	if got == nil {
+		t.Fatal("Get returned nil")
+	}
+
+	if !bytes.Equal(got, value) {
+		t.Errorf("Get returned %v, want %v", got, value)
+	}
+}
+
+// TestCache_GetNonExistent 测试获取不存在的 key
+func TestCache_GetNonExistent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	got := cache.Get("non-existent-key")
+	if got != nil {
+		t.Errorf("Get returned %v, want nil", got)
+	}
+}
+
+// TestCache_GetOK 测试 GetOK 区分不存在和空值
+func TestCache_GetOK(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	got, ok := cache.GetOK("missing")
+	if ok || got != nil {
+		t.Errorf("GetOK(missing) = %v, %v, want nil, false", got, ok)
+	}
+
+	cache.Set("empty", []byte{})
+	got, ok = cache.GetOK("empty")
+	if !ok {
+		t.Error("GetOK(empty) returned false for stored empty value")
+	}
+	if len(got) != 0 {
+		t.Errorf("GetOK(empty) returned %v, want empty", got)
+	}
+
+	value := []byte("test-value")
+	cache.Set("key", value)
+	got, ok = cache.GetOK("key")
+	if !ok || !bytes.Equal(got, value) {
+		t.Errorf("GetOK(key) = %v, %v, want %v, true", got, ok, value)
+	}
+}
+
+// TestCache_MGetMap 测试批量读取返回命中和缺失的 key
+func TestCache_MGetMap(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"))
+	cache.Set("empty", []byte{})
+
+	hits, misses := cache.MGetMap([]string{"x", "a", "empty", "y", "x", "a"})
+	if len(hits) != 2 || !bytes.Equal(hits["a"], []byte("value-a")) {
+		t.Errorf("hits = %q, want a and empty", hits)
+	}
+	// 空值属于命中
+	if v, ok := hits["empty"]; !ok || len(v) != 0 {
+		t.Errorf("hits[empty] = %q, %v, want empty, true", v, ok)
+	}
+	// 缺失的 key 按输入顺序去重
+	if want := []string{"x", "y"}; !slices.Equal(misses, want) {
+		t.Errorf("misses = %q, want %q", misses, want)
+	}
+
+	// 结果和缓存互相独立
+	cache.Set("a", []byte("changed"))
+	if !bytes.Equal(hits["a"], []byte("value-a")) {
+		t.Errorf("hits[a] = %q after Set, want value-a", hits["a"])
+	}
+
+	hits, misses = cache.MGetMap(nil)
+	if len(hits) != 0 || misses != nil {
+		t.Errorf("MGetMap(nil) = %q, %q, want empty", hits, misses)
+	}
+}
+
+// TestCache_Peek 测试 Peek 返回和 Get 相同的副本
+func TestCache_Peek(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	if got := cache.Peek("missing"); got != nil {
+		t.Errorf("Peek(missing) = %q, want nil", got)
+	}
+	cache.Set("empty", []byte{})
+	if got := cache.Peek("empty"); got == nil || len(got) != 0 {
+		t.Errorf("Peek(empty) = %q, want empty", got)
+	}
+
+	cache.Set("key", []byte("value"))
+	got := cache.Peek("key")
+	if !bytes.Equal(got, []byte("value")) {
+		t.Fatalf("Peek = %q, want value", got)
+	}
+	got[0] = 'X'
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("modifying the Peek result changed the cache: %q", got)
+	}
+}
+
+// TestCache_GetOrDefault 测试 key 不存在时返回默认值
+func TestCache_GetOrDefault(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	def := []byte("default")
+	if got := cache.GetOrDefault("missing", def); &got[0] != &def[0] {
+		t.Errorf("GetOrDefault(missing) = %q, want def itself", got)
+	}
+	if cache.Has("missing") {
+		t.Error("GetOrDefault stored the default")
+	}
+	if got := cache.GetOrDefault("missing", nil); got != nil {
+		t.Errorf("GetOrDefault(missing, nil) = %q, want nil", got)
+	}
+
+	// 空值不会被默认值替换
+	cache.Set("empty", []byte{})
+	if got := cache.GetOrDefault("empty", def); got == nil || len(got) != 0 {
+		t.Errorf("GetOrDefault(empty) = %q, want empty", got)
+	}
+
+	cache.Set("key", []byte("value"))
+	if got := cache.GetOrDefault("key", def); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetOrDefault(key) = %q, want value", got)
+	}
+}
+
+// TestCache_MGet 测试批量 Get
+func TestCache_MGet(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"))
+	cache.Set("b", []byte("value-b"))
+	cache.Set("empty", []byte{})
+
+	keys := []string{"a", "missing", "b", "empty", "a"}
+	want := [][]byte{[]byte("value-a"), nil, []byte("value-b"), {}, []byte("value-a")}
+
+	got := cache.MGet(keys)
+	if len(got) != len(want) {
+		t.Fatalf("MGet returned %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if (got[i] == nil) != (want[i] == nil) || !bytes.Equal(got[i], want[i]) {
+			t.Errorf("MGet[%d] (%q) = %v, want %v", i, keys[i], got[i], want[i])
+		}
+	}
+
+	// 结果互相独立，追加写入不会覆盖相邻的结果
+	_ = append(got[0], 'x', 'x', 'x')
+	if !bytes.Equal(got[2], []byte("value-b")) {
+		t.Errorf("append to MGet result clobbered neighbour: %q", got[2])
+	}
+
+	if got := cache.MGet(nil); got != nil {
+		t.Errorf("MGet(nil) = %v, want nil", got)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		_ = cache.MGet([]string{})
+	})
+	if allocs != 0 {
+		t.Errorf("MGet of empty slice allocs = %v, want 0", allocs)
+	}
+
+	// 整批共用一个 pool buffer，只分配结果、found 和存放 value 的 arena
+	keys = benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256))
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		_ = cache.MGet(keys)
+	})
+	if allocs > 3 {
+		t.Errorf("MGet of 100 keys allocs = %v, want at most 3", allocs)
+	}
+}
+
+// TestCache_KeyNoCopy 测试 key 不经复制传给 fastcache：内容相同的另一个字符串仍能读写同一个 entry，且 key 不产生分配
+func TestCache_KeyNoCopy(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+	ttl := NewCacheWithTTL(1024 * 1024)
+	defer ttl.Close()
+
+	key := strings.Repeat("user:42", 2)
+	other := strings.Clone(key)
+	if unsafe.StringData(key) == unsafe.StringData(other) {
+		t.Fatal("keys should not share their bytes")
+	}
+	cache.Set(key, []byte("value"))
+	ttl.Set(key, []byte("value"), time.Minute)
+	if got := cache.Get(other); !bytes.Equal(got, []byte("value")) || !cache.Has(other) {
+		t.Errorf("Get with an equal key = %q, want value", got)
+	}
+	if got := ttl.Get(other); !bytes.Equal(got, []byte("value")) || !ttl.Has(other) {
+		t.Errorf("CacheWithTTL.Get with an equal key = %q, want value", got)
+	}
+
+	// 只有 Get 返回的副本需要分配，CacheWithTTL 的 entry 在 pool 的 buffer 中编码
+	value := []byte("value")
+	for _, tc := range []struct {
+		name string
+		fn   func()
+		want float64
+	}{
+		{"Set", func() { cache.Set(other, value) }, 0},
+		{"Get", func() { cache.Get(other) }, 1},
+		{"Has", func() { cache.Has(other) }, 0},
+		{"Delete", func() { cache.Delete(other) }, 0},
+		{"CacheWithTTL.Set", func() { ttl.Set(other, value, time.Minute) }, 0},
+		{"CacheWithTTL.Get", func() { ttl.Get(other) }, 1},
+		{"CacheWithTTL.Has", func() { ttl.Has(other) }, 0},
+		{"CacheWithTTL.Delete", func() { ttl.Delete(other) }, 0},
+	} {
+		if allocs := testing.AllocsPerRun(100, tc.fn); allocs != tc.want {
+			t.Errorf("%s allocs = %v, want %v", tc.name, allocs, tc.want)
+		}
+	}
+}
+
+// TestCache_GetInto 测试 GetInto 把 value 追加到调用方的缓冲区
+func TestCache_GetInto(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"))
+	if got, ok := cache.GetInto(nil, "key"); !ok || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetInto(nil) = %q, %v, want value, true", got, ok)
+	}
+	got, ok := cache.GetInto([]byte("prefix-"), "key")
+	if !ok || string(got) != "prefix-value" {
+		t.Errorf("GetInto = %q, %v, want prefix-value, true", got, ok)
+	}
+	if got, ok := cache.GetInto([]byte("prefix-"), "missing"); ok || string(got) != "prefix-" {
+		t.Errorf("GetInto(missing) = %q, %v, want prefix- untouched, false", got, ok)
+	}
+
+	// 缓冲区足够大时不分配内存
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = cache.GetInto(buf[:0], "key")
+	})
+	if allocs != 0 {
+		t.Errorf("GetInto allocs = %v, want 0", allocs)
+	}
+}
+
+// TestCache_GetFn 测试 GetFn 直接把缓冲区中的 value 交给回调，并返回回调的错误
+func TestCache_GetFn(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"))
+	var got []byte
+	found, err := cache.GetFn("key", func(value []byte) error {
+		got = append(got, value...)
+		return nil
+	})
+	if !found || err != nil || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetFn = %v, %v with %q, want true, nil with value", found, err, got)
+	}
+
+	errDecode := errors.New("decode failed")
+	if found, err := cache.GetFn("key", func([]byte) error { return errDecode }); !found || err != errDecode {
+		t.Errorf("GetFn = %v, %v, want true, %v", found, err, errDecode)
+	}
+	called := false
+	if found, err := cache.GetFn("missing", func([]byte) error { called = true; return nil }); found || err != nil || called {
+		t.Errorf("GetFn(missing) = %v, %v, called %v, want false, nil, not called", found, err, called)
+	}
+
+	// 命中时不分配内存
+	var sum int
+	sumFn := func(value []byte) error {
+		sum += len(value)
+		return nil
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.GetFn("key", sumFn)
+	})
+	if allocs != 0 {
+		t.Errorf("GetFn allocs = %v, want 0", allocs)
+	}
+}
+
+// TestCache_Has 测试 Has 方法
+func TestCache_Has(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := []byte("test-value")
+
+	// 测试不存在的 key
+	if cache.Has(key) {
+		t.Error("Has returned true for non-existent key")
+	}
+
+	// 设置 key
+	err := cache.Set(key, value)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// 测试存在的 key
+	if !cache.Has(key) {
+		t.Error("Has returned false for existing key")
+	}
+}
+
+// TestCache_HasMulti 测试批量 Has
+func TestCache_HasMulti(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("1"))
+	cache.Set("c", []byte{})
+
+	keys := []string{"a", "b", "c", "a", "d"}
+	want := []bool{true, false, true, true, false}
+
+	got := cache.HasMulti(keys)
+	if len(got) != len(want) {
+		t.Fatalf("HasMulti returned %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("HasMulti[%d] (%q) = %v, want %v", i, keys[i], got[i], want[i])
+		}
+	}
+
+	if got := cache.HasMulti(nil); len(got) != 0 {
+		t.Errorf("HasMulti(nil) returned %v, want empty", got)
+	}
+}
+
+// TestCache_MSet 测试批量 Set
+func TestCache_MSet(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	entries := map[string][]byte{
+		"a":     []byte("value-a"),
+		"b":     []byte("value-b"),
+		"empty": {},
+	}
+	if err := cache.MSet(entries); err != nil {
+		t.Fatalf("MSet failed: %v", err)
+	}
+
+	for key, value := range entries {
+		got, ok := cache.GetOK(key)
+		if !ok || !bytes.Equal(got, value) {
+			t.Errorf("GetOK(%q) = %v, %v, want %v, true", key, got, ok, value)
+		}
+	}
+
+	if err := cache.MSet(nil); err != nil {
+		t.Errorf("MSet(nil) failed: %v", err)
+	}
+}
+
+// TestCache_Delete 测试 Delete 方法
+func TestCache_Delete(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := []byte("test-value")
+
+	// 设置 key
+	err := cache.Set(key, value)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// 验证存在
+	if !cache.Has(key) {
+		t.Error("Key should exist before delete")
+	}
+
+	// 删除 key
+	err = cache.Delete(key)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// 验证已删除
+	if cache.Has(key) {
+		t.Error("Key should not exist after delete")
+	}
+
+	got := cache.Get(key)
+	if got != nil {
+		t.Errorf("Get returned %v after delete, want nil", got)
+	}
+}
+
+// TestCache_MDelete 测试批量删除并返回删除数量
+func TestCache_MDelete(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"))
+	cache.Set("b", []byte("value-b"))
+	cache.Set("empty", []byte{})
+
+	n, err := cache.MDelete("a", "missing", "empty", "a")
+	if err != nil {
+		t.Fatalf("MDelete failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("MDelete returned %d, want 2", n)
+	}
+	if cache.Has("a") || cache.Has("empty") {
+		t.Error("deleted keys still exist")
+	}
+	if !cache.Has("b") {
+		t.Error("untouched key was deleted")
+	}
+
+	n, err = cache.MDelete()
+	if n != 0 || err != nil {
+		t.Errorf("MDelete() = %d, %v, want 0, nil", n, err)
+	}
+}
+
+// TestCache_GetOrSet 测试 GetOrSet
+func TestCache_GetOrSet(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	value := []byte("value-1")
+	got, stored, err := cache.GetOrSet("key", value)
+	if err != nil {
+		t.Fatalf("GetOrSet failed: %v", err)
+	}
+	if !stored || !bytes.Equal(got, value) {
+		t.Errorf("GetOrSet = %q, %v, want %q, true", got, stored, value)
+	}
+
+	// 已存在时返回旧值，不覆盖
+	got, stored, err = cache.GetOrSet("key", []byte("value-2"))
+	if err != nil {
+		t.Fatalf("GetOrSet failed: %v", err)
+	}
+	if stored || !bytes.Equal(got, value) {
+		t.Errorf("GetOrSet = %q, %v, want %q, false", got, stored, value)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, value) {
+		t.Errorf("Get = %q, want %q", got, value)
+	}
+}
+
+// TestCache_GetOrSetConcurrent 测试并发 GetOrSet 只有一次写入
+func TestCache_GetOrSetConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	storedCount := 0
+	results := make([][]byte, numGoroutines)
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			got, stored, err := cache.GetOrSet("key", []byte{byte(id)})
+			if err != nil {
+				t.Errorf("GetOrSet failed: %v", err)
+			}
+			results[id] = got
+			if stored {
+				mu.Lock()
+				storedCount++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if storedCount != 1 {
+		t.Errorf("stored %d times, want 1", storedCount)
+	}
+	final := cache.Get("key")
+	for i, got := range results {
+		if !bytes.Equal(got, final) {
+			t.Errorf("goroutine %d observed %v, want %v", i, got, final)
+		}
+	}
+}
+
+// TestCache_SetNX 测试只在 key 不存在时写入
+func TestCache_SetNX(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	ok, err := cache.SetNX("key", []byte("first"))
+	if err != nil || !ok {
+		t.Fatalf("SetNX = %v, %v, want true, nil", ok, err)
+	}
+	ok, err = cache.SetNX("key", []byte("second"))
+	if err != nil || ok {
+		t.Errorf("SetNX on existing key = %v, %v, want false, nil", ok, err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("first")) {
+		t.Errorf("Get = %q, want first", got)
+	}
+
+	// 删除后可以再次写入
+	cache.Delete("key")
+	if ok, _ := cache.SetNX("key", []byte("third")); !ok {
+		t.Error("SetNX after Delete returned false")
+	}
+}
+
+// TestCache_SetNXConcurrent 测试并发 SetNX 只有一个成功
+func TestCache_SetNXConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			ok, err := cache.SetNX("key", []byte{byte(id)})
+			if err != nil {
+				t.Errorf("SetNX failed: %v", err)
+			}
+			if ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("%d SetNX calls succeeded, want 1", winners)
+	}
+}
+
+// TestCache_SetXX 测试只在 key 存在时写入
+func TestCache_SetXX(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	ok, err := cache.SetXX("key", []byte("first"))
+	if err != nil || ok {
+		t.Fatalf("SetXX on missing key = %v, %v, want false, nil", ok, err)
+	}
+	if cache.Has("key") {
+		t.Error("SetXX stored a missing key")
+	}
+
+	cache.Set("key", []byte("first"))
+	if ok, _ := cache.SetXX("key", []byte("second")); !ok {
+		t.Error("SetXX on existing key returned false")
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("second")) {
+		t.Errorf("Get = %q, want second", got)
+	}
+
+	// 删除后不会被复活
+	cache.Delete("key")
+	if ok, _ := cache.SetXX("key", []byte("third")); ok {
+		t.Error("SetXX resurrected a deleted key")
+	}
+}
+
+// TestCache_SetReplaced 测试区分插入和更新
+func TestCache_SetReplaced(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	if replaced, err := cache.SetReplaced("key", []byte("first")); err != nil || replaced {
+		t.Fatalf("SetReplaced on missing key = %v, %v, want false, nil", replaced, err)
+	}
+	if replaced, err := cache.SetReplaced("key", []byte("second")); err != nil || !replaced {
+		t.Fatalf("SetReplaced on existing key = %v, %v, want true, nil", replaced, err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("second")) {
+		t.Errorf("Get = %q, want second", got)
+	}
+}
+
+// TestCache_GetAndDelete 测试读取并删除
+func TestCache_GetAndDelete(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("token"))
+	if got := cache.GetAndDelete("key"); !bytes.Equal(got, []byte("token")) {
+		t.Errorf("GetAndDelete = %q, want token", got)
+	}
+	if cache.Has("key") {
+		t.Error("key still exists after GetAndDelete")
+	}
+	if got := cache.GetAndDelete("key"); got != nil {
+		t.Errorf("second GetAndDelete = %q, want nil", got)
+	}
+}
+
+// TestCache_GetAndDeleteConcurrent 测试并发 GetAndDelete 只有一个拿到值
+func TestCache_GetAndDeleteConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	for round := 0; round < 10; round++ {
+		cache.Set("token", []byte("secret"))
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		winners := 0
+		wg.Add(numGoroutines)
+		for i := 0; i < numGoroutines; i++ {
+			go func() {
+				defer wg.Done()
+				if cache.GetAndDelete("token") != nil {
+					mu.Lock()
+					winners++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if winners != 1 {
+			t.Fatalf("round %d: %d goroutines got the token, want 1", round, winners)
+		}
+	}
+}
+
+// TestCache_Swap 测试写入新值并返回旧值
+func TestCache_Swap(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	old, existed, err := cache.Swap("key", []byte("v1"))
+	if err != nil || existed || old != nil {
+		t.Fatalf("Swap on missing key = %q, %v, %v, want nil, false, nil", old, existed, err)
+	}
+
+	old, existed, _ = cache.Swap("key", []byte("v2"))
+	if !existed || !bytes.Equal(old, []byte("v1")) {
+		t.Errorf("Swap = %q, %v, want v1, true", old, existed)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("v2")) {
+		t.Errorf("Get = %q, want v2", got)
+	}
+
+	// 返回的旧值是副本，修改不影响缓存
+	old, _, _ = cache.Swap("key", []byte("v3"))
+	old[0] = 'x'
+	if got, _, _ := cache.Swap("key", []byte("v4")); !bytes.Equal(got, []byte("v3")) {
+		t.Errorf("Swap = %q, want v3", got)
+	}
+}
+
+// TestCache_SwapConcurrent 测试并发 Swap 不会有两个调用拿到同一个旧值
+func TestCache_SwapConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	cache.Set("key", []byte("init"))
+
+	var wg sync.WaitGroup
+	olds := make([]string, numGoroutines)
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			old, _, _ := cache.Swap("key", []byte(strconv.Itoa(id)))
+			olds[id] = string(old)
+		}(i)
+	}
+	wg.Wait()
+
+	// 所有旧值加上最终值，恰好是初始值和每个写入值各一次
+	seen := map[string]int{string(cache.Get("key")): 1}
+	for _, old := range olds {
+		seen[old]++
+	}
+	if len(seen) != numGoroutines+1 {
+		t.Errorf("saw %d distinct values, want %d", len(seen), numGoroutines+1)
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Errorf("value %q observed %d times", v, n)
+		}
+	}
+}
+
+// TestCache_CompareAndSwap 测试按值比较后写入
+func TestCache_CompareAndSwap(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	// old 为 nil 时等同于 SetNX
+	ok, err := cache.CompareAndSwap("key", nil, []byte("v1"))
+	if err != nil || !ok {
+		t.Fatalf("CompareAndSwap(nil) on missing key = %v, %v, want true, nil", ok, err)
+	}
+	if ok, _ := cache.CompareAndSwap("key", nil, []byte("v2")); ok {
+		t.Error("CompareAndSwap(nil) on existing key returned true")
+	}
+
+	if ok, _ := cache.CompareAndSwap("key", []byte("wrong"), []byte("v2")); ok {
+		t.Error("CompareAndSwap with mismatched value returned true")
+	}
+	if ok, _ := cache.CompareAndSwap("key", []byte("v1"), []byte("v2")); !ok {
+		t.Error("CompareAndSwap with matching value returned false")
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("v2")) {
+		t.Errorf("Get = %q, want v2", got)
+	}
+
+	// 空值和不存在不相同
+	cache.Set("empty", []byte{})
+	if ok, _ := cache.CompareAndSwap("empty", nil, []byte("x")); ok {
+		t.Error("CompareAndSwap(nil) matched an empty value")
+	}
+	if ok, _ := cache.CompareAndSwap("empty", []byte{}, []byte("x")); !ok {
+		t.Error("CompareAndSwap(empty) did not match an empty value")
+	}
+	if ok, _ := cache.CompareAndSwap("missing", []byte{}, []byte("x")); ok {
+		t.Error("CompareAndSwap(empty) matched a missing key")
+	}
+}
+
+// TestCache_CompareAndSwapConcurrent 测试并发 CAS 自增不丢失更新
+func TestCache_CompareAndSwapConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 20
+	const numIncrements = 50
+	cache.Set("counter", []byte("0"))
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numIncrements; {
+				old := cache.Get("counter")
+				n, _ := strconv.Atoi(string(old))
+				if ok, _ := cache.CompareAndSwap("counter", old, []byte(strconv.Itoa(n+1))); ok {
+					j++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := strconv.Itoa(numGoroutines * numIncrements)
+	if got := cache.Get("counter"); string(got) != want {
+		t.Errorf("counter = %s, want %s", got, want)
+	}
+}
+
+// TestCache_CompareAndDelete 测试按值比较后删除
+func TestCache_CompareAndDelete(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	if ok, _ := cache.CompareAndDelete("missing", []byte("v1")); ok {
+		t.Error("CompareAndDelete on missing key returned true")
+	}
+
+	cache.Set("key", []byte("v1"))
+	if ok, _ := cache.CompareAndDelete("key", []byte("v2")); ok {
+		t.Error("CompareAndDelete with mismatched value returned true")
+	}
+	if !cache.Has("key") {
+		t.Fatal("mismatched CompareAndDelete removed the key")
+	}
+	ok, err := cache.CompareAndDelete("key", []byte("v1"))
+	if err != nil || !ok {
+		t.Errorf("CompareAndDelete = %v, %v, want true, nil", ok, err)
+	}
+	if cache.Has("key") {
+		t.Error("key still exists after CompareAndDelete")
+	}
+
+	// nil 匹配空值
+	cache.Set("empty", []byte{})
+	if ok, _ := cache.CompareAndDelete("empty", nil); !ok {
+		t.Error("CompareAndDelete(nil) did not match an empty value")
+	}
+	if ok, _ := cache.CompareAndDelete("missing", nil); ok {
+		t.Error("CompareAndDelete(nil) matched a missing key")
 	}
-	defer cache.Close()
 }
 
-// TestCache_SetAndGet 测试基本的 Set 和 Get 操作
-func TestCache_SetAndGet(t *testing.T) {
+// TestCache_SetValueTooLarge 测试单条上限的边界：恰好达到上限可存储，超出一个字节返回 ErrValueTooLarge
+func TestCache_SetValueTooLarge(t *testing.T) {
 	cache := NewCache(1024 * 1024)
 	defer cache.Close()
 
-	key := "test-key"
-	value := []byte("test-value")
+	key := "key"
+	fits := make([]byte, maxKeyValueSize-len(key))
+	if err := cache.Set(key, fits); err != nil {
+		t.Fatalf("Set at the limit failed: %v", err)
+	}
+	if got := cache.Get(key); len(got) != len(fits) {
+		t.Fatalf("Get at the limit returned %d bytes, want %d", len(got), len(fits))
+	}
 
-	// 测试 Set
-	err := cache.Set(key, value)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+	err := cache.Set(key, make([]byte, len(fits)+1))
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set past the limit returned %v, want %v", err, ErrValueTooLarge)
+	}
+	if msg := err.Error(); !strings.Contains(msg, strconv.Itoa(maxKeyValueSize+1)) || !strings.Contains(msg, strconv.Itoa(maxKeyValueSize)) {
+		t.Errorf("error %q should tell the size and the limit", msg)
+	}
+	if got := cache.Get(key); len(got) != len(fits) {
+		t.Errorf("Get after failed Set returned %d bytes, want the old %d", len(got), len(fits))
+	}
+	if _, err := cache.SetNX("other", make([]byte, len(fits)+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("SetNX past the limit returned %v, want %v", err, ErrValueTooLarge)
 	}
 
-	// 测试 Get
-	got := cache.Get(key)
-	if got == nil {
-		t.Fatal("Get returned nil")
+	// 确认上限与 fastcache 一致：超出一个字节会被 fastcache 丢弃
+	c := cache.(*Cache)
+	c.fc().Set([]byte("raw"), make([]byte, maxKeyValueSize-len("raw")+1))
+	if c.fc().Has([]byte("raw")) {
+		t.Error("fastcache stored an entry past maxKeyValueSize, the limit is out of date")
 	}
+}
 
-	if !bytes.Equal(got, value) {
-		t.Errorf("Get returned %v, want %v", got, value)
+// TestCache_Append 测试追加写入
+func TestCache_Append(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	// 不存在时创建
+	if err := cache.Append("key", []byte("a")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := cache.Append("key", []byte("bc")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("abc")) {
+		t.Errorf("Get = %q, want abc", got)
+	}
+
+	// 超过单条上限时返回错误，原值不变
+	big := make([]byte, 64*1024)
+	if err := cache.Append("key", big); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Append returned %v, want %v", err, ErrValueTooLarge)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("abc")) {
+		t.Errorf("Get after failed Append = %q, want abc", got)
 	}
 }
 
-// TestCache_GetNonExistent 测试获取不存在的 key
-func TestCache_GetNonExistent(t *testing.T) {
+// TestCache_AppendConcurrent 测试并发追加不会丢失写入
+func TestCache_AppendConcurrent(t *testing.T) {
 	cache := NewCache(1024 * 1024)
 	defer cache.Close()
 
-	got := cache.Get("non-existent-key")
-	if got != nil {
-		t.Errorf("Get returned %v, want nil", got)
+	const numGoroutines = 100
+	const numAppends = 10
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numAppends; j++ {
+				if err := cache.Append("key", []byte("x")); err != nil {
+					t.Errorf("Append failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(cache.Get("key")); got != numGoroutines*numAppends {
+		t.Errorf("value length = %d, want %d", got, numGoroutines*numAppends)
 	}
 }
 
-// TestCache_Has 测试 Has 方法
-func TestCache_Has(t *testing.T) {
+// TestCache_Incr 测试整数计数器
+func TestCache_Incr(t *testing.T) {
 	cache := NewCache(1024 * 1024)
 	defer cache.Close()
 
-	key := "test-key"
-	value := []byte("test-value")
+	// 不存在时从 0 开始
+	if n, err := cache.Incr("counter", 5); err != nil || n != 5 {
+		t.Fatalf("Incr = %d, %v, want 5, nil", n, err)
+	}
+	if n, err := cache.Decr("counter", 7); err != nil || n != -2 {
+		t.Fatalf("Decr = %d, %v, want -2, nil", n, err)
+	}
 
-	// 测试不存在的 key
-	if cache.Has(key) {
-		t.Error("Has returned true for non-existent key")
+	// 非计数器的值返回 EncodingError 且不被修改
+	cache.Set("text", []byte("hello"))
+	var encErr EncodingError
+	if _, err := cache.Incr("text", 1); !errors.As(err, &encErr) {
+		t.Errorf("Incr returned %v, want EncodingError", err)
 	}
+	if got := cache.Get("text"); !bytes.Equal(got, []byte("hello")) {
+		t.Errorf("Get after failed Incr = %q, want hello", got)
+	}
+}
 
-	// 设置 key
-	err := cache.Set(key, value)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+// TestCache_IncrConcurrent 测试并发自增结果正确
+func TestCache_IncrConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	const numIncrs = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numIncrs; j++ {
+				if _, err := cache.Incr("counter", 1); err != nil {
+					t.Errorf("Incr failed: %v", err)
+					return
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
-	// 测试存在的 key
-	if !cache.Has(key) {
-		t.Error("Has returned false for existing key")
+	if n, _ := cache.Incr("counter", 0); n != numGoroutines*numIncrs {
+		t.Errorf("counter = %d, want %d", n, numGoroutines*numIncrs)
 	}
 }
 
-// TestCache_Delete 测试 Delete 方法
-func TestCache_Delete(t *testing.T) {
+// TestCache_IncrFloat 测试浮点计数器
+func TestCache_IncrFloat(t *testing.T) {
 	cache := NewCache(1024 * 1024)
 	defer cache.Close()
 
-	key := "test-key"
-	value := []byte("test-value")
+	if f, err := cache.IncrFloat("sum", 1.5); err != nil || f != 1.5 {
+		t.Fatalf("IncrFloat = %v, %v, want 1.5, nil", f, err)
+	}
+	if f, err := cache.IncrFloat("sum", -0.25); err != nil || f != 1.25 {
+		t.Fatalf("IncrFloat = %v, %v, want 1.25, nil", f, err)
+	}
 
-	// 设置 key
-	err := cache.Set(key, value)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+	// NaN 和 Inf 直接拒绝
+	for _, delta := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := cache.IncrFloat("sum", delta); !errors.Is(err, ErrInvalidFloat) {
+			t.Errorf("IncrFloat(%v) returned %v, want %v", delta, err, ErrInvalidFloat)
+		}
+	}
+	cache.IncrFloat("big", math.MaxFloat64)
+	if _, err := cache.IncrFloat("big", math.MaxFloat64); !errors.Is(err, ErrInvalidFloat) {
+		t.Errorf("overflowing IncrFloat returned %v, want %v", err, ErrInvalidFloat)
 	}
 
-	// 验证存在
-	if !cache.Has(key) {
-		t.Error("Key should exist before delete")
+	// 整数和浮点计数器不能混用
+	var encErr EncodingError
+	if _, err := cache.Incr("sum", 1); !errors.As(err, &encErr) || encErr.Got != "float64" {
+		t.Errorf("Incr on float counter returned %v, want EncodingError from float64", err)
 	}
+	cache.Incr("counter", 1)
+	if _, err := cache.IncrFloat("counter", 1); !errors.As(err, &encErr) || encErr.Got != "int64" {
+		t.Errorf("IncrFloat on int counter returned %v, want EncodingError from int64", err)
+	}
+	if f, _ := cache.IncrFloat("sum", 0); f != 1.25 {
+		t.Errorf("sum = %v after failed operations, want 1.25", f)
+	}
+}
 
-	// 删除 key
-	err = cache.Delete(key)
-	if err != nil {
-		t.Fatalf("Delete failed: %v", err)
+// TestCache_GetRange 测试部分读取
+func TestCache_GetRange(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("0123456789"))
+
+	testCases := []struct {
+		name           string
+		offset, length int
+		want           []byte
+	}{
+		{"window", 2, 3, []byte("234")},
+		{"to end", 7, -1, []byte("789")},
+		{"past end", 8, 100, []byte("89")},
+		{"at end", 10, 5, []byte{}},
+		{"offset out of range", 11, 1, nil},
+		{"negative offset", -1, 1, nil},
 	}
 
-	// 验证已删除
-	if cache.Has(key) {
-		t.Error("Key should not exist after delete")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := cache.GetRange("key", tc.offset, tc.length)
+			if !bytes.Equal(got, tc.want) || (got == nil) != (tc.want == nil) {
+				t.Errorf("GetRange(%d, %d) = %q, want %q", tc.offset, tc.length, got, tc.want)
+			}
+		})
 	}
 
-	got := cache.Get(key)
-	if got != nil {
-		t.Errorf("Get returned %v after delete, want nil", got)
+	if cache.GetRange("missing", 0, -1) != nil {
+		t.Error("GetRange returned value for missing key")
 	}
 }
 
@@ -288,6 +1284,203 @@ func TestCache_Close(t *testing.T) {
 	}
 }
 
+// TestCache_CloseTerminal 测试关闭后读取落空、写入返回 ErrClosed，且可重复关闭
+func TestCache_CloseTerminal(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	cache.Set("key", []byte("value"))
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+
+	if cache.Has("key") || cache.Peek("key") != nil || cache.MGet([]string{"key"})[0] != nil {
+		t.Error("reads after Close should miss")
+	}
+	if err := cache.Set("key", []byte("value")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set after Close = %v, want ErrClosed", err)
+	}
+	if err := cache.Delete("key"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Delete after Close = %v, want ErrClosed", err)
+	}
+	if _, err := cache.Incr("n", 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Incr after Close = %v, want ErrClosed", err)
+	}
+	if cache.Has("key") {
+		t.Error("failed Set should leave nothing behind")
+	}
+}
+
+// TestCache_CloseConcurrent 测试与读写并发关闭，关闭后不会再有写入生效
+func TestCache_CloseConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			key := strconv.Itoa(id)
+			for {
+				if err := cache.Set(key, []byte("value")); err != nil {
+					if !errors.Is(err, ErrClosed) {
+						t.Errorf("Set = %v, want nil or ErrClosed", err)
+					}
+					return
+				}
+				cache.Get(key)
+			}
+		}(i)
+	}
+
+	cache.Close()
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if cache.Has(strconv.Itoa(i)) {
+			t.Errorf("key %d is readable after Close", i)
+		}
+	}
+}
+
+// TestCache_CloseHammer 测试 Close 与并发的读写删除交错时，读到的要么是完整的值要么是 nil
+func TestCache_CloseHammer(t *testing.T) {
+	for round := 0; round < 5; round++ {
+		cache := NewCache(1024 * 1024)
+		// 另一个缓存不停写入，复用 Close 释放的内存
+		other := NewCache(1024 * 1024)
+		value := bytes.Repeat([]byte("v"), 1024)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(3)
+			key := strconv.Itoa(i)
+			go func() {
+				defer wg.Done()
+				for {
+					if err := cache.Set(key, value); errors.Is(err, ErrClosed) {
+						return
+					} else if err != nil {
+						t.Errorf("Set = %v, want nil or ErrClosed", err)
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if got := cache.Get(key); got != nil && !bytes.Equal(got, value) {
+						t.Errorf("Get returned a torn value of %d bytes", len(got))
+						return
+					}
+					for _, got := range cache.MGet([]string{key, "missing"}) {
+						if got != nil && !bytes.Equal(got, value) {
+							t.Errorf("MGet returned a torn value of %d bytes", len(got))
+							return
+						}
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for {
+					if err := cache.Delete(key); errors.Is(err, ErrClosed) {
+						return
+					}
+					other.Set(key, bytes.Repeat([]byte("x"), 1024))
+				}
+			}()
+		}
+
+		time.Sleep(5 * time.Millisecond) // 让读写先跑起来
+		cache.Close()
+		if cache.Get("0") != nil || cache.Has("0") {
+			t.Error("reads after Close should miss")
+		}
+		close(stop)
+		wg.Wait()
+		other.Close()
+	}
+}
+
+// TestCache_Reset 测试 Reset 清空所有 entry 和统计后缓存仍可使用
+func TestCache_Reset(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues(), WithChecksum())
+	c := cache.(*Cache)
+
+	cache.Set("key", []byte("value"))
+	cache.Set("page", randomBytes(200*1024))
+	corrupt(t, c, []byte("key"))
+	cache.Get("key")
+	if err := cache.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	// 先检查 Stats，读取会从 pool 分配 buffer；fastcache 只保留容量
+	want := Stats{Fastcache: fastcache.Stats{MaxBytesSize: uint64(cache.EffectiveMaxBytes())}}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats after Reset = %+v, want zero", got)
+	}
+	if cache.Has("key") || cache.Has("page") || entries(c.fc())+entries(c.big) != 0 {
+		t.Error("entries should be gone after Reset")
+	}
+
+	// Reset 之后仍可读写
+	if err := cache.Set("key", []byte("again")); err != nil {
+		t.Fatalf("Set after Reset failed: %v", err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("again")) {
+		t.Errorf("Get after Reset = %q, want again", got)
+	}
+
+	cache.Close()
+	if err := cache.Reset(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Reset after Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+// TestCache_ResetConcurrent 测试 Reset 与并发读写交错时读到的要么是完整的值要么是 nil
+func TestCache_ResetConcurrent(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+	value := bytes.Repeat([]byte("v"), 1024)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		key := strconv.Itoa(i)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cache.Set(key, value)
+				if got := cache.Get(key); got != nil && !bytes.Equal(got, value) {
+					t.Errorf("Get returned a torn value of %d bytes", len(got))
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := cache.Reset(); err != nil {
+			t.Fatalf("Reset failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
 // TestCache_MultipleKeys 测试多个 key
 func TestCache_MultipleKeys(t *testing.T) {
 	cache := NewCache(10 * 1024 * 1024)
@@ -380,6 +1573,7 @@ func BenchmarkCache_Set(b *testing.B) {
 	key := "bench-key"
 	value := []byte("bench-value")
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		cache.Set(key, value)
@@ -395,12 +1589,63 @@ func BenchmarkCache_Get(b *testing.B) {
 	value := []byte("bench-value")
 	cache.Set(key, value)
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_ = cache.Get(key)
 	}
 }
 
+// BenchmarkCache_GetInto 基准测试复用缓冲区的 GetInto 操作
+func BenchmarkCache_GetInto(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	cache.Set(key, []byte("bench-value"))
+	buf := make([]byte, 0, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = cache.GetInto(buf[:0], key)
+	}
+}
+
+// BenchmarkCache_GetFn 基准测试 GetFn 操作，命中时不复制 value
+func BenchmarkCache_GetFn(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	cache.Set(key, []byte("bench-value"))
+	var n int
+	fn := func(value []byte) error {
+		n += len(value)
+		return nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.GetFn(key, fn)
+	}
+}
+
+// BenchmarkCache_Delete 基准测试 Delete 操作
+func BenchmarkCache_Delete(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Delete(key)
+	}
+}
+
 // BenchmarkCache_Has 基准测试 Has 操作
 func BenchmarkCache_Has(b *testing.B) {
 	cache := NewCache(100 * 1024 * 1024)
@@ -410,6 +1655,7 @@ func BenchmarkCache_Has(b *testing.B) {
 	value := []byte("bench-value")
 	cache.Set(key, value)
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_ = cache.Has(key)
@@ -430,3 +1676,85 @@ func BenchmarkCache_Concurrent(b *testing.B) {
 		}
 	})
 }
+
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "bench-key-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// BenchmarkCache_HasLoop 基准测试循环调用 Has 1k 个 key
+func BenchmarkCache_HasLoop(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(1000)
+	for _, key := range keys[:500] {
+		cache.Set(key, []byte("bench-value"))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := make([]bool, len(keys))
+		for j, key := range keys {
+			res[j] = cache.Has(key)
+		}
+	}
+}
+
+// BenchmarkCache_HasMulti 基准测试 HasMulti 1k 个 key
+func BenchmarkCache_HasMulti(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(1000)
+	for _, key := range keys[:500] {
+		cache.Set(key, []byte("bench-value"))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cache.HasMulti(keys)
+	}
+}
+
+// BenchmarkCache_GetLoop 基准测试循环调用 Get 100 个 key
+func BenchmarkCache_GetLoop(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := make([][]byte, len(keys))
+		for j, key := range keys {
+			res[j] = cache.Get(key)
+		}
+	}
+}
+
+// BenchmarkCache_MGet 基准测试 MGet 100 个 key
+func BenchmarkCache_MGet(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cache.MGet(keys)
+	}
+}
@@ -1,64 +1,1458 @@
 package gcache
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
 	"time"
 )
 
 type CacheWithTTL struct {
-	ICache
+	cache        *Cache
+	rules        atomic.Pointer[ttlRules]
+	defaultTTL   time.Duration // used for a zero ttl if positive
+	jitter       float64
+	clock        Clock
+	strictSoft   bool  // reads stop at the soft TTL
+	compact      bool  // write formatCompact headers
+	precision    int64 // millis written expiries are rounded up to
+	flights      flightGroup
+	lazyPurged   atomic.Int64
+	foreignReads atomic.Int64 // reads that found a value of another writer, see Stats
+	index        *keyIndex    // nil unless something needs to walk the keys
+	sweeper      *sweeper
+	probes       int // keys sampled for expiry by each Set
+	entryFormat      // how entries are read, shared with the sweeper
 }
 
-func NewCacheWithTTL(maxBytes int) ICacheWithTTL {
-	return &CacheWithTTL{
-		ICache: NewCache(maxBytes),
+// NewCacheWithTTL creates a cache whose entries expire, it panics where
+// NewCacheWithTTLE fails.
+func NewCacheWithTTL(maxBytes int, opts ...Option) ICacheWithTTL {
+	c, err := NewCacheWithTTLE(maxBytes, opts...)
+	if err != nil {
+		panic(err)
 	}
+	return c
 }
 
+// NewCacheWithTTLE is NewCacheWithTTL returning an error: ErrInvalidMaxBytes
+// like NewCacheE, or the error of an invalid option.
+func NewCacheWithTTLE(maxBytes int, opts ...Option) (ICacheWithTTL, error) {
+	if err := checkMaxBytes(maxBytes); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	if err := o.checkCache(); err != nil {
+		return nil, err
+	}
+	if o.defaultTTL < 0 {
+		return nil, ErrInvalidDefaultTTL
+	}
+	if !(o.ttlJitter >= 0 && o.ttlJitter < 1) {
+		return nil, ErrInvalidTTLJitter
+	}
+	if o.ttlPrecision == 0 {
+		o.ttlPrecision = time.Millisecond
+	}
+	if o.ttlPrecision != time.Millisecond && o.ttlPrecision != time.Second {
+		return nil, ErrInvalidTTLPrecision
+	}
+	var rules *ttlRules
+	if o.ttlRules != nil {
+		var err error
+		if rules, err = newTTLRules(o.ttlRules); err != nil {
+			return nil, err
+		}
+	}
+	c := &CacheWithTTL{
+		cache:      newCache(maxBytes, o),
+		defaultTTL: o.defaultTTL,
+		jitter:     o.ttlJitter,
+		clock:      o.clock,
+		strictSoft: o.strictSoftTTL,
+		compact:    o.compactTTL,
+		precision:  o.ttlPrecision.Milliseconds(),
+	}
+	c.legacy = o.legacyEntries
+	if c.clock == nil {
+		c.clock = procClock
+	}
+	c.epoch = c.now()
+	c.rules.Store(rules)
+	if o.keyIndex || o.cleanupInterval > 0 || o.expireProbes > 0 {
+		c.index = newKeyIndex()
+	}
+	if o.cleanupInterval > 0 {
+		c.sweeper = startSweeper(c, o.cleanupInterval)
+	}
+	c.probes = max(o.expireProbes, 0)
+	return c, nil
+}
+
+// EffectiveMaxBytes returns the memory the cache allocates, see Cache.EffectiveMaxBytes.
+func (c *CacheWithTTL) EffectiveMaxBytes() int {
+	return c.cache.EffectiveMaxBytes()
+}
+
+// Has reports whether key holds a live entry, deleting it if it has expired
+// like Get. The value isn't copied out: fastcache only reads entries whole, so
+// the header is checked in the pooled read buffer, payload included.
 func (c *CacheWithTTL) Has(key string) bool {
-	_, ok := unwrapCacheWithTTL(c.ICache.Get(key))
+	ok, _ := c.getFn(key, func([]byte) error { return nil })
 	return ok
 }
 
 func (c *CacheWithTTL) Get(key string) []byte {
-	data, ok := unwrapCacheWithTTL(c.ICache.Get(key))
+	data, _ := c.GetOK(key)
+	return data
+}
+
+// GetOK is Get that also reports whether a live entry was found,
+// false for missing and expired keys. An entry found past its expiry is
+// deleted, see LazyPurged. Reading an entry restarts its time-to-idle.
+// See GetE for why a key has no value.
+func (c *CacheWithTTL) GetOK(key string) ([]byte, bool) {
+	value, err := c.GetE(key)
+	return value, err == nil
+}
+
+// GetE is GetOK returning why key has no value: ErrNotFound if it is missing
+// or expired, ErrNotTTLEntry if it holds a value the cache didn't write, which
+// is left in place, and ErrClosed after Close.
+func (c *CacheWithTTL) GetE(key string) ([]byte, error) {
+	start := c.cache.observeStart()
+	value, read, err := c.getE(key)
+	c.countRead(start, read)
+	return value, err
+}
+
+// getE is GetE without counting towards the stats, returning the TTLStats
+// counter of the read instead
+func (c *CacheWithTTL) getE(key string) ([]byte, int, error) {
+	if c.cache.closed.Load() {
+		return nil, countMissesAbsent, ErrClosed
+	}
+	data, _ := c.cache.getOK(key)
+	value, ok := c.unwrap(data)
 	if !ok {
+		if data == nil {
+			return nil, countMissesAbsent, ErrNotFound
+		}
+		foreign := c.foreign(data)
+		read := c.missed(key, foreign)
+		if foreign {
+			return nil, read, fmt.Errorf("%w: %q", ErrNotTTLEntry, key)
+		}
+		return nil, read, ErrNotFound
+	}
+	if isIdle(data) {
+		c.access(key)
+	}
+	return value, countTTLHits, nil
+}
+
+// GetInto appends the live value of key, without its header, to dst and
+// returns the extended slice, see Cache.GetInto. Otherwise it behaves like
+// GetOK.
+func (c *CacheWithTTL) GetInto(dst []byte, key string) ([]byte, bool) {
+	start := c.cache.observeStart()
+	if !c.cache.enter() {
+		return dst, false
+	}
+	c.cache.sample(key)
+	if c.cache.filtered(key) {
+		c.cache.leave()
+		c.countRead(start, countMissesAbsent)
+		return dst, false
+	}
+	n := len(dst)
+	dst, has := c.cache.hasGet(dst, key)
+	c.cache.passedFilter(has)
+	c.cache.leave()
+	if !has {
+		c.countRead(start, countMissesAbsent)
+		return dst, false
+	}
+
+	data := dst[n:]
+	h, m, ok := c.decode(data)
+	if !ok || isExpired(c.servedUntil(h), c.now()) {
+		c.countRead(start, c.missed(key, c.foreign(data)))
+		return dst[:n], false
+	}
+	c.countRead(start, countTTLHits)
+	if isIdle(data) {
+		c.access(key)
+	}
+	// the header is dropped by moving the payload over it
+	return dst[:n+copy(data, data[m:])], true
+}
+
+// GetFn calls fn with the live value of key, its header stripped, without
+// copying it, see Cache.GetFn for the lifetime of value. Otherwise it behaves
+// like GetOK: fn isn't called for a missing or expired key, an expired entry
+// is deleted and a read restarts the time-to-idle.
+func (c *CacheWithTTL) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	start := c.cache.observeStart()
+	c.cache.sample(key)
+	found, err := c.getFn(key, fn)
+	c.cache.countGet(found)
+	c.cache.observeGet(start, found)
+	return found, err
+}
+
+// getFn is GetFn without counting towards the hot keys and Stats, for Has
+func (c *CacheWithTTL) getFn(key string, fn func(value []byte) error) (bool, error) {
+	var found, idle, foreign bool
+	var err error
+	has := c.cache.view(key, func(data []byte) {
+		value, ok := c.unwrap(data)
+		if !ok {
+			foreign = c.foreign(data)
+			return
+		}
+		found, idle = true, isIdle(data)
+		err = fn(value)
+	})
+	read := countMissesAbsent
+	switch {
+	case found:
+		read = countTTLHits
+		if idle {
+			c.access(key)
+		}
+	case has:
+		read = c.missed(key, foreign)
+	}
+	c.cache.counts.add(read)
+	return found, err
+}
+
+// missed counts a read of key that found an entry it can't serve, purging
+// the entry unless it's foreign, and returns the TTLStats counter of the read
+func (c *CacheWithTTL) missed(key string, foreign bool) int {
+	if foreign {
+		c.foreignReads.Add(1)
+		return countMissesAbsent
+	}
+	c.purge(key)
+	return countMissesExpired
+}
+
+// access records a read of key for its time-to-idle, patching the last
+// access time in its header
+func (c *CacheWithTTL) access(key string) {
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	data, _ := c.cache.load(buf, key)
+	now := c.now()
+	h, n, ok := c.decode(data)
+	if !ok || h.tti == 0 || isExpired(h.deadline(), now) {
+		return
+	}
+	// lastAccess is the last field of a formatIdle header
+	binary.BigEndian.PutUint64(data[n-8:n], uint64(now))
+	c.cache.put(key, data)
+}
+
+// LazyPurged returns how many expired entries Get and Has have deleted.
+//
+// Deprecated: use TTLStats().ExpiredPurged, which also counts the entries
+// deleted by the sweeper and Compact, and is zeroed by ResetStats.
+func (c *CacheWithTTL) LazyPurged() int64 {
+	return c.lazyPurged.Load()
+}
+
+// Peek returns a copy of the live value of key like Get, but is meant for
+// inspection: it never counts towards stats, refreshes a TTL or removes an
+// expired entry, which is left in place while Peek returns nil.
+func (c *CacheWithTTL) Peek(key string) []byte {
+	var res []byte
+	c.cache.view(key, func(data []byte) {
+		if value, ok := c.unwrap(data); ok && value != nil {
+			res = append([]byte{}, value...)
+		}
+	})
+	return res
+}
+
+// GetOrDefault returns a copy of the live value of key, or def itself if key
+// is missing or expired.
+func (c *CacheWithTTL) GetOrDefault(key string, def []byte) []byte {
+	if value, ok := c.GetOK(key); ok {
+		return value
+	}
+	return def
+}
+
+// MGet returns the values of keys by position, nil for missing or expired keys.
+func (c *CacheWithTTL) MGet(keys []string) [][]byte {
+	if len(keys) == 0 {
 		return nil
 	}
-	return data
+	values, _ := c.mget(keys)
+	return values
+}
+
+// MGetMap returns the live values of the keys found and the missing or
+// expired keys, in input order without duplicates.
+func (c *CacheWithTTL) MGetMap(keys []string) (map[string][]byte, []string) {
+	values, found := c.mget(keys)
+	return splitHits(keys, values, found)
+}
+
+// mget reads keys like Cache.mget, counting them towards TTLStats. Expired
+// entries are left in place.
+func (c *CacheWithTTL) mget(keys []string) ([][]byte, []bool) {
+	var hits, expired int64
+	values, found := c.cache.mget(keys, func(data []byte) ([]byte, bool) {
+		value, ok := c.unwrap(data)
+		switch {
+		case ok:
+			hits++
+		case !c.foreign(data):
+			expired++
+		}
+		return value, ok
+	})
+	c.cache.counts.addN(countTTLHits, hits)
+	c.cache.counts.addN(countMissesExpired, expired)
+	c.cache.counts.addN(countMissesAbsent, int64(len(keys))-hits-expired)
+	return values, found
+}
+
+// HasMulti reports whether each key holds a live entry, in input order.
+// Headers are checked in a single pooled buffer without copying payloads.
+func (c *CacheWithTTL) HasMulti(keys []string) []bool {
+	res := make([]bool, len(keys))
+	if len(keys) == 0 || !c.cache.enter() {
+		return res
+	}
+	defer c.cache.leave()
+
+	buf := c.cache.pool.get()
+	now := c.now()
+	for i, key := range keys {
+		read := countMissesAbsent
+		if !c.cache.filtered(key) {
+			dst, has := c.cache.load(buf, key)
+			c.cache.passedFilter(has)
+			if has {
+				h, _, ok := c.decode(dst)
+				switch {
+				case !ok:
+				case isExpired(c.servedUntil(h), now):
+					read = countMissesExpired
+				default:
+					read, res[i] = countTTLHits, true
+				}
+			}
+		}
+		c.cache.counts.add(read)
+	}
+	c.cache.pool.put(buf)
+	return res
+}
+
+// Inspect reports whether key is fresh, stale (stored but expired) or absent,
+// decoding only the header without copying the payload out.
+func (c *CacheWithTTL) Inspect(key string) EntryState {
+	state := EntryAbsent
+	c.cache.view(key, func(data []byte) {
+		expireAt, ok := c.decodeExpireAt(data)
+		switch {
+		case !ok:
+		case isExpired(expireAt, c.now()):
+			state = EntryStale
+		default:
+			state = EntryFresh
+		}
+	})
+	return state
+}
+
+// GetRange returns a copy of length bytes of the live value of key starting at
+// offset, offsets are relative to the value as passed to Set. See Cache.GetRange.
+func (c *CacheWithTTL) GetRange(key string, offset, length int) []byte {
+	var res []byte
+	c.cache.view(key, func(data []byte) {
+		if value, ok := c.unwrap(data); ok {
+			res = copyRange(value, offset, length)
+		}
+	})
+	return res
+}
+
+// TTL returns the time key has left, rounded up to the millisecond,
+// persisted keys report the largest Duration.
+// It returns 0, false if key is missing or expired.
+func (c *CacheWithTTL) TTL(key string) (time.Duration, bool) {
+	var ttl time.Duration
+	var ok bool
+	c.cache.view(key, func(data []byte) {
+		h, _, valid := c.decode(data)
+		if valid && !isExpired(c.servedUntil(h), c.now()) {
+			ttl, ok = remaining(c.servedUntil(h), c.clock.Now()), true
+		}
+	})
+	return ttl, ok
+}
+
+// GetWithTTL returns a copy of the live value of key and the time it has left,
+// read from a single lookup. It returns nil, 0, false if key is missing or expired.
+func (c *CacheWithTTL) GetWithTTL(key string) ([]byte, time.Duration, bool) {
+	var value []byte
+	var ttl time.Duration
+	var ok bool
+	c.cache.view(key, func(data []byte) {
+		h, n, valid := c.decode(data)
+		if !valid || isExpired(c.servedUntil(h), c.now()) {
+			return
+		}
+		value = copyPayload(h, data, n)
+		ttl = remaining(c.servedUntil(h), c.clock.Now())
+		ok = true
+	})
+	return value, ttl, ok
+}
+
+// GetStale returns a copy of the value of key even if it has expired, as long
+// as fastcache still holds it, with stale reporting whether it is past its
+// soft expiry, its only one unless set by SetWithSoftTTL. Expired entries are
+// left as they are. ok is false if key was never stored, deleted or evicted.
+func (c *CacheWithTTL) GetStale(key string) (value []byte, stale bool, ok bool) {
+	c.cache.view(key, func(data []byte) {
+		h, n, valid := c.decode(data)
+		if !valid {
+			return
+		}
+		value = copyPayload(h, data, n)
+		stale, ok = isExpired(h.softExpireAt(), c.now()), true
+	})
+	return value, stale, ok
+}
+
+// Age returns how long ago the live entry of key was written, Expire, Touch and
+// in-place updates like Append don't reset it. It returns 0, false if key is
+// missing or expired, or its entry predates creation times being recorded.
+func (c *CacheWithTTL) Age(key string) (time.Duration, bool) {
+	var age time.Duration
+	var ok bool
+	c.cache.view(key, func(data []byte) {
+		h, _, valid := c.decode(data)
+		if !valid || isExpired(h.deadline(), c.now()) || h.createdAt == 0 {
+			return
+		}
+		age = time.Duration(max(c.now()-h.createdAt, 0)) * time.Millisecond
+		ok = true
+	})
+	return age, ok
 }
 
+// Expire re-arms the TTL of a live key without rewriting its value, a negative
+// ttl, or zero without a default TTL, removes it. ttl also becomes the duration
+// Touch re-arms with. It returns false if key is missing or expired.
+func (c *CacheWithTTL) Expire(key string, ttl time.Duration) (bool, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return false, err
+	}
+	return c.rearm(key, func(h header) (header, error) {
+		h.expireAt, h.ttl = c.clock.Now().Add(ttl).UnixMilli(), ttl
+		return h, nil
+	})
+}
+
+// Persist makes a live key never expire until its TTL is set again by Expire
+// or a write. It returns false if key is missing or expired.
+func (c *CacheWithTTL) Persist(key string) (bool, error) {
+	return c.rearm(key, func(h header) (header, error) {
+		h.expireAt, h.ttl, h.stale, h.tti = noExpiry, 0, 0, 0
+		return h, nil
+	})
+}
+
+// Touch re-arms a live key with the TTL it was written with, or last given by
+// Expire, and counts as an access for its time-to-idle. It returns false if key
+// is missing or expired, and ErrNoTTL if the key has no TTL to refresh: written
+// by SetWithExpireAt or made persistent.
+func (c *CacheWithTTL) Touch(key string) (bool, error) {
+	return c.rearm(key, func(h header) (header, error) {
+		if h.ttl == 0 {
+			return h, ErrNoTTL
+		}
+		h.expireAt = c.clock.Now().Add(h.ttl).UnixMilli()
+		h.lastAccess = c.now()
+		return h, nil
+	})
+}
+
+// rearm rewrites the header of a live key with what next makes of it, leaving
+// the payload as is. The key is removed if the new expireAt has passed.
+func (c *CacheWithTTL) rearm(key string, next func(h header) (header, error)) (bool, error) {
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	wrapped, _ := c.cache.load(buf, key)
+	h, n, ok := c.decode(wrapped)
+	if !ok || isExpired(h.deadline(), c.now()) {
+		return false, nil
+	}
+	h, err = next(h)
+	if err != nil {
+		return false, err
+	}
+	if isExpired(h.deadline(), c.now()) {
+		c.del(key)
+		return true, nil
+	}
+	if err := c.replaceHeader(key, wrapped, n, h); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// replaceHeader stores the entry wrapped, whose header takes its first n
+// bytes, with h as its header. The caller holds the lock of key.
+func (c *CacheWithTTL) replaceHeader(key string, wrapped []byte, n int, h header) error {
+	var hdr [maxHeaderSize]byte
+	m, err := c.putHeader(hdr[:], h)
+	if err != nil {
+		return err
+	}
+	if m == n {
+		copy(wrapped, hdr[:m])
+	} else {
+		if err := c.cache.checkSize(key, len(wrapped)-n+m); err != nil {
+			return err
+		}
+		wrapped = append(hdr[:m:m], wrapped[n:]...)
+	}
+	c.cache.put(key, wrapped)
+	return nil
+}
+
+// Set stores value for ttl, pass UseRuleTTL to take the ttl from the TTL rules.
+// A zero ttl uses the default TTL if one is configured, see WithDefaultTTL,
+// otherwise the entry is stored already expired like with a negative ttl.
+// It fails with ErrValueTooLarge if key and value, with the TTL header in
+// front of it, exceed fastcache's per-entry limit. A nil value reads back as
+// nil and an empty one as empty.
 func (c *CacheWithTTL) Set(key string, value []byte, ttl time.Duration) error {
-	value = wrapCacheWithTTL(value, ttl)
-	return c.ICache.Set(key, value)
+	c.cache.counts.add(countSets)
+	defer c.cache.observeSet(c.cache.observeStart(), len(value))
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return err
+	}
+	h := c.ttlHeader(ttl)
+	if c.cache.setDedup {
+		if same, sameHeader := c.unchanged(key, value, h); same && (sameHeader || c.rewriteHeader(key, value, h)) {
+			c.cache.skipped.Add(1)
+			return nil
+		}
+	}
+	if err := c.setEntry(key, value, h); err != nil {
+		return err
+	}
+	c.probe()
+	return nil
+}
+
+// SetWithSoftTTL stores value for the hard ttl, after the soft ttl it is stale
+// but still served by reads, unless WithStrictSoftTTL is set. GetOrCompute
+// serves a stale entry and reloads it in the background. hard is resolved like
+// the ttl of Set, soft must be positive and no longer than it.
+func (c *CacheWithTTL) SetWithSoftTTL(key string, value []byte, soft, hard time.Duration) error {
+	c.cache.counts.add(countSets)
+	defer c.cache.observeSet(c.cache.observeStart(), len(value))
+	hard, err := c.resolveTTL(key, hard)
+	if err != nil {
+		return err
+	}
+	if soft <= 0 || soft > hard {
+		return ErrInvalidSoftTTL
+	}
+	h := c.ttlHeader(hard)
+	h.stale = hard - soft
+	return c.setEntry(key, value, h)
+}
+
+// SetWithTTI stores value for ttl, resolved like the ttl of Set, and also
+// expires it once it hasn't been read for tti, whichever comes first. Get, GetOK,
+// Has and Touch count as reads, other lookups like Peek and MGet don't. tti
+// must be positive.
+func (c *CacheWithTTL) SetWithTTI(key string, value []byte, ttl, tti time.Duration) error {
+	c.cache.counts.add(countSets)
+	defer c.cache.observeSet(c.cache.observeStart(), len(value))
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return err
+	}
+	if tti <= 0 {
+		return ErrInvalidTTI
+	}
+	h := c.ttlHeader(ttl)
+	h.tti, h.lastAccess = tti, h.createdAt
+	return c.setEntry(key, value, h)
+}
+
+// SetWithExpireAt stores value until the absolute deadline expireAt,
+// a zero or past expireAt stores it already expired.
+func (c *CacheWithTTL) SetWithExpireAt(key string, value []byte, expireAt time.Time) error {
+	c.cache.counts.add(countSets)
+	defer c.cache.observeSet(c.cache.observeStart(), len(value))
+	return c.setEntry(key, value, header{
+		expireAt:  expireAt.UnixMilli(),
+		createdAt: c.now(),
+	})
+}
+
+// GetOrSet returns the live value of key, or stores value for ttl and returns it.
+// stored reports whether value was written, an expired entry counts as absent.
+func (c *CacheWithTTL) GetOrSet(key string, value []byte, ttl time.Duration) (actual []byte, stored bool, err error) {
+	ttl, err = c.resolveTTL(key, ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer mu.Unlock()
+
+	if old, ok := c.get(key); ok {
+		return old, false, nil
+	}
+	if err := c.store(key, value, ttl); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// SetNX stores value for ttl only if key holds no live entry and reports
+// whether it did, an expired entry counts as absent.
+func (c *CacheWithTTL) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if c.live(key) {
+		return false, nil
+	}
+	if err := c.store(key, value, ttl); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TTLEntry is a single write of a batch on CacheWithTTL.
+type TTLEntry struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+}
+
+// SetXX stores value for ttl only if key holds a live entry and reports
+// whether it did, an expired entry counts as absent.
+func (c *CacheWithTTL) SetXX(key string, value []byte, ttl time.Duration) (bool, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.live(key) {
+		return false, nil
+	}
+	if err := c.store(key, value, ttl); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetReplaced stores value for ttl and reports whether it replaced a live entry,
+// overwriting an expired one counts as an insert.
+func (c *CacheWithTTL) SetReplaced(key string, value []byte, ttl time.Duration) (bool, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	replaced := c.live(key)
+	if err := c.store(key, value, ttl); err != nil {
+		return false, err
+	}
+	return replaced, nil
+}
+
+// Swap stores value for ttl and returns a copy of the previous live value,
+// existed is false if there was none or it had expired.
+func (c *CacheWithTTL) Swap(key string, value []byte, ttl time.Duration) (old []byte, existed bool, err error) {
+	ttl, err = c.resolveTTL(key, ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer mu.Unlock()
+
+	old, existed = c.get(key)
+	if err := c.store(key, value, ttl); err != nil {
+		return nil, false, err
+	}
+	return old, existed, nil
+}
+
+// CompareAndSwap stores value for ttl only if key's live value is exactly
+// expected, a nil expected matching a missing or expired key, and reports
+// whether it did.
+func (c *CacheWithTTL) CompareAndSwap(key string, expected, value []byte, ttl time.Duration) (bool, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.holds(key, expected) {
+		return false, nil
+	}
+	if err := c.store(key, value, ttl); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CompareAndDelete deletes key only if its live value is exactly expected
+// and reports whether it did. Missing and expired keys never match, a nil
+// expected matches an empty value.
+func (c *CacheWithTTL) CompareAndDelete(key string, expected []byte) (bool, error) {
+	if expected == nil {
+		expected = []byte{}
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return false, err
+	}
+	defer mu.Unlock()
+
+	if !c.holds(key, expected) {
+		return false, nil
+	}
+	c.del(key)
+	return true, nil
+}
+
+// Append appends data to the live value of key keeping its remaining TTL.
+// If key has no live entry it is created with data for ttl.
+// It fails with ErrValueTooLarge rather than truncating.
+func (c *CacheWithTTL) Append(key string, data []byte, ttl time.Duration) error {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	wrapped, has := c.cache.load(buf, key)
+	if _, ok := c.unwrap(wrapped); !has || !ok {
+		wrapped, err = c.wrap(data, ttl)
+		if err != nil {
+			return err
+		}
+		if err := c.cache.checkSize(key, len(wrapped)); err != nil {
+			return err
+		}
+		c.cache.put(key, wrapped)
+		c.index.add(key)
+		return nil
+	}
+
+	// the header, and with it the expiry, is kept as is, except for the nil
+	// flag: the value is no longer nil
+	if len(data) > 0 {
+		wrapped = clearNil(wrapped)
+	}
+	if err := c.cache.checkSize(key, len(wrapped)+len(data)); err != nil {
+		return err
+	}
+	c.cache.put(key, append(wrapped, data...))
+	return nil
+}
+
+// Incr adds delta to the int64 counter at key and returns the new value.
+// The first increment creates the counter for ttl, later ones keep its
+// remaining TTL. It fails with EncodingError if key holds anything but a counter.
+func (c *CacheWithTTL) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	wrapped, _ := c.cache.load(buf, key)
+	value, ok := c.unwrap(wrapped)
+	if !ok {
+		var b [counterSize]byte
+		putCounter(b[:], delta)
+		if err := c.store(key, b[:], ttl); err != nil {
+			return 0, err
+		}
+		return delta, nil
+	}
+
+	n, err := decodeCounter(key, value)
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	// value aliases the payload of wrapped, the header is kept as is
+	putCounter(value, n)
+	c.cache.put(key, wrapped)
+	return n, nil
+}
+
+// Decr subtracts delta from the int64 counter at key, see Incr.
+func (c *CacheWithTTL) Decr(key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.Incr(key, -delta, ttl)
+}
+
+// IncrFloat adds delta to the float64 counter at key and returns the new value,
+// with the TTL handling of Incr. It fails with EncodingError if key holds
+// anything but a float64 counter, and with ErrInvalidFloat if delta or the
+// result is NaN or infinite.
+func (c *CacheWithTTL) IncrFloat(key string, delta float64, ttl time.Duration) (float64, error) {
+	if err := checkFloat(delta); err != nil {
+		return 0, err
+	}
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
+
+	buf := c.cache.pool.get()
+	defer c.cache.pool.put(buf)
+
+	wrapped, _ := c.cache.load(buf, key)
+	value, ok := c.unwrap(wrapped)
+	if !ok {
+		var b [floatCounterSize]byte
+		putFloatCounter(b[:], delta)
+		if err := c.store(key, b[:], ttl); err != nil {
+			return 0, err
+		}
+		return delta, nil
+	}
+
+	f, err := decodeFloatCounter(key, value)
+	if err != nil {
+		return 0, err
+	}
+	f += delta
+	if err := checkFloat(f); err != nil {
+		return 0, err
+	}
+	putFloatCounter(value, f)
+	c.cache.put(key, wrapped)
+	return f, nil
+}
+
+// MSet writes every entry like Set, continuing past failures,
+// which are returned as a *BatchError in input order.
+func (c *CacheWithTTL) MSet(entries []TTLEntry) error {
+	var errs BatchError
+	for _, e := range entries {
+		errs.add(e.Key, c.Set(e.Key, e.Value, e.TTL))
+	}
+	return errs.err()
+}
+
+// SetMany is MSet, for warming the cache in bulk.
+func (c *CacheWithTTL) SetMany(entries []TTLEntry) error {
+	return c.MSet(entries)
+}
+
+// GetOrCompute returns the live value of key, or calls loader and stores its
+// result for ttl. Concurrent misses on the same key share a single loader call.
+// Loader errors are returned and not cached, a nil result is stored and
+// returned as nil, e.g. to cache that a key is absent upstream.
+func (c *CacheWithTTL) GetOrCompute(key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	start := c.cache.observeStart()
+	v, h, read := c.lookup(key)
+	if read == countTTLHits {
+		if !isExpired(h.softExpireAt(), c.now()) {
+			c.countRead(start, read)
+			return v, nil
+		}
+		if !c.strictSoft {
+			c.countRead(start, read)
+			c.revalidate(key, ttl, h.stale, loader)
+			return v, nil
+		}
+		read = countMissesExpired
+	}
+	c.countRead(start, read)
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.flights.do(key, func() ([]byte, error) {
+		// a flight that just finished may have stored it
+		if v, _, err := c.getE(key); err == nil {
+			return v, nil
+		}
+		v, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Set(key, v, ttl); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
+
+// lookup returns a copy of the value of key and its header if it hasn't
+// reached its hard expiry, and the TTLStats counter of the read, without
+// counting it
+func (c *CacheWithTTL) lookup(key string) ([]byte, header, int) {
+	var value []byte
+	var h header
+	read := countMissesAbsent
+	c.cache.view(key, func(data []byte) {
+		var n int
+		var ok bool
+		switch h, n, ok = c.decode(data); {
+		case !ok && c.foreign(data):
+		case !ok || isExpired(h.deadline(), c.now()):
+			read = countMissesExpired
+		default:
+			value, read = copyPayload(h, data, n), countTTLHits
+		}
+	})
+	return value, h, read
+}
+
+// revalidate reloads a stale key in the background unless a load for it is
+// already in flight, keeping its stale window. Failures leave the stale entry
+// in place until its hard expiry.
+func (c *CacheWithTTL) revalidate(key string, ttl, stale time.Duration, loader func() ([]byte, error)) {
+	ttl, err := c.resolveTTL(key, ttl)
+	if err != nil {
+		return
+	}
+	c.flights.spawn(key, func() ([]byte, error) {
+		v, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		now := c.clock.Now()
+		wrapped, err := c.encode(v, header{
+			expireAt:  now.Add(ttl).UnixMilli(),
+			ttl:       ttl,
+			createdAt: now.UnixMilli(),
+			stale:     min(stale, ttl),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v, c.set(key, wrapped)
+	})
+}
+
+// MGetOrCompute returns the live values of keys, calling loader once with the
+// keys that miss and storing what it returns for ttl. Keys the loader omits are
+// left out of the result. Keys a concurrent GetOrCompute or MGetOrCompute is
+// already loading are waited for rather than loaded again. Failed keys are
+// reported in a *BatchError, returned along with every value that was found.
+func (c *CacheWithTTL) MGetOrCompute(keys []string, ttl time.Duration, loader func(missing []string) (map[string][]byte, error)) (map[string][]byte, error) {
+	res, misses := c.MGetMap(keys)
+	if len(misses) == 0 {
+		return res, nil
+	}
+	b, err := c.computeBatch(misses, ttl)
+	if err != nil {
+		return res, err
+	}
+	loadMany(misses, []*computeBatch{b}, loader)
+
+	var errs BatchError
+	b.wait(res, &errs)
+	return res, errs.err()
+}
+
+// computeBatch is the part of an MGetOrCompute served by one CacheWithTTL:
+// the flights of the keys that missed, own to load and others to wait for
+type computeBatch struct {
+	c           *CacheWithTTL
+	misses      []string
+	ttls        map[string]time.Duration
+	own, others map[string]*flight
+}
+
+// computeBatch resolves the TTLs of misses, then claims their flights
+func (c *CacheWithTTL) computeBatch(misses []string, ttl time.Duration) (*computeBatch, error) {
+	ttls := make(map[string]time.Duration, len(misses))
+	for _, key := range misses {
+		d, err := c.resolveTTL(key, ttl)
+		if err != nil {
+			return nil, err
+		}
+		ttls[key] = d
+	}
+	b := &computeBatch{c: c, misses: misses, ttls: ttls}
+	b.own, b.others = c.flights.claim(misses)
+	return b, nil
+}
+
+// wait adds the values of the flights of b to res and their errors to errs,
+// in the order of the misses
+func (b *computeBatch) wait(res map[string][]byte, errs *BatchError) {
+	for _, key := range b.misses {
+		f := b.own[key]
+		if f == nil {
+			f = b.others[key]
+		}
+		v, ok, err := f.wait()
+		errs.add(key, err)
+		if ok {
+			res[key] = v
+		}
+	}
+}
+
+// loadMany fills and ends the own flights of batches, calling loader once
+// for the keys still missing, in the order of keys, and storing what it
+// returns in the cache of their batch.
+func loadMany(keys []string, batches []*computeBatch, loader func(missing []string) (map[string][]byte, error)) {
+	for _, b := range batches {
+		for _, f := range b.own {
+			f.absent = true
+		}
+	}
+	defer func() {
+		r := recover()
+		for _, b := range batches {
+			for key, f := range b.own {
+				if r != nil && f.absent && f.err == nil {
+					f.err = fmt.Errorf("gcache: loader for %q panicked: %v", key, r)
+				}
+				b.c.flights.finish(key, f)
+			}
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	// a flight that just finished may have stored some of them, MGetOrCompute
+	// already counted the reads
+	owner := make(map[string]*computeBatch)
+	for _, b := range batches {
+		for key, f := range b.own {
+			if v, _, read := b.c.lookup(key); read == countTTLHits {
+				f.val, f.absent = v, false
+			} else {
+				owner[key] = b
+			}
+		}
+	}
+	if len(owner) == 0 {
+		return
+	}
+	missing := make([]string, 0, len(owner))
+	owners := make([]*computeBatch, 0, len(owner))
+	for _, key := range keys {
+		if b := owner[key]; b != nil {
+			missing, owners = append(missing, key), append(owners, b)
+			delete(owner, key)
+		}
+	}
+
+	loaded, err := loader(missing)
+	for i, key := range missing {
+		b := owners[i]
+		f := b.own[key]
+		if err != nil {
+			f.err = err
+			continue
+		}
+		v, ok := loaded[key]
+		if !ok {
+			continue
+		}
+		if err := b.c.Set(key, v, b.ttls[key]); err != nil {
+			f.err = err
+			continue
+		}
+		f.val, f.absent = bytes.Clone(v), false
+	}
 }
 
 func (c *CacheWithTTL) Delete(key string) error {
-	return c.ICache.Delete(key)
+	c.cache.counts.add(countDels)
+	defer c.cache.observeDelete(c.cache.observeStart())
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	c.del(key)
+	mu.Unlock()
+	return nil
+}
+
+// GetAndDelete returns the live value of key and deletes it in one step,
+// so only one caller can observe a given value. Expired entries are deleted
+// and nil is returned.
+func (c *CacheWithTTL) GetAndDelete(key string) []byte {
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return nil
+	}
+	defer mu.Unlock()
+
+	value, _ := c.get(key)
+	c.del(key)
+	return value
+}
+
+// MDelete deletes keys and returns how many of them held a live entry,
+// expired entries are removed but not counted.
+func (c *CacheWithTTL) MDelete(keys ...string) (int, error) {
+	n := 0
+	for _, key := range keys {
+		c.cache.counts.add(countDels)
+		start := c.cache.observeStart()
+		mu, err := c.cache.lockOpen(key)
+		if err != nil {
+			c.cache.observeDelete(start)
+			return n, err
+		}
+		if c.live(key) {
+			n++
+		}
+		c.del(key)
+		mu.Unlock()
+		c.cache.observeDelete(start)
+	}
+	return n, nil
+}
+
+// Reset removes every entry like Cache.Reset, with the key index, the stats,
+// LazyPurged and the sweeper's progress, see LastSweep. Loads of GetOrCompute
+// in flight may still store their value after it.
+func (c *CacheWithTTL) Reset() error {
+	return c.cache.reset(func() {
+		c.index.clear()
+		c.lazyPurged.Store(0)
+		c.foreignReads.Store(0)
+		c.sweeper.reset()
+	})
 }
 
+// Close stops the sweeper, if any, waits for the background reloads of
+// GetOrCompute and closes the cache like Cache.Close.
 func (c *CacheWithTTL) Close() error {
-	return c.ICache.Close()
+	c.sweeper.close()
+	c.flights.close()
+	return c.cache.Close()
 }
 
-// wrapCacheWithTTL wrap data with ttl
-func wrapCacheWithTTL(data []byte, ttl time.Duration) []byte {
-	expireAt := time.Now().Add(ttl).UnixMilli()
-	buf := make([]byte, 8+len(data))
-	binary.BigEndian.PutUint64(buf[:8], uint64(expireAt))
-	copy(buf[8:], data)
-	return buf
+// LastSweep returns the result of the latest sweep, false if the cache has no
+// sweeper or it hasn't run yet, see WithCleanupInterval.
+func (c *CacheWithTTL) LastSweep() (SweepResult, bool) {
+	if c.sweeper == nil {
+		return SweepResult{}, false
+	}
+	if res := c.sweeper.last.Load(); res != nil {
+		return *res, true
+	}
+	return SweepResult{}, false
 }
 
-// unwrapCacheWithTTL unwrap data with ttl
-func unwrapCacheWithTTL(data []byte) ([]byte, bool) {
-	if len(data) < 8 {
-		return nil, false
+// get returns the live value of key like GetOK without deleting an expired
+// entry, for callers holding the key's lock
+func (c *CacheWithTTL) get(key string) ([]byte, bool) {
+	data, _ := c.cache.getOK(key)
+	return c.unwrap(data)
+}
+
+// purge deletes key if it holds an entry past its hard expiry. The expiry is
+// checked again under the key's lock so a value written since the caller's
+// read is kept.
+func (c *CacheWithTTL) purge(key string) {
+	if dropExpired(c.cache, c.index, key, c.entryFormat, c.now()) {
+		c.lazyPurged.Add(1)
+	}
+}
+
+// probe deletes the expired entries among a few random indexed keys,
+// see WithExpireProbes
+func (c *CacheWithTTL) probe() {
+	if c.probes == 0 || c.index.len() == 0 {
+		return
+	}
+	now := c.now()
+	for range c.probes {
+		if key, ok := c.index.sample(); ok {
+			dropExpired(c.cache, c.index, key, c.entryFormat, now)
+		}
+	}
+}
+
+// setEntry stores value with h in front of it, see set
+func (c *CacheWithTTL) setEntry(key string, value []byte, h header) error {
+	buf, wrapped, err := c.encodePooled(value, h)
+	if err != nil {
+		return err
+	}
+	err = c.set(key, wrapped)
+	c.cache.pool.put(buf)
+	return err
+}
+
+// set writes an entry and indexes its key
+func (c *CacheWithTTL) set(key string, wrapped []byte) error {
+	if err := c.cache.checkSize(key, len(wrapped)); err != nil {
+		return err
+	}
+
+	mu, err := c.cache.lockOpen(key)
+	if err != nil {
+		return err
+	}
+	c.cache.put(key, wrapped)
+	c.index.add(key)
+	mu.Unlock()
+	return nil
+}
+
+// del deletes key and drops it from the index, the caller holds the key's lock
+func (c *CacheWithTTL) del(key string) {
+	c.cache.del(key)
+	c.index.remove(key)
+}
+
+// live reports whether key holds an unexpired entry
+func (c *CacheWithTTL) live(key string) bool {
+	return c.Inspect(key) == EntryFresh
+}
+
+// holds reports whether key's live value equals expected, nil expected meaning
+// missing or expired
+func (c *CacheWithTTL) holds(key string, expected []byte) bool {
+	matched := expected == nil
+	c.cache.view(key, func(data []byte) {
+		if payload, ok := c.unwrap(data); ok {
+			matched = expected != nil && bytes.Equal(payload, expected)
+		}
+	})
+	return matched
+}
+
+// store writes value for ttl, the caller holds the key's lock
+func (c *CacheWithTTL) store(key string, value []byte, ttl time.Duration) error {
+	buf, wrapped, err := c.encodePooled(value, c.ttlHeader(ttl))
+	if err != nil {
+		return err
+	}
+	defer c.cache.pool.put(buf)
+	if err := c.cache.checkSize(key, len(wrapped)); err != nil {
+		return err
+	}
+	c.cache.put(key, wrapped)
+	c.index.add(key)
+	return nil
+}
+
+// SetTTLRules atomically replaces the TTL rules, the longest matching prefix wins.
+// Passing nil removes the rules.
+func (c *CacheWithTTL) SetTTLRules(rules []TTLRule) error {
+	if rules == nil {
+		c.rules.Store(nil)
+		return nil
 	}
+	r, err := newTTLRules(rules)
+	if err != nil {
+		return err
+	}
+	c.rules.Store(r)
+	return nil
+}
+
+// resolveTTL turns UseRuleTTL into the ttl of the matching rule
+// and a zero ttl into the default TTL, if any, then applies the jitter
+func (c *CacheWithTTL) resolveTTL(key string, ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl == 0 && c.defaultTTL > 0:
+		ttl = c.defaultTTL
+	case ttl == UseRuleTTL:
+		rules := c.rules.Load()
+		if rules == nil {
+			return 0, ErrNoTTLRules
+		}
+		ttl = rules.lookup(key)
+	}
+	return c.jittered(ttl), nil
+}
+
+// jittered spreads a positive ttl within ±c.jitter of it, keeping it positive
+func (c *CacheWithTTL) jittered(ttl time.Duration) time.Duration {
+	if c.jitter == 0 || ttl <= 0 {
+		return ttl
+	}
+	d := time.Duration(float64(ttl) * (1 + c.jitter*(2*rand.Float64()-1)))
+	return max(d, 1)
+}
+
+// now returns the current time of the cache's clock in unix millis
+func (c *CacheWithTTL) now() int64 {
+	return c.clock.Now().UnixMilli()
+}
 
-	expireAt := binary.BigEndian.Uint64(data[:8])
-	if time.Now().UnixMilli() >= int64(expireAt) {
+func (c *CacheWithTTL) wrap(data []byte, ttl time.Duration) ([]byte, error) {
+	return c.encode(data, c.ttlHeader(ttl))
+}
+
+// ttlHeader returns the header of an entry stored now for ttl
+func (c *CacheWithTTL) ttlHeader(ttl time.Duration) header {
+	now := c.clock.Now()
+	return header{
+		expireAt:  now.Add(ttl).UnixMilli(),
+		ttl:       ttl,
+		createdAt: now.UnixMilli(),
+	}
+}
+
+// encode puts h in front of data in the format the cache writes,
+// flagging a nil data as such
+func (c *CacheWithTTL) encode(data []byte, h header) ([]byte, error) {
+	return c.appendEntry(nil, data, h)
+}
+
+// encodePooled is encode into a buffer of the cache's pool, which the caller
+// returns once fastcache has copied the entry
+func (c *CacheWithTTL) encodePooled(data []byte, h header) (*readBuf, []byte, error) {
+	buf := c.cache.pool.getSize(maxHeaderSize + len(data))
+	wrapped, err := c.appendEntry(buf.b[:0], data, h)
+	if err != nil {
+		c.cache.pool.put(buf)
+		return nil, nil, err
+	}
+	// emptied so the size of a write doesn't pick the class of the next read
+	buf.b = wrapped[:0]
+	return buf, wrapped, nil
+}
+
+// appendEntry appends data with h in front of it to dst, see encode
+func (c *CacheWithTTL) appendEntry(dst, data []byte, h header) ([]byte, error) {
+	h.nilValue = data == nil
+	n := len(dst)
+	dst = slices.Grow(dst, maxHeaderSize+len(data))
+	m, err := c.putHeader(dst[n:n+maxHeaderSize], h)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst[:n+m], data...), nil
+}
+
+// putHeader writes h with its expiry rounded up to the cache's precision,
+// compact with WithCompactTTL unless it has a stale window or tti to keep,
+// and in full otherwise
+func (c *CacheWithTTL) putHeader(dst []byte, h header) (int, error) {
+	n := copy(dst, entryMarker)
+	h.expireAt = roundUp(h.expireAt, c.precision)
+	if c.compact && h.stale == 0 && h.tti == 0 {
+		version := byte(formatCompact)
+		if c.precision == compactSecUnit {
+			version = formatCompactSec
+		}
+		n += putFlags(dst[n:], h)
+		m, err := putCompactHeader(dst[n:], version, h.expireAt, c.epoch)
+		return n + m, err
+	}
+	return n + putHeader(dst[n:], h), nil
+}
+
+func (c *CacheWithTTL) unwrap(data []byte) ([]byte, bool) {
+	h, n, ok := c.decode(data)
+	if !ok || isExpired(c.servedUntil(h), c.now()) {
 		return nil, false
 	}
-	return data[8:], true
+	return h.payload(data, n), true
+}
+
+// servedUntil is when reads stop returning an entry: its hard expiry,
+// or its soft one with WithStrictSoftTTL
+func (c *CacheWithTTL) servedUntil(h header) int64 {
+	if c.strictSoft {
+		return h.softExpireAt()
+	}
+	return h.deadline()
 }
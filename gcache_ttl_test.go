@@ -2,9 +2,18 @@ package gcache
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
 )
 
 // TestNewCacheWithTTL 测试创建带 TTL 的缓存
@@ -16,6 +25,42 @@ func TestNewCacheWithTTL(t *testing.T) {
 	defer cache.Close()
 }
 
+// TestNewCacheWithTTLE 测试非法容量和非法选项返回错误而不是 panic
+func TestNewCacheWithTTLE(t *testing.T) {
+	tests := []struct {
+		maxBytes int
+		opts     []Option
+		want     error
+	}{
+		{0, nil, ErrInvalidMaxBytes},
+		{-1, nil, ErrInvalidMaxBytes},
+		{1024, []Option{WithDefaultTTL(-time.Second)}, ErrInvalidDefaultTTL},
+		{1024, []Option{WithTTLJitter(1)}, ErrInvalidTTLJitter},
+		{1024, []Option{WithTTLPrecision(time.Minute)}, ErrInvalidTTLPrecision},
+	}
+	for _, tt := range tests {
+		if c, err := NewCacheWithTTLE(tt.maxBytes, tt.opts...); !errors.Is(err, tt.want) || c != nil {
+			t.Errorf("NewCacheWithTTLE(%d) = %v, %v, want nil, %v", tt.maxBytes, c, err, tt.want)
+		}
+	}
+	// 缺少默认规则
+	if _, err := NewCacheWithTTLE(1024, WithTTLRules([]TTLRule{{Prefix: "a:", TTL: time.Second}})); err == nil {
+		t.Error("NewCacheWithTTLE with invalid TTL rules should fail")
+	}
+
+	cache, err := NewCacheWithTTLE(1024, WithTTLRules([]TTLRule{{Prefix: "", TTL: time.Second}}))
+	if err != nil {
+		t.Fatalf("NewCacheWithTTLE failed: %v", err)
+	}
+	defer cache.Close()
+	if got := cache.EffectiveMaxBytes(); got != 32*1024*1024 {
+		t.Errorf("EffectiveMaxBytes = %d, want 32MB", got)
+	}
+	if err := cache.Set("a:1", []byte("v"), UseRuleTTL); err != nil || !cache.Has("a:1") {
+		t.Errorf("Set with the rules = %v, want them applied", err)
+	}
+}
+
 // TestCacheWithTTL_SetAndGet 测试基本的 Set 和 Get 操作
 func TestCacheWithTTL_SetAndGet(t *testing.T) {
 	cache := NewCacheWithTTL(1024 * 1024)
@@ -41,9 +86,232 @@ func TestCacheWithTTL_SetAndGet(t *testing.T) {
 	}
 }
 
+// TestCacheWithTTL_NilValue 测试 nil、空值和非空值经过 TTL 包装后原样返回
+func TestCacheWithTTL_NilValue(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"full", nil},
+		{"compact", []Option{WithCompactTTL()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := NewCacheWithTTL(1024*1024, tc.opts...)
+			defer cache.Close()
+
+			values := map[string][]byte{"nil": nil, "empty": {}, "value": []byte("v")}
+			for key, value := range values {
+				if err := cache.Set(key, value, time.Minute); err != nil {
+					t.Fatalf("Set(%s) failed: %v", key, err)
+				}
+			}
+			hits, misses := cache.MGetMap([]string{"nil", "empty", "value"})
+			if len(misses) != 0 {
+				t.Errorf("MGetMap misses = %v, want none", misses)
+			}
+			for key, want := range values {
+				check := func(op string, got []byte, ok bool) {
+					t.Helper()
+					if !ok || (got == nil) != (want == nil) || !bytes.Equal(got, want) {
+						t.Errorf("%s(%s) = %#v, %v, want %#v, true", op, key, got, ok, want)
+					}
+				}
+				got, ok := cache.GetOK(key)
+				check("GetOK", got, ok)
+				check("Get", cache.Get(key), true)
+				check("Peek", cache.Peek(key), true)
+				got, _, ok = cache.GetWithTTL(key)
+				check("GetWithTTL", got, ok)
+				got, _, ok = cache.GetStale(key)
+				check("GetStale", got, ok)
+				got, ok = hits[key]
+				check("MGetMap", got, ok)
+			}
+
+			// 修改 TTL 不影响 nil 标记
+			cache.Persist("nil")
+			if got, ok := cache.GetOK("nil"); !ok || got != nil {
+				t.Errorf("GetOK after Persist = %#v, %v, want nil, true", got, ok)
+			}
+			// 追加后不再是 nil
+			cache.Append("nil", []byte("x"), time.Minute)
+			if got := cache.Get("nil"); !bytes.Equal(got, []byte("x")) {
+				t.Errorf("Get after Append = %q, want x", got)
+			}
+		})
+	}
+}
+
+// TestCacheWithTTL_NilValueCompute 测试 loader 返回的 nil 作为否定缓存保存，不会重复加载
+func TestCacheWithTTL_NilValueCompute(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	calls := 0
+	loader := func() ([]byte, error) {
+		calls++
+		return nil, nil
+	}
+	for i := 0; i < 3; i++ {
+		got, err := cache.GetOrCompute("absent", time.Minute, loader)
+		if err != nil || got != nil {
+			t.Fatalf("GetOrCompute = %#v, %v, want nil, nil", got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want 1", calls)
+	}
+
+	// 带 tti 的 nil 值在读取刷新访问时间后仍是 nil
+	cache.SetWithTTI("idle", nil, time.Minute, time.Hour)
+	for i := 0; i < 2; i++ {
+		if got, ok := cache.GetOK("idle"); !ok || got != nil {
+			t.Errorf("GetOK(idle) = %#v, %v, want nil, true", got, ok)
+		}
+	}
+}
+
+// TestCacheWithTTL_GetOK 测试 GetOK 区分不存在、过期和空值
+func TestCacheWithTTL_GetOK(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	got, ok := cache.GetOK("missing")
+	if ok || got != nil {
+		t.Errorf("GetOK(missing) = %v, %v, want nil, false", got, ok)
+	}
+
+	cache.Set("empty", []byte{}, time.Second)
+	got, ok = cache.GetOK("empty")
+	if !ok {
+		t.Error("GetOK(empty) returned false for stored empty value")
+	}
+	if len(got) != 0 {
+		t.Errorf("GetOK(empty) returned %v, want empty", got)
+	}
+
+	// 已过期的数据虽然还在 fastcache 中，也要返回 false
+	cache.Set("expired", []byte("value"), -time.Second)
+	got, ok = cache.GetOK("expired")
+	if ok || got != nil {
+		t.Errorf("GetOK(expired) = %v, %v, want nil, false", got, ok)
+	}
+
+	value := []byte("test-value")
+	cache.Set("key", value, time.Second)
+	got, ok = cache.GetOK("key")
+	if !ok || !bytes.Equal(got, value) {
+		t.Errorf("GetOK(key) = %v, %v, want %v, true", got, ok, value)
+	}
+}
+
+// TestCacheWithTTL_MGetMap 测试过期的 key 计入缺失
+func TestCacheWithTTL_MGetMap(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"), time.Minute)
+	cache.Set("empty", []byte{}, time.Minute)
+	cache.Set("expired", []byte("value"), -time.Second)
+
+	hits, misses := cache.MGetMap([]string{"expired", "a", "missing", "empty", "expired"})
+	if len(hits) != 2 || !bytes.Equal(hits["a"], []byte("value-a")) || hits["empty"] == nil {
+		t.Errorf("hits = %q, want a and empty", hits)
+	}
+	if want := []string{"expired", "missing"}; !slices.Equal(misses, want) {
+		t.Errorf("misses = %q, want %q", misses, want)
+	}
+}
+
+// TestCacheWithTTL_Peek 测试 Peek 不会改动过期的 entry
+func TestCacheWithTTL_Peek(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Minute)
+	if got := cache.Peek("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Peek = %q, want value", got)
+	}
+
+	cache.Set("expired", []byte("value"), -time.Second)
+	if got := cache.Peek("expired"); got != nil {
+		t.Errorf("Peek(expired) = %q, want nil", got)
+	}
+	if cache.Inspect("expired") != EntryStale {
+		t.Error("Peek touched the expired entry")
+	}
+}
+
+// TestCacheWithTTL_GetOrDefault 测试过期的 key 返回默认值
+func TestCacheWithTTL_GetOrDefault(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	def := []byte("default")
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if got := cache.GetOrDefault(key, def); !bytes.Equal(got, def) {
+			t.Errorf("GetOrDefault(%q) = %q, want default", key, got)
+		}
+		if got := cache.GetOrDefault(key, nil); got != nil {
+			t.Errorf("GetOrDefault(%q, nil) = %q, want nil", key, got)
+		}
+	}
+
+	cache.Set("empty", []byte{}, time.Second)
+	if got := cache.GetOrDefault("empty", def); got == nil || len(got) != 0 {
+		t.Errorf("GetOrDefault(empty) = %q, want empty", got)
+	}
+}
+
+// TestCacheWithTTL_MGet 测试批量 Get，过期的 key 返回 nil
+func TestCacheWithTTL_MGet(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"), time.Second)
+	cache.Set("expired", []byte("value-x"), -time.Second)
+	cache.Set("empty", []byte{}, time.Second)
+
+	keys := []string{"a", "missing", "expired", "empty", "a"}
+	want := [][]byte{[]byte("value-a"), nil, nil, {}, []byte("value-a")}
+
+	got := cache.MGet(keys)
+	if len(got) != len(want) {
+		t.Fatalf("MGet returned %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if (got[i] == nil) != (want[i] == nil) || !bytes.Equal(got[i], want[i]) {
+			t.Errorf("MGet[%d] (%q) = %v, want %v", i, keys[i], got[i], want[i])
+		}
+	}
+
+	if got := cache.MGet(nil); got != nil {
+		t.Errorf("MGet(nil) = %v, want nil", got)
+	}
+
+	// header 在 pool buffer 中原地去掉，不多复制一次
+	keys = benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256), time.Minute)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = cache.MGet(keys)
+	})
+	if allocs > 3 {
+		t.Errorf("MGet of 100 keys allocs = %v, want at most 3", allocs)
+	}
+}
+
+// newFakeClockCache 创建使用 FakeClock 的缓存，过期测试无需 sleep
+func newFakeClockCache() (ICacheWithTTL, *FakeClock) {
+	clock := NewFakeClock(time.Now())
+	return NewCacheWithTTL(1024*1024, WithClock(clock)), clock
+}
+
 // TestCacheWithTTL_Expiration 测试过期功能
 func TestCacheWithTTL_Expiration(t *testing.T) {
-	cache := NewCacheWithTTL(1024 * 1024)
+	cache, clock := newFakeClockCache()
 	defer cache.Close()
 
 	key := "test-key"
@@ -61,8 +329,8 @@ func TestCacheWithTTL_Expiration(t *testing.T) {
 		t.Errorf("Get returned %v, want %v", got, value)
 	}
 
-	// 等待过期
-	time.Sleep(150 * time.Millisecond)
+	// 时钟前进到过期之后
+	clock.Advance(150 * time.Millisecond)
 
 	// 过期后应该返回 nil
 	got = cache.Get(key)
@@ -78,7 +346,7 @@ func TestCacheWithTTL_Expiration(t *testing.T) {
 
 // TestCacheWithTTL_DifferentTTL 测试不同的 TTL 值
 func TestCacheWithTTL_DifferentTTL(t *testing.T) {
-	cache := NewCacheWithTTL(1024 * 1024)
+	cache, clock := newFakeClockCache()
 	defer cache.Close()
 
 	key1 := "key1"
@@ -96,8 +364,8 @@ func TestCacheWithTTL_DifferentTTL(t *testing.T) {
 		t.Fatalf("Set failed: %v", err)
 	}
 
-	// 等待第一个 key 过期
-	time.Sleep(100 * time.Millisecond)
+	// 时钟前进到第一个 key 过期之后
+	clock.Advance(100 * time.Millisecond)
 
 	// key1 应该过期
 	if cache.Get(key1) != nil {
@@ -110,8 +378,8 @@ func TestCacheWithTTL_DifferentTTL(t *testing.T) {
 		t.Errorf("key2 Get returned %v, want %v", got, value)
 	}
 
-	// 等待 key2 也过期
-	time.Sleep(150 * time.Millisecond)
+	// 时钟前进到 key2 也过期之后
+	clock.Advance(150 * time.Millisecond)
 
 	// key2 应该过期
 	if cache.Get(key2) != nil {
@@ -121,7 +389,7 @@ func TestCacheWithTTL_DifferentTTL(t *testing.T) {
 
 // TestCacheWithTTL_UpdateTTL 测试更新 TTL
 func TestCacheWithTTL_UpdateTTL(t *testing.T) {
-	cache := NewCacheWithTTL(1024 * 1024)
+	cache, clock := newFakeClockCache()
 	defer cache.Close()
 
 	key := "test-key"
@@ -134,14 +402,14 @@ func TestCacheWithTTL_UpdateTTL(t *testing.T) {
 	}
 
 	// 在过期前更新为更长的 TTL
-	time.Sleep(30 * time.Millisecond)
+	clock.Advance(30 * time.Millisecond)
 	err = cache.Set(key, value, 200*time.Millisecond)
 	if err != nil {
 		t.Fatalf("Set failed: %v", err)
 	}
 
-	// 等待第一次 TTL 过期时间
-	time.Sleep(50 * time.Millisecond)
+	// 时钟前进到第一次 TTL 的过期时间
+	clock.Advance(50 * time.Millisecond)
 
 	// 应该还存在（因为 TTL 被更新了）
 	got := cache.Get(key)
@@ -149,8 +417,8 @@ func TestCacheWithTTL_UpdateTTL(t *testing.T) {
 		t.Errorf("Get returned %v, want %v", got, value)
 	}
 
-	// 等待新的 TTL 过期
-	time.Sleep(150 * time.Millisecond)
+	// 时钟前进到新的 TTL 过期之后
+	clock.Advance(150 * time.Millisecond)
 
 	// 现在应该过期
 	if cache.Get(key) != nil {
@@ -200,214 +468,2083 @@ func TestCacheWithTTL_NegativeTTL(t *testing.T) {
 	}
 }
 
-// TestCacheWithTTL_Delete 测试删除操作
-func TestCacheWithTTL_Delete(t *testing.T) {
+// TestCacheWithTTL_MSet 测试批量 Set 以及部分失败
+func TestCacheWithTTL_MSet(t *testing.T) {
 	cache := NewCacheWithTTL(1024 * 1024)
 	defer cache.Close()
 
-	key := "test-key"
-	value := []byte("test-value")
-
-	// 设置 key
-	err := cache.Set(key, value, time.Second)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+	entries := []TTLEntry{
+		{Key: "a", Value: []byte("value-a"), TTL: time.Second},
+		{Key: "bad", Value: []byte("value-bad"), TTL: UseRuleTTL}, // 没有配置规则，会失败
+		{Key: "expired", Value: []byte("value-x"), TTL: -time.Second},
+		{Key: "b", Value: []byte("value-b"), TTL: time.Second},
 	}
 
-	// 验证存在
-	if !cache.Has(key) {
-		t.Error("Key should exist before delete")
+	err := cache.MSet(entries)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("MSet returned %v, want *BatchError", err)
+	}
+	if keys := batchErr.Keys(); len(keys) != 1 || keys[0] != "bad" {
+		t.Errorf("failed keys = %v, want [bad]", keys)
+	}
+	if !errors.Is(err, ErrNoTTLRules) {
+		t.Errorf("MSet error %v does not wrap %v", err, ErrNoTTLRules)
 	}
 
-	// 删除 key
-	err = cache.Delete(key)
-	if err != nil {
-		t.Fatalf("Delete failed: %v", err)
+	// 成功的 key 可以读取
+	if got := cache.Get("a"); !bytes.Equal(got, []byte("value-a")) {
+		t.Errorf("Get(a) = %v, want value-a", got)
+	}
+	if got := cache.Get("b"); !bytes.Equal(got, []byte("value-b")) {
+		t.Errorf("Get(b) = %v, want value-b", got)
+	}
+	if cache.Has("bad") {
+		t.Error("failed entry should not be stored")
+	}
+	if cache.Has("expired") {
+		t.Error("entry with negative TTL should be expired")
 	}
 
-	// 验证已删除
-	if cache.Has(key) {
-		t.Error("Key should not exist after delete")
+	if err := cache.MSet(nil); err != nil {
+		t.Errorf("MSet(nil) failed: %v", err)
 	}
+}
 
-	got := cache.Get(key)
-	if got != nil {
-		t.Errorf("Get returned %v after delete, want nil", got)
+// TestCacheWithTTL_SetMany 测试 SetMany 与 MSet 一样写入并返回 *BatchError
+func TestCacheWithTTL_SetMany(t *testing.T) {
+	for _, cache := range []ICacheWithTTL{NewCacheWithTTL(1024 * 1024), NewShardedCacheWithTTL(4, 1024*1024)} {
+		err := cache.SetMany([]TTLEntry{
+			{Key: "a", Value: []byte("value-a"), TTL: time.Second},
+			{Key: "bad", Value: []byte("value-bad"), TTL: UseRuleTTL},
+			{Key: "expired", Value: []byte("value-x"), TTL: -time.Second},
+		})
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || len(batchErr.Keys()) != 1 || batchErr.Keys()[0] != "bad" {
+			t.Errorf("%T SetMany = %v, want a *BatchError for bad", cache, err)
+		}
+		if got := cache.Get("a"); !bytes.Equal(got, []byte("value-a")) {
+			t.Errorf("%T Get(a) = %q, want value-a", cache, got)
+		}
+		if cache.Has("expired") {
+			t.Errorf("%T entry with negative TTL should be expired", cache)
+		}
+		if err := cache.SetMany(nil); err != nil {
+			t.Errorf("%T SetMany(nil) = %v", cache, err)
+		}
+		cache.Close()
 	}
 }
 
-// TestCacheWithTTL_Concurrent 测试并发操作
-func TestCacheWithTTL_Concurrent(t *testing.T) {
-	cache := NewCacheWithTTL(10 * 1024 * 1024)
+// TestCacheWithTTL_SetWithExpireAt 测试使用绝对过期时间写入
+func TestCacheWithTTL_SetWithExpireAt(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
 	defer cache.Close()
 
-	const numGoroutines = 50
-	const numKeys = 100
+	expireAt := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	if err := cache.SetWithExpireAt("key", []byte("value"), expireAt); err != nil {
+		t.Fatalf("SetWithExpireAt failed: %v", err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get = %q, want value", got)
+	}
+	stored, _ := cache.(*CacheWithTTL).decodeExpireAt(cache.(*CacheWithTTL).cache.Get("key"))
+	if stored != expireAt.UnixMilli() {
+		t.Errorf("stored expireAt = %d, want %d", stored, expireAt.UnixMilli())
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(numGoroutines * 2)
+	// 零值和过去的时间立即过期
+	for _, expireAt := range []time.Time{{}, time.Now().Add(-time.Second)} {
+		cache.SetWithExpireAt("past", []byte("value"), expireAt)
+		if cache.Has("past") {
+			t.Errorf("key with expireAt %v should be expired", expireAt)
+		}
+	}
+}
 
-	// 并发写入
-	for i := 0; i < numGoroutines; i++ {
-		go func(id int) {
-			defer wg.Done()
-			for j := 0; j < numKeys; j++ {
-				key := string(rune(id*numKeys + j))
-				value := []byte{byte(id), byte(j)}
-				err := cache.Set(key, value, time.Second)
-				if err != nil {
-					t.Errorf("Set failed: %v", err)
-				}
-			}
-		}(i)
+// TestCacheWithTTL_TTL 测试查询剩余时间
+func TestCacheWithTTL_TTL(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Minute)
+	ttl, ok := cache.TTL("key")
+	if !ok || ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("TTL = %v, %v, want about 1m, true", ttl, ok)
 	}
 
-	// 并发读取
-	for i := 0; i < numGoroutines; i++ {
-		go func(id int) {
-			defer wg.Done()
-			for j := 0; j < numKeys; j++ {
-				key := string(rune(id*numKeys + j))
-				_ = cache.Get(key)
-				_ = cache.Has(key)
-			}
-		}(i)
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if ttl, ok := cache.TTL(key); ok || ttl != 0 {
+			t.Errorf("TTL(%q) = %v, %v, want 0, false", key, ttl, ok)
+		}
 	}
 
-	wg.Wait()
+	// 不足 1 毫秒的剩余时间向上取整
+	if got := remaining(time.Now().UnixMilli()+1, time.Now()); got < time.Millisecond {
+		t.Errorf("remaining = %v, want >= 1ms", got)
+	}
 }
 
-// TestCacheWithTTL_ExpirationRace 测试过期竞态条件
-func TestCacheWithTTL_ExpirationRace(t *testing.T) {
-	cache := NewCacheWithTTL(1024 * 1024)
+// TestCacheWithTTL_Expire 测试修改过期时间而不重写值
+func TestCacheWithTTL_Expire(t *testing.T) {
+	cache, clock := newFakeClockCache()
 	defer cache.Close()
 
-	key := "test-key"
-	value := []byte("test-value")
+	// 即将过期的 key 被延长
+	cache.Set("key", []byte("value"), 50*time.Millisecond)
+	if ok, err := cache.Expire("key", time.Minute); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v, want true, nil", ok, err)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Expire = %q, want value", got)
+	}
+	assertTTL(t, cache, "key", time.Minute)
 
-	// 设置一个很短的 TTL
-	err := cache.Set(key, value, 50*time.Millisecond)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+	// 缺失和已过期的 key 返回 false
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if ok, err := cache.Expire(key, time.Minute); err != nil || ok {
+			t.Errorf("Expire(%q) = %v, %v, want false, nil", key, ok, err)
+		}
+	}
+	if cache.Has("expired") {
+		t.Error("Expire revived an expired key")
 	}
 
-	// 并发读取，可能在过期过程中
-	var wg sync.WaitGroup
-	const numGoroutines = 10
-	wg.Add(numGoroutines)
+	// 非正数 ttl 立即过期
+	if ok, err := cache.Expire("key", 0); err != nil || !ok {
+		t.Fatalf("Expire(0) = %v, %v, want true, nil", ok, err)
+	}
+	if cache.Has("key") {
+		t.Error("key should be gone after Expire(0)")
+	}
+}
 
-	for i := 0; i < numGoroutines; i++ {
+// TestCacheWithTTL_ExpireConcurrentGet 测试并发 Get 不会读到损坏的 header
+func TestCacheWithTTL_ExpireConcurrentGet(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	value := []byte("session-data")
+	cache.Set("key", value, time.Minute)
+
+	const numReaders = 10
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(numReaders)
+	for i := 0; i < numReaders; i++ {
 		go func() {
 			defer wg.Done()
-			for j := 0; j < 100; j++ {
-				_ = cache.Get(key)
-				_ = cache.Has(key)
-				time.Sleep(time.Millisecond)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if got := cache.Get("key"); !bytes.Equal(got, value) {
+					t.Errorf("Get = %q during Expire, want %q", got, value)
+					return
+				}
 			}
 		}()
 	}
 
+	for i := 0; i < 1000; i++ {
+		if ok, err := cache.Expire("key", time.Minute+time.Duration(i)*time.Millisecond); err != nil || !ok {
+			t.Fatalf("Expire = %v, %v, want true, nil", ok, err)
+		}
+	}
+	close(stop)
 	wg.Wait()
 }
 
-// TestCacheWithTTL_LargeValue 测试大值
-func TestCacheWithTTL_LargeValue(t *testing.T) {
-	cache := NewCacheWithTTL(10 * 1024 * 1024)
+// TestCacheWithTTL_Persist 测试移除 TTL
+func TestCacheWithTTL_Persist(t *testing.T) {
+	cache, clock := newFakeClockCache()
 	defer cache.Close()
 
-	key := "test-key"
-	value := make([]byte, 10*1024) // 10KB
-	for i := range value {
-		value[i] = byte(i % 256)
+	cache.Set("key", []byte("value"), 50*time.Millisecond)
+	if ok, err := cache.Persist("key"); err != nil || !ok {
+		t.Fatalf("Persist = %v, %v, want true, nil", ok, err)
 	}
-
-	err := cache.Set(key, value, time.Second)
-	if err != nil {
-		t.Fatalf("Set failed: %v", err)
+	clock.Advance(100 * time.Millisecond)
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Persist = %q, want value", got)
 	}
-
-	got := cache.Get(key)
-	if !bytes.Equal(got, value) {
-		t.Error("Large value mismatch")
+	if ttl, ok := cache.TTL("key"); !ok || ttl != math.MaxInt64 {
+		t.Errorf("TTL after Persist = %v, %v, want max duration, true", ttl, ok)
 	}
-}
-
-// TestCacheWithTTL_WrapUnwrap 测试包装和解包函数
-func TestCacheWithTTL_WrapUnwrap(t *testing.T) {
-	original := []byte("test-data")
-	ttl := time.Second
 
-	// 包装
-	wrapped := wrapCacheWithTTL(original, ttl)
-	if len(wrapped) != 8+len(original) {
-		t.Errorf("Wrapped length %d, want %d", len(wrapped), 8+len(original))
+	// Expire 可以重新设置 TTL
+	if ok, err := cache.Expire("key", time.Minute); err != nil || !ok {
+		t.Fatalf("Expire = %v, %v, want true, nil", ok, err)
 	}
+	assertTTL(t, cache, "key", time.Minute)
 
-	// 立即解包应该成功
-	unwrapped, ok := unwrapCacheWithTTL(wrapped)
-	if !ok {
-		t.Error("unwrapCacheWithTTL returned false")
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if ok, err := cache.Persist(key); err != nil || ok {
+			t.Errorf("Persist(%q) = %v, %v, want false, nil", key, ok, err)
+		}
 	}
-	if !bytes.Equal(unwrapped, original) {
-		t.Errorf("Unwrapped %v, want %v", unwrapped, original)
+	if cache.Has("expired") {
+		t.Error("Persist revived an expired key")
 	}
 }
 
-// TestCacheWithTTL_WrapUnwrapExpired 测试过期解包
-func TestCacheWithTTL_WrapUnwrapExpired(t *testing.T) {
-	original := []byte("test-data")
-	ttl := -time.Second // 负 TTL，立即过期
-
-	// 包装
-	wrapped := wrapCacheWithTTL(original, ttl)
+// TestCacheWithTTL_Touch 测试按原始时长刷新 TTL
+func TestCacheWithTTL_Touch(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
 
-	// 解包应该失败（已过期）
-	unwrapped, ok := unwrapCacheWithTTL(wrapped)
-	if ok {
-		t.Error("unwrapCacheWithTTL returned true for expired data")
+	cache.Set("key", []byte("value"), 200*time.Millisecond)
+	clock.Advance(150 * time.Millisecond)
+	if ok, err := cache.Touch("key"); err != nil || !ok {
+		t.Fatalf("Touch = %v, %v, want true, nil", ok, err)
 	}
-	if unwrapped != nil {
-		t.Errorf("Unwrapped %v, want nil", unwrapped)
+	clock.Advance(100 * time.Millisecond)
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Touch = %q, want value", got)
 	}
-}
 
-// TestCacheWithTTL_WrapUnwrapInvalid 测试无效数据解包
-func TestCacheWithTTL_WrapUnwrapInvalid(t *testing.T) {
-	// 测试太短的数据
-	shortData := []byte{1, 2, 3}
-	unwrapped, ok := unwrapCacheWithTTL(shortData)
-	if ok {
-		t.Error("unwrapCacheWithTTL returned true for short data")
+	// Expire 之后按新的时长刷新
+	cache.Expire("key", time.Minute)
+	cache.Expire("key", time.Second)
+	if ok, err := cache.Touch("key"); err != nil || !ok {
+		t.Fatalf("Touch = %v, %v, want true, nil", ok, err)
 	}
-	if unwrapped != nil {
-		t.Errorf("Unwrapped %v, want nil", unwrapped)
+	assertTTL(t, cache, "key", time.Second)
+
+	// 没有时长的 entry 返回 ErrNoTTL
+	cache.SetWithExpireAt("deadline", []byte("value"), time.Now().Add(time.Minute))
+	cache.Set("persisted", []byte("value"), time.Minute)
+	cache.Persist("persisted")
+	for _, key := range []string{"deadline", "persisted"} {
+		if ok, err := cache.Touch(key); !errors.Is(err, ErrNoTTL) || ok {
+			t.Errorf("Touch(%q) = %v, %v, want false, %v", key, ok, err, ErrNoTTL)
+		}
 	}
 
-	// 测试 nil
-	unwrapped, ok = unwrapCacheWithTTL(nil)
-	if ok {
-		t.Error("unwrapCacheWithTTL returned true for nil")
-	}
-	if unwrapped != nil {
-		t.Errorf("Unwrapped %v, want nil", unwrapped)
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if ok, err := cache.Touch(key); err != nil || ok {
+			t.Errorf("Touch(%q) = %v, %v, want false, nil", key, ok, err)
+		}
 	}
 }
 
-// BenchmarkCacheWithTTL_Set 基准测试 Set 操作
-func BenchmarkCacheWithTTL_Set(b *testing.B) {
-	cache := NewCacheWithTTL(100 * 1024 * 1024)
+// TestCacheWithTTL_GetWithTTL 测试同时返回值和剩余时间
+func TestCacheWithTTL_GetWithTTL(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
 	defer cache.Close()
 
-	key := "bench-key"
-	value := []byte("bench-value")
+	cache.Set("key", []byte("value"), time.Minute)
+	value, ttl, ok := cache.GetWithTTL("key")
+	if !ok || !bytes.Equal(value, []byte("value")) {
+		t.Fatalf("GetWithTTL = %q, %v, want value, true", value, ok)
+	}
+	if ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("ttl = %v, want about 1m", ttl)
+	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		cache.Set(key, value, time.Second)
+	// 返回的是副本
+	value[0] = 'X'
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("modifying the result changed the cache: %q", got)
 	}
-}
 
-// BenchmarkCacheWithTTL_Get 基准测试 Get 操作
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"expired", "missing"} {
+		if value, ttl, ok := cache.GetWithTTL(key); value != nil || ttl != 0 || ok {
+			t.Errorf("GetWithTTL(%q) = %q, %v, %v, want nil, 0, false", key, value, ttl, ok)
+		}
+	}
+}
+
+// TestCacheWithTTL_Delete 测试删除操作
+func TestCacheWithTTL_Delete(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := []byte("test-value")
+
+	// 设置 key
+	err := cache.Set(key, value, time.Second)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// 验证存在
+	if !cache.Has(key) {
+		t.Error("Key should exist before delete")
+	}
+
+	// 删除 key
+	err = cache.Delete(key)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// 验证已删除
+	if cache.Has(key) {
+		t.Error("Key should not exist after delete")
+	}
+
+	got := cache.Get(key)
+	if got != nil {
+		t.Errorf("Get returned %v after delete, want nil", got)
+	}
+}
+
+// TestCacheWithTTL_CloseTerminal 测试关闭后读取落空、写入返回 ErrClosed，且可重复关闭
+func TestCacheWithTTL_CloseTerminal(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithCleanupInterval(time.Millisecond), WithExpireProbes(2))
+	cache.Set("key", []byte("value"), time.Hour)
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+
+	if cache.Has("key") || cache.HasMulti([]string{"key"})[0] {
+		t.Error("reads after Close should miss")
+	}
+	if _, _, ok := cache.GetStale("key"); ok {
+		t.Error("GetStale after Close should miss")
+	}
+	if err := cache.Set("key", []byte("value"), time.Hour); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set after Close = %v, want ErrClosed", err)
+	}
+	if _, err := cache.GetOrCompute("key", time.Hour, func() ([]byte, error) {
+		return []byte("value"), nil
+	}); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetOrCompute after Close = %v, want ErrClosed", err)
+	}
+	if _, err := cache.Compact(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Compact after Close = %v, want ErrClosed", err)
+	}
+}
+
+// TestCacheWithTTL_CloseConcurrent 测试与读写并发关闭
+func TestCacheWithTTL_CloseConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithCleanupInterval(time.Millisecond))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			key := string(rune('a' + id))
+			for {
+				if err := cache.Set(key, []byte("value"), time.Minute); err != nil {
+					if !errors.Is(err, ErrClosed) {
+						t.Errorf("Set = %v, want nil or ErrClosed", err)
+					}
+					return
+				}
+				cache.Get(key)
+			}
+		}(i)
+	}
+
+	cache.Close()
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if cache.Has(string(rune('a' + i))) {
+			t.Errorf("key %c is readable after Close", 'a'+i)
+		}
+	}
+}
+
+// TestCacheWithTTL_CloseHammer 测试 Close 与并发读写、后台清理和 Compact 交错
+func TestCacheWithTTL_CloseHammer(t *testing.T) {
+	for round := 0; round < 5; round++ {
+		cache := NewCacheWithTTL(1024*1024, WithCleanupInterval(time.Millisecond))
+		value := bytes.Repeat([]byte("v"), 1024)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			key := string(rune('a' + i))
+			go func() {
+				defer wg.Done()
+				for {
+					if err := cache.Set(key, value, time.Millisecond); errors.Is(err, ErrClosed) {
+						return
+					} else if err != nil {
+						t.Errorf("Set = %v, want nil or ErrClosed", err)
+						return
+					}
+					cache.Delete(key)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if got, err := cache.GetE(key); err == nil && !bytes.Equal(got, value) {
+						t.Errorf("GetE returned a torn value of %d bytes", len(got))
+						return
+					} else if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrClosed) {
+						t.Errorf("GetE = %v, want a hit, ErrNotFound or ErrClosed", err)
+						return
+					}
+					cache.HasMulti([]string{key})
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := cache.Compact(); errors.Is(err, ErrClosed) {
+					return
+				}
+			}
+		}()
+
+		time.Sleep(5 * time.Millisecond) // 让读写先跑起来
+		cache.Close()
+		if _, err := cache.GetE("a"); !errors.Is(err, ErrClosed) {
+			t.Errorf("GetE after Close = %v, want %v", err, ErrClosed)
+		}
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// TestCacheWithTTL_CloseWaitsForReload 测试 Close 等待后台刷新结束，之后不再启动新的刷新
+func TestCacheWithTTL_CloseWaitsForReload(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock))
+	cache.SetWithSoftTTL("key", []byte("stale"), time.Second, time.Minute)
+	clock.Advance(2 * time.Second)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	if got, err := cache.GetOrCompute("key", time.Minute, func() ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("fresh"), nil
+	}); err != nil || !bytes.Equal(got, []byte("stale")) {
+		t.Fatalf("GetOrCompute = %q, %v, want the stale value", got, err)
+	}
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		cache.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the reload finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+
+	// 关闭后不再启动后台刷新
+	cache.(*CacheWithTTL).revalidate("key", time.Minute, time.Second, func() ([]byte, error) {
+		t.Error("reload started after Close")
+		return nil, nil
+	})
+	if cache.(*CacheWithTTL).flights.m["key"] != nil {
+		t.Error("flight registered after Close")
+	}
+}
+
+// TestCacheWithTTL_Reset 测试 Reset 清空 entry、key 索引和统计后缓存仍可使用
+func TestCacheWithTTL_Reset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("key", []byte("value"), time.Minute)
+	cache.Set("expired", []byte("value"), time.Second)
+	clock.Advance(2 * time.Second)
+	cache.Get("expired")
+	if cache.Stats().ExpiredReads != 1 || cache.LazyPurged() != 1 {
+		t.Fatalf("Stats = %+v, LazyPurged = %d, want an expired read", cache.Stats(), cache.LazyPurged())
+	}
+
+	if err := cache.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	// 先检查 Stats，读取会从 pool 分配 buffer；fastcache 只保留容量
+	want := Stats{Fastcache: fastcache.Stats{MaxBytesSize: uint64(cache.EffectiveMaxBytes())}}
+	if got := cache.Stats(); got != want || cache.LazyPurged() != 0 {
+		t.Errorf("Stats = %+v, LazyPurged = %d after Reset, want zero", got, cache.LazyPurged())
+	}
+	if cache.Has("key") {
+		t.Error("entries should be gone after Reset")
+	}
+	if n := c.index.len(); n != 0 {
+		t.Errorf("index holds %d keys after Reset, want 0", n)
+	}
+
+	cache.Set("key", []byte("again"), time.Minute)
+	if got, ttl, ok := cache.GetWithTTL("key"); !ok || !bytes.Equal(got, []byte("again")) || ttl != time.Minute {
+		t.Errorf("GetWithTTL after Reset = %q, %v, %v, want again, 1m, true", got, ttl, ok)
+	}
+	if rep, err := cache.Compact(); err != nil || rep.Retained != 1 {
+		t.Errorf("Compact after Reset = %+v, %v, want 1 retained", rep, err)
+	}
+	if err := cache.AsICache(time.Minute).Reset(); err != nil || cache.Has("key") {
+		t.Errorf("Reset through the ICache view = %v, want the entries gone", err)
+	}
+}
+
+// TestCacheWithTTL_MDelete 测试批量删除，过期的 key 不计数
+func TestCacheWithTTL_MDelete(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("value-a"), time.Second)
+	cache.Set("b", []byte("value-b"), time.Second)
+	cache.Set("expired", []byte("value-x"), -time.Second)
+
+	n, err := cache.MDelete("a", "missing", "expired")
+	if err != nil {
+		t.Fatalf("MDelete failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("MDelete returned %d, want 1", n)
+	}
+	// 过期的数据也被物理删除
+	if got := cache.Inspect("expired"); got != EntryAbsent {
+		t.Errorf("Inspect(expired) = %v, want %v", got, EntryAbsent)
+	}
+	if cache.Has("a") {
+		t.Error("deleted key still exists")
+	}
+	if !cache.Has("b") {
+		t.Error("untouched key was deleted")
+	}
+}
+
+// TestCacheWithTTL_GetOrSet 测试 GetOrSet，过期的 key 视为不存在
+func TestCacheWithTTL_GetOrSet(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	value := []byte("value-1")
+	got, stored, err := cache.GetOrSet("key", value, time.Second)
+	if err != nil {
+		t.Fatalf("GetOrSet failed: %v", err)
+	}
+	if !stored || !bytes.Equal(got, value) {
+		t.Errorf("GetOrSet = %q, %v, want %q, true", got, stored, value)
+	}
+
+	got, stored, _ = cache.GetOrSet("key", []byte("value-2"), time.Second)
+	if stored || !bytes.Equal(got, value) {
+		t.Errorf("GetOrSet = %q, %v, want %q, false", got, stored, value)
+	}
+
+	// 过期的 key 会被覆盖
+	cache.Set("expired", []byte("old"), -time.Second)
+	got, stored, _ = cache.GetOrSet("expired", []byte("new"), time.Second)
+	if !stored || !bytes.Equal(got, []byte("new")) {
+		t.Errorf("GetOrSet(expired) = %q, %v, want new, true", got, stored)
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get(expired) = %q, want new", got)
+	}
+}
+
+// TestCacheWithTTL_GetOrSetConcurrent 测试并发 GetOrSet 只有一次写入
+func TestCacheWithTTL_GetOrSetConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	storedCount := 0
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			_, stored, err := cache.GetOrSet("key", []byte{byte(id)}, time.Second)
+			if err != nil {
+				t.Errorf("GetOrSet failed: %v", err)
+			}
+			if stored {
+				mu.Lock()
+				storedCount++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if storedCount != 1 {
+		t.Errorf("stored %d times, want 1", storedCount)
+	}
+}
+
+// TestCacheWithTTL_GetOrCompute 测试 GetOrCompute 的基本行为
+func TestCacheWithTTL_GetOrCompute(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	calls := 0
+	loader := func() ([]byte, error) {
+		calls++
+		return []byte("loaded"), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.GetOrCompute("key", time.Second, loader)
+		if err != nil {
+			t.Fatalf("GetOrCompute failed: %v", err)
+		}
+		if !bytes.Equal(got, []byte("loaded")) {
+			t.Errorf("GetOrCompute = %q, want loaded", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want 1", calls)
+	}
+
+	// loader 返回 nil 时原样存为 nil
+	got, err := cache.GetOrCompute("nil", time.Second, func() ([]byte, error) {
+		return nil, nil
+	})
+	if err != nil || got != nil {
+		t.Errorf("GetOrCompute(nil) = %#v, %v, want nil, nil", got, err)
+	}
+	if got, ok := cache.GetOK("nil"); !ok || got != nil {
+		t.Errorf("GetOK(nil) = %#v, %v, want nil, true", got, ok)
+	}
+}
+
+// TestCacheWithTTL_GetOrComputeError 测试 loader 的错误不会被缓存
+func TestCacheWithTTL_GetOrComputeError(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	loadErr := errors.New("db down")
+	_, err := cache.GetOrCompute("key", time.Second, func() ([]byte, error) {
+		return nil, loadErr
+	})
+	if !errors.Is(err, loadErr) {
+		t.Fatalf("GetOrCompute returned %v, want %v", err, loadErr)
+	}
+	if cache.Has("key") {
+		t.Error("loader error should not store anything")
+	}
+
+	got, err := cache.GetOrCompute("key", time.Second, func() ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil || !bytes.Equal(got, []byte("ok")) {
+		t.Errorf("GetOrCompute after error = %q, %v, want ok, nil", got, err)
+	}
+}
+
+// TestCacheWithTTL_GetOrComputeSingleflight 测试并发 miss 只调用一次 loader
+func TestCacheWithTTL_GetOrComputeSingleflight(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 50
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func() ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("loaded"), nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			got, err := cache.GetOrCompute("key", time.Second, loader)
+			if err != nil || !bytes.Equal(got, []byte("loaded")) {
+				t.Errorf("GetOrCompute = %q, %v, want loaded, nil", got, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+}
+
+// TestCacheWithTTL_GetOrComputeSharedError 测试等待中的调用方都收到 loader 的错误
+func TestCacheWithTTL_GetOrComputeSharedError(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 10
+	loadErr := errors.New("db down")
+	release := make(chan struct{})
+	loader := func() ([]byte, error) {
+		<-release
+		return nil, loadErr
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetOrCompute("key", time.Second, loader); !errors.Is(err, loadErr) {
+				t.Errorf("GetOrCompute returned %v, want %v", err, loadErr)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+// TestCacheWithTTL_GetOrComputePanic 测试 loader panic 后不会卡住后续调用
+func TestCacheWithTTL_GetOrComputePanic(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("loader panic was not propagated")
+			}
+		}()
+		cache.GetOrCompute("key", time.Second, func() ([]byte, error) {
+			panic("boom")
+		})
+	}()
+
+	got, err := cache.GetOrCompute("key", time.Second, func() ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil || !bytes.Equal(got, []byte("ok")) {
+		t.Errorf("GetOrCompute after panic = %q, %v, want ok, nil", got, err)
+	}
+}
+
+// TestCacheWithTTL_MGetOrCompute 测试一次 loader 调用加载所有 miss
+func TestCacheWithTTL_MGetOrCompute(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("cached-a"), time.Minute)
+	cache.Set("expired", []byte("old"), -time.Second)
+
+	var calls [][]string
+	loader := func(missing []string) (map[string][]byte, error) {
+		calls = append(calls, missing)
+		return map[string][]byte{
+			"b":       []byte("loaded-b"),
+			"expired": []byte("loaded-expired"),
+		}, nil
+	}
+
+	got, err := cache.MGetOrCompute([]string{"a", "b", "expired", "omitted", "b"}, time.Minute, loader)
+	if err != nil {
+		t.Fatalf("MGetOrCompute failed: %v", err)
+	}
+	if want := [][]string{{"b", "expired", "omitted"}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("loader calls = %q, want %q", calls, want)
+	}
+	want := map[string][]byte{
+		"a":       []byte("cached-a"),
+		"b":       []byte("loaded-b"),
+		"expired": []byte("loaded-expired"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MGetOrCompute = %q, want %q", got, want)
+	}
+
+	// 加载的值按 ttl 写入缓存，loader 未返回的 key 不写入
+	assertTTL(t, cache, "b", time.Minute)
+	if cache.Has("omitted") {
+		t.Error("omitted key was stored")
+	}
+
+	// 全部命中时不调用 loader
+	calls = nil
+	cache.MGetOrCompute([]string{"a", "b"}, time.Minute, loader)
+	if calls != nil {
+		t.Errorf("loader called on all hits: %q", calls)
+	}
+}
+
+// TestCacheWithTTL_MGetOrComputeError 测试 loader 出错时仍返回命中的值
+func TestCacheWithTTL_MGetOrComputeError(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("cached-a"), time.Minute)
+	loadErr := errors.New("db down")
+
+	got, err := cache.MGetOrCompute([]string{"a", "b", "c"}, time.Minute, func([]string) (map[string][]byte, error) {
+		return nil, loadErr
+	})
+	if !errors.Is(err, loadErr) {
+		t.Errorf("MGetOrCompute returned %v, want %v", err, loadErr)
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || !slices.Equal(batchErr.Keys(), []string{"b", "c"}) {
+		t.Errorf("failed keys = %v, want [b c]", err)
+	}
+	if want := map[string][]byte{"a": []byte("cached-a")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MGetOrCompute = %q, want %q", got, want)
+	}
+	if cache.Has("b") {
+		t.Error("failed key was stored")
+	}
+}
+
+// TestCacheWithTTL_MGetOrComputeDedupe 测试并发调用中重叠的 key 只加载一次
+func TestCacheWithTTL_MGetOrComputeDedupe(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(missing []string) (map[string][]byte, error) {
+		mu.Lock()
+		res := make(map[string][]byte)
+		for _, key := range missing {
+			loads[key]++
+			res[key] = []byte("loaded-" + key)
+		}
+		mu.Unlock()
+		if slices.Contains(missing, "a") {
+			close(entered)
+			<-release
+		}
+		return res, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		got, err := cache.MGetOrCompute([]string{"a", "b"}, time.Minute, loader)
+		if err != nil || len(got) != 2 {
+			t.Errorf("MGetOrCompute(a, b) = %q, %v", got, err)
+		}
+	}()
+	<-entered
+
+	// 第二个调用只加载 c，等待第一个调用加载的 b
+	go func() {
+		defer wg.Done()
+		got, err := cache.MGetOrCompute([]string{"b", "c"}, time.Minute, loader)
+		if err != nil || !bytes.Equal(got["b"], []byte("loaded-b")) || !bytes.Equal(got["c"], []byte("loaded-c")) {
+			t.Errorf("MGetOrCompute(b, c) = %q, %v", got, err)
+		}
+	}()
+	// 单 key 的 GetOrCompute 同样等待
+	go func() {
+		defer wg.Done()
+		got, err := cache.GetOrCompute("a", time.Minute, func() ([]byte, error) {
+			t.Error("GetOrCompute loaded a key already in flight")
+			return nil, nil
+		})
+		if err != nil || !bytes.Equal(got, []byte("loaded-a")) {
+			t.Errorf("GetOrCompute(a) = %q, %v", got, err)
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for key, n := range loads {
+		if n != 1 {
+			t.Errorf("%q loaded %d times, want 1", key, n)
+		}
+	}
+}
+
+// TestCacheWithTTL_SetNX 测试 SetNX，过期的 key 视为不存在
+func TestCacheWithTTL_SetNX(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	ok, err := cache.SetNX("key", []byte("first"), time.Second)
+	if err != nil || !ok {
+		t.Fatalf("SetNX = %v, %v, want true, nil", ok, err)
+	}
+	if ok, _ := cache.SetNX("key", []byte("second"), time.Second); ok {
+		t.Error("SetNX on live key returned true")
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("first")) {
+		t.Errorf("Get = %q, want first", got)
+	}
+
+	cache.Set("expired", []byte("old"), -time.Second)
+	if ok, _ := cache.SetNX("expired", []byte("new"), time.Second); !ok {
+		t.Error("SetNX on expired key returned false")
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get(expired) = %q, want new", got)
+	}
+}
+
+// TestCacheWithTTL_SetNXConcurrent 测试并发 SetNX 只有一个成功
+func TestCacheWithTTL_SetNXConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	var wg sync.WaitGroup
+	var winners atomic.Int32
+
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			if ok, _ := cache.SetNX("key", []byte{byte(id)}, time.Second); ok {
+				winners.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := winners.Load(); got != 1 {
+		t.Errorf("%d SetNX calls succeeded, want 1", got)
+	}
+}
+
+// TestCacheWithTTL_SetXX 测试 SetXX，过期的 key 视为不存在
+func TestCacheWithTTL_SetXX(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if ok, _ := cache.SetXX("key", []byte("first"), time.Second); ok {
+		t.Error("SetXX on missing key returned true")
+	}
+	if cache.Has("key") {
+		t.Error("SetXX stored a missing key")
+	}
+
+	cache.Set("key", []byte("first"), time.Second)
+	if ok, _ := cache.SetXX("key", []byte("second"), time.Second); !ok {
+		t.Error("SetXX on live key returned false")
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("second")) {
+		t.Errorf("Get = %q, want second", got)
+	}
+
+	cache.Set("expired", []byte("old"), -time.Second)
+	if ok, _ := cache.SetXX("expired", []byte("new"), time.Second); ok {
+		t.Error("SetXX on expired key returned true")
+	}
+	if cache.Has("expired") {
+		t.Error("SetXX revived an expired key")
+	}
+}
+
+// TestCacheWithTTL_SetReplaced 测试覆盖过期的 key 视为插入
+func TestCacheWithTTL_SetReplaced(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if replaced, _ := cache.SetReplaced("key", []byte("first"), time.Second); replaced {
+		t.Error("SetReplaced on missing key returned true")
+	}
+	if replaced, _ := cache.SetReplaced("key", []byte("second"), time.Second); !replaced {
+		t.Error("SetReplaced on live key returned false")
+	}
+
+	cache.Set("expired", []byte("old"), -time.Second)
+	if replaced, _ := cache.SetReplaced("expired", []byte("new"), time.Second); replaced {
+		t.Error("SetReplaced on expired key returned true")
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get = %q, want new", got)
+	}
+}
+
+// TestCacheWithTTL_GetAndDelete 测试读取并删除，过期时返回 nil 但仍删除
+func TestCacheWithTTL_GetAndDelete(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("token"), time.Second)
+	if got := cache.GetAndDelete("key"); !bytes.Equal(got, []byte("token")) {
+		t.Errorf("GetAndDelete = %q, want token", got)
+	}
+	if cache.Inspect("key") != EntryAbsent {
+		t.Error("key still exists after GetAndDelete")
+	}
+
+	cache.Set("expired", []byte("token"), -time.Second)
+	if got := cache.GetAndDelete("expired"); got != nil {
+		t.Errorf("GetAndDelete(expired) = %q, want nil", got)
+	}
+	if cache.Inspect("expired") != EntryAbsent {
+		t.Error("expired key was not deleted")
+	}
+}
+
+// TestCacheWithTTL_GetAndDeleteConcurrent 测试并发 GetAndDelete 只有一个拿到值
+func TestCacheWithTTL_GetAndDeleteConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	cache.Set("token", []byte("secret"), time.Second)
+
+	var wg sync.WaitGroup
+	var winners atomic.Int32
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if cache.GetAndDelete("token") != nil {
+				winners.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := winners.Load(); got != 1 {
+		t.Errorf("%d goroutines got the token, want 1", got)
+	}
+}
+
+// TestCacheWithTTL_Swap 测试 Swap，过期的旧值不返回
+func TestCacheWithTTL_Swap(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("v1"), time.Second)
+	old, existed, err := cache.Swap("key", []byte("v2"), time.Second)
+	if err != nil || !existed || !bytes.Equal(old, []byte("v1")) {
+		t.Errorf("Swap = %q, %v, %v, want v1, true, nil", old, existed, err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("v2")) {
+		t.Errorf("Get = %q, want v2", got)
+	}
+
+	cache.Set("expired", []byte("old"), -time.Second)
+	old, existed, _ = cache.Swap("expired", []byte("new"), time.Second)
+	if existed || old != nil {
+		t.Errorf("Swap(expired) = %q, %v, want nil, false", old, existed)
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get(expired) = %q, want new", got)
+	}
+}
+
+// TestCacheWithTTL_CompareAndSwap 测试 CAS，过期的 key 视为不存在
+func TestCacheWithTTL_CompareAndSwap(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if ok, _ := cache.CompareAndSwap("key", nil, []byte("v1"), time.Second); !ok {
+		t.Fatal("CompareAndSwap(nil) on missing key returned false")
+	}
+	if ok, _ := cache.CompareAndSwap("key", []byte("wrong"), []byte("v2"), time.Second); ok {
+		t.Error("CompareAndSwap with mismatched value returned true")
+	}
+	if ok, _ := cache.CompareAndSwap("key", []byte("v1"), []byte("v2"), time.Second); !ok {
+		t.Error("CompareAndSwap with matching value returned false")
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("v2")) {
+		t.Errorf("Get = %q, want v2", got)
+	}
+
+	// 过期的值不能被匹配，但 nil 可以匹配过期的 key
+	cache.Set("expired", []byte("old"), -time.Second)
+	if ok, _ := cache.CompareAndSwap("expired", []byte("old"), []byte("new"), time.Second); ok {
+		t.Error("CompareAndSwap matched an expired value")
+	}
+	if ok, _ := cache.CompareAndSwap("expired", nil, []byte("new"), time.Second); !ok {
+		t.Error("CompareAndSwap(nil) did not match an expired key")
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get(expired) = %q, want new", got)
+	}
+}
+
+// TestCacheWithTTL_CompareAndDelete 测试按值删除，过期的 key 不会匹配
+func TestCacheWithTTL_CompareAndDelete(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("v1"), time.Second)
+	if ok, _ := cache.CompareAndDelete("key", []byte("v2")); ok {
+		t.Error("CompareAndDelete with mismatched value returned true")
+	}
+	if ok, _ := cache.CompareAndDelete("key", []byte("v1")); !ok {
+		t.Error("CompareAndDelete with matching value returned false")
+	}
+	if cache.Inspect("key") != EntryAbsent {
+		t.Error("key still exists after CompareAndDelete")
+	}
+
+	cache.Set("expired", []byte("v1"), -time.Second)
+	if ok, _ := cache.CompareAndDelete("expired", []byte("v1")); ok {
+		t.Error("CompareAndDelete matched an expired value")
+	}
+	if cache.Inspect("expired") != EntryStale {
+		t.Error("CompareAndDelete removed a non-matching expired entry")
+	}
+}
+
+// TestCacheWithTTL_CompareAndDeleteRace 测试 CompareAndDelete 不会删除被刷新过的值
+func TestCacheWithTTL_CompareAndDeleteRace(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numRounds = 200
+	for i := 0; i < numRounds; i++ {
+		cache.Set("key", []byte("mine"), time.Second)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.CompareAndSwap("key", []byte("mine"), []byte("theirs"), time.Second)
+		}()
+		var deleted bool
+		go func() {
+			defer wg.Done()
+			deleted, _ = cache.CompareAndDelete("key", []byte("mine"))
+		}()
+		wg.Wait()
+
+		// 两者只能有一个成功：要么删除了，要么留下刷新后的值
+		got, ok := cache.GetOK("key")
+		if deleted && ok {
+			t.Fatalf("round %d: deleted but key holds %q", i, got)
+		}
+		if !deleted && !bytes.Equal(got, []byte("theirs")) {
+			t.Fatalf("round %d: not deleted but key holds %q, want theirs", i, got)
+		}
+	}
+}
+
+// TestCacheWithTTL_SetValueTooLarge 测试单条上限计入 TTL 头部，恰好达到上限可存储，超出一个字节返回 ErrValueTooLarge
+func TestCacheWithTTL_SetValueTooLarge(t *testing.T) {
+	cache, _ := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	// 时钟不动，头部大小固定
+	hdr, err := c.wrap([]byte{}, time.Minute)
+	if err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	key := "key"
+	fits := make([]byte, maxKeyValueSize-len(key)-len(hdr))
+	if err := cache.Set(key, fits, time.Minute); err != nil {
+		t.Fatalf("Set at the limit failed: %v", err)
+	}
+	if got := cache.Get(key); len(got) != len(fits) {
+		t.Fatalf("Get at the limit returned %d bytes, want %d", len(got), len(fits))
+	}
+
+	tooLarge := make([]byte, len(fits)+1)
+	if err := cache.Set(key, tooLarge, time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set past the limit returned %v, want %v", err, ErrValueTooLarge)
+	}
+	if got := cache.Get(key); len(got) != len(fits) {
+		t.Errorf("Get after failed Set returned %d bytes, want the old %d", len(got), len(fits))
+	}
+	if _, err := cache.SetNX("other", tooLarge, time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("SetNX past the limit returned %v, want %v", err, ErrValueTooLarge)
+	}
+}
+
+// TestCacheWithTTL_SetPooledEntry 测试在 pool 的 buffer 中编码的 entry 与 encode 的结果逐字节相同
+func TestCacheWithTTL_SetPooledEntry(t *testing.T) {
+	cache, _ := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	values := [][]byte{nil, {}, []byte("value"), randomBytes(1000), randomBytes(8 * 1024), randomBytes(60 * 1024)}
+	for i, value := range values {
+		key := fmt.Sprintf("key-%d", i)
+		for _, tc := range []struct {
+			name string
+			set  func() error
+			h    header
+		}{
+			{"Set", func() error { return cache.Set(key, value, time.Minute) }, c.ttlHeader(time.Minute)},
+			{"SetNX", func() error {
+				cache.Delete(key)
+				_, err := cache.SetNX(key, value, time.Minute)
+				return err
+			}, c.ttlHeader(time.Minute)},
+			{"SetWithSoftTTL", func() error { return cache.SetWithSoftTTL(key, value, time.Second, time.Minute) },
+				header{expireAt: c.ttlHeader(time.Minute).expireAt, ttl: time.Minute, createdAt: c.now(), stale: time.Minute - time.Second}},
+			{"SetWithTTI", func() error { return cache.SetWithTTI(key, value, time.Minute, time.Second) },
+				header{expireAt: c.ttlHeader(time.Minute).expireAt, ttl: time.Minute, createdAt: c.now(), tti: time.Second, lastAccess: c.now()}},
+		} {
+			if err := tc.set(); err != nil {
+				t.Fatalf("%s(%d bytes) failed: %v", tc.name, len(value), err)
+			}
+			want, err := c.encode(value, tc.h)
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if got := c.cache.fc().Get(nil, []byte(key)); !bytes.Equal(got, want) {
+				t.Errorf("%s(%d bytes) stored %d bytes, want the %d encode returns", tc.name, len(value), len(got), len(want))
+			}
+		}
+	}
+
+	// 之前写入的 entry 不受 buffer 复用影响
+	for i, value := range values {
+		if got, ok := cache.GetOK(fmt.Sprintf("key-%d", i)); !ok || !bytes.Equal(got, value) || (value == nil) != (got == nil) {
+			t.Errorf("GetOK(key-%d) = %d bytes, %v, want the %d stored", i, len(got), ok, len(value))
+		}
+	}
+}
+
+// TestCacheWithTTL_Append 测试追加写入保留剩余 TTL
+func TestCacheWithTTL_Append(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if err := cache.Append("key", []byte("a"), time.Minute); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	assertTTL(t, cache, "key", time.Minute)
+
+	// 追加时传入的 ttl 不会重置已有的过期时间
+	if err := cache.Append("key", []byte("bc"), time.Hour); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("abc")) {
+		t.Errorf("Get = %q, want abc", got)
+	}
+	assertTTL(t, cache, "key", time.Minute)
+
+	// 过期的 key 重新创建
+	cache.Set("expired", []byte("old"), -time.Second)
+	if err := cache.Append("expired", []byte("new"), time.Minute); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := cache.Get("expired"); !bytes.Equal(got, []byte("new")) {
+		t.Errorf("Get(expired) = %q, want new", got)
+	}
+
+	big := make([]byte, 64*1024)
+	if err := cache.Append("key", big, time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Append returned %v, want %v", err, ErrValueTooLarge)
+	}
+	if err := cache.Append("new-big", big, time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Append returned %v, want %v", err, ErrValueTooLarge)
+	}
+}
+
+// TestCacheWithTTL_AppendConcurrent 测试并发追加不会丢失写入
+func TestCacheWithTTL_AppendConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	const numAppends = 10
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numAppends; j++ {
+				if err := cache.Append("key", []byte("x"), time.Minute); err != nil {
+					t.Errorf("Append failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(cache.Get("key")); got != numGoroutines*numAppends {
+		t.Errorf("value length = %d, want %d", got, numGoroutines*numAppends)
+	}
+}
+
+// TestCacheWithTTL_Incr 测试计数器的 TTL 由第一次自增确定
+func TestCacheWithTTL_Incr(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if n, err := cache.Incr("counter", 1, time.Minute); err != nil || n != 1 {
+		t.Fatalf("Incr = %d, %v, want 1, nil", n, err)
+	}
+	// 之后的自增保留剩余 TTL
+	if n, err := cache.Decr("counter", 3, time.Hour); err != nil || n != -2 {
+		t.Fatalf("Decr = %d, %v, want -2, nil", n, err)
+	}
+	assertTTL(t, cache, "counter", time.Minute)
+
+	// 过期后重新从 0 开始
+	cache.Incr("expired", 10, -time.Second)
+	if n, err := cache.Incr("expired", 1, time.Minute); err != nil || n != 1 {
+		t.Errorf("Incr on expired = %d, %v, want 1, nil", n, err)
+	}
+
+	cache.Set("text", []byte("hello"), time.Minute)
+	var encErr EncodingError
+	if _, err := cache.Incr("text", 1, time.Minute); !errors.As(err, &encErr) {
+		t.Errorf("Incr returned %v, want EncodingError", err)
+	}
+}
+
+// TestCacheWithTTL_IncrConcurrent 测试并发自增结果正确
+func TestCacheWithTTL_IncrConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 100
+	const numIncrs = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numIncrs; j++ {
+				if _, err := cache.Incr("counter", 1, time.Minute); err != nil {
+					t.Errorf("Incr failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := cache.Incr("counter", 0, time.Minute); n != numGoroutines*numIncrs {
+		t.Errorf("counter = %d, want %d", n, numGoroutines*numIncrs)
+	}
+}
+
+// TestCacheWithTTL_IncrFloat 测试浮点计数器保留剩余 TTL
+func TestCacheWithTTL_IncrFloat(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	if f, err := cache.IncrFloat("sum", 0.5, time.Minute); err != nil || f != 0.5 {
+		t.Fatalf("IncrFloat = %v, %v, want 0.5, nil", f, err)
+	}
+	if f, err := cache.IncrFloat("sum", 2, time.Hour); err != nil || f != 2.5 {
+		t.Fatalf("IncrFloat = %v, %v, want 2.5, nil", f, err)
+	}
+	assertTTL(t, cache, "sum", time.Minute)
+
+	if _, err := cache.IncrFloat("sum", math.NaN(), time.Minute); !errors.Is(err, ErrInvalidFloat) {
+		t.Errorf("IncrFloat(NaN) returned %v, want %v", err, ErrInvalidFloat)
+	}
+	var encErr EncodingError
+	if _, err := cache.Incr("sum", 1, time.Minute); !errors.As(err, &encErr) {
+		t.Errorf("Incr on float counter returned %v, want EncodingError", err)
+	}
+}
+
+// TestCacheWithTTL_GetRange 测试部分读取的偏移不包含过期时间头
+func TestCacheWithTTL_GetRange(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("0123456789"), time.Minute)
+	if got := cache.GetRange("key", 0, 4); !bytes.Equal(got, []byte("0123")) {
+		t.Errorf("GetRange(0, 4) = %q, want 0123", got)
+	}
+	if got := cache.GetRange("key", 6, -1); !bytes.Equal(got, []byte("6789")) {
+		t.Errorf("GetRange(6, -1) = %q, want 6789", got)
+	}
+	if got := cache.GetRange("key", 11, -1); got != nil {
+		t.Errorf("GetRange(11, -1) = %q, want nil", got)
+	}
+
+	cache.Set("expired", []byte("0123456789"), -time.Second)
+	if got := cache.GetRange("expired", 0, -1); got != nil {
+		t.Errorf("GetRange on expired key = %q, want nil", got)
+	}
+}
+
+// TestCacheWithTTL_Concurrent 测试并发操作
+func TestCacheWithTTL_Concurrent(t *testing.T) {
+	cache := NewCacheWithTTL(10 * 1024 * 1024)
+	defer cache.Close()
+
+	const numGoroutines = 50
+	const numKeys = 100
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines * 2)
+
+	// 并发写入
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < numKeys; j++ {
+				key := string(rune(id*numKeys + j))
+				value := []byte{byte(id), byte(j)}
+				err := cache.Set(key, value, time.Second)
+				if err != nil {
+					t.Errorf("Set failed: %v", err)
+				}
+			}
+		}(i)
+	}
+
+	// 并发读取
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < numKeys; j++ {
+				key := string(rune(id*numKeys + j))
+				_ = cache.Get(key)
+				_ = cache.Has(key)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// TestCacheWithTTL_ExpirationRace 测试过期竞态条件
+func TestCacheWithTTL_ExpirationRace(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := []byte("test-value")
+
+	// 设置一个很短的 TTL
+	err := cache.Set(key, value, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// 并发读取，可能在过期过程中
+	var wg sync.WaitGroup
+	const numGoroutines = 10
+	wg.Add(numGoroutines)
+
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = cache.Get(key)
+				_ = cache.Has(key)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestCacheWithTTL_LargeValue 测试大值
+func TestCacheWithTTL_LargeValue(t *testing.T) {
+	cache := NewCacheWithTTL(10 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "test-key"
+	value := make([]byte, 10*1024) // 10KB
+	for i := range value {
+		value[i] = byte(i % 256)
+	}
+
+	err := cache.Set(key, value, time.Second)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got := cache.Get(key)
+	if !bytes.Equal(got, value) {
+		t.Error("Large value mismatch")
+	}
+}
+
+// TestCacheWithTTL_WrapUnwrap 测试 entry 的编码和解码
+func TestCacheWithTTL_WrapUnwrap(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+	original := []byte("test-data")
+	ttl := time.Second
+
+	// 标记 + 版本号 + 8 字节过期时间 + 1000ms、创建时间和 stale 窗口的 varint
+	wrapped, err := c.encode(original, c.ttlHeader(ttl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !marked(wrapped) || version(wrapped) != formatV3 {
+		t.Errorf("entry starts with %x, want the marker and version %#x", wrapped[:3], formatV3)
+	}
+	now := clock.Now()
+	h, n, ok := c.decode(wrapped)
+	want := header{expireAt: now.Add(ttl).UnixMilli(), ttl: ttl, createdAt: now.UnixMilli()}
+	if !ok || h != want || len(wrapped) != n+len(original) {
+		t.Errorf("decode = %+v, %d, %v, want %+v", h, n, ok, want)
+	}
+
+	// 立即解包应该成功
+	if unwrapped, ok := c.unwrap(wrapped); !ok || !bytes.Equal(unwrapped, original) {
+		t.Errorf("unwrap = %q, %v, want %q, true", unwrapped, ok, original)
+	}
+}
+
+// version 返回 entry 标记之后的版本号
+func version(raw []byte) byte {
+	return raw[len(entryMarker)]
+}
+
+// wrapLegacy 按加入版本号之前的格式编码
+func wrapLegacy(data []byte, expireAt int64) []byte {
+	buf := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(buf, uint64(expireAt))
+	copy(buf[8:], data)
+	return buf
+}
+
+// TestCacheWithTTL_WrapLegacy 测试旧格式仍然可以读取
+func TestCacheWithTTL_WrapLegacy(t *testing.T) {
+	now := time.Now()
+	c := NewCacheWithTTL(1024*1024, WithClock(NewFakeClock(now)), WithLegacyEntries()).(*CacheWithTTL)
+	defer c.Close()
+	original := []byte("test-data")
+
+	testCases := []struct {
+		name     string
+		expireAt int64
+		live     bool
+	}{
+		{"now", now.Add(time.Minute).UnixMilli(), true},
+		{"year 9999", time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC).UnixMilli(), true},
+		{"no expiry", noExpiry, true},
+		{"expired", now.Add(-time.Minute).UnixMilli(), false},
+		{"epoch", 0, false},
+		{"zero time", time.Time{}.UnixMilli(), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wrapped := wrapLegacy(original, tc.expireAt)
+			h, n, ok := decodeHeader(wrapped, 0)
+			if !ok || h != (header{expireAt: tc.expireAt}) || n != 8 {
+				t.Fatalf("decodeHeader = %+v, %d, %v, want expireAt %d, 8, true", h, n, ok, tc.expireAt)
+			}
+			got, ok := c.unwrap(wrapped)
+			if ok != tc.live || (ok && !bytes.Equal(got, original)) {
+				t.Errorf("unwrap = %q, %v, want live %v", got, ok, tc.live)
+			}
+		})
+	}
+}
+
+// TestCacheWithTTL_LegacyFirstByte 测试真实时间戳的首字节不会被误认为版本号
+func TestCacheWithTTL_LegacyFirstByte(t *testing.T) {
+	for year := 1970; year <= 9999; year += 7 {
+		expireAt := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+		if first := wrapLegacy(nil, expireAt)[0]; first >= formatV1 && first <= formatIdle {
+			t.Fatalf("legacy entry expiring in %d starts with a version byte", year)
+		}
+	}
+}
+
+// TestCacheWithTTL_LegacyEntry 测试开启 WithLegacyEntries 后旧格式 entry 的读取和升级
+func TestCacheWithTTL_LegacyEntry(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithLegacyEntries())
+	defer cache.Close()
+
+	expireAt := clock.Now().Add(time.Minute).UnixMilli()
+	cache.(*CacheWithTTL).cache.Set("legacy", wrapLegacy([]byte("value"), expireAt))
+
+	if got := cache.Get("legacy"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get(legacy) = %q, want value", got)
+	}
+	// 旧格式没有保存时长
+	if _, err := cache.Touch("legacy"); !errors.Is(err, ErrNoTTL) {
+		t.Errorf("Touch(legacy) returned %v, want %v", err, ErrNoTTL)
+	}
+	// Expire 重写 header 后变为带标记的新格式
+	cache.Expire("legacy", time.Hour)
+	if raw := cache.(*CacheWithTTL).cache.Get("legacy"); !marked(raw) || version(raw) != formatV3 {
+		t.Errorf("version byte after Expire = %#x, want %#x", version(raw), formatV3)
+	}
+	if got := cache.Get("legacy"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Expire = %q, want value", got)
+	}
+	assertTTL(t, cache, "legacy", time.Hour)
+}
+
+// TestCacheWithTTL_ForeignEntry 测试其他写入者存入的 value 不会被当作 entry 解析或删除
+func TestCacheWithTTL_ForeignEntry(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	c := cache.(*CacheWithTTL)
+
+	// 普通 Cache 写入的 value 与旧格式 entry 都没有标记
+	foreign := map[string][]byte{
+		"text":   []byte("hello, world"),
+		"short":  []byte("x"),
+		"empty":  {},
+		"legacy": wrapLegacy([]byte("value"), clock.Now().Add(-time.Minute).UnixMilli()),
+	}
+	for key, value := range foreign {
+		c.cache.Set(key, value)
+	}
+	for key, value := range foreign {
+		if got, err := cache.GetE(key); !errors.Is(err, ErrNotTTLEntry) || got != nil {
+			t.Errorf("GetE(%q) = %q, %v, want %v", key, got, err, ErrNotTTLEntry)
+		}
+		if cache.Has(key) {
+			t.Errorf("Has(%q) = true, want false", key)
+		}
+		if _, ok := cache.TTL(key); ok {
+			t.Errorf("TTL(%q) reported a ttl", key)
+		}
+		c.purge(key)
+		if got := c.cache.Get(key); !bytes.Equal(got, value) {
+			t.Errorf("foreign value of %q = %q, want it left as %q", key, got, value)
+		}
+	}
+	if st := cache.Stats(); st.ForeignReads != 8 || st.ExpiredReads != 0 {
+		t.Errorf("Stats = %+v, want 8 foreign reads and no expired one", st)
+	}
+	if got := cache.LazyPurged(); got != 0 {
+		t.Errorf("LazyPurged = %d, want 0", got)
+	}
+
+	// 写入覆盖后恢复正常
+	cache.Set("text", []byte("value"), time.Minute)
+	if got, err := cache.GetE("text"); err != nil || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetE after Set = %q, %v, want value, nil", got, err)
+	}
+	if _, err := cache.GetE("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetE(missing) = %v, want %v", err, ErrNotFound)
+	}
+	cache.Close()
+	if _, err := cache.GetE("text"); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetE after Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+// TestCacheWithTTL_LegacyCompact 测试开启 WithLegacyEntries 时 Compact 为保留的旧格式 entry 加上标记
+func TestCacheWithTTL_LegacyCompact(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithLegacyEntries(), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	c.cache.Set("live", wrapLegacy([]byte("value"), clock.Now().Add(time.Minute).UnixMilli()))
+	c.cache.Set("expired", wrapLegacy([]byte("value"), clock.Now().Add(-time.Minute).UnixMilli()))
+	c.index.add("live")
+	c.index.add("expired")
+
+	rep, err := cache.Compact()
+	if err != nil || rep.Retained != 1 || rep.Dropped != 1 {
+		t.Fatalf("Compact = %+v, %v, want 1 retained and 1 dropped", rep, err)
+	}
+	if raw := c.cache.Get("live"); !marked(raw) {
+		t.Errorf("entry after Compact = %x, want it marked", raw)
+	}
+	if got := cache.Get("live"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Compact = %q, want value", got)
+	}
+	assertTTL(t, cache, "live", time.Minute)
+}
+
+// TestCacheWithTTL_WrapV1 测试读取 V1 和 V2 格式
+func TestCacheWithTTL_WrapV1(t *testing.T) {
+	now := time.Now()
+	c := NewCacheWithTTL(1024*1024, WithClock(NewFakeClock(now))).(*CacheWithTTL)
+	defer c.Close()
+	expireAt := now.Add(time.Minute).UnixMilli()
+	wrapped := append([]byte(entryMarker), formatV1)
+	wrapped = binary.BigEndian.AppendUint64(wrapped, uint64(expireAt))
+	wrapped = binary.AppendUvarint(wrapped, uint64(time.Minute.Milliseconds()))
+	wrapped = append(wrapped, "test-data"...)
+
+	h, _, ok := c.decode(wrapped)
+	if want := (header{expireAt: expireAt, ttl: time.Minute}); !ok || h != want {
+		t.Errorf("decode = %+v, %v, want %+v", h, ok, want)
+	}
+	if got, ok := c.unwrap(wrapped); !ok || !bytes.Equal(got, []byte("test-data")) {
+		t.Errorf("unwrap = %q, %v, want test-data, true", got, ok)
+	}
+
+	// V2 多了创建时间，没有 stale 窗口
+	v2 := append([]byte(entryMarker), formatV2)
+	v2 = binary.BigEndian.AppendUint64(v2, uint64(expireAt))
+	v2 = binary.AppendUvarint(v2, uint64(time.Minute.Milliseconds()))
+	v2 = binary.AppendUvarint(v2, uint64(now.UnixMilli()))
+	v2 = append(v2, "test-data"...)
+	h, _, ok = c.decode(v2)
+	if want := (header{expireAt: expireAt, ttl: time.Minute, createdAt: now.UnixMilli()}); !ok || h != want {
+		t.Errorf("decode(v2) = %+v, %v, want %+v", h, ok, want)
+	}
+}
+
+// TestCacheWithTTL_Age 测试 entry 的存在时长
+func TestCacheWithTTL_Age(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Minute)
+	clock.Advance(5 * time.Second)
+	if age, ok := cache.Age("key"); !ok || age != 5*time.Second {
+		t.Errorf("Age = %v, %v, want 5s, true", age, ok)
+	}
+
+	// Expire 和 Touch 不重置创建时间
+	cache.Expire("key", time.Hour)
+	cache.Touch("key")
+	clock.Advance(time.Second)
+	if age, _ := cache.Age("key"); age != 6*time.Second {
+		t.Errorf("Age after Expire and Touch = %v, want 6s", age)
+	}
+
+	// 覆盖写入重置创建时间
+	cache.Set("key", []byte("new"), time.Minute)
+	if age, ok := cache.Age("key"); !ok || age != 0 {
+		t.Errorf("Age after Set = %v, %v, want 0, true", age, ok)
+	}
+
+	// 旧格式没有创建时间
+	expireAt := clock.Now().Add(time.Minute).UnixMilli()
+	cache.(*CacheWithTTL).cache.Set("legacy", wrapLegacy([]byte("value"), expireAt))
+	cache.Set("expired", []byte("value"), -time.Second)
+	for _, key := range []string{"legacy", "expired", "missing"} {
+		if age, ok := cache.Age(key); ok || age != 0 {
+			t.Errorf("Age(%q) = %v, %v, want 0, false", key, age, ok)
+		}
+	}
+}
+
+// TestCacheWithTTL_WrapUnwrapExpired 测试过期解包
+func TestCacheWithTTL_WrapUnwrapExpired(t *testing.T) {
+	cache, _ := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	// 负 TTL，立即过期
+	wrapped, err := c.encode([]byte("test-data"), c.ttlHeader(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unwrapped, ok := c.unwrap(wrapped); ok || unwrapped != nil {
+		t.Errorf("unwrap of an expired entry = %q, %v, want nil, false", unwrapped, ok)
+	}
+}
+
+// TestCacheWithTTL_WrapUnwrapInvalid 测试无效数据解包
+func TestCacheWithTTL_WrapUnwrapInvalid(t *testing.T) {
+	cache, _ := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	for _, data := range [][]byte{
+		{1, 2, 3},                             // 没有标记
+		append([]byte(entryMarker), formatV3), // 标记后的头部太短
+		nil,
+	} {
+		if unwrapped, ok := c.unwrap(data); ok || unwrapped != nil {
+			t.Errorf("unwrap(%x) = %q, %v, want nil, false", data, unwrapped, ok)
+		}
+	}
+}
+
+// TestCacheWithTTL_HasMulti 测试批量 Has，包含存在、不存在和过期的 key
+func TestCacheWithTTL_HasMulti(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("live", []byte("value"), time.Second)
+	cache.Set("empty", []byte{}, time.Second)
+	cache.Set("expired", []byte("value"), -time.Second)
+
+	keys := []string{"live", "missing", "expired", "empty", "live"}
+	want := []bool{true, false, false, true, true}
+
+	got := cache.HasMulti(keys)
+	if len(got) != len(want) {
+		t.Fatalf("HasMulti returned %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("HasMulti[%d] (%q) = %v, want %v", i, keys[i], got[i], want[i])
+		}
+		if got[i] != cache.Has(keys[i]) {
+			t.Errorf("HasMulti[%d] (%q) disagrees with Has", i, keys[i])
+		}
+	}
+}
+
+// TestCacheWithTTL_Inspect 测试 Inspect 的三种状态
+func TestCacheWithTTL_Inspect(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	value := []byte("test-value")
+
+	if got := cache.Inspect("absent"); got != EntryAbsent {
+		t.Errorf("Inspect(absent) = %v, want %v", got, EntryAbsent)
+	}
+
+	if err := cache.Set("fresh", value, time.Second); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := cache.Inspect("fresh"); got != EntryFresh {
+		t.Errorf("Inspect(fresh) = %v, want %v", got, EntryFresh)
+	}
+
+	// 负 TTL 立即过期，但数据仍在 fastcache 中
+	if err := cache.Set("stale", value, -time.Second); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := cache.Inspect("stale"); got != EntryStale {
+		t.Errorf("Inspect(stale) = %v, want %v", got, EntryStale)
+	}
+	// Has 仍然只认为新鲜的 key 存在
+	if cache.Has("stale") {
+		t.Error("Has returned true for stale key")
+	}
+
+	// 删除后变为不存在
+	if err := cache.Delete("fresh"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := cache.Inspect("fresh"); got != EntryAbsent {
+		t.Errorf("Inspect after delete = %v, want %v", got, EntryAbsent)
+	}
+}
+
+// TestCacheWithTTL_InspectExpiration 测试过期后从 Fresh 变为 Stale
+func TestCacheWithTTL_InspectExpiration(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	if err := cache.Set("key", []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := cache.Inspect("key"); got != EntryFresh {
+		t.Errorf("Inspect = %v, want %v", got, EntryFresh)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+
+	if got := cache.Inspect("key"); got != EntryStale {
+		t.Errorf("Inspect after expiration = %v, want %v", got, EntryStale)
+	}
+}
+
+// TestCacheWithTTL_InspectNoAlloc 测试 Inspect 不会复制 value
+func TestCacheWithTTL_InspectNoAlloc(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", make([]byte, 512), time.Hour)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = cache.Inspect("key")
+	})
+	if allocs != 0 {
+		t.Errorf("Inspect allocs = %v, want 0", allocs)
+	}
+}
+
+// TestCacheWithTTL_GetInto 测试 GetInto 只追加去掉 header 的 value，过期的 entry 像 Get 一样被删除
+func TestCacheWithTTL_GetInto(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Minute)
+	cache.Set("short", []byte("value"), time.Second)
+	if got, ok := cache.GetInto(nil, "key"); !ok || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetInto(nil) = %q, %v, want value, true", got, ok)
+	}
+	if got, ok := cache.GetInto([]byte("prefix-"), "key"); !ok || string(got) != "prefix-value" {
+		t.Errorf("GetInto = %q, %v, want prefix-value, true", got, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	if got, ok := cache.GetInto([]byte("prefix-"), "short"); ok || string(got) != "prefix-" {
+		t.Errorf("GetInto(expired) = %q, %v, want prefix- untouched, false", got, ok)
+	}
+	if _, _, ok := cache.GetStale("short"); ok || cache.Stats().ExpiredReads != 1 {
+		t.Error("expired entry read by GetInto should be deleted and counted")
+	}
+
+	// 缓冲区足够大时不分配内存
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = cache.GetInto(buf[:0], "key")
+	})
+	if allocs != 0 {
+		t.Errorf("GetInto allocs = %v, want 0", allocs)
+	}
+}
+
+// TestCacheWithTTL_GetFn 测试 GetFn 交给回调的是去掉 header 的 value，过期的 entry 像 Get 一样被删除
+func TestCacheWithTTL_GetFn(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("key", []byte("value"), time.Minute)
+	cache.Set("nil", nil, time.Minute)
+	cache.Set("short", []byte("value"), time.Second)
+	var got []byte
+	if found, err := cache.GetFn("key", func(value []byte) error {
+		got = append(got, value...)
+		return nil
+	}); !found || err != nil || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetFn = %v, %v with %q, want true, nil with value", found, err, got)
+	}
+	if found, _ := cache.GetFn("nil", func(value []byte) error {
+		if value != nil {
+			t.Errorf("GetFn(nil) passed %q, want nil", value)
+		}
+		return nil
+	}); !found {
+		t.Error("GetFn(nil) = false, want true")
+	}
+
+	clock.Advance(2 * time.Second)
+	if found, _ := cache.GetFn("short", func([]byte) error {
+		t.Error("fn called for an expired key")
+		return nil
+	}); found {
+		t.Error("GetFn of an expired key = true, want false")
+	}
+	if _, _, ok := cache.GetStale("short"); ok || cache.Stats().ExpiredReads != 1 {
+		t.Error("expired entry read by GetFn should be deleted and counted")
+	}
+
+	// 命中时不分配内存
+	var n int
+	fn := func(value []byte) error {
+		n += len(value)
+		return nil
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		c.GetFn("key", fn)
+	})
+	if allocs != 0 {
+		t.Errorf("GetFn allocs = %v, want 0", allocs)
+	}
+}
+
+// BenchmarkCacheWithTTL_GetInto 基准测试复用缓冲区的 GetInto 操作
+func BenchmarkCacheWithTTL_GetInto(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	cache.Set(key, []byte("bench-value"), time.Hour)
+	buf := make([]byte, 0, 64)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = cache.GetInto(buf[:0], key)
+	}
+}
+
+// BenchmarkCacheWithTTL_GetFn 基准测试 GetFn 操作，命中时不复制 value
+func BenchmarkCacheWithTTL_GetFn(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	cache.Set(key, []byte("bench-value"), time.Hour)
+	var n int
+	fn := func(value []byte) error {
+		n += len(value)
+		return nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.GetFn(key, fn)
+	}
+}
+
+// BenchmarkCacheWithTTL_Set 基准测试 Set 操作
+func BenchmarkCacheWithTTL_Set(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	value := []byte("bench-value")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(key, value, time.Second)
+	}
+}
+
+// BenchmarkCacheWithTTL_SetSizes 基准测试不同大小 value 的 Set，pool buffer 能容纳的不分配内存
+func BenchmarkCacheWithTTL_SetSizes(b *testing.B) {
+	for _, size := range []int{100, 1000, 8000, 60000} {
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			cache := NewCacheWithTTL(100 * 1024 * 1024)
+			defer cache.Close()
+			value := randomBytes(size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Set("bench-key", value, time.Second)
+			}
+		})
+	}
+}
+
+// BenchmarkCacheWithTTL_SetCompact 基准测试紧凑格式的 Set，并报告每个 entry 的存储字节数
+func BenchmarkCacheWithTTL_SetCompact(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"V3", nil},
+		{"Compact", []Option{WithCompactTTL()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCacheWithTTL(100*1024*1024, bc.opts...)
+			defer cache.Close()
+
+			value := make([]byte, 16)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Set("bench-key", value, time.Hour)
+			}
+			b.StopTimer()
+			stored := cache.(*CacheWithTTL).cache.Get("bench-key")
+			b.ReportMetric(float64(len(stored)), "stored-B/entry")
+		})
+	}
+}
+
+// BenchmarkCacheWithTTL_Get 基准测试 Get 操作
 func BenchmarkCacheWithTTL_Get(b *testing.B) {
 	cache := NewCacheWithTTL(100 * 1024 * 1024)
 	defer cache.Close()
@@ -416,6 +2553,7 @@ func BenchmarkCacheWithTTL_Get(b *testing.B) {
 	value := []byte("bench-value")
 	cache.Set(key, value, time.Hour) // 设置很长的 TTL 避免过期
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_ = cache.Get(key)
@@ -436,3 +2574,615 @@ func BenchmarkCacheWithTTL_Concurrent(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkCacheWithTTL_Inspect 基准测试 Inspect 操作
+func BenchmarkCacheWithTTL_Inspect(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	key := "bench-key"
+	cache.Set(key, make([]byte, 512), time.Hour)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cache.Inspect(key)
+	}
+}
+
+// BenchmarkCacheWithTTL_HasLoop 基准测试循环调用 Has 1k 个 key
+func BenchmarkCacheWithTTL_HasLoop(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(1000)
+	for _, key := range keys[:500] {
+		cache.Set(key, make([]byte, 256), time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := make([]bool, len(keys))
+		for j, key := range keys {
+			res[j] = cache.Has(key)
+		}
+	}
+}
+
+// BenchmarkCacheWithTTL_HasLarge 基准测试 40KB value 的 Has、TTL 与 Get，前两者不复制 value
+func BenchmarkCacheWithTTL_HasLarge(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+	cache.Set("key", randomBytes(40*1024), time.Hour)
+
+	for _, bc := range []struct {
+		name string
+		fn   func()
+	}{
+		{"Has", func() { cache.Has("key") }},
+		{"TTL", func() { cache.TTL("key") }},
+		{"Get", func() { cache.Get("key") }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bc.fn()
+			}
+		})
+	}
+}
+
+// BenchmarkCacheWithTTL_HasMulti 基准测试 HasMulti 1k 个 key
+func BenchmarkCacheWithTTL_HasMulti(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(1000)
+	for _, key := range keys[:500] {
+		cache.Set(key, make([]byte, 256), time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cache.HasMulti(keys)
+	}
+}
+
+// BenchmarkCacheWithTTL_GetLoop 基准测试循环调用 Get 100 个 key
+func BenchmarkCacheWithTTL_GetLoop(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256), time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := make([][]byte, len(keys))
+		for j, key := range keys {
+			res[j] = cache.Get(key)
+		}
+	}
+}
+
+// BenchmarkCacheWithTTL_MGet 基准测试 MGet 100 个 key
+func BenchmarkCacheWithTTL_MGet(b *testing.B) {
+	cache := NewCacheWithTTL(100 * 1024 * 1024)
+	defer cache.Close()
+
+	keys := benchKeys(100)
+	for _, key := range keys {
+		cache.Set(key, make([]byte, 256), time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = cache.MGet(keys)
+	}
+}
+
+// TestCacheWithTTL_SoftTTL 测试软过期后默认仍可读，硬过期后不可读
+func TestCacheWithTTL_SoftTTL(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	if err := cache.SetWithSoftTTL("key", []byte("value"), time.Second, 3*time.Second); err != nil {
+		t.Fatalf("SetWithSoftTTL failed: %v", err)
+	}
+
+	// 软过期后仍返回值，TTL 按硬过期计算
+	clock.Advance(2 * time.Second)
+	if got, ok := cache.GetOK("key"); !ok || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetOK after soft ttl = %q, %v, want value, true", got, ok)
+	}
+	if ttl, ok := cache.TTL("key"); !ok || ttl != time.Second {
+		t.Errorf("TTL = %v, %v, want 1s, true", ttl, ok)
+	}
+
+	clock.Advance(time.Second)
+	if cache.Has("key") {
+		t.Error("key should be gone after hard ttl")
+	}
+
+	// 非法的软硬 TTL 组合
+	for _, tc := range []struct{ soft, hard time.Duration }{
+		{0, time.Second},
+		{-time.Second, time.Second},
+		{2 * time.Second, time.Second},
+	} {
+		if err := cache.SetWithSoftTTL("bad", []byte("v"), tc.soft, tc.hard); !errors.Is(err, ErrInvalidSoftTTL) {
+			t.Errorf("SetWithSoftTTL(%v, %v) = %v, want ErrInvalidSoftTTL", tc.soft, tc.hard, err)
+		}
+	}
+	if cache.Has("bad") {
+		t.Error("invalid SetWithSoftTTL should not store the key")
+	}
+}
+
+// TestCacheWithTTL_StrictSoftTTL 测试严格模式下软过期后即不可读
+func TestCacheWithTTL_StrictSoftTTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithStrictSoftTTL())
+	defer cache.Close()
+
+	cache.SetWithSoftTTL("soft", []byte("value"), time.Second, 3*time.Second)
+	cache.Set("plain", []byte("value"), 2*time.Second)
+
+	if ttl, ok := cache.TTL("soft"); !ok || ttl != time.Second {
+		t.Errorf("TTL = %v, %v, want 1s, true", ttl, ok)
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if _, ok := cache.GetOK("soft"); ok {
+		t.Error("strict mode should not serve a stale entry")
+	}
+	if cache.HasMulti([]string{"soft"})[0] {
+		t.Error("HasMulti should report a stale entry as missing")
+	}
+	// 只有一个 TTL 的条目不受影响
+	if _, ok := cache.GetOK("plain"); !ok {
+		t.Error("plain entry should still be live")
+	}
+	// 条件写仍按硬过期判断
+	if ok, _ := cache.SetNX("soft", []byte("new"), time.Second); ok {
+		t.Error("SetNX should fail before the hard ttl")
+	}
+}
+
+// TestCacheWithTTL_StaleWhileRevalidate 测试软过期后 GetOrCompute 返回旧值并后台刷新一次
+func TestCacheWithTTL_StaleWhileRevalidate(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.SetWithSoftTTL("key", []byte("old"), time.Second, time.Minute)
+	clock.Advance(2 * time.Second)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func() ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("new"), nil
+	}
+
+	// 刷新进行中时都返回旧值，且只刷新一次
+	for i := 0; i < 3; i++ {
+		got, err := cache.GetOrCompute("key", time.Minute, loader)
+		if err != nil || !bytes.Equal(got, []byte("old")) {
+			t.Fatalf("GetOrCompute = %q, %v, want old, nil", got, err)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, _ := cache.GetOK("key"); bytes.Equal(got, []byte("new")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not store the new value")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+
+	// 刷新后的条目保留软过期窗口
+	got, err := cache.GetOrCompute("key", time.Minute, func() ([]byte, error) {
+		t.Error("loader should not be called for a fresh entry")
+		return nil, nil
+	})
+	if err != nil || !bytes.Equal(got, []byte("new")) {
+		t.Errorf("GetOrCompute = %q, %v, want new, nil", got, err)
+	}
+	clock.Advance(time.Minute - time.Second)
+	if _, ok := cache.GetOK("key"); !ok {
+		t.Error("refreshed entry should be served in its stale window")
+	}
+}
+
+// TestCacheWithTTL_GetStale 测试过期后仍能显式读到旧值且不影响 Get
+func TestCacheWithTTL_GetStale(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	if _, _, ok := cache.GetStale("missing"); ok {
+		t.Error("GetStale should miss a key never stored")
+	}
+
+	cache.Set("key", []byte("value"), time.Second)
+	if got, stale, ok := cache.GetStale("key"); !ok || stale || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetStale = %q, %v, %v, want value, false, true", got, stale, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	if got, stale, ok := cache.GetStale("key"); !ok || !stale || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("GetStale after expiry = %q, %v, %v, want value, true, true", got, stale, ok)
+	}
+	// 不影响 Get，也不会续期
+	if cache.Get("key") != nil || cache.Has("key") {
+		t.Error("Get should still hide the expired entry")
+	}
+	if _, ok := cache.TTL("key"); ok {
+		t.Error("GetStale should not re-arm the entry")
+	}
+
+	// 软过期后即为 stale
+	cache.SetWithSoftTTL("soft", []byte("v"), time.Second, time.Minute)
+	clock.Advance(2 * time.Second)
+	if _, stale, ok := cache.GetStale("soft"); !ok || !stale {
+		t.Errorf("GetStale past soft ttl = %v, %v, want true, true", stale, ok)
+	}
+
+	cache.Delete("key")
+	if _, _, ok := cache.GetStale("key"); ok {
+		t.Error("GetStale should miss a deleted key")
+	}
+}
+
+// newCompactCache 创建使用紧凑格式和可控时钟的缓存
+func newCompactCache() (ICacheWithTTL, *FakeClock) {
+	clock := NewFakeClock(time.Now())
+	return NewCacheWithTTL(1024*1024, WithClock(clock), WithCompactTTL()), clock
+}
+
+// TestCacheWithTTL_CompactTTL 测试紧凑格式的写入、过期与 header 大小
+func TestCacheWithTTL_CompactTTL(t *testing.T) {
+	cache, clock := newCompactCache()
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Second)
+	raw := cache.(*CacheWithTTL).cache.Get("key")
+	if version(raw) != formatCompact || len(raw) != len(entryMarker)+compactHeaderSize+len("value") {
+		t.Fatalf("stored entry = %x, want a %d-byte compact header", raw, compactHeaderSize)
+	}
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get = %q, want value", got)
+	}
+	// 精度为 100ms，过期时间只会向后取整
+	if ttl, ok := cache.TTL("key"); !ok || ttl < time.Second || ttl > time.Second+compactUnit*time.Millisecond {
+		t.Errorf("TTL = %v, %v, want about 1s", ttl, ok)
+	}
+
+	clock.Advance(1100 * time.Millisecond)
+	if cache.Has("key") {
+		t.Error("compact entry should expire")
+	}
+
+	// 紧凑格式不保存时长和创建时间
+	cache.Set("key", []byte("value"), time.Minute)
+	if _, err := cache.Touch("key"); !errors.Is(err, ErrNoTTL) {
+		t.Errorf("Touch = %v, want ErrNoTTL", err)
+	}
+	if _, ok := cache.Age("key"); ok {
+		t.Error("Age should report nothing for a compact entry")
+	}
+
+	// Persist 与 Expire 保持紧凑格式
+	cache.Persist("key")
+	clock.Advance(24 * time.Hour)
+	if ttl, ok := cache.TTL("key"); !ok || ttl != math.MaxInt64 {
+		t.Errorf("TTL after Persist = %v, %v, want persistent", ttl, ok)
+	}
+	cache.Expire("key", time.Second)
+	if raw := cache.(*CacheWithTTL).cache.Get("key"); version(raw) != formatCompact {
+		t.Errorf("version byte after Expire = %#x, want %#x", version(raw), formatCompact)
+	}
+	clock.Advance(2 * time.Second)
+	if cache.Has("key") {
+		t.Error("key should expire after Expire")
+	}
+
+	// 带软过期的 entry 仍使用完整格式
+	cache.SetWithSoftTTL("soft", []byte("v"), time.Second, time.Minute)
+	if raw := cache.(*CacheWithTTL).cache.Get("soft"); version(raw) != formatV3 {
+		t.Errorf("version byte of soft entry = %#x, want %#x", version(raw), formatV3)
+	}
+}
+
+// TestCacheWithTTL_CompactTTLOutOfRange 测试超出紧凑格式范围的 TTL 返回错误
+func TestCacheWithTTL_CompactTTLOutOfRange(t *testing.T) {
+	cache, clock := newCompactCache()
+	defer cache.Close()
+
+	const limit = (compactNoExpiry - 1) * compactUnit * time.Millisecond
+	if err := cache.Set("max", []byte("v"), limit); err != nil {
+		t.Errorf("Set at the limit = %v, want nil", err)
+	}
+
+	tooLong := limit + time.Second
+	if err := cache.Set("key", []byte("v"), tooLong); !errors.Is(err, ErrTTLOutOfRange) {
+		t.Errorf("Set = %v, want ErrTTLOutOfRange", err)
+	}
+	if err := cache.SetWithExpireAt("key", []byte("v"), clock.Now().Add(tooLong)); !errors.Is(err, ErrTTLOutOfRange) {
+		t.Errorf("SetWithExpireAt = %v, want ErrTTLOutOfRange", err)
+	}
+	if ok, err := cache.SetNX("key", []byte("v"), tooLong); ok || !errors.Is(err, ErrTTLOutOfRange) {
+		t.Errorf("SetNX = %v, %v, want false, ErrTTLOutOfRange", ok, err)
+	}
+	if _, err := cache.Incr("key", 1, tooLong); !errors.Is(err, ErrTTLOutOfRange) {
+		t.Errorf("Incr = %v, want ErrTTLOutOfRange", err)
+	}
+	if cache.Has("key") {
+		t.Error("failed writes should not store the key")
+	}
+
+	// Expire 失败时保留原有的过期时间
+	cache.Set("key", []byte("v"), time.Minute)
+	if _, err := cache.Expire("key", tooLong); !errors.Is(err, ErrTTLOutOfRange) {
+		t.Errorf("Expire = %v, want ErrTTLOutOfRange", err)
+	}
+	if ttl, ok := cache.TTL("key"); !ok || ttl < time.Minute-time.Millisecond || ttl > time.Minute+compactUnit*time.Millisecond {
+		t.Errorf("TTL after failed Expire = %v, %v, want about 1m", ttl, ok)
+	}
+
+	// 过去的时间存为已过期
+	if err := cache.SetWithExpireAt("past", []byte("v"), time.Time{}); err != nil || cache.Has("past") {
+		t.Errorf("SetWithExpireAt(zero) = %v, has %v, want nil, false", err, cache.Has("past"))
+	}
+}
+
+// TestCacheWithTTL_LazyPurge 测试读到过期 entry 时将其删除
+func TestCacheWithTTL_LazyPurge(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("get", []byte("v"), time.Second)
+	cache.Set("has", []byte("v"), time.Second)
+	cache.Set("peek", []byte("v"), time.Second)
+	clock.Advance(2 * time.Second)
+
+	if cache.Get("get") != nil || cache.Has("has") {
+		t.Fatal("expired entries should not be returned")
+	}
+	for _, key := range []string{"get", "has"} {
+		if _, _, ok := cache.GetStale(key); ok {
+			t.Errorf("%q should be deleted after an expired read", key)
+		}
+	}
+	// Peek 不删除
+	cache.Peek("peek")
+	if _, _, ok := cache.GetStale("peek"); !ok {
+		t.Error("Peek should leave the expired entry in place")
+	}
+	if got := cache.LazyPurged(); got != 2 {
+		t.Errorf("LazyPurged = %d, want 2", got)
+	}
+
+	// 缺失的 key 不计数
+	cache.Get("missing")
+	if got := cache.LazyPurged(); got != 2 {
+		t.Errorf("LazyPurged after a miss = %d, want 2", got)
+	}
+
+	// 读到过期值后并发写入的新值不会被删除
+	cache.Set("key", []byte("fresh"), time.Minute)
+	c.purge("key")
+	if got := cache.Get("key"); !bytes.Equal(got, []byte("fresh")) {
+		t.Errorf("Get = %q, want fresh", got)
+	}
+}
+
+// TestCacheWithTTL_LazyPurgeStrictSoft 测试严格模式下软过期的 entry 不会被删除
+func TestCacheWithTTL_LazyPurgeStrictSoft(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithStrictSoftTTL())
+	defer cache.Close()
+
+	cache.SetWithSoftTTL("key", []byte("v"), time.Second, time.Minute)
+	clock.Advance(2 * time.Second)
+	if cache.Has("key") {
+		t.Fatal("stale entry should be hidden in strict mode")
+	}
+	if _, _, ok := cache.GetStale("key"); !ok || cache.LazyPurged() != 0 {
+		t.Error("an entry before its hard expiry should not be purged")
+	}
+}
+
+// TestCacheWithTTL_ExpiredReads 测试读到过期 entry 的计数
+func TestCacheWithTTL_ExpiredReads(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.Set("a", []byte("v"), time.Second)
+	cache.Set("b", []byte("v"), time.Second)
+	cache.Set("c", []byte("v"), time.Second)
+	clock.Advance(2 * time.Second)
+
+	// Peek、GetStale 和缺失的 key 不计数
+	cache.Peek("a")
+	cache.GetStale("a")
+	cache.Get("missing")
+	if got := cache.Stats().ExpiredReads; got != 0 {
+		t.Fatalf("ExpiredReads = %d, want 0", got)
+	}
+
+	cache.Get("a")
+	cache.Has("b")
+	// 已被删除的 entry 再读就是缺失
+	cache.Get("a")
+	if got := cache.Stats().ExpiredReads; got != 2 {
+		t.Errorf("ExpiredReads = %d, want 2", got)
+	}
+
+	cache.ResetStats()
+	if got := cache.Stats().ExpiredReads; got != 0 {
+		t.Errorf("ExpiredReads after ResetStats = %d, want 0", got)
+	}
+	cache.Get("c")
+	if got := cache.Stats().ExpiredReads; got != 1 {
+		t.Errorf("ExpiredReads = %d, want 1", got)
+	}
+}
+
+// TestCacheWithTTL_AsICache 测试以 ICache 视图使用 TTL 缓存
+func TestCacheWithTTL_AsICache(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	view := cache.AsICache(time.Second)
+	if err := view.Set("key", []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// 视图写入的数据对缓存可见，且带默认 TTL
+	if ttl, ok := cache.TTL("key"); !ok || ttl != time.Second {
+		t.Errorf("TTL = %v, %v, want 1s, true", ttl, ok)
+	}
+	if got := view.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get = %q, want value", got)
+	}
+	if n, err := view.Incr("counter", 2); err != nil || n != 2 {
+		t.Errorf("Incr = %d, %v, want 2, nil", n, err)
+	}
+	if err := view.MSet(map[string][]byte{"a": []byte("1"), "b": []byte("2")}); err != nil {
+		t.Errorf("MSet failed: %v", err)
+	}
+
+	clock.Advance(2 * time.Second)
+	if view.Has("key") || view.Get("a") != nil {
+		t.Error("view should hide expired entries")
+	}
+
+	cache.Set("key", []byte("direct"), time.Minute)
+	if err := view.Delete("key"); err != nil || cache.Has("key") {
+		t.Errorf("Delete = %v, Has = %v, want nil, false", err, cache.Has("key"))
+	}
+
+	// 关闭视图不关闭缓存
+	view.Close()
+	cache.Set("key", []byte("value"), time.Minute)
+	if !cache.Has("key") {
+		t.Error("closing the view should not close the cache")
+	}
+}
+
+// TestCacheWithTTL_AsICacheConcurrent 测试视图与缓存并发使用
+func TestCacheWithTTL_AsICacheConcurrent(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+	view := cache.AsICache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					view.Incr("counter", 1)
+				} else {
+					cache.Incr("counter", 1, time.Minute)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n, _ := view.Incr("counter", 0); n != 800 {
+		t.Errorf("counter = %d, want 800", n)
+	}
+}
+
+// TestCacheWithTTL_TTI 测试空闲超时与读取续期
+func TestCacheWithTTL_TTI(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	if err := cache.SetWithTTI("key", []byte("value"), time.Minute, 10*time.Second); err != nil {
+		t.Fatalf("SetWithTTI failed: %v", err)
+	}
+	size := len(c.cache.fc().Get(nil, []byte("key")))
+	if raw := c.cache.fc().Get(nil, []byte("key")); version(raw) != formatIdle {
+		t.Errorf("version byte = %#x, want %#x", version(raw), formatIdle)
+	}
+
+	// 每次读取都会重新计算空闲时间
+	for i := 0; i < 5; i++ {
+		clock.Advance(8 * time.Second)
+		if got := cache.Get("key"); !bytes.Equal(got, []byte("value")) {
+			t.Fatalf("Get after %d reads = %q, want value", i, got)
+		}
+	}
+	// 就地更新 header，entry 大小不变
+	if got := len(c.cache.fc().Get(nil, []byte("key"))); got != size {
+		t.Errorf("entry size after reads = %d, want %d", got, size)
+	}
+	if ttl, ok := cache.TTL("key"); !ok || ttl != 10*time.Second {
+		t.Errorf("TTL = %v, %v, want 10s", ttl, ok)
+	}
+
+	// Peek 不算访问
+	clock.Advance(8 * time.Second)
+	cache.Peek("key")
+	clock.Advance(3 * time.Second)
+	if cache.Has("key") {
+		t.Error("key should expire after being idle for its tti")
+	}
+
+	// 一直被读取也会在 TTL 到期时过期
+	cache.SetWithTTI("capped", []byte("value"), 20*time.Second, 10*time.Second)
+	for i := 0; i < 3; i++ {
+		clock.Advance(6 * time.Second)
+		cache.Get("capped")
+	}
+	clock.Advance(3 * time.Second)
+	if cache.Has("capped") {
+		t.Error("key should expire at its ttl even when read")
+	}
+
+	if err := cache.SetWithTTI("bad", []byte("v"), time.Minute, 0); !errors.Is(err, ErrInvalidTTI) {
+		t.Errorf("SetWithTTI(tti 0) = %v, want ErrInvalidTTI", err)
+	}
+}
+
+// TestCacheWithTTL_TTIUnaffected 测试没有 TTI 的 entry 不受影响，Persist 会去掉 TTI
+func TestCacheWithTTL_TTIUnaffected(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("plain", []byte("value"), time.Minute)
+	if raw := c.cache.fc().Get(nil, []byte("plain")); version(raw) != formatV3 {
+		t.Errorf("version byte = %#x, want %#x", version(raw), formatV3)
+	}
+	clock.Advance(30 * time.Second)
+	cache.Get("plain")
+	if ttl, _ := cache.TTL("plain"); ttl != 30*time.Second {
+		t.Errorf("TTL = %v, want 30s", ttl)
+	}
+
+	cache.SetWithTTI("idle", []byte("value"), time.Minute, time.Second)
+	cache.Persist("idle")
+	clock.Advance(time.Hour)
+	if !cache.Has("idle") {
+		t.Error("Persist should drop the tti")
+	}
+}
@@ -0,0 +1,227 @@
+// Package gcachebench measures the allocation and GC behavior of gcache
+// configurations so that two setups can be compared on the same workload.
+package gcachebench
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+)
+
+// Workload describes a fixed, deterministic operation mix.
+type Workload struct {
+	Keys      int           // number of distinct keys, default 1024
+	ValueSize int           // size of every stored value, default 128
+	Ops       int           // operations in the mixed phase, default 100000
+	ReadRatio float64       // fraction of Gets in the mixed phase, default 0.9
+	TTL       time.Duration // ttl passed to Set, default 1 hour
+	Runs      int           // iterations per core-op measurement, default 1000
+	Warmup    int           // iterations run before measuring, default Runs
+}
+
+func (w Workload) withDefaults() Workload {
+	if w.Keys <= 0 {
+		w.Keys = 1024
+	}
+	if w.ValueSize < 0 {
+		w.ValueSize = 0
+	} else if w.ValueSize == 0 {
+		w.ValueSize = 128
+	}
+	if w.Ops <= 0 {
+		w.Ops = 100000
+	}
+	if w.ReadRatio <= 0 || w.ReadRatio > 1 {
+		w.ReadRatio = 0.9
+	}
+	if w.TTL <= 0 {
+		w.TTL = time.Hour
+	}
+	if w.Runs <= 0 {
+		w.Runs = 1000
+	}
+	if w.Warmup <= 0 {
+		w.Warmup = w.Runs
+	}
+	return w
+}
+
+// OpAllocs holds the average number of heap allocations per call of each core op.
+type OpAllocs struct {
+	Set    float64
+	Get    float64
+	Has    float64
+	Delete float64
+}
+
+// AllocReport is the result of AllocProfile.
+type AllocReport struct {
+	PerOp OpAllocs
+
+	// mixed phase, measured from runtime.MemStats deltas
+	Ops        int
+	Mallocs    uint64
+	Bytes      uint64
+	GCCycles   uint32
+	PauseTotal time.Duration
+	Elapsed    time.Duration
+}
+
+// MallocsPerOp returns the average allocations per op of the mixed phase.
+func (r AllocReport) MallocsPerOp() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+	return float64(r.Mallocs) / float64(r.Ops)
+}
+
+// BytesPerOp returns the average allocated bytes per op of the mixed phase.
+func (r AllocReport) BytesPerOp() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+	return float64(r.Bytes) / float64(r.Ops)
+}
+
+// AllocProfile runs w against c and reports allocation behavior.
+// The core ops are measured one by one after a warm-up, then a mixed
+// read/write phase is run with GC statistics sampled around it.
+// It leaves the keys it wrote in c, so c should be dedicated to the profile.
+func AllocProfile(c gcache.ICacheWithTTL, w Workload) AllocReport {
+	w = w.withDefaults()
+
+	// build all inputs up front so they don't show up in the numbers
+	keys := make([]string, w.Keys)
+	for i := range keys {
+		keys[i] = "gcachebench:" + strconv.Itoa(i)
+	}
+	value := make([]byte, w.ValueSize)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	missKey := "gcachebench:missing"
+
+	for _, key := range keys {
+		_ = c.Set(key, value, w.TTL)
+	}
+
+	var report AllocReport
+	next := 0
+	nextKey := func() string {
+		key := keys[next]
+		next++
+		if next == len(keys) {
+			next = 0
+		}
+		return key
+	}
+
+	report.PerOp.Set = allocsPerRun(w.Warmup, w.Runs, func() {
+		_ = c.Set(nextKey(), value, w.TTL)
+	})
+	report.PerOp.Get = allocsPerRun(w.Warmup, w.Runs, func() {
+		_ = c.Get(nextKey())
+	})
+	report.PerOp.Has = allocsPerRun(w.Warmup, w.Runs, func() {
+		_ = c.Has(nextKey())
+	})
+	report.PerOp.Delete = allocsPerRun(w.Warmup, w.Runs, func() {
+		_ = c.Delete(missKey)
+	})
+
+	// mixed phase: deterministic interleaving of reads and writes
+	writeEvery := 0
+	if w.ReadRatio < 1 {
+		writeEvery = int(1 / (1 - w.ReadRatio))
+	}
+	step := func(i int) {
+		key := keys[i%len(keys)]
+		if writeEvery > 0 && i%writeEvery == 0 {
+			_ = c.Set(key, value, w.TTL)
+		} else {
+			_ = c.Get(key)
+		}
+	}
+	for i := 0; i < w.Warmup; i++ {
+		step(i)
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < w.Ops; i++ {
+		step(i)
+	}
+	report.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	report.Ops = w.Ops
+	report.Mallocs = after.Mallocs - before.Mallocs
+	report.Bytes = after.TotalAlloc - before.TotalAlloc
+	report.GCCycles = after.NumGC - before.NumGC
+	report.PauseTotal = time.Duration(after.PauseTotalNs - before.PauseTotalNs)
+	return report
+}
+
+// allocsPerRun is testing.AllocsPerRun without the testing dependency,
+// returning the fractional average so small differences stay visible.
+func allocsPerRun(warmup, runs int, f func()) float64 {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	for i := 0; i < warmup; i++ {
+		f()
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	mallocs := ms.Mallocs
+	for i := 0; i < runs; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&ms)
+	return float64(ms.Mallocs-mallocs) / float64(runs)
+}
+
+// ComparisonReport holds the percentage change from a to b for each metric,
+// positive meaning b is higher. A change from zero to non-zero is +Inf.
+type ComparisonReport struct {
+	PerOp OpAllocs
+
+	MallocsPerOp float64
+	BytesPerOp   float64
+	GCCycles     float64
+	PauseTotal   float64
+}
+
+// Compare reports the percentage deltas between two AllocReports.
+func Compare(a, b AllocReport) ComparisonReport {
+	return ComparisonReport{
+		PerOp: OpAllocs{
+			Set:    delta(a.PerOp.Set, b.PerOp.Set),
+			Get:    delta(a.PerOp.Get, b.PerOp.Get),
+			Has:    delta(a.PerOp.Has, b.PerOp.Has),
+			Delete: delta(a.PerOp.Delete, b.PerOp.Delete),
+		},
+		MallocsPerOp: delta(a.MallocsPerOp(), b.MallocsPerOp()),
+		BytesPerOp:   delta(a.BytesPerOp(), b.BytesPerOp()),
+		GCCycles:     delta(float64(a.GCCycles), float64(b.GCCycles)),
+		PauseTotal:   delta(float64(a.PauseTotal), float64(b.PauseTotal)),
+	}
+}
+
+func delta(a, b float64) float64 {
+	switch {
+	case a == b:
+		return 0
+	case a == 0:
+		if b > 0 {
+			return math.Inf(1)
+		}
+		return math.Inf(-1)
+	}
+	return (b - a) / a * 100
+}
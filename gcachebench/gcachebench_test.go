@@ -0,0 +1,102 @@
+package gcachebench
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+)
+
+// copyingCache 在每次 Get 时额外复制两次结果，模拟开销更大的读取路径
+type copyingCache struct {
+	gcache.ICacheWithTTL
+}
+
+func (c copyingCache) Get(key string) []byte {
+	v := c.ICacheWithTTL.Get(key)
+	if v == nil {
+		return nil
+	}
+	tmp := append([]byte(nil), v...)
+	return append([]byte(nil), tmp...)
+}
+
+var testWorkload = Workload{
+	Keys:      256,
+	ValueSize: 64,
+	Ops:       20000,
+	ReadRatio: 0.9,
+	TTL:       time.Hour,
+	Runs:      500,
+}
+
+// TestAllocProfile 测试报告字段被填充
+func TestAllocProfile(t *testing.T) {
+	cache := gcache.NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	report := AllocProfile(cache, testWorkload)
+	if report.Ops != testWorkload.Ops {
+		t.Errorf("Ops = %d, want %d", report.Ops, testWorkload.Ops)
+	}
+	if report.Elapsed <= 0 {
+		t.Error("Elapsed should be positive")
+	}
+	// Get 至少要分配返回的副本
+	if report.PerOp.Get < 1 {
+		t.Errorf("PerOp.Get = %v, want >= 1", report.PerOp.Get)
+	}
+	if report.MallocsPerOp() <= 0 {
+		t.Errorf("MallocsPerOp = %v, want > 0", report.MallocsPerOp())
+	}
+}
+
+// TestCompare_DetectsCopyPath 测试对比报告能识别出多余的复制
+func TestCompare_DetectsCopyPath(t *testing.T) {
+	direct := gcache.NewCacheWithTTL(1024 * 1024)
+	defer direct.Close()
+	copying := copyingCache{gcache.NewCacheWithTTL(1024 * 1024)}
+	defer copying.Close()
+
+	a := AllocProfile(direct, testWorkload)
+	b := AllocProfile(copying, testWorkload)
+	cmp := Compare(a, b)
+
+	if b.PerOp.Get < a.PerOp.Get+1.5 {
+		t.Errorf("copying Get allocs %v, direct %v: difference not detected", b.PerOp.Get, a.PerOp.Get)
+	}
+	if cmp.PerOp.Get <= 0 {
+		t.Errorf("PerOp.Get delta = %v, want > 0", cmp.PerOp.Get)
+	}
+	if cmp.MallocsPerOp <= 0 {
+		t.Errorf("MallocsPerOp delta = %v, want > 0", cmp.MallocsPerOp)
+	}
+	if cmp.BytesPerOp <= 0 {
+		t.Errorf("BytesPerOp delta = %v, want > 0", cmp.BytesPerOp)
+	}
+
+	// 反向对比应该得到负值
+	if rev := Compare(b, a); rev.PerOp.Get >= 0 {
+		t.Errorf("reverse PerOp.Get delta = %v, want < 0", rev.PerOp.Get)
+	}
+}
+
+// TestDelta 测试百分比计算
+func TestDelta(t *testing.T) {
+	testCases := []struct {
+		a, b, want float64
+	}{
+		{10, 10, 0},
+		{10, 15, 50},
+		{10, 5, -50},
+		{0, 0, 0},
+		{0, 1, math.Inf(1)},
+	}
+
+	for _, tc := range testCases {
+		if got := delta(tc.a, tc.b); got != tc.want {
+			t.Errorf("delta(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
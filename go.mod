@@ -3,8 +3,11 @@ module github.com/AcSunday/gwatch-chain
 go 1.24.3
 
 require (
-	github.com/VictoriaMetrics/fastcache v1.13.2 // indirect
-	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/VictoriaMetrics/fastcache v1.13.2
+	github.com/cespare/xxhash/v2 v2.3.0
+)
+
+require (
 	github.com/golang/snappy v1.0.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 )
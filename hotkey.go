@@ -0,0 +1,261 @@
+package gcache
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// hotKeySampling is how many Get calls there are for each one the hot-key
+// tracker records, a power of two
+const hotKeySampling = 64
+
+// hotKeySlots is how many keys the tracker counts per key it reports, the
+// room the top keys need to stand out from the ones passing through
+const hotKeySlots = 8
+
+// ErrInvalidHotKeyWindow is returned by NewCacheE and NewCacheWithTTLE for a
+// WithHotKeyTracking window that isn't positive.
+var ErrInvalidHotKeyWindow = errors.New("gcache: hot key window must be positive")
+
+// WithHotKeyTracking samples one Get in 64 to track the topK keys read the
+// most over the last window, see HotKeys. Every Get-like read counts: GetOK,
+// GetInto, GetFn, GetLease and each key of MGet, while Has and Peek don't. The
+// tracker counts 8*topK keys at most, the least read making room for new ones,
+// and rolls its window on the cache's clock, see WithClock. A non-positive
+// topK disables it, constructors fail with ErrInvalidHotKeyWindow for a
+// window that isn't positive.
+func WithHotKeyTracking(topK int, window time.Duration) Option {
+	return func(o *options) {
+		o.hotKeys, o.hotKeyWindow = topK, window
+	}
+}
+
+// HotKey is a key reported by HotKeys.
+type HotKey struct {
+	// Key is the key as fastcache stores it: with WithKeyHashing, the hex of
+	// its hash for keys past the threshold.
+	Key    string
+	Hashed bool
+	// Hits estimates the Get calls of the key over the last window, from the
+	// calls sampled. Keys read less than a few hundred times are mostly noise.
+	Hits int64
+}
+
+// HotKeys returns the keys read the most over the last window, most read
+// first, nil unless the cache was created WithHotKeyTracking.
+func (c *Cache) HotKeys() []HotKey {
+	if c.hot == nil {
+		return nil
+	}
+	return c.hot.top()
+}
+
+// HotKeys returns the keys read the most over the last window, see Cache.HotKeys.
+func (c *CacheWithTTL) HotKeys() []HotKey {
+	return c.cache.HotKeys()
+}
+
+// HotKeys returns the keys read the most across all shards over the last
+// window, see Cache.HotKeys.
+func (c *ShardedCache) HotKeys() []HotKey {
+	if c.shards[0].hot == nil {
+		return nil
+	}
+	var keys []HotKey
+	for _, s := range c.shards {
+		keys = append(keys, s.HotKeys()...)
+	}
+	return topHotKeys(keys, c.shards[0].hot.topK)
+}
+
+// HotKeys returns the keys read the most across all shards over the last
+// window, see Cache.HotKeys.
+func (c *ShardedCacheWithTTL) HotKeys() []HotKey {
+	if c.shards[0].cache.hot == nil {
+		return nil
+	}
+	var keys []HotKey
+	for _, s := range c.shards {
+		keys = append(keys, s.HotKeys()...)
+	}
+	return topHotKeys(keys, c.shards[0].cache.hot.topK)
+}
+
+// sample records one Get in hotKeySampling of key, if hot keys are tracked
+func (c *Cache) sample(key string) {
+	if c.hot == nil || rand.Uint32()&(hotKeySampling-1) != 0 {
+		return
+	}
+	if c.hashes(key) {
+		c.hot.record(string(c.storeKey(key)), true)
+		return
+	}
+	c.hot.record(key, false)
+}
+
+// hotKeys counts the sampled reads of the current window with the Space-Saving
+// algorithm: a key that isn't counted takes the slot of the least read one,
+// starting from its count, so counts only ever overestimate. The slots are a
+// min-heap on the count. The previous window's counts are kept to weigh in
+// while the current one fills.
+type hotKeys struct {
+	topK   int
+	window time.Duration
+	clock  Clock
+
+	mu    sync.Mutex
+	start time.Time // of the current window
+	slots []hotSlot
+	pos   map[string]int // index of each key in slots
+	prev  map[string]hotSlot
+}
+
+type hotSlot struct {
+	key    string
+	hashed bool
+	n      int64
+}
+
+func newHotKeys(topK int, window time.Duration, clock Clock) *hotKeys {
+	return &hotKeys{
+		topK:   topK,
+		window: window,
+		clock:  clock,
+		start:  clock.Now(),
+		slots:  make([]hotSlot, 0, topK*hotKeySlots),
+		pos:    make(map[string]int, topK*hotKeySlots),
+	}
+}
+
+// record counts a sampled read of key
+func (h *hotKeys) record(key string, hashed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roll(h.clock.Now())
+	if i, ok := h.pos[key]; ok {
+		h.slots[i].n++
+		h.down(i)
+		return
+	}
+	if len(h.slots) < cap(h.slots) {
+		h.slots = append(h.slots, hotSlot{key: key, hashed: hashed, n: 1})
+		h.pos[key] = len(h.slots) - 1
+		h.up(len(h.slots) - 1)
+		return
+	}
+	delete(h.pos, h.slots[0].key)
+	h.slots[0] = hotSlot{key: key, hashed: hashed, n: h.slots[0].n + 1}
+	h.pos[key] = 0
+	h.down(0)
+}
+
+// roll starts a new window if the current one has ended by now, keeping its
+// counts unless it ended more than a window ago
+func (h *hotKeys) roll(now time.Time) {
+	elapsed := now.Sub(h.start)
+	if elapsed < h.window {
+		return
+	}
+	h.prev = nil
+	if elapsed < 2*h.window {
+		h.prev = make(map[string]hotSlot, len(h.slots))
+		for _, s := range h.slots {
+			h.prev[s.key] = s
+		}
+	}
+	h.start = now.Add(-elapsed % h.window)
+	h.slots = h.slots[:0]
+	clear(h.pos)
+}
+
+// top returns the topK keys by their count over the last window: the count of
+// the current window plus the previous one's in proportion to the part of the
+// last window it covers
+func (h *hotKeys) top() []HotKey {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.clock.Now()
+	h.roll(now)
+	weight := 1 - float64(now.Sub(h.start))/float64(h.window)
+
+	counts := make(map[string]float64, len(h.slots)+len(h.prev))
+	hashed := make(map[string]bool, len(h.slots)+len(h.prev))
+	for key, s := range h.prev {
+		counts[key] = float64(s.n) * weight
+		hashed[key] = s.hashed
+	}
+	for _, s := range h.slots {
+		counts[s.key] += float64(s.n)
+		hashed[s.key] = s.hashed
+	}
+	res := make([]HotKey, 0, len(counts))
+	for key, n := range counts {
+		hits := int64(n * hotKeySampling)
+		if hits == 0 {
+			continue
+		}
+		res = append(res, HotKey{Key: key, Hashed: hashed[key], Hits: hits})
+	}
+	res = topHotKeys(res, h.topK)
+	for i := range res {
+		if res[i].Hashed {
+			res[i].Key = hex.EncodeToString([]byte(res[i].Key))
+		}
+	}
+	return res
+}
+
+// topHotKeys returns the topK most read of keys, most read first
+func topHotKeys(keys []HotKey, topK int) []HotKey {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Hits != keys[j].Hits {
+			return keys[i].Hits > keys[j].Hits
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > topK {
+		keys = keys[:topK]
+	}
+	return keys
+}
+
+func (h *hotKeys) less(i, j int) bool {
+	return h.slots[i].n < h.slots[j].n
+}
+
+func (h *hotKeys) swap(i, j int) {
+	h.slots[i], h.slots[j] = h.slots[j], h.slots[i]
+	h.pos[h.slots[i].key] = i
+	h.pos[h.slots[j].key] = j
+}
+
+func (h *hotKeys) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *hotKeys) down(i int) {
+	for {
+		least := i
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h.slots) && h.less(child, least) {
+				least = child
+			}
+		}
+		if least == i {
+			return
+		}
+		h.swap(i, least)
+		i = least
+	}
+}
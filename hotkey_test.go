@@ -0,0 +1,166 @@
+package gcache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readN 读 key n 次
+func readN(cache ICache, key string, n int) {
+	for i := 0; i < n; i++ {
+		cache.GetFn(key, func([]byte) error { return nil })
+	}
+}
+
+// within 判断 got 与 want 的偏差不超过 tolerance 比例
+func within(got, want int64, tolerance float64) bool {
+	diff := float64(got - want)
+	return diff >= -tolerance*float64(want) && diff <= tolerance*float64(want)
+}
+
+// TestHotKeys 测试按采样估计的读取次数返回 top-K key
+func TestHotKeys(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCache(1024*1024, WithClock(clock), WithHotKeyTracking(2, time.Minute))
+	defer cache.Close()
+	for _, key := range []string{"hot", "warm", "cold"} {
+		cache.Set(key, []byte("value"))
+	}
+
+	readN(cache, "hot", 64000)
+	readN(cache, "warm", 12800)
+	readN(cache, "cold", 64)
+	// Has 和 Peek 不计入
+	for i := 0; i < 64000; i++ {
+		cache.Has("cold")
+		cache.Peek("cold")
+	}
+
+	got := cache.HotKeys()
+	if len(got) != 2 || got[0].Key != "hot" || got[1].Key != "warm" || got[0].Hashed {
+		t.Fatalf("HotKeys = %+v, want hot then warm", got)
+	}
+	if !within(got[0].Hits, 64000, 0.15) || !within(got[1].Hits, 12800, 0.35) {
+		t.Errorf("Hits = %d, %d, want about 64000, 12800", got[0].Hits, got[1].Hits)
+	}
+
+	// 窗口结束后上一个窗口按剩余比例计入
+	clock.Advance(time.Minute)
+	full := cache.HotKeys()[0].Hits
+	clock.Advance(30 * time.Second)
+	if half := cache.HotKeys()[0].Hits; half != full/2 && half != (full+1)/2 {
+		t.Errorf("Hits half a window later = %d, want %d", half, full/2)
+	}
+	clock.Advance(2 * time.Minute)
+	if got := cache.HotKeys(); len(got) != 0 {
+		t.Errorf("HotKeys two windows later = %+v, want none", got)
+	}
+
+	// 命中的采样不分配内存
+	readN(cache, "hot", 6400)
+	allocs := testing.AllocsPerRun(1000, func() {
+		cache.GetFn("hot", func([]byte) error { return nil })
+	})
+	if allocs != 0 {
+		t.Errorf("GetFn allocs with hot key tracking = %v, want 0", allocs)
+	}
+
+	// 未开启时返回 nil
+	plain := NewCache(1024 * 1024)
+	defer plain.Close()
+	readN(plain, "hot", 640)
+	if got := plain.HotKeys(); got != nil {
+		t.Errorf("HotKeys without tracking = %+v, want nil", got)
+	}
+
+	if _, err := NewCacheE(1024*1024, WithHotKeyTracking(10, 0)); !errors.Is(err, ErrInvalidHotKeyWindow) {
+		t.Errorf("NewCacheE with a zero window = %v, want ErrInvalidHotKeyWindow", err)
+	}
+}
+
+// TestHotKeys_Bounded 测试跟踪的 key 数量有上限，热点 key 不会被大量冷 key 挤掉
+func TestHotKeys_Bounded(t *testing.T) {
+	cache := NewCache(1024*1024, WithHotKeyTracking(1, time.Minute))
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	cache.Set("hot", []byte("value"))
+	for i := 0; i < 20000; i++ {
+		key := "cold-" + strings.Repeat("x", i%50) + string(rune('a'+i%26))
+		cache.GetFn(key, func([]byte) error { return nil })
+		if i%4 == 0 {
+			readN(cache, "hot", 1)
+		}
+	}
+	if n := len(c.hot.slots); n > hotKeySlots {
+		t.Errorf("tracked %d keys, want at most %d", n, hotKeySlots)
+	}
+	if got := cache.HotKeys(); len(got) != 1 || got[0].Key != "hot" {
+		t.Errorf("HotKeys = %+v, want hot", got)
+	}
+}
+
+// TestHotKeys_Hashed 测试开启 key hashing 时报告 key 的哈希
+func TestHotKeys_Hashed(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithKeyHashing(16), WithHotKeyTracking(1, time.Minute))
+	defer cache.Close()
+
+	key := strings.Repeat("long-key-", 8)
+	cache.Set(key, []byte("value"), time.Minute)
+	readN(cache.AsICache(time.Minute), key, 6400)
+
+	got := cache.HotKeys()
+	if len(got) != 1 || !got[0].Hashed || len(got[0].Key) != 2*keyHashSize {
+		t.Errorf("HotKeys = %+v, want the hex of the key's hash", got)
+	}
+}
+
+// TestHotKeys_Sharded 测试分片缓存合并各分片的 hot key
+func TestHotKeys_Sharded(t *testing.T) {
+	cache := NewShardedCacheWithTTL(4, 1024*1024, WithHotKeyTracking(3, time.Minute))
+	defer cache.Close()
+
+	reads := map[string]int{"a": 51200, "b": 25600, "c": 12800, "d": 1600, "e": 800, "f": 400}
+	for key, n := range reads {
+		cache.Set(key, []byte("value"), time.Minute)
+		for j := 0; j < n; j++ {
+			cache.Get(key)
+		}
+	}
+	got := cache.HotKeys()
+	if len(got) != 3 || got[0].Key != "a" || got[1].Key != "b" || got[2].Key != "c" {
+		t.Errorf("HotKeys = %+v, want a, b, c", got)
+	}
+	plain := NewShardedCache(2, 1024*1024)
+	defer plain.Close()
+	if got := plain.HotKeys(); got != nil {
+		t.Errorf("HotKeys without tracking = %+v, want nil", got)
+	}
+}
+
+// BenchmarkCache_GetHotKeys 基准测试开启 hot key 跟踪前后的 GetFn
+func BenchmarkCache_GetHotKeys(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"off", nil},
+		{"on", []Option{WithHotKeyTracking(10, time.Minute)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCache(100*1024*1024, bc.opts...)
+			defer cache.Close()
+			cache.Set("bench-key", []byte("bench-value"))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					cache.GetFn("bench-key", func([]byte) error { return nil })
+				}
+			})
+		})
+	}
+}
@@ -4,18 +4,123 @@ import "time"
 
 type ICache interface {
 	Has(key string) bool
+	HasMulti(keys []string) []bool
 	Get(key string) []byte
+	GetOK(key string) ([]byte, bool)
+	GetString(key string) (string, bool)
+	GetInto(dst []byte, key string) ([]byte, bool)
+	GetFn(key string, fn func(value []byte) error) (bool, error)
+	GetLease(key string) (*Lease, bool)
+	GetOrDefault(key string, def []byte) []byte
+	Peek(key string) []byte
+	MGet(keys []string) [][]byte
+	MGetMap(keys []string) (map[string][]byte, []string)
+	GetRange(key string, offset, length int) []byte
 	Set(key string, value []byte) error
+	SetString(key, value string) error
+	MSet(entries map[string][]byte) error
+	GetOrSet(key string, value []byte) (actual []byte, stored bool, err error)
+	SetNX(key string, value []byte) (bool, error)
+	SetXX(key string, value []byte) (bool, error)
+	SetReplaced(key string, value []byte) (bool, error)
+	Swap(key string, value []byte) (old []byte, existed bool, err error)
+	CompareAndSwap(key string, expected, value []byte) (bool, error)
+	Append(key string, data []byte) error
+	Incr(key string, delta int64) (int64, error)
+	Decr(key string, delta int64) (int64, error)
+	IncrFloat(key string, delta float64) (float64, error)
 	Delete(key string) error
+	GetAndDelete(key string) []byte
+	CompareAndDelete(key string, expected []byte) (bool, error)
+	MDelete(keys ...string) (int, error)
+	Stats() Stats
+	ResetStats() Stats
+	EffectiveMaxBytes() int
+	HotKeys() []HotKey
 
+	Reset() error
 	Close() error
 }
 
 type ICacheWithTTL interface {
 	Has(key string) bool
+	HasMulti(keys []string) []bool
 	Get(key string) []byte
+	GetOK(key string) ([]byte, bool)
+	GetString(key string) (string, bool)
+	GetE(key string) ([]byte, error)
+	GetInto(dst []byte, key string) ([]byte, bool)
+	GetFn(key string, fn func(value []byte) error) (bool, error)
+	GetLease(key string) (*Lease, bool)
+	GetOrDefault(key string, def []byte) []byte
+	Peek(key string) []byte
+	MGet(keys []string) [][]byte
+	MGetMap(keys []string) (map[string][]byte, []string)
+	GetRange(key string, offset, length int) []byte
 	Set(key string, value []byte, ttl time.Duration) error
+	SetString(key, value string, ttl time.Duration) error
+	SetWithExpireAt(key string, value []byte, expireAt time.Time) error
+	SetWithSoftTTL(key string, value []byte, soft, hard time.Duration) error
+	SetWithTTI(key string, value []byte, ttl, tti time.Duration) error
+	MSet(entries []TTLEntry) error
+	SetMany(entries []TTLEntry) error
+	GetOrSet(key string, value []byte, ttl time.Duration) (actual []byte, stored bool, err error)
+	GetOrCompute(key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error)
+	MGetOrCompute(keys []string, ttl time.Duration, loader func(missing []string) (map[string][]byte, error)) (map[string][]byte, error)
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	SetXX(key string, value []byte, ttl time.Duration) (bool, error)
+	SetReplaced(key string, value []byte, ttl time.Duration) (bool, error)
+	Swap(key string, value []byte, ttl time.Duration) (old []byte, existed bool, err error)
+	CompareAndSwap(key string, expected, value []byte, ttl time.Duration) (bool, error)
+	Append(key string, data []byte, ttl time.Duration) error
+	Incr(key string, delta int64, ttl time.Duration) (int64, error)
+	Decr(key string, delta int64, ttl time.Duration) (int64, error)
+	IncrFloat(key string, delta float64, ttl time.Duration) (float64, error)
 	Delete(key string) error
+	GetAndDelete(key string) []byte
+	CompareAndDelete(key string, expected []byte) (bool, error)
+	MDelete(keys ...string) (int, error)
 
+	Inspect(key string) EntryState
+	TTL(key string) (time.Duration, bool)
+	GetWithTTL(key string) ([]byte, time.Duration, bool)
+	GetStale(key string) (value []byte, stale bool, ok bool)
+	Age(key string) (time.Duration, bool)
+	LazyPurged() int64
+	LastSweep() (SweepResult, bool)
+	Stats() Stats
+	TTLStats() TTLStats
+	ResetStats() Stats
+	AsICache(ttl time.Duration) ICache
+	Compact() (CompactReport, error)
+	Expire(key string, ttl time.Duration) (bool, error)
+	Persist(key string) (bool, error)
+	Touch(key string) (bool, error)
+	SetTTLRules(rules []TTLRule) error
+	EffectiveMaxBytes() int
+	HotKeys() []HotKey
+
+	Reset() error
 	Close() error
 }
+
+// EntryState is the state of a key as reported by ICacheWithTTL.Inspect
+type EntryState int
+
+const (
+	EntryAbsent EntryState = iota // never stored, deleted or evicted
+	EntryFresh                    // stored and not expired
+	EntryStale                    // stored but expired, the bytes are still resident
+)
+
+func (s EntryState) String() string {
+	switch s {
+	case EntryAbsent:
+		return "absent"
+	case EntryFresh:
+		return "fresh"
+	case EntryStale:
+		return "stale"
+	}
+	return "unknown"
+}
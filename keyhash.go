@@ -0,0 +1,70 @@
+package gcache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// Keys longer than the WithKeyHashing threshold are stored under the first
+// keyHashSize bytes of their SHA-256, and their value in an envelope
+// [uvarint len(key)][key][value], so a read can tell a hash collision from
+// its own entry. With CacheWithTTL the value in the envelope is the wrapped
+// entry, header included.
+
+// keyHashSize is the length of a hashed key
+const keyHashSize = 16
+
+// ErrInvalidKeyHashing is returned by NewCacheE and NewCacheWithTTLE for a
+// WithKeyHashing threshold shorter than a hashed key.
+var ErrInvalidKeyHashing = errors.New("gcache: key hashing threshold must be at least 16 bytes")
+
+// WithKeyHashing stores keys longer than threshold bytes under a 16-byte hash
+// of them, so fastcache indexes and compares short fixed-size keys. The
+// original key is stored with the value and checked on reads, so colliding
+// keys miss rather than read each other's value, and still counts against the
+// per-entry limit. With WithBigValues only the hash is limited in size. A
+// non-positive threshold disables it, constructors fail with
+// ErrInvalidKeyHashing below 16.
+func WithKeyHashing(threshold int) Option {
+	return func(o *options) {
+		o.keyHashing = threshold
+	}
+}
+
+// hashes reports whether key is stored under its hash
+func (c *Cache) hashes(key string) bool {
+	return c.hashKeysOver > 0 && len(key) > c.hashKeysOver
+}
+
+// storeKey returns the key fastcache stores key under
+func (c *Cache) storeKey(key string) []byte {
+	if !c.hashes(key) {
+		return keyBytes(key)
+	}
+	sum := sha256.Sum256(keyBytes(key))
+	return sum[:keyHashSize]
+}
+
+func envelopeSize(key string) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(len(key))) + len(key)
+}
+
+// seal puts value in the envelope of a hashed key
+func seal(key string, value []byte) []byte {
+	buf := make([]byte, 0, envelopeSize(key)+len(value))
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	return append(buf, value...)
+}
+
+// unseal returns the value in the envelope of a hashed key, false if it was
+// written for another key
+func unseal(sealed []byte, key string) ([]byte, bool) {
+	l, m := binary.Uvarint(sealed)
+	if m <= 0 || uint64(len(sealed)-m) < l || string(sealed[m:m+int(l)]) != key {
+		return nil, false
+	}
+	return sealed[m+int(l):], true
+}
@@ -0,0 +1,144 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestKeyHashing 测试超过阈值的长 key 以哈希存储，读写删除都透明
+func TestKeyHashing(t *testing.T) {
+	cache := NewCache(1024*1024, WithKeyHashing(64))
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	long := strings.Repeat("k", 4096)
+	if err := cache.Set(long, []byte("value")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if c.fc().Has([]byte(long)) {
+		t.Error("long key should not be stored as is")
+	}
+	if got := cache.Get(long); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get = %q, want value", got)
+	}
+	if !cache.Has(long) || !cache.HasMulti([]string{long})[0] {
+		t.Error("Has = false, want true")
+	}
+	if got := cache.MGet([]string{long}); !bytes.Equal(got[0], []byte("value")) {
+		t.Errorf("MGet = %q, want value", got[0])
+	}
+	if n, err := cache.Incr(long+"-n", 2); err != nil || n != 2 {
+		t.Errorf("Incr = %d, %v, want 2, nil", n, err)
+	}
+
+	// 短 key 不受影响
+	cache.Set("short", []byte("value"))
+	if !c.fc().Has([]byte("short")) {
+		t.Error("short key should be stored as is")
+	}
+
+	if err := cache.Delete(long); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if cache.Has(long) || cache.Get(long) != nil {
+		t.Error("deleted long key should miss")
+	}
+}
+
+// TestKeyHashing_SharedPrefix 测试共享长前缀的不同 key 互不影响
+func TestKeyHashing_SharedPrefix(t *testing.T) {
+	cache := NewCache(1024*1024, WithKeyHashing(64))
+	defer cache.Close()
+
+	prefix := "https://example.com/search?" + strings.Repeat("q=a&", 1000)
+	a, b := prefix+"#a", prefix+"#b"
+	cache.Set(a, []byte("A"))
+	cache.Set(b, []byte("B"))
+	if got := cache.Get(a); !bytes.Equal(got, []byte("A")) {
+		t.Errorf("Get(a) = %q, want A", got)
+	}
+	if got := cache.Get(b); !bytes.Equal(got, []byte("B")) {
+		t.Errorf("Get(b) = %q, want B", got)
+	}
+	cache.Delete(a)
+	if cache.Has(a) || !cache.Has(b) {
+		t.Error("deleting a should leave b")
+	}
+}
+
+// TestKeyHashing_Collision 测试哈希碰撞时读到别的 key 写入的 entry 视为未命中
+func TestKeyHashing_Collision(t *testing.T) {
+	cache := NewCache(1024*1024, WithKeyHashing(16))
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	a, b := strings.Repeat("a", 100), strings.Repeat("b", 100)
+	// 模拟碰撞：把 b 的 entry 写到 a 的哈希下
+	c.fc().Set(c.storeKey(a), seal(b, []byte("B")))
+	if got, ok := cache.GetOK(a); ok {
+		t.Errorf("GetOK(a) = %q, true, want a miss", got)
+	}
+	if cache.Has(a) {
+		t.Error("Has(a) = true, want false")
+	}
+}
+
+// TestKeyHashing_Size 测试哈希后长 key 不再占用单条上限
+func TestKeyHashing_Size(t *testing.T) {
+	long := strings.Repeat("k", 8*1024)
+	value := make([]byte, 60*1024)
+
+	plain := NewCache(1024 * 1024)
+	defer plain.Close()
+	if err := plain.Set(long, value); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Set without hashing = %v, want %v", err, ErrValueTooLarge)
+	}
+
+	// 信封里仍保存原始 key，所以 key 与 value 之和仍受上限约束
+	cache := NewCache(1024*1024, WithKeyHashing(64))
+	defer cache.Close()
+	if err := cache.Set(long, value); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Set with hashing = %v, want %v", err, ErrValueTooLarge)
+	}
+	if err := cache.Set(long, value[:50*1024]); err != nil {
+		t.Errorf("Set with hashing failed: %v", err)
+	}
+
+	if _, err := NewCacheE(1024, WithKeyHashing(8)); !errors.Is(err, ErrInvalidKeyHashing) {
+		t.Errorf("NewCacheE with WithKeyHashing(8) = %v, want %v", err, ErrInvalidKeyHashing)
+	}
+}
+
+// TestKeyHashing_TTL 测试 CacheWithTTL 下长 key 的读写、过期与压缩
+func TestKeyHashing_TTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithKeyHashing(64), WithKeyIndex())
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	long := strings.Repeat("k", 2048)
+	cache.Set(long, []byte("value"), time.Minute)
+	cache.Set(long+"-short", []byte("value"), time.Second)
+	if c.cache.fc().Has([]byte(long)) {
+		t.Error("long key should not be stored as is")
+	}
+	if got, ttl, ok := cache.GetWithTTL(long); !ok || !bytes.Equal(got, []byte("value")) || ttl != time.Minute {
+		t.Errorf("GetWithTTL = %q, %v, %v, want value, 1m, true", got, ttl, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	rep, err := cache.Compact()
+	if err != nil || rep.Retained != 1 || rep.Dropped != 1 {
+		t.Errorf("Compact = %+v, %v, want 1 retained and 1 dropped", rep, err)
+	}
+	if got := cache.Get(long); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get after Compact = %q, want value", got)
+	}
+	cache.Delete(long)
+	if cache.Has(long) {
+		t.Error("deleted long key should miss")
+	}
+}
@@ -0,0 +1,147 @@
+package gcache
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// keyIndex tracks the keys written to a CacheWithTTL, which fastcache can't
+// enumerate. Keys are added and removed under their lock stripe, after the
+// write or delete, so a key held by fastcache is always indexed. Keys
+// fastcache evicted stay until a sweep or probe finds them gone. A nil
+// *keyIndex tracks nothing.
+type keyIndex struct {
+	shards [lockStripes]indexShard
+	n      atomic.Int64
+}
+
+// indexShard keeps its keys in a slice for cursors and sampling,
+// with their positions for O(1) removal
+type indexShard struct {
+	mu   sync.Mutex
+	pos  map[string]int
+	keys []string
+}
+
+func newKeyIndex() *keyIndex {
+	x := &keyIndex{}
+	for i := range x.shards {
+		x.shards[i].pos = make(map[string]int)
+	}
+	return x
+}
+
+func (x *keyIndex) shard(key string) *indexShard {
+	return &x.shards[xxhash.Sum64String(key)&(lockStripes-1)]
+}
+
+func (x *keyIndex) add(key string) {
+	if x == nil {
+		return
+	}
+	s := x.shard(key)
+	s.mu.Lock()
+	if _, ok := s.pos[key]; !ok {
+		s.pos[key] = len(s.keys)
+		s.keys = append(s.keys, key)
+		x.n.Add(1)
+	}
+	s.mu.Unlock()
+}
+
+func (x *keyIndex) remove(key string) {
+	if x == nil {
+		return
+	}
+	s := x.shard(key)
+	s.mu.Lock()
+	if i, ok := s.pos[key]; ok {
+		last := len(s.keys) - 1
+		s.keys[i] = s.keys[last]
+		s.pos[s.keys[i]] = i
+		s.keys[last] = ""
+		s.keys = s.keys[:last]
+		delete(s.pos, key)
+		x.n.Add(-1)
+	}
+	s.mu.Unlock()
+}
+
+// len returns the number of indexed keys
+func (x *keyIndex) len() int {
+	if x == nil {
+		return 0
+	}
+	return int(x.n.Load())
+}
+
+// sample returns a random key of a random shard, false if that shard is empty
+func (x *keyIndex) sample() (string, bool) {
+	s := &x.shards[rand.IntN(lockStripes)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.keys) == 0 {
+		return "", false
+	}
+	return s.keys[rand.IntN(len(s.keys))], true
+}
+
+// collect appends up to max keys of shard i from position pos to dst and
+// returns the position after them, or 0 once the shard is exhausted
+func (x *keyIndex) collect(dst []string, i, pos, max int) ([]string, int) {
+	s := &x.shards[i]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos >= len(s.keys) {
+		return dst, 0
+	}
+	end := min(pos+max, len(s.keys))
+	dst = append(dst, s.keys[pos:end]...)
+	if end == len(s.keys) {
+		return dst, 0
+	}
+	return dst, end
+}
+
+// clear drops every key
+func (x *keyIndex) clear() {
+	if x == nil {
+		return
+	}
+	for i := range x.shards {
+		s := &x.shards[i]
+		s.mu.Lock()
+		x.n.Add(-int64(len(s.keys)))
+		clear(s.pos)
+		clear(s.keys)
+		s.keys = s.keys[:0]
+		s.mu.Unlock()
+	}
+}
+
+// retain drops every key for which keep returns false
+func (x *keyIndex) retain(keep func(key string) bool) {
+	for i := range x.shards {
+		s := &x.shards[i]
+		s.mu.Lock()
+		for j := 0; j < len(s.keys); {
+			if key := s.keys[j]; keep(key) {
+				j++
+				continue
+			}
+			last := len(s.keys) - 1
+			delete(s.pos, s.keys[j])
+			s.keys[j] = s.keys[last]
+			if j < last {
+				s.pos[s.keys[j]] = j
+			}
+			s.keys[last] = ""
+			s.keys = s.keys[:last]
+			x.n.Add(-1)
+		}
+		s.mu.Unlock()
+	}
+}
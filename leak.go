@@ -0,0 +1,62 @@
+package gcache
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+var (
+	leakedCaches atomic.Int64
+	leakHandler  atomic.Pointer[func()]
+)
+
+// LeakedCaches returns how many caches created WithFinalizerSafety were
+// garbage collected without being closed.
+func LeakedCaches() int64 {
+	return leakedCaches.Load()
+}
+
+// SetLeakHandler sets fn to be called each time a leaked cache is reclaimed,
+// e.g. to log it. fn runs on the runtime's cleanup goroutine and must not block.
+// Passing nil removes the handler.
+func SetLeakHandler(fn func()) {
+	if fn == nil {
+		leakHandler.Store(nil)
+		return
+	}
+	leakHandler.Store(&fn)
+}
+
+// WithFinalizerSafety releases the cache's memory if the cache becomes
+// unreachable without Close being called, counting it in LeakedCaches.
+// Close unregisters the cleanup, so closed caches pay nothing.
+func WithFinalizerSafety() Option {
+	return func(o *options) {
+		o.finalizerSafety = true
+	}
+}
+
+// leakedStores are the fastcache instances of a Cache, held by its leak
+// cleanup without the Cache itself
+type leakedStores struct {
+	fc  *atomic.Pointer[fastcache.Cache]
+	big *fastcache.Cache
+}
+
+func registerLeakCleanup(c *Cache) {
+	c.cleanup = runtime.AddCleanup(c, reclaimLeaked, leakedStores{fc: c.cache, big: c.big})
+}
+
+// reclaimLeaked must not reference the Cache itself, or it would never become unreachable
+func reclaimLeaked(s leakedStores) {
+	s.fc.Load().Reset()
+	if s.big != nil {
+		s.big.Reset()
+	}
+	leakedCaches.Add(1)
+	if fn := leakHandler.Load(); fn != nil {
+		(*fn)()
+	}
+}
@@ -0,0 +1,86 @@
+package gcache
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitLeaked 反复 GC 直到泄露计数达到 want 或超时
+func waitLeaked(want int64) int64 {
+	deadline := time.Now().Add(5 * time.Second)
+	for LeakedCaches() < want && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return LeakedCaches()
+}
+
+// TestFinalizerSafety_Leaked 测试未关闭就被回收的缓存会被计数
+func TestFinalizerSafety_Leaked(t *testing.T) {
+	var calls atomic.Int64
+	SetLeakHandler(func() { calls.Add(1) })
+	defer SetLeakHandler(nil)
+
+	baseGoroutines := runtime.NumGoroutine()
+	baseLeaked := LeakedCaches()
+
+	const numCaches = 4
+	func() {
+		for i := 0; i < numCaches/2; i++ {
+			cache := NewCache(1024*1024, WithFinalizerSafety())
+			cache.Set("key", []byte("value"))
+			ttlCache := NewCacheWithTTL(1024*1024, WithFinalizerSafety())
+			ttlCache.Set("key", []byte("value"), time.Minute)
+		}
+	}()
+
+	if got := waitLeaked(baseLeaked + numCaches); got != baseLeaked+numCaches {
+		t.Fatalf("LeakedCaches = %d, want %d", got, baseLeaked+numCaches)
+	}
+	if got := calls.Load(); got != numCaches {
+		t.Errorf("leak handler called %d times, want %d", got, numCaches)
+	}
+	if got := runtime.NumGoroutine(); got > baseGoroutines {
+		t.Errorf("goroutines = %d, want <= %d", got, baseGoroutines)
+	}
+}
+
+// TestFinalizerSafety_Closed 测试正常关闭的缓存不会被计数
+func TestFinalizerSafety_Closed(t *testing.T) {
+	baseLeaked := LeakedCaches()
+
+	func() {
+		cache := NewCache(1024*1024, WithFinalizerSafety())
+		cache.Close()
+		ttlCache := NewCacheWithTTL(1024*1024, WithFinalizerSafety())
+		ttlCache.Close()
+	}()
+
+	// 作为对照，再泄露一个缓存，等它被回收说明前面的也已经不可达
+	func() {
+		NewCache(1024*1024, WithFinalizerSafety())
+	}()
+
+	if got := waitLeaked(baseLeaked + 1); got != baseLeaked+1 {
+		t.Errorf("LeakedCaches = %d, want %d", got, baseLeaked+1)
+	}
+}
+
+// TestFinalizerSafety_Sweeper 测试带后台清理的缓存未关闭时仍能被回收
+func TestFinalizerSafety_Sweeper(t *testing.T) {
+	baseGoroutines := runtime.NumGoroutine()
+	baseLeaked := LeakedCaches()
+
+	func() {
+		NewCacheWithTTL(1024*1024, WithFinalizerSafety(), WithCleanupInterval(time.Millisecond))
+	}()
+
+	if got := waitLeaked(baseLeaked + 1); got != baseLeaked+1 {
+		t.Fatalf("LeakedCaches = %d, want %d", got, baseLeaked+1)
+	}
+	if got := runtime.NumGoroutine(); got > baseGoroutines {
+		t.Errorf("goroutines = %d, want <= %d", got, baseGoroutines)
+	}
+}
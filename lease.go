@@ -0,0 +1,128 @@
+package gcache
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+var leakedLeases atomic.Int64
+
+// LeakedLeases returns how many leases of caches created WithLeaseDebug were
+// garbage collected without being released.
+func LeakedLeases() int64 {
+	return leakedLeases.Load()
+}
+
+// WithLeaseDebug tracks the leases handed out by GetLease, counting those
+// garbage collected without Release in LeakedLeases. Each lease then
+// registers a cleanup, so it's meant for tests and debugging.
+func WithLeaseDebug() Option {
+	return func(o *options) {
+		o.leaseDebug = true
+	}
+}
+
+// Lease is a value read by GetLease into a buffer of the cache's pool. The
+// buffer returns to the pool on Release. Each GetLease returns a lease of its
+// own, so a released lease can't reach the buffer of a later one.
+type Lease struct {
+	pool    *bufPool
+	buf     *readBuf
+	value   []byte
+	cleanup runtime.Cleanup // registered WithLeaseDebug
+	tracked bool
+}
+
+// Bytes returns the leased value. It is only valid until Release: it must not
+// be retained or modified after, as the buffer is reused by other reads.
+func (l *Lease) Bytes() []byte {
+	return l.value
+}
+
+// Release returns the buffer of l to the pool. The lease must not be used
+// afterwards. Release is a no-op on a released lease, but must not be
+// called concurrently.
+func (l *Lease) Release() {
+	buf := l.buf
+	if buf == nil {
+		return
+	}
+	l.buf, l.value = nil, nil
+	if l.tracked {
+		l.cleanup.Stop()
+	}
+	l.pool.put(buf)
+}
+
+func countLeakedLease(struct{}) {
+	leakedLeases.Add(1)
+}
+
+// GetLease returns the value of key in a pooled buffer, without the copy Get
+// makes, and whether key was found. The caller must Release the lease once
+// done with its bytes. A missing key returns a nil lease.
+func (c *Cache) GetLease(key string) (*Lease, bool) {
+	start := c.observeStart()
+	l, ok := c.getLease(key)
+	c.countGet(ok)
+	c.observeGet(start, ok)
+	return l, ok
+}
+
+// getLease is GetLease without counting towards the stats
+func (c *Cache) getLease(key string) (*Lease, bool) {
+	if !c.enter() {
+		return nil, false
+	}
+	defer c.leave()
+	c.sample(key)
+	if c.filtered(key) {
+		return nil, false
+	}
+	buf := c.pool.get()
+	value, has := c.load(buf, key)
+	c.passedFilter(has)
+	if !has {
+		c.pool.put(buf)
+		return nil, false
+	}
+	return c.lease(buf, value), true
+}
+
+// lease hands out value, read into buf. Only the buffer is pooled: a pooled
+// lease would be handed out again while a holder that released it may still
+// call it.
+func (c *Cache) lease(buf *readBuf, value []byte) *Lease {
+	l := &Lease{pool: c.pool, buf: buf, value: value}
+	if c.leaseDebug {
+		l.tracked = true
+		l.cleanup = runtime.AddCleanup(l, countLeakedLease, struct{}{})
+	}
+	return l
+}
+
+// GetLease returns the live value of key, without its header, in a pooled
+// buffer, see Cache.GetLease. Misses are counted and expired entries purged
+// like Get does.
+func (c *CacheWithTTL) GetLease(key string) (*Lease, bool) {
+	start := c.cache.observeStart()
+	l, has := c.cache.getLease(key)
+	if !has {
+		c.countRead(start, countMissesAbsent)
+		return nil, false
+	}
+	data := l.value
+	value, ok := c.unwrap(data)
+	if !ok {
+		foreign := c.foreign(data)
+		l.Release()
+		c.countRead(start, c.missed(key, foreign))
+		return nil, false
+	}
+	c.countRead(start, countTTLHits)
+	l.value = value
+	if isIdle(data) {
+		c.access(key)
+	}
+	return l, true
+}
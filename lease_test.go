@@ -0,0 +1,161 @@
+package gcache
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitLeakedLeases 反复 GC 直到泄露的 lease 计数达到 want 或超时
+func waitLeakedLeases(want int64) int64 {
+	deadline := time.Now().Add(5 * time.Second)
+	for LeakedLeases() < want && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return LeakedLeases()
+}
+
+// TestCache_GetLease 测试 GetLease 返回 pool 中的 value，Release 后 buffer 回到 pool
+func TestCache_GetLease(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"))
+	cache.Set("empty", []byte{})
+
+	l, ok := cache.GetLease("key")
+	if !ok || !bytes.Equal(l.Bytes(), []byte("value")) {
+		t.Fatalf("GetLease = %q, %v, want value, true", l.Bytes(), ok)
+	}
+	l.Release()
+	l.Release() // 重复 Release 无副作用
+
+	if l, ok := cache.GetLease("empty"); !ok || len(l.Bytes()) != 0 {
+		t.Errorf("GetLease(empty) = %q, %v, want an empty hit", l.Bytes(), ok)
+	} else {
+		l.Release()
+	}
+	if l, ok := cache.GetLease("missing"); ok || l != nil {
+		t.Errorf("GetLease(missing) = %v, %v, want nil, false", l, ok)
+	}
+
+	// 同时持有的 lease 互不影响
+	cache.Set("other", []byte("other value"))
+	a, _ := cache.GetLease("key")
+	b, _ := cache.GetLease("other")
+	if !bytes.Equal(a.Bytes(), []byte("value")) || !bytes.Equal(b.Bytes(), []byte("other value")) {
+		t.Errorf("leases = %q, %q, want value, other value", a.Bytes(), b.Bytes())
+	}
+	a.Release()
+	b.Release()
+
+	// 只分配 lease 本身，buffer 来自 pool
+	allocs := testing.AllocsPerRun(100, func() {
+		l, _ := cache.GetLease("key")
+		l.Release()
+	})
+	if allocs != 1 {
+		t.Errorf("GetLease allocs = %v, want 1", allocs)
+	}
+
+	cache.Close()
+	if l, ok := cache.GetLease("key"); ok || l != nil {
+		t.Errorf("GetLease after Close = %v, %v, want nil, false", l, ok)
+	}
+}
+
+// TestCache_GetLeaseReleaseTwice 测试重复 Release 不会影响之后复用同一 buffer 的 lease
+func TestCache_GetLeaseReleaseTwice(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+	cache.Set("a", []byte("value a"))
+	cache.Set("b", []byte("value b"))
+
+	a, _ := cache.GetLease("a")
+	a.Release()
+	// b 拿到 a 刚归还的 buffer
+	b, _ := cache.GetLease("b")
+	a.Release()
+	if a == b || a.Bytes() != nil {
+		t.Errorf("released lease %p = %q, want nil and distinct from %p", a, a.Bytes(), b)
+	}
+	// a 的第二次 Release 没有归还 b 的 buffer，再读不会覆盖它
+	c, _ := cache.GetLease("a")
+	if !bytes.Equal(b.Bytes(), []byte("value b")) || !bytes.Equal(c.Bytes(), []byte("value a")) {
+		t.Errorf("leases = %q, %q, want value b, value a", b.Bytes(), c.Bytes())
+	}
+	b.Release()
+	c.Release()
+}
+
+// TestCacheWithTTL_GetLease 测试 TTL 缓存的 lease 只包含 payload，过期 entry 被清理
+func TestCacheWithTTL_GetLease(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock))
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), time.Minute)
+	cache.Set("short", []byte("value"), time.Second)
+
+	l, ok := cache.GetLease("key")
+	if !ok || !bytes.Equal(l.Bytes(), []byte("value")) {
+		t.Fatalf("GetLease = %q, %v, want value, true", l.Bytes(), ok)
+	}
+	l.Release()
+
+	// 通过 ICache 视图同样可用
+	if l, ok := cache.AsICache(time.Minute).GetLease("key"); !ok || !bytes.Equal(l.Bytes(), []byte("value")) {
+		t.Errorf("view GetLease = %q, %v, want value, true", l.Bytes(), ok)
+	} else {
+		l.Release()
+	}
+
+	clock.Advance(2 * time.Second)
+	if l, ok := cache.GetLease("short"); ok || l != nil {
+		t.Errorf("GetLease of an expired key = %v, %v, want nil, false", l, ok)
+	}
+	if got := cache.Stats().ExpiredReads; got != 1 || cache.LazyPurged() != 1 {
+		t.Errorf("ExpiredReads = %d, LazyPurged = %d, want 1, 1", got, cache.LazyPurged())
+	}
+}
+
+// TestLease_Leaked 测试 WithLeaseDebug 下未 Release 的 lease 被计数
+func TestLease_Leaked(t *testing.T) {
+	cache := NewCache(1024*1024, WithLeaseDebug())
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+	base := LeakedLeases()
+
+	// 已 Release 的 lease 不计数
+	func() {
+		for i := 0; i < 2; i++ {
+			l, _ := cache.GetLease("key")
+			l.Release()
+		}
+		for i := 0; i < 3; i++ {
+			if l, ok := cache.GetLease("key"); !ok || !bytes.Equal(l.Bytes(), []byte("value")) {
+				t.Errorf("GetLease = %q, %v, want value, true", l.Bytes(), ok)
+			}
+		}
+	}()
+
+	if got := waitLeakedLeases(base + 3); got != base+3 {
+		t.Fatalf("LeakedLeases = %d, want %d", got, base+3)
+	}
+}
+
+// BenchmarkCache_GetLease 基准测试 GetLease
+func BenchmarkCache_GetLease(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+	cache.Set("bench-key", []byte("bench-value"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l, _ := cache.GetLease("bench-key")
+		l.Release()
+	}
+}
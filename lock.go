@@ -0,0 +1,34 @@
+package gcache
+
+import (
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const lockStripes = 256 // power of two
+
+// keyLocks serializes gcache's writes to the same key, so read-modify-write
+// operations are atomic against each other and against plain Set/Delete.
+// fastcache itself has no conditional writes.
+type keyLocks [lockStripes]sync.Mutex
+
+// lock locks the stripe of key and returns it for unlocking
+func (l *keyLocks) lock(key string) *sync.Mutex {
+	mu := &l[xxhash.Sum64String(key)&(lockStripes-1)]
+	mu.Lock()
+	return mu
+}
+
+// lockAll locks every stripe, holding off all writes until unlockAll
+func (l *keyLocks) lockAll() {
+	for i := range l {
+		l[i].Lock()
+	}
+}
+
+func (l *keyLocks) unlockAll() {
+	for i := range l {
+		l[i].Unlock()
+	}
+}
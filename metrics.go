@@ -0,0 +1,91 @@
+package gcache
+
+import "time"
+
+// MetricsRecorder receives the operations of a cache as they complete, to
+// feed a metrics system gcache doesn't know about, see WithMetricsRecorder.
+// Its methods are called from the goroutines calling the cache, concurrently,
+// never while the cache holds a lock: they may block, though the caller waits
+// for them, but must not call back into the cache they observe.
+type MetricsRecorder interface {
+	// ObserveGet is called for each read Stats.GetCalls counts, hit false for
+	// missing and expired keys. The keys of a batch, like MGet, share its
+	// duration evenly.
+	ObserveGet(hit bool, d time.Duration)
+	// ObserveSet is called for each write Stats.SetCalls counts, failed ones
+	// included, with the size of the value passed.
+	ObserveSet(d time.Duration, size int)
+	// ObserveDelete is called for each delete Stats.DelCalls counts.
+	ObserveDelete(d time.Duration)
+	// ObserveExpired is called for each expired entry a CacheWithTTL deletes,
+	// see TTLStats.ExpiredPurged.
+	ObserveExpired()
+}
+
+// NopMetricsRecorder is a MetricsRecorder doing nothing, the default.
+type NopMetricsRecorder struct{}
+
+func (NopMetricsRecorder) ObserveGet(bool, time.Duration) {}
+func (NopMetricsRecorder) ObserveSet(time.Duration, int)  {}
+func (NopMetricsRecorder) ObserveDelete(time.Duration)    {}
+func (NopMetricsRecorder) ObserveExpired()                {}
+
+// WithMetricsRecorder reports every read, write, delete and expired entry
+// purged to r, timed on real time whatever the clock of WithClock. Without
+// one, or with a nil or NopMetricsRecorder, operations only check for it and
+// read no time.
+func WithMetricsRecorder(r MetricsRecorder) Option {
+	return func(o *options) {
+		if _, nop := r.(NopMetricsRecorder); nop {
+			r = nil
+		}
+		o.metrics = r
+	}
+}
+
+// observeStart returns the start of an operation to time, zero without a
+// recorder
+func (c *Cache) observeStart() time.Time {
+	if c.metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (c *Cache) observeGet(start time.Time, hit bool) {
+	if c.metrics != nil {
+		c.metrics.ObserveGet(hit, time.Since(start))
+	}
+}
+
+// observeGets reports the reads of a batch started at start, found by position
+func (c *Cache) observeGets(start time.Time, found []bool) {
+	if c.metrics == nil || len(found) == 0 {
+		return
+	}
+	d := time.Since(start) / time.Duration(len(found))
+	for _, hit := range found {
+		c.metrics.ObserveGet(hit, d)
+	}
+}
+
+func (c *Cache) observeSet(start time.Time, size int) {
+	if c.metrics != nil {
+		c.metrics.ObserveSet(time.Since(start), size)
+	}
+}
+
+func (c *Cache) observeDelete(start time.Time) {
+	if c.metrics != nil {
+		c.metrics.ObserveDelete(time.Since(start))
+	}
+}
+
+// expiredPurged counts an expired entry deleted, after its key's lock is
+// released
+func (c *Cache) expiredPurged() {
+	c.counts.add(countExpiredPurged)
+	if c.metrics != nil {
+		c.metrics.ObserveExpired()
+	}
+}
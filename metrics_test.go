@@ -0,0 +1,190 @@
+package gcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics 记录每类调用的次数和最大耗时，并检查调用时缓存没有持有锁
+type recordingMetrics struct {
+	cache *Cache
+
+	mu                     sync.Mutex
+	hits, misses           int
+	sets, deletes, expired int
+	setBytes               int
+	maxDuration            time.Duration
+	negative, underLock    bool
+}
+
+func (r *recordingMetrics) observe(d time.Duration) {
+	r.negative = r.negative || d < 0
+	r.maxDuration = max(r.maxDuration, d)
+	// 单 goroutine 的测试中锁拿不到只能是调用方持有
+	for i := range r.cache.locks {
+		if !r.cache.locks[i].TryLock() {
+			r.underLock = true
+			continue
+		}
+		r.cache.locks[i].Unlock()
+	}
+	if !r.cache.reads.TryLock() {
+		r.underLock = true
+		return
+	}
+	r.cache.reads.Unlock()
+}
+
+func (r *recordingMetrics) ObserveGet(hit bool, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hit {
+		r.hits++
+	} else {
+		r.misses++
+	}
+	r.observe(d)
+}
+
+func (r *recordingMetrics) ObserveSet(d time.Duration, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sets++
+	r.setBytes += size
+	r.observe(d)
+}
+
+func (r *recordingMetrics) ObserveDelete(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deletes++
+	r.observe(d)
+}
+
+func (r *recordingMetrics) ObserveExpired() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expired++
+	r.observe(0)
+}
+
+// TestMetricsRecorder 测试 recorder 收到的调用次数与 Stats 一致，耗时合理且不在锁内调用
+func TestMetricsRecorder(t *testing.T) {
+	r := &recordingMetrics{}
+	cache := NewCache(1024*1024, WithMetricsRecorder(r))
+	defer cache.Close()
+	r.cache = cache.(*Cache)
+
+	start := time.Now()
+	cache.Set("a", []byte("12345"))
+	cache.SetString("b", "123")
+	cache.MSet(map[string][]byte{"c": []byte("1")})
+	cache.Get("a")
+	cache.GetInto(nil, "missing")
+	cache.GetFn("b", func([]byte) error { return nil })
+	if l, ok := cache.GetLease("c"); ok {
+		l.Release()
+	}
+	cache.MGet([]string{"a", "missing", "b"})
+	cache.Has("a")
+	cache.Peek("a")
+	cache.Delete("a")
+	cache.MDelete("b", "missing")
+	elapsed := time.Since(start)
+
+	s := cache.Stats()
+	if r.hits != int(s.Hits) || r.misses != int(s.Misses) || r.hits != 5 || r.misses != 2 {
+		t.Errorf("recorded %d hits, %d misses, Stats %d, %d, want 5, 2", r.hits, r.misses, s.Hits, s.Misses)
+	}
+	if r.sets != int(s.SetCalls) || r.sets != 3 || r.setBytes != 9 {
+		t.Errorf("recorded %d sets of %d bytes, want 3 of 9", r.sets, r.setBytes)
+	}
+	if r.deletes != int(s.DelCalls) || r.deletes != 3 {
+		t.Errorf("recorded %d deletes, want 3", r.deletes)
+	}
+	if r.negative || r.maxDuration > elapsed {
+		t.Errorf("longest duration = %v, want within the %v the calls took", r.maxDuration, elapsed)
+	}
+	if r.underLock {
+		t.Error("recorder called while the cache held a lock")
+	}
+}
+
+// TestMetricsRecorder_TTL 测试 TTL 缓存的过期读取计为未命中，清理的过期 entry 逐个上报
+func TestMetricsRecorder_TTL(t *testing.T) {
+	r := &recordingMetrics{}
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithKeyIndex(), WithMetricsRecorder(r))
+	defer cache.Close()
+	r.cache = cache.(*CacheWithTTL).cache
+
+	cache.Set("a", []byte("value"), time.Second)
+	cache.SetWithTTI("b", []byte("value"), time.Second, time.Second)
+	cache.MSet([]TTLEntry{{Key: "c", Value: []byte("value"), TTL: time.Second}})
+	cache.GetString("a")
+	clock.Advance(2 * time.Second)
+	// a 被 Get 惰性删除，b 和 c 由 Compact 删除
+	cache.Get("a")
+	cache.MGet([]string{"b", "c"})
+	if _, err := cache.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	cache.Delete("a")
+
+	if r.hits != 1 || r.misses != 3 || r.sets != 3 || r.setBytes != 15 || r.deletes != 1 {
+		t.Errorf("recorded %d hits, %d misses, %d sets of %d bytes, %d deletes, want 1, 3, 3 of 15, 1",
+			r.hits, r.misses, r.sets, r.setBytes, r.deletes)
+	}
+	if got := cache.TTLStats().ExpiredPurged; r.expired != 3 || got != 3 {
+		t.Errorf("recorded %d expired, ExpiredPurged %d, want 3", r.expired, got)
+	}
+	if r.underLock {
+		t.Error("recorder called while the cache held a lock")
+	}
+}
+
+// TestWithMetricsRecorder_Nop 测试未设置或设置 NopMetricsRecorder 时读写不分配内存
+func TestWithMetricsRecorder_Nop(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithMetricsRecorder(NopMetricsRecorder{})}, {WithMetricsRecorder(nil)}} {
+		cache := NewCache(1024*1024, opts...)
+		if cache.(*Cache).metrics != nil {
+			t.Error("a no-op recorder should be left unset")
+		}
+		value := []byte("value")
+		dst := make([]byte, 0, 64)
+		allocs := testing.AllocsPerRun(100, func() {
+			cache.Set("key", value)
+			dst, _ = cache.GetInto(dst[:0], "key")
+			cache.Delete("key")
+		})
+		if allocs != 0 {
+			t.Errorf("Set, GetInto and Delete allocs = %v, want 0", allocs)
+		}
+		cache.Close()
+	}
+}
+
+// BenchmarkCache_MetricsRecorder 基准测试设置 recorder 前后的读取开销
+func BenchmarkCache_MetricsRecorder(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"unset", nil},
+		{"timed", []Option{WithMetricsRecorder(struct{ NopMetricsRecorder }{})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCache(32*1024*1024, bc.opts...)
+			defer cache.Close()
+			cache.Set("bench-key", []byte("bench-value"))
+			dst := make([]byte, 0, 64)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dst, _ = cache.GetInto(dst[:0], "bench-key")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package gcache
+
+import (
+	"errors"
+	"time"
+)
+
+// Option configures a cache created by NewCache or NewCacheWithTTL.
+// Options that only make sense with expiry are ignored by NewCache.
+type Option func(*options)
+
+type options struct {
+	ttlRules        []TTLRule
+	defaultTTL      time.Duration
+	ttlJitter       float64
+	clock           Clock
+	strictSoftTTL   bool
+	compactTTL      bool
+	ttlPrecision    time.Duration
+	cleanupInterval time.Duration
+	expireProbes    int
+	keyIndex        bool
+	finalizerSafety bool
+	bigValues       bool
+	keyHashing      int
+	checksum        bool
+	legacyEntries   bool
+	leaseDebug      bool
+	maxPooledBuffer int
+	poolBypass      int
+	setDedup        bool
+	hotKeys         int
+	hotKeyWindow    time.Duration
+	filterKeys      int
+	filterRate      float64
+	metrics         MetricsRecorder
+	// poolBufferSize is validated only when set, its zero value is invalid
+	poolBufferSize    int
+	poolBufferSizeSet bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// checkCache validates the options applying to both cache types
+func (o *options) checkCache() error {
+	if o.keyHashing > 0 && o.keyHashing < keyHashSize {
+		return ErrInvalidKeyHashing
+	}
+	if o.hotKeys > 0 && o.hotKeyWindow <= 0 {
+		return ErrInvalidHotKeyWindow
+	}
+	if o.filterKeys > 0 {
+		if err := checkFilterRate(o.filterRate); err != nil {
+			return err
+		}
+	}
+	if o.poolBufferSizeSet {
+		return checkPoolBufferSize(o.poolBufferSize)
+	}
+	return nil
+}
+
+// WithTTLRules sets the rules used by Set when it is passed UseRuleTTL,
+// see CacheWithTTL.SetTTLRules. NewCacheWithTTL panics if the rules are invalid.
+func WithTTLRules(rules []TTLRule) Option {
+	return func(o *options) {
+		o.ttlRules = rules
+	}
+}
+
+// ErrInvalidDefaultTTL is returned by NewCacheWithTTLE, and what
+// NewCacheWithTTL panics with, for a negative WithDefaultTTL.
+var ErrInvalidDefaultTTL = errors.New("gcache: default ttl must not be negative")
+
+// WithDefaultTTL makes a zero ttl passed to CacheWithTTL mean ttl instead of
+// expiring the entry immediately, negative ttls still do. NewCacheWithTTL
+// panics if ttl is negative, zero leaves the default unset.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+	}
+}
+
+// ErrInvalidTTLJitter is returned by NewCacheWithTTLE, and what
+// NewCacheWithTTL panics with, for a WithTTLJitter fraction outside [0, 1).
+var ErrInvalidTTLJitter = errors.New("gcache: ttl jitter must be in [0, 1)")
+
+// WithTTLJitter spreads each write's ttl uniformly within ±fraction of it, so
+// keys written together don't expire together. NewCacheWithTTL panics unless
+// 0 <= fraction < 1, zero disables jitter.
+func WithTTLJitter(fraction float64) Option {
+	return func(o *options) {
+		o.ttlJitter = fraction
+	}
+}
+
+// ErrInvalidTTLPrecision is returned by NewCacheWithTTLE, and what
+// NewCacheWithTTL panics with, for a WithTTLPrecision other than a millisecond
+// or a second.
+var ErrInvalidTTLPrecision = errors.New("gcache: ttl precision must be a millisecond or a second")
+
+// WithTTLPrecision rounds the expiry of every write up to a multiple of p,
+// time.Millisecond (the default) or time.Second, so entries never expire
+// before their TTL. With WithCompactTTL a second extends the range of
+// expiries to about 136 years. Entries keep the precision they were written
+// with. NewCacheWithTTL panics for any other p.
+func WithTTLPrecision(p time.Duration) Option {
+	return func(o *options) {
+		o.ttlPrecision = p
+	}
+}
+
+// WithClock makes CacheWithTTL read the current time from clock,
+// e.g. a FakeClock in tests.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithStrictSoftTTL makes reads treat entries past their soft TTL as missing,
+// see CacheWithTTL.SetWithSoftTTL. Such entries still count as present for
+// conditional writes until their hard TTL.
+func WithStrictSoftTTL() Option {
+	return func(o *options) {
+		o.strictSoftTTL = true
+	}
+}
+
+// WithCompactTTL stores the expiry of entries in 5 bytes instead of about 20,
+// as deciseconds since the cache was created. Expiries more than about 13
+// years past that fail with ErrTTLOutOfRange, 136 years with a
+// WithTTLPrecision of a second. Compact entries don't record
+// the TTL they were written with or their creation time, so Touch fails with
+// ErrNoTTL and Age reports nothing for them. Entries with a soft TTL keep the
+// full header. It only applies to NewCacheWithTTL.
+func WithCompactTTL() Option {
+	return func(o *options) {
+		o.compactTTL = true
+	}
+}
+
+// WithCleanupInterval runs a background sweeper that deletes expired entries
+// every d, so keys that are never read again don't stay resident until
+// fastcache evicts live data. The cache then keeps an index of its keys, and
+// each sweep checks at most a fixed number of them, resuming where the last
+// one stopped. The sweeper ticks on real time and stops on Close. See
+// CacheWithTTL.LastSweep. A non-positive d disables it.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.cleanupInterval = d
+	}
+}
+
+// WithExpireProbes makes every CacheWithTTL.Set also check n random keys and
+// delete those that have expired, like Redis does on writes, so memory is
+// reclaimed without a sweeper. The cache keeps an index of its keys to sample
+// from. Each probe costs constant time, those landing on an empty part of the
+// index are skipped. A non-positive n disables it, 3 to 5 is a good start.
+func WithExpireProbes(n int) Option {
+	return func(o *options) {
+		o.expireProbes = n
+	}
+}
+
+// WithKeyIndex makes CacheWithTTL keep an index of its keys, which fastcache
+// can't enumerate, for CacheWithTTL.Compact. WithCleanupInterval and
+// WithExpireProbes keep one as well. It costs a map entry and a slice slot
+// per key.
+func WithKeyIndex() Option {
+	return func(o *options) {
+		o.keyIndex = true
+	}
+}
+
+// WithLegacyEntries makes CacheWithTTL read entries without the marker that
+// versions of gcache before it wrote, which are otherwise reported as not
+// written by the cache, see ErrNotTTLEntry. Values of other writers are then
+// read as entries again. Writes always mark their entry, and with WithKeyIndex
+// Compact marks the legacy entries it keeps: enable it until the legacy
+// entries have expired or been compacted, then drop it.
+func WithLegacyEntries() Option {
+	return func(o *options) {
+		o.legacyEntries = true
+	}
+}
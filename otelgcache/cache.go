@@ -0,0 +1,298 @@
+package otelgcache
+
+import (
+	"context"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache is a gcache.ICache tracing the calls of the cache it wraps.
+type Cache struct {
+	c gcache.ICache
+	t tracing
+}
+
+// WrapWithTracing returns c starting a span with tracer around each call,
+// see the package documentation.
+func WrapWithTracing(c gcache.ICache, tracer trace.Tracer, opts ...Option) gcache.ICache {
+	return &Cache{c: c, t: newTracing(tracer, opts)}
+}
+
+// WithContext returns a copy of c whose spans are children of the span in
+// ctx, for the calls made on behalf of a traced request.
+func (c *Cache) WithContext(ctx context.Context) *Cache {
+	cp := *c
+	cp.t.ctx = ctx
+	return &cp
+}
+
+func (c *Cache) Has(key string) bool {
+	span := c.t.start("gcache.has", key)
+	ok := c.c.Has(key)
+	endRead(span, ok, 0, nil)
+	return ok
+}
+
+func (c *Cache) HasMulti(keys []string) []bool {
+	span := c.t.startBatch("gcache.has_multi", len(keys))
+	res := c.c.HasMulti(keys)
+	if recording(span) {
+		endBatch(span, count(res), nil)
+	} else {
+		end(span, nil)
+	}
+	return res
+}
+
+func (c *Cache) Get(key string) []byte {
+	span := c.t.start("gcache.get", key)
+	value, ok := c.c.GetOK(key)
+	endRead(span, ok, len(value), nil)
+	return value
+}
+
+func (c *Cache) GetOK(key string) ([]byte, bool) {
+	span := c.t.start("gcache.get_ok", key)
+	value, ok := c.c.GetOK(key)
+	endRead(span, ok, len(value), nil)
+	return value, ok
+}
+
+func (c *Cache) GetString(key string) (string, bool) {
+	span := c.t.start("gcache.get_string", key)
+	value, ok := c.c.GetString(key)
+	endRead(span, ok, len(value), nil)
+	return value, ok
+}
+
+func (c *Cache) GetInto(dst []byte, key string) ([]byte, bool) {
+	span := c.t.start("gcache.get_into", key)
+	n := len(dst)
+	dst, ok := c.c.GetInto(dst, key)
+	endRead(span, ok, len(dst)-n, nil)
+	return dst, ok
+}
+
+func (c *Cache) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	span := c.t.start("gcache.get_fn", key)
+	if !recording(span) {
+		ok, err := c.c.GetFn(key, fn)
+		end(span, err)
+		return ok, err
+	}
+	size := 0
+	ok, err := c.c.GetFn(key, func(value []byte) error {
+		size = len(value)
+		return fn(value)
+	})
+	endRead(span, ok, size, err)
+	return ok, err
+}
+
+func (c *Cache) GetLease(key string) (*gcache.Lease, bool) {
+	span := c.t.start("gcache.get_lease", key)
+	l, ok := c.c.GetLease(key)
+	size := 0
+	if ok {
+		size = len(l.Bytes())
+	}
+	endRead(span, ok, size, nil)
+	return l, ok
+}
+
+func (c *Cache) GetOrDefault(key string, def []byte) []byte {
+	span := c.t.start("gcache.get_or_default", key)
+	value, ok := c.c.GetOK(key)
+	endRead(span, ok, len(value), nil)
+	if !ok {
+		return def
+	}
+	return value
+}
+
+func (c *Cache) Peek(key string) []byte {
+	span := c.t.start("gcache.peek", key)
+	value := c.c.Peek(key)
+	endRead(span, value != nil, len(value), nil)
+	return value
+}
+
+func (c *Cache) MGet(keys []string) [][]byte {
+	span := c.t.startBatch("gcache.mget", len(keys))
+	values := c.c.MGet(keys)
+	if recording(span) {
+		endBatch(span, countValues(values), nil)
+	} else {
+		end(span, nil)
+	}
+	return values
+}
+
+func (c *Cache) MGetMap(keys []string) (map[string][]byte, []string) {
+	span := c.t.startBatch("gcache.mget_map", len(keys))
+	hits, misses := c.c.MGetMap(keys)
+	endBatch(span, len(hits), nil)
+	return hits, misses
+}
+
+func (c *Cache) GetRange(key string, offset, length int) []byte {
+	span := c.t.start("gcache.get_range", key)
+	value := c.c.GetRange(key, offset, length)
+	endRead(span, value != nil, len(value), nil)
+	return value
+}
+
+func (c *Cache) Set(key string, value []byte) error {
+	span := c.t.start("gcache.set", key)
+	err := c.c.Set(key, value)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *Cache) SetString(key, value string) error {
+	span := c.t.start("gcache.set_string", key)
+	err := c.c.SetString(key, value)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *Cache) MSet(entries map[string][]byte) error {
+	span := c.t.startBatch("gcache.mset", len(entries))
+	err := c.c.MSet(entries)
+	if recording(span) {
+		size := 0
+		for _, value := range entries {
+			size += len(value)
+		}
+		endWrite(span, size, err)
+	} else {
+		end(span, err)
+	}
+	return err
+}
+
+func (c *Cache) GetOrSet(key string, value []byte) (actual []byte, stored bool, err error) {
+	span := c.t.start("gcache.get_or_set", key)
+	actual, stored, err = c.c.GetOrSet(key, value)
+	endRead(span, !stored && err == nil, len(actual), err)
+	return actual, stored, err
+}
+
+func (c *Cache) SetNX(key string, value []byte) (bool, error) {
+	span := c.t.start("gcache.set_nx", key)
+	stored, err := c.c.SetNX(key, value)
+	endRead(span, !stored && err == nil, len(value), err)
+	return stored, err
+}
+
+func (c *Cache) SetXX(key string, value []byte) (bool, error) {
+	span := c.t.start("gcache.set_xx", key)
+	stored, err := c.c.SetXX(key, value)
+	endRead(span, stored, len(value), err)
+	return stored, err
+}
+
+func (c *Cache) SetReplaced(key string, value []byte) (bool, error) {
+	span := c.t.start("gcache.set_replaced", key)
+	replaced, err := c.c.SetReplaced(key, value)
+	endRead(span, replaced, len(value), err)
+	return replaced, err
+}
+
+func (c *Cache) Swap(key string, value []byte) (old []byte, existed bool, err error) {
+	span := c.t.start("gcache.swap", key)
+	old, existed, err = c.c.Swap(key, value)
+	endRead(span, existed, len(value), err)
+	return old, existed, err
+}
+
+func (c *Cache) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	span := c.t.start("gcache.compare_and_swap", key)
+	swapped, err := c.c.CompareAndSwap(key, expected, value)
+	endRead(span, swapped, len(value), err)
+	return swapped, err
+}
+
+func (c *Cache) Append(key string, data []byte) error {
+	span := c.t.start("gcache.append", key)
+	err := c.c.Append(key, data)
+	endWrite(span, len(data), err)
+	return err
+}
+
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	span := c.t.start("gcache.incr", key)
+	n, err := c.c.Incr(key, delta)
+	end(span, err)
+	return n, err
+}
+
+func (c *Cache) Decr(key string, delta int64) (int64, error) {
+	span := c.t.start("gcache.decr", key)
+	n, err := c.c.Decr(key, delta)
+	end(span, err)
+	return n, err
+}
+
+func (c *Cache) IncrFloat(key string, delta float64) (float64, error) {
+	span := c.t.start("gcache.incr_float", key)
+	f, err := c.c.IncrFloat(key, delta)
+	end(span, err)
+	return f, err
+}
+
+func (c *Cache) Delete(key string) error {
+	span := c.t.start("gcache.delete", key)
+	err := c.c.Delete(key)
+	end(span, err)
+	return err
+}
+
+func (c *Cache) GetAndDelete(key string) []byte {
+	span := c.t.start("gcache.get_and_delete", key)
+	value := c.c.GetAndDelete(key)
+	endRead(span, value != nil, len(value), nil)
+	return value
+}
+
+func (c *Cache) CompareAndDelete(key string, expected []byte) (bool, error) {
+	span := c.t.start("gcache.compare_and_delete", key)
+	deleted, err := c.c.CompareAndDelete(key, expected)
+	endRead(span, deleted, len(expected), err)
+	return deleted, err
+}
+
+func (c *Cache) MDelete(keys ...string) (int, error) {
+	span := c.t.startBatch("gcache.mdelete", len(keys))
+	n, err := c.c.MDelete(keys...)
+	endBatch(span, n, err)
+	return n, err
+}
+
+func (c *Cache) Stats() gcache.Stats {
+	return c.c.Stats()
+}
+
+func (c *Cache) ResetStats() gcache.Stats {
+	return c.c.ResetStats()
+}
+
+func (c *Cache) EffectiveMaxBytes() int {
+	return c.c.EffectiveMaxBytes()
+}
+
+func (c *Cache) HotKeys() []gcache.HotKey {
+	return c.c.HotKeys()
+}
+
+func (c *Cache) Reset() error {
+	span := c.t.startOp("gcache.reset")
+	err := c.c.Reset()
+	end(span, err)
+	return err
+}
+
+func (c *Cache) Close() error {
+	return c.c.Close()
+}
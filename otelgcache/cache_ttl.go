@@ -0,0 +1,477 @@
+package otelgcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CacheWithTTL is a gcache.ICacheWithTTL tracing the calls of the cache it
+// wraps.
+type CacheWithTTL struct {
+	c gcache.ICacheWithTTL
+	t tracing
+}
+
+// WrapWithTracingTTL returns c starting a span with tracer around each call,
+// see the package documentation.
+func WrapWithTracingTTL(c gcache.ICacheWithTTL, tracer trace.Tracer, opts ...Option) gcache.ICacheWithTTL {
+	return &CacheWithTTL{c: c, t: newTracing(tracer, opts)}
+}
+
+// WithContext returns a copy of c whose spans are children of the span in
+// ctx, for the calls made on behalf of a traced request.
+func (c *CacheWithTTL) WithContext(ctx context.Context) *CacheWithTTL {
+	cp := *c
+	cp.t.ctx = ctx
+	return &cp
+}
+
+// stale reports whether key holds an expired entry before a read that may
+// delete it, only looked up for spans that record
+func (c *CacheWithTTL) stale(span trace.Span, key string) bool {
+	return recording(span) && c.c.Inspect(key) == gcache.EntryStale
+}
+
+// endExpiring ends the span of a read of key, stale being whether it held an
+// expired entry
+func endExpiring(span trace.Span, hit bool, size int, stale bool, err error) {
+	if recording(span) {
+		span.SetAttributes(ExpiredAttr.Bool(!hit && stale))
+	}
+	endRead(span, hit, size, err)
+}
+
+func (c *CacheWithTTL) Has(key string) bool {
+	span := c.t.start("gcache.has", key)
+	stale := c.stale(span, key)
+	ok := c.c.Has(key)
+	endExpiring(span, ok, 0, stale, nil)
+	return ok
+}
+
+func (c *CacheWithTTL) HasMulti(keys []string) []bool {
+	span := c.t.startBatch("gcache.has_multi", len(keys))
+	res := c.c.HasMulti(keys)
+	if recording(span) {
+		endBatch(span, count(res), nil)
+	} else {
+		end(span, nil)
+	}
+	return res
+}
+
+func (c *CacheWithTTL) Get(key string) []byte {
+	span := c.t.start("gcache.get", key)
+	stale := c.stale(span, key)
+	value, ok := c.c.GetOK(key)
+	endExpiring(span, ok, len(value), stale, nil)
+	return value
+}
+
+func (c *CacheWithTTL) GetOK(key string) ([]byte, bool) {
+	span := c.t.start("gcache.get_ok", key)
+	stale := c.stale(span, key)
+	value, ok := c.c.GetOK(key)
+	endExpiring(span, ok, len(value), stale, nil)
+	return value, ok
+}
+
+func (c *CacheWithTTL) GetString(key string) (string, bool) {
+	span := c.t.start("gcache.get_string", key)
+	stale := c.stale(span, key)
+	value, ok := c.c.GetString(key)
+	endExpiring(span, ok, len(value), stale, nil)
+	return value, ok
+}
+
+func (c *CacheWithTTL) GetE(key string) ([]byte, error) {
+	span := c.t.start("gcache.get_e", key)
+	stale := c.stale(span, key)
+	value, err := c.c.GetE(key)
+	endExpiring(span, err == nil, len(value), stale, err)
+	return value, err
+}
+
+func (c *CacheWithTTL) GetInto(dst []byte, key string) ([]byte, bool) {
+	span := c.t.start("gcache.get_into", key)
+	stale := c.stale(span, key)
+	n := len(dst)
+	dst, ok := c.c.GetInto(dst, key)
+	endExpiring(span, ok, len(dst)-n, stale, nil)
+	return dst, ok
+}
+
+func (c *CacheWithTTL) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	span := c.t.start("gcache.get_fn", key)
+	if !recording(span) {
+		ok, err := c.c.GetFn(key, fn)
+		end(span, err)
+		return ok, err
+	}
+	stale := c.stale(span, key)
+	size := 0
+	ok, err := c.c.GetFn(key, func(value []byte) error {
+		size = len(value)
+		return fn(value)
+	})
+	endExpiring(span, ok, size, stale, err)
+	return ok, err
+}
+
+func (c *CacheWithTTL) GetLease(key string) (*gcache.Lease, bool) {
+	span := c.t.start("gcache.get_lease", key)
+	stale := c.stale(span, key)
+	l, ok := c.c.GetLease(key)
+	size := 0
+	if ok {
+		size = len(l.Bytes())
+	}
+	endExpiring(span, ok, size, stale, nil)
+	return l, ok
+}
+
+func (c *CacheWithTTL) GetOrDefault(key string, def []byte) []byte {
+	span := c.t.start("gcache.get_or_default", key)
+	stale := c.stale(span, key)
+	value, ok := c.c.GetOK(key)
+	endExpiring(span, ok, len(value), stale, nil)
+	if !ok {
+		return def
+	}
+	return value
+}
+
+func (c *CacheWithTTL) Peek(key string) []byte {
+	span := c.t.start("gcache.peek", key)
+	value := c.c.Peek(key)
+	endRead(span, value != nil, len(value), nil)
+	return value
+}
+
+func (c *CacheWithTTL) MGet(keys []string) [][]byte {
+	span := c.t.startBatch("gcache.mget", len(keys))
+	values := c.c.MGet(keys)
+	if recording(span) {
+		endBatch(span, countValues(values), nil)
+	} else {
+		end(span, nil)
+	}
+	return values
+}
+
+func (c *CacheWithTTL) MGetMap(keys []string) (map[string][]byte, []string) {
+	span := c.t.startBatch("gcache.mget_map", len(keys))
+	hits, misses := c.c.MGetMap(keys)
+	endBatch(span, len(hits), nil)
+	return hits, misses
+}
+
+func (c *CacheWithTTL) GetRange(key string, offset, length int) []byte {
+	span := c.t.start("gcache.get_range", key)
+	value := c.c.GetRange(key, offset, length)
+	endRead(span, value != nil, len(value), nil)
+	return value
+}
+
+func (c *CacheWithTTL) Set(key string, value []byte, ttl time.Duration) error {
+	span := c.t.start("gcache.set", key)
+	err := c.c.Set(key, value, ttl)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *CacheWithTTL) SetString(key, value string, ttl time.Duration) error {
+	span := c.t.start("gcache.set_string", key)
+	err := c.c.SetString(key, value, ttl)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *CacheWithTTL) SetWithExpireAt(key string, value []byte, expireAt time.Time) error {
+	span := c.t.start("gcache.set_with_expire_at", key)
+	err := c.c.SetWithExpireAt(key, value, expireAt)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *CacheWithTTL) SetWithSoftTTL(key string, value []byte, soft, hard time.Duration) error {
+	span := c.t.start("gcache.set_with_soft_ttl", key)
+	err := c.c.SetWithSoftTTL(key, value, soft, hard)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *CacheWithTTL) SetWithTTI(key string, value []byte, ttl, tti time.Duration) error {
+	span := c.t.start("gcache.set_with_tti", key)
+	err := c.c.SetWithTTI(key, value, ttl, tti)
+	endWrite(span, len(value), err)
+	return err
+}
+
+func (c *CacheWithTTL) MSet(entries []gcache.TTLEntry) error {
+	return c.mset("gcache.mset", entries, c.c.MSet)
+}
+
+func (c *CacheWithTTL) SetMany(entries []gcache.TTLEntry) error {
+	return c.mset("gcache.set_many", entries, c.c.SetMany)
+}
+
+// mset traces set writing entries
+func (c *CacheWithTTL) mset(name string, entries []gcache.TTLEntry, set func([]gcache.TTLEntry) error) error {
+	span := c.t.startBatch(name, len(entries))
+	err := set(entries)
+	if recording(span) {
+		size := 0
+		for _, e := range entries {
+			size += len(e.Value)
+		}
+		endWrite(span, size, err)
+	} else {
+		end(span, err)
+	}
+	return err
+}
+
+func (c *CacheWithTTL) GetOrSet(key string, value []byte, ttl time.Duration) (actual []byte, stored bool, err error) {
+	span := c.t.start("gcache.get_or_set", key)
+	actual, stored, err = c.c.GetOrSet(key, value, ttl)
+	endRead(span, !stored && err == nil, len(actual), err)
+	return actual, stored, err
+}
+
+func (c *CacheWithTTL) GetOrCompute(key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	span := c.t.start("gcache.get_or_compute", key)
+	if !recording(span) {
+		value, err := c.c.GetOrCompute(key, ttl, loader)
+		end(span, err)
+		return value, err
+	}
+	stale := c.stale(span, key)
+	// a stale value is reloaded in the background, after the span ends
+	var loaded atomic.Bool
+	value, err := c.c.GetOrCompute(key, ttl, func() ([]byte, error) {
+		loaded.Store(true)
+		return loader()
+	})
+	endExpiring(span, !loaded.Load() && err == nil, len(value), stale, err)
+	return value, err
+}
+
+func (c *CacheWithTTL) MGetOrCompute(keys []string, ttl time.Duration, loader func(missing []string) (map[string][]byte, error)) (map[string][]byte, error) {
+	span := c.t.startBatch("gcache.mget_or_compute", len(keys))
+	if !recording(span) {
+		res, err := c.c.MGetOrCompute(keys, ttl, loader)
+		end(span, err)
+		return res, err
+	}
+	loaded := 0
+	res, err := c.c.MGetOrCompute(keys, ttl, func(missing []string) (map[string][]byte, error) {
+		loaded += len(missing)
+		return loader(missing)
+	})
+	endBatch(span, len(res)-loaded, err)
+	return res, err
+}
+
+func (c *CacheWithTTL) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	span := c.t.start("gcache.set_nx", key)
+	stored, err := c.c.SetNX(key, value, ttl)
+	endRead(span, !stored && err == nil, len(value), err)
+	return stored, err
+}
+
+func (c *CacheWithTTL) SetXX(key string, value []byte, ttl time.Duration) (bool, error) {
+	span := c.t.start("gcache.set_xx", key)
+	stored, err := c.c.SetXX(key, value, ttl)
+	endRead(span, stored, len(value), err)
+	return stored, err
+}
+
+func (c *CacheWithTTL) SetReplaced(key string, value []byte, ttl time.Duration) (bool, error) {
+	span := c.t.start("gcache.set_replaced", key)
+	replaced, err := c.c.SetReplaced(key, value, ttl)
+	endRead(span, replaced, len(value), err)
+	return replaced, err
+}
+
+func (c *CacheWithTTL) Swap(key string, value []byte, ttl time.Duration) (old []byte, existed bool, err error) {
+	span := c.t.start("gcache.swap", key)
+	old, existed, err = c.c.Swap(key, value, ttl)
+	endRead(span, existed, len(value), err)
+	return old, existed, err
+}
+
+func (c *CacheWithTTL) CompareAndSwap(key string, expected, value []byte, ttl time.Duration) (bool, error) {
+	span := c.t.start("gcache.compare_and_swap", key)
+	swapped, err := c.c.CompareAndSwap(key, expected, value, ttl)
+	endRead(span, swapped, len(value), err)
+	return swapped, err
+}
+
+func (c *CacheWithTTL) Append(key string, data []byte, ttl time.Duration) error {
+	span := c.t.start("gcache.append", key)
+	err := c.c.Append(key, data, ttl)
+	endWrite(span, len(data), err)
+	return err
+}
+
+func (c *CacheWithTTL) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	span := c.t.start("gcache.incr", key)
+	n, err := c.c.Incr(key, delta, ttl)
+	end(span, err)
+	return n, err
+}
+
+func (c *CacheWithTTL) Decr(key string, delta int64, ttl time.Duration) (int64, error) {
+	span := c.t.start("gcache.decr", key)
+	n, err := c.c.Decr(key, delta, ttl)
+	end(span, err)
+	return n, err
+}
+
+func (c *CacheWithTTL) IncrFloat(key string, delta float64, ttl time.Duration) (float64, error) {
+	span := c.t.start("gcache.incr_float", key)
+	f, err := c.c.IncrFloat(key, delta, ttl)
+	end(span, err)
+	return f, err
+}
+
+func (c *CacheWithTTL) Delete(key string) error {
+	span := c.t.start("gcache.delete", key)
+	err := c.c.Delete(key)
+	end(span, err)
+	return err
+}
+
+func (c *CacheWithTTL) GetAndDelete(key string) []byte {
+	span := c.t.start("gcache.get_and_delete", key)
+	stale := c.stale(span, key)
+	value := c.c.GetAndDelete(key)
+	endExpiring(span, value != nil, len(value), stale, nil)
+	return value
+}
+
+func (c *CacheWithTTL) CompareAndDelete(key string, expected []byte) (bool, error) {
+	span := c.t.start("gcache.compare_and_delete", key)
+	deleted, err := c.c.CompareAndDelete(key, expected)
+	endRead(span, deleted, len(expected), err)
+	return deleted, err
+}
+
+func (c *CacheWithTTL) MDelete(keys ...string) (int, error) {
+	span := c.t.startBatch("gcache.mdelete", len(keys))
+	n, err := c.c.MDelete(keys...)
+	endBatch(span, n, err)
+	return n, err
+}
+
+func (c *CacheWithTTL) Inspect(key string) gcache.EntryState {
+	return c.c.Inspect(key)
+}
+
+func (c *CacheWithTTL) TTL(key string) (time.Duration, bool) {
+	span := c.t.start("gcache.ttl", key)
+	ttl, ok := c.c.TTL(key)
+	endRead(span, ok, 0, nil)
+	return ttl, ok
+}
+
+func (c *CacheWithTTL) GetWithTTL(key string) ([]byte, time.Duration, bool) {
+	span := c.t.start("gcache.get_with_ttl", key)
+	stale := c.stale(span, key)
+	value, ttl, ok := c.c.GetWithTTL(key)
+	endExpiring(span, ok, len(value), stale, nil)
+	return value, ttl, ok
+}
+
+func (c *CacheWithTTL) GetStale(key string) (value []byte, stale bool, ok bool) {
+	span := c.t.start("gcache.get_stale", key)
+	value, stale, ok = c.c.GetStale(key)
+	endRead(span, ok, len(value), nil)
+	return value, stale, ok
+}
+
+func (c *CacheWithTTL) Age(key string) (time.Duration, bool) {
+	return c.c.Age(key)
+}
+
+func (c *CacheWithTTL) LazyPurged() int64 {
+	return c.c.LazyPurged()
+}
+
+func (c *CacheWithTTL) LastSweep() (gcache.SweepResult, bool) {
+	return c.c.LastSweep()
+}
+
+func (c *CacheWithTTL) Stats() gcache.Stats {
+	return c.c.Stats()
+}
+
+func (c *CacheWithTTL) TTLStats() gcache.TTLStats {
+	return c.c.TTLStats()
+}
+
+func (c *CacheWithTTL) ResetStats() gcache.Stats {
+	return c.c.ResetStats()
+}
+
+// AsICache returns the ICache view of the wrapped cache, see
+// gcache.CacheWithTTL.AsICache, traced like c.
+func (c *CacheWithTTL) AsICache(ttl time.Duration) gcache.ICache {
+	return &Cache{c: c.c.AsICache(ttl), t: c.t}
+}
+
+func (c *CacheWithTTL) Compact() (gcache.CompactReport, error) {
+	span := c.t.startOp("gcache.compact")
+	rep, err := c.c.Compact()
+	end(span, err)
+	return rep, err
+}
+
+func (c *CacheWithTTL) Expire(key string, ttl time.Duration) (bool, error) {
+	span := c.t.start("gcache.expire", key)
+	ok, err := c.c.Expire(key, ttl)
+	endRead(span, ok, 0, err)
+	return ok, err
+}
+
+func (c *CacheWithTTL) Persist(key string) (bool, error) {
+	span := c.t.start("gcache.persist", key)
+	ok, err := c.c.Persist(key)
+	endRead(span, ok, 0, err)
+	return ok, err
+}
+
+func (c *CacheWithTTL) Touch(key string) (bool, error) {
+	span := c.t.start("gcache.touch", key)
+	ok, err := c.c.Touch(key)
+	endRead(span, ok, 0, err)
+	return ok, err
+}
+
+func (c *CacheWithTTL) SetTTLRules(rules []gcache.TTLRule) error {
+	return c.c.SetTTLRules(rules)
+}
+
+func (c *CacheWithTTL) EffectiveMaxBytes() int {
+	return c.c.EffectiveMaxBytes()
+}
+
+func (c *CacheWithTTL) HotKeys() []gcache.HotKey {
+	return c.c.HotKeys()
+}
+
+func (c *CacheWithTTL) Reset() error {
+	span := c.t.startOp("gcache.reset")
+	err := c.c.Reset()
+	end(span, err)
+	return err
+}
+
+func (c *CacheWithTTL) Close() error {
+	return c.c.Close()
+}
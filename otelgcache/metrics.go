@@ -0,0 +1,147 @@
+package otelgcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// NameAttr is the attribute naming the cache of the instruments of
+// InstrumentMetrics.
+const NameAttr = attribute.Key("gcache.name")
+
+// ErrInstrumented is returned by InstrumentMetrics for a cache it already
+// instruments.
+var ErrInstrumented = errors.New("otelgcache: cache is already instrumented")
+
+// ErrNotComparable is returned by InstrumentMetrics for a cache that can't be
+// compared, such as a struct holding a slice, as the caches it instruments
+// are tracked by their value.
+var ErrNotComparable = errors.New("otelgcache: cache is not comparable")
+
+// instrumented holds the caches InstrumentMetrics instruments, until closed
+var instrumented sync.Map
+
+// MetricsCache is a gcache.ICache reporting the Stats of the cache it wraps
+// to OpenTelemetry instruments, see InstrumentMetrics.
+type MetricsCache struct {
+	gcache.ICache
+
+	reg   metric.Registration
+	close sync.Once
+
+	mu   sync.Mutex
+	base gcache.Stats // counters zeroed by ResetStats, kept so they only grow
+}
+
+// InstrumentMetrics registers instruments with meter reporting the Stats of
+// c, each observation carrying name as the gcache.name attribute:
+//
+//   - gcache.hits, gcache.misses, gcache.sets and gcache.deletes count the
+//     Hits, Misses, SetCalls and DelCalls of Stats,
+//   - gcache.expired counts the reads finding an expired entry, ExpiredReads,
+//   - gcache.entries and gcache.bytes gauge EntriesCount and BytesSize.
+//
+// Stats is read once per collection, so the cache is never slowed down by
+// the instruments. ResetStats called on the returned cache leaves the
+// counters growing, unlike a call on c. Closing the returned cache
+// unregisters the instruments, then closes c. InstrumentMetrics returns
+// ErrInstrumented if c is instrumented already, and ErrNotComparable if c
+// can't be compared to the caches it instruments.
+func InstrumentMetrics(c gcache.ICache, meter metric.Meter, name string) (*MetricsCache, error) {
+	if !reflect.ValueOf(c).Comparable() {
+		return nil, ErrNotComparable
+	}
+	m := &MetricsCache{ICache: c}
+	if _, loaded := instrumented.LoadOrStore(c, m); loaded {
+		return nil, ErrInstrumented
+	}
+	reg, err := m.register(meter, metric.WithAttributes(NameAttr.String(name)))
+	if err != nil {
+		instrumented.Delete(c)
+		return nil, err
+	}
+	m.reg = reg
+	return m, nil
+}
+
+// register creates the instruments and the callback observing them
+func (m *MetricsCache) register(meter metric.Meter, attrs metric.ObserveOption) (metric.Registration, error) {
+	var counters [5]metric.Int64ObservableCounter
+	for i, c := range []struct{ name, desc string }{
+		{"gcache.hits", "Reads that found a value."},
+		{"gcache.misses", "Reads that found no value."},
+		{"gcache.sets", "Writes of a value."},
+		{"gcache.deletes", "Deletions of a key."},
+		{"gcache.expired", "Reads that found an expired entry."},
+	} {
+		var err error
+		counters[i], err = meter.Int64ObservableCounter(c.name, metric.WithDescription(c.desc), metric.WithUnit("{call}"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	entries, err := meter.Int64ObservableGauge("gcache.entries",
+		metric.WithDescription("Entries stored."), metric.WithUnit("{entry}"))
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := meter.Int64ObservableGauge("gcache.bytes",
+		metric.WithDescription("Memory taken by the entries."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := m.counted()
+		for i, n := range [...]int64{s.Hits, s.Misses, s.SetCalls, s.DelCalls, s.ExpiredReads} {
+			o.ObserveInt64(counters[i], n, attrs)
+		}
+		o.ObserveInt64(entries, int64(s.EntriesCount), attrs)
+		o.ObserveInt64(bytes, int64(s.BytesSize), attrs)
+		return nil
+	}, counters[0], counters[1], counters[2], counters[3], counters[4], entries, bytes)
+}
+
+// counted returns the stats of the wrapped cache, the counters zeroed by
+// ResetStats added back
+func (m *MetricsCache) counted() gcache.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.ICache.Stats()
+	s.Hits += m.base.Hits
+	s.Misses += m.base.Misses
+	s.SetCalls += m.base.SetCalls
+	s.DelCalls += m.base.DelCalls
+	s.ExpiredReads += m.base.ExpiredReads
+	return s
+}
+
+// ResetStats resets the counters of the wrapped cache, leaving those the
+// instruments report growing, and returns the Stats they were reset from.
+// The counts are swapped out of the cache, so none landing meanwhile is lost.
+func (m *MetricsCache) ResetStats() gcache.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.ICache.ResetStats()
+	m.base.Hits += s.Hits
+	m.base.Misses += s.Misses
+	m.base.SetCalls += s.SetCalls
+	m.base.DelCalls += s.DelCalls
+	m.base.ExpiredReads += s.ExpiredReads
+	return s
+}
+
+// Close unregisters the instruments and closes the wrapped cache.
+func (m *MetricsCache) Close() error {
+	var err error
+	m.close.Do(func() {
+		err = m.reg.Unregister()
+		instrumented.Delete(m.ICache)
+	})
+	return errors.Join(err, m.ICache.Close())
+}
@@ -0,0 +1,118 @@
+package otelgcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collect 用 manual reader 收集一次，返回每个指标 name 属性为 name 的值
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			var points []metricdata.DataPoint[int64]
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				points = data.DataPoints
+			case metricdata.Gauge[int64]:
+				points = data.DataPoints
+			}
+			for _, p := range points {
+				if v, _ := p.Attributes.Value(NameAttr); v.AsString() == name {
+					got[m.Name] = p.Value
+				}
+			}
+		}
+	}
+	return got
+}
+
+// TestInstrumentMetrics 测试指标值与 Stats 一致，ResetStats 后计数仍递增，Close 后不再上报
+func TestInstrumentMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("gcache")
+	clock := gcache.NewFakeClock(time.Now())
+	ttl := gcache.NewCacheWithTTL(1024*1024, gcache.WithClock(clock))
+	defer ttl.Close()
+	cache, err := InstrumentMetrics(ttl.AsICache(time.Second), meter, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Set("a", []byte("value"))
+	cache.Set("b", []byte("value"))
+	cache.Get("a")
+	cache.Get("missing")
+	cache.Delete("b")
+	clock.Advance(2 * time.Second)
+	cache.Get("a")
+
+	got := collect(t, reader, "users")
+	s := cache.Stats()
+	want := map[string]int64{
+		"gcache.hits":    1,
+		"gcache.misses":  2,
+		"gcache.sets":    2,
+		"gcache.deletes": 1,
+		"gcache.expired": 1,
+		"gcache.entries": int64(s.EntriesCount),
+		"gcache.bytes":   int64(s.BytesSize),
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s = %d, want %d", name, got[name], v)
+		}
+	}
+
+	// ResetStats 返回清零前的 Stats，不让计数器回退
+	if old := cache.ResetStats(); old.SetCalls != 2 || old.Hits != 1 {
+		t.Errorf("ResetStats = %+v, want 2 sets and 1 hit", old)
+	}
+	cache.Set("c", []byte("value"))
+	if got := collect(t, reader, "users"); got["gcache.sets"] != 3 || cache.Stats().SetCalls != 1 {
+		t.Errorf("sets after ResetStats = %d, Stats %d, want 3, 1", got["gcache.sets"], cache.Stats().SetCalls)
+	}
+
+	// 同一个缓存只能注册一次，Close 后可以再注册
+	if _, err := InstrumentMetrics(cache.ICache, meter, "users"); !errors.Is(err, ErrInstrumented) {
+		t.Errorf("second InstrumentMetrics = %v, want ErrInstrumented", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, reader, "users"); len(got) != 0 {
+		t.Errorf("closed cache still reported %v", got)
+	}
+	again, err := InstrumentMetrics(cache.ICache, meter, "users")
+	if err != nil {
+		t.Fatalf("InstrumentMetrics after Close = %v", err)
+	}
+	again.Close()
+}
+
+// uncomparable 是不可比较的 ICache，不能作为 map 的 key
+type uncomparable struct {
+	gcache.ICache
+	tags []string
+}
+
+// TestInstrumentMetrics_NotComparable 测试不可比较的缓存返回 ErrNotComparable 而不是 panic
+func TestInstrumentMetrics_NotComparable(t *testing.T) {
+	meter := sdkmetric.NewMeterProvider().Meter("gcache")
+	c := gcache.NewCache(1024 * 1024)
+	defer c.Close()
+	if _, err := InstrumentMetrics(uncomparable{ICache: c}, meter, "users"); !errors.Is(err, ErrNotComparable) {
+		t.Errorf("InstrumentMetrics = %v, want ErrNotComparable", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package otelgcache traces the operations of gcache caches with
+// OpenTelemetry: WrapWithTracing and WrapWithTracingTTL return caches that
+// start a span around each call of the cache they wrap, and InstrumentMetrics
+// reports the Stats of a cache to metric instruments.
+//
+// Spans are named after the method, gcache.get for Get, gcache.get_ok for
+// GetOK, and so on, and carry the length of the key, the size of the value
+// read or written and, for reads, whether they hit. Reads of a CacheWithTTL
+// that miss also record whether the entry had expired. Keys themselves are
+// only recorded WithKeys, as they may hold personal data.
+//
+// gcache's methods take no context, so spans are the children of the span in
+// the context given to WithContext, roots without one. Attributes are only
+// built for spans that record, and a nil tracer or the no-op one of
+// go.opentelemetry.io/otel/trace/noop starts no span at all: the wrappers then
+// cost a nil check per call and allocate nothing.
+//
+// otelgcache is a module of its own, so that importing gcache doesn't pull in
+// OpenTelemetry.
+package otelgcache
+
+import (
+	"context"
+	"errors"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// The attributes of the spans.
+const (
+	KeyAttr       = attribute.Key("gcache.key")        // only WithKeys
+	KeyLengthAttr = attribute.Key("gcache.key.length") // in bytes
+	ValueSizeAttr = attribute.Key("gcache.value.size") // in bytes, of the value read or written
+	HitAttr       = attribute.Key("gcache.hit")        // reads and conditional writes finding a value
+	ExpiredAttr   = attribute.Key("gcache.expired")    // misses of a CacheWithTTL finding an expired entry
+	KeysAttr      = attribute.Key("gcache.keys")       // batches, how many keys
+	HitsAttr      = attribute.Key("gcache.hits")       // batch reads, how many keys hit
+)
+
+// Option configures a cache returned by WrapWithTracing or WrapWithTracingTTL.
+type Option func(*tracing)
+
+// WithKeys records the key of each operation, the keys of batches aside, as
+// the gcache.key attribute. Only enable it if keys can't identify a person,
+// or traces are allowed to hold such data.
+func WithKeys() Option {
+	return func(t *tracing) {
+		t.keys = true
+	}
+}
+
+// tracing starts the spans of a wrapper
+type tracing struct {
+	tracer trace.Tracer // nil for a no-op tracer
+	ctx    context.Context
+	keys   bool
+}
+
+func newTracing(tracer trace.Tracer, opts []Option) tracing {
+	t := tracing{tracer: tracer, ctx: context.Background()}
+	if _, nop := tracer.(noop.Tracer); nop {
+		t.tracer = nil
+	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
+}
+
+// startOp starts the span of an operation, nil without a tracer
+func (t *tracing) startOp(name string) trace.Span {
+	if t.tracer == nil {
+		return nil
+	}
+	_, span := t.tracer.Start(t.ctx, name)
+	return span
+}
+
+// start starts the span of an operation on key
+func (t *tracing) start(name, key string) trace.Span {
+	span := t.startOp(name)
+	if recording(span) {
+		span.SetAttributes(KeyLengthAttr.Int(len(key)))
+		if t.keys {
+			span.SetAttributes(KeyAttr.String(key))
+		}
+	}
+	return span
+}
+
+// startBatch starts the span of an operation on n keys
+func (t *tracing) startBatch(name string, n int) trace.Span {
+	span := t.startOp(name)
+	if recording(span) {
+		span.SetAttributes(KeysAttr.Int(n))
+	}
+	return span
+}
+
+// recording reports whether span records, so its attributes are worth building
+func recording(span trace.Span) bool {
+	return span != nil && span.IsRecording()
+}
+
+// end ends span, recording err unless it is nil or gcache.ErrNotFound
+func end(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil && !errors.Is(err, gcache.ErrNotFound) && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endRead ends the span of a read, size being that of the value found
+func endRead(span trace.Span, hit bool, size int, err error) {
+	if recording(span) {
+		span.SetAttributes(HitAttr.Bool(hit), ValueSizeAttr.Int(size))
+	}
+	end(span, err)
+}
+
+// endWrite ends the span of a write of size bytes
+func endWrite(span trace.Span, size int, err error) {
+	if recording(span) {
+		span.SetAttributes(ValueSizeAttr.Int(size))
+	}
+	end(span, err)
+}
+
+// endBatch ends the span of a batch read, hits of its keys found
+func endBatch(span trace.Span, hits int, err error) {
+	if recording(span) {
+		span.SetAttributes(HitsAttr.Int(hits))
+	}
+	end(span, err)
+}
+
+// count returns how many of found are true
+func count(found []bool) int {
+	n := 0
+	for _, ok := range found {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// countValues returns how many of values aren't nil
+func countValues(values [][]byte) int {
+	n := 0
+	for _, v := range values {
+		if v != nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,192 @@
+package otelgcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	gcache "github.com/AcSunday/gwatch-chain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// testTracer 记录开始的每个 span
+type testTracer struct {
+	embedded.Tracer
+
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &testSpan{name: name, parent: trace.SpanContextFromContext(ctx), attrs: map[attribute.Key]attribute.Value{}}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// last 返回最近开始的 span
+func (t *testTracer) last() *testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spans[len(t.spans)-1]
+}
+
+// testSpan 记录属性、错误以及是否结束
+type testSpan struct {
+	noop.Span
+
+	name   string
+	parent trace.SpanContext
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	errs   []error
+	ended  bool
+}
+
+func (s *testSpan) IsRecording() bool { return true }
+
+func (s *testSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+
+func (s *testSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *testSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+// check 检查 span 的名字、属性和结束状态
+func (s *testSpan) check(t *testing.T, name string, want map[attribute.Key]any) {
+	t.Helper()
+	if s.name != name || !s.ended {
+		t.Errorf("span %s ended %v, want %s ended", s.name, s.ended, name)
+	}
+	for key, v := range want {
+		if got, ok := s.attrs[key]; !ok || got.AsInterface() != v {
+			t.Errorf("%s %s = %v, want %v", name, key, got.AsInterface(), v)
+		}
+	}
+}
+
+// TestWrapWithTracing 测试每个操作一个 span，带 key 长度、value 大小和命中属性，默认不记录 key
+func TestWrapWithTracing(t *testing.T) {
+	tracer := &testTracer{}
+	cache := WrapWithTracing(gcache.NewCache(1024*1024), tracer)
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"))
+	tracer.last().check(t, "gcache.set", map[attribute.Key]any{KeyLengthAttr: int64(3), ValueSizeAttr: int64(5)})
+	cache.Get("key")
+	tracer.last().check(t, "gcache.get", map[attribute.Key]any{HitAttr: true, ValueSizeAttr: int64(5)})
+	cache.GetFn("missing", func([]byte) error { return nil })
+	tracer.last().check(t, "gcache.get_fn", map[attribute.Key]any{HitAttr: false, KeyLengthAttr: int64(7)})
+	cache.MGet([]string{"key", "missing", "key"})
+	tracer.last().check(t, "gcache.mget", map[attribute.Key]any{KeysAttr: int64(3), HitsAttr: int64(2)})
+	if _, ok := tracer.last().attrs[KeyAttr]; ok {
+		t.Error("keys should only be recorded WithKeys")
+	}
+
+	// 错误记录在 span 上
+	cache.Set("counter", []byte("not a counter"))
+	if _, err := cache.Incr("counter", 1); err == nil {
+		t.Fatal("Incr of a value that isn't a counter should fail")
+	}
+	if s := tracer.last(); len(s.errs) != 1 || s.status != codes.Error {
+		t.Errorf("Incr span errors %v, status %v, want the error recorded", s.errs, s.status)
+	}
+
+	keyed := WrapWithTracing(gcache.NewCache(1024*1024), tracer, WithKeys())
+	defer keyed.Close()
+	keyed.Delete("user:42")
+	tracer.last().check(t, "gcache.delete", map[attribute.Key]any{KeyAttr: "user:42"})
+}
+
+// TestWrapWithTracingTTL 测试读到过期 entry 时记录 expired，以及 GetOrCompute 是否调用 loader
+func TestWrapWithTracingTTL(t *testing.T) {
+	tracer := &testTracer{}
+	clock := gcache.NewFakeClock(time.Now())
+	cache := WrapWithTracingTTL(gcache.NewCacheWithTTL(1024*1024, gcache.WithClock(clock)), tracer)
+	defer cache.Close()
+
+	cache.Set("short", []byte("value"), time.Second)
+	cache.GetOK("short")
+	tracer.last().check(t, "gcache.get_ok", map[attribute.Key]any{HitAttr: true, ExpiredAttr: false})
+	clock.Advance(2 * time.Second)
+	cache.GetOK("short")
+	tracer.last().check(t, "gcache.get_ok", map[attribute.Key]any{HitAttr: false, ExpiredAttr: true})
+	// 过期 entry 已被删除，再读就是不存在
+	if _, err := cache.GetE("short"); !errors.Is(err, gcache.ErrNotFound) {
+		t.Fatalf("GetE = %v, want ErrNotFound", err)
+	}
+	s := tracer.last()
+	s.check(t, "gcache.get_e", map[attribute.Key]any{HitAttr: false, ExpiredAttr: false})
+	if len(s.errs) != 0 {
+		t.Errorf("a miss recorded errors %v", s.errs)
+	}
+
+	loader := func() ([]byte, error) { return []byte("loaded"), nil }
+	cache.GetOrCompute("computed", time.Minute, loader)
+	tracer.last().check(t, "gcache.get_or_compute", map[attribute.Key]any{HitAttr: false, ValueSizeAttr: int64(6)})
+	cache.GetOrCompute("computed", time.Minute, loader)
+	tracer.last().check(t, "gcache.get_or_compute", map[attribute.Key]any{HitAttr: true})
+
+	cache.AsICache(time.Minute).Set("viewed", []byte("value"))
+	tracer.last().check(t, "gcache.set", map[attribute.Key]any{ValueSizeAttr: int64(5)})
+}
+
+// TestWithContext 测试 span 是 WithContext 传入的 span 的子 span
+func TestWithContext(t *testing.T) {
+	tracer := &testTracer{}
+	cache := WrapWithTracing(gcache.NewCache(1024*1024), tracer).(*Cache)
+	defer cache.Close()
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+	cache.WithContext(ctx).Get("key")
+	if got := tracer.last().parent; !got.Equal(parent) {
+		t.Errorf("span parent = %v, want %v", got, parent)
+	}
+	cache.Get("key")
+	if got := tracer.last().parent; got.IsValid() {
+		t.Errorf("span without a context has parent %v", got)
+	}
+}
+
+// TestWrapWithTracing_Noop 测试 no-op tracer 不比未包装的缓存多分配内存
+func TestWrapWithTracing_Noop(t *testing.T) {
+	value := []byte("value")
+	dst := make([]byte, 0, 64)
+	fn := func([]byte) error { return nil }
+	allocs := func(cache gcache.ICache, ttl gcache.ICacheWithTTL) float64 {
+		return testing.AllocsPerRun(100, func() {
+			cache.Set("key", value)
+			dst, _ = cache.GetInto(dst[:0], "key")
+			cache.GetFn("key", fn)
+			cache.Delete("key")
+			ttl.Set("key", value, time.Minute)
+			dst, _ = ttl.GetInto(dst[:0], "key")
+			ttl.Has("key")
+			ttl.Delete("key")
+		})
+	}
+
+	cache, ttl := gcache.NewCache(1024*1024), gcache.NewCacheWithTTL(1024*1024)
+	defer cache.Close()
+	defer ttl.Close()
+	// race detector 下未包装的缓存也可能分配
+	want := allocs(cache, ttl)
+	for _, tracer := range []trace.Tracer{nil, noop.NewTracerProvider().Tracer("gcache")} {
+		if got := allocs(WrapWithTracing(cache, tracer), WrapWithTracingTTL(ttl, tracer)); got != want {
+			t.Errorf("allocs with a %T tracer = %v, want %v as unwrapped", tracer, got, want)
+		}
+	}
+}
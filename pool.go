@@ -0,0 +1,191 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// bufClasses are the capacities of the pooled read buffers. Each class has its
+// own pool, so a mix of small and large values doesn't leave every buffer as
+// large as the largest value read. WithPoolBufferSize replaces the smallest.
+var bufClasses = [...]int{1 << 10, 8 << 10, 64 << 10}
+
+// ErrInvalidPoolBufferSize is returned by NewCacheE and NewCacheWithTTLE for a
+// WithPoolBufferSize size that isn't positive or exceeds the per-entry limit.
+var ErrInvalidPoolBufferSize = errors.New("gcache: pool buffer size must be positive and within the per-entry limit")
+
+// WithPoolBufferSize sets the capacity of the smallest pooled read buffers,
+// which reads start with, to size bytes, 1KB by default. Set it to the typical
+// value size of a workload of values larger than that, so its buffers are no
+// larger than needed. The larger size classes are kept, constructors fail
+// with ErrInvalidPoolBufferSize for a size that isn't positive or exceeds the
+// per-entry limit.
+func WithPoolBufferSize(size int) Option {
+	return func(o *options) {
+		o.poolBufferSize, o.poolBufferSizeSet = size, true
+	}
+}
+
+// checkPoolBufferSize returns ErrInvalidPoolBufferSize for a size
+// WithPoolBufferSize doesn't accept
+func checkPoolBufferSize(size int) error {
+	if size <= 0 || size > maxKeyValueSize {
+		return fmt.Errorf("%w: %d", ErrInvalidPoolBufferSize, size)
+	}
+	return nil
+}
+
+// poolClasses returns the capacities of the size classes starting at first
+func poolClasses(first int) []int {
+	sizes := []int{first}
+	for _, n := range bufClasses[1:] {
+		if n > first {
+			sizes = append(sizes, n)
+		}
+	}
+	return sizes
+}
+
+// defaultMaxPooledBuffer is the capacity past which grown read buffers are
+// dropped, see WithMaxPooledBuffer
+const defaultMaxPooledBuffer = 256 << 10
+
+// WithMaxPooledBuffer sets the capacity past which a read buffer grown by a
+// large value is dropped rather than returned to the cache's pool, so a few
+// big values don't pin their size in memory. Buffers up to it are pooled in
+// the largest size class they hold, and spare later reads of values as large
+// from growing a buffer again. A non-positive size keeps the default, 256KB.
+func WithMaxPooledBuffer(size int) Option {
+	return func(o *options) {
+		o.maxPooledBuffer = size
+	}
+}
+
+// defaultPoolBypass is the value size past which reads bypass the pool,
+// see WithPoolBypass
+const defaultPoolBypass = 16 << 10
+
+// WithPoolBypass makes reads of values larger than size bytes bypass the
+// cache's pool: their buffer is allocated for the read and dropped after it,
+// and doesn't change the size class of the next read, so a few large values
+// don't leave large buffers to every small read. Get hands such a buffer over
+// instead of copying it. A non-positive size keeps the default, 16KB; see
+// Stats.PoolBypassed to tune it.
+func WithPoolBypass(size int) Option {
+	return func(o *options) {
+		o.poolBypass = size
+	}
+}
+
+// readBuf is a pooled read buffer holding at least its class's capacity
+type readBuf struct {
+	b     []byte
+	size  int // capacity of b when it was pooled, a read growing it overflowed
+	class int32
+}
+
+// bufPool hands out the read buffers of a cache. Without a size hint a read
+// gets a buffer of the class of the last value the cache read, values being
+// alike in size more often than not.
+type bufPool struct {
+	sizes     []int // capacities of the classes, see poolClasses
+	classes   []sync.Pool
+	maxSize   int          // capacity past which grown buffers are dropped
+	bypass    int          // value size past which reads bypass the pool
+	last      atomic.Int32 // class of the last value read
+	allocs    atomic.Int64 // buffers allocated, see Stats
+	overflows atomic.Int64 // reads that outgrew their buffer, see Stats
+	bypassed  atomic.Int64 // reads that bypassed the pool, see Stats
+}
+
+func newBufPool(first, maxSize, bypass int) *bufPool {
+	if maxSize <= 0 {
+		maxSize = defaultMaxPooledBuffer
+	}
+	if bypass <= 0 {
+		bypass = defaultPoolBypass
+	}
+	p := &bufPool{sizes: poolClasses(first), maxSize: maxSize, bypass: bypass}
+	p.classes = make([]sync.Pool, len(p.sizes))
+	for i, size := range p.sizes {
+		p.classes[i].New = func() any {
+			p.allocs.Add(1)
+			return &readBuf{b: make([]byte, 0, size), size: size, class: int32(i)}
+		}
+	}
+	return p
+}
+
+// classOf returns the smallest class holding size bytes, the largest one
+// for larger sizes
+func (p *bufPool) classOf(size int) int32 {
+	for i, n := range p.sizes {
+		if size <= n {
+			return int32(i)
+		}
+	}
+	return int32(len(p.sizes) - 1)
+}
+
+// classHeld returns the largest class a buffer of capacity size holds
+func (p *bufPool) classHeld(size int) int32 {
+	for i := len(p.sizes) - 1; i > 0; i-- {
+		if size >= p.sizes[i] {
+			return int32(i)
+		}
+	}
+	return 0
+}
+
+// get returns a buffer of the class of the last value read
+func (p *bufPool) get() *readBuf {
+	return p.classes[p.last.Load()].Get().(*readBuf)
+}
+
+// getBatch returns a buffer for n values of the class of the last value read,
+// so a batch of reads doesn't grow it value after value
+func (p *bufPool) getBatch(n int) *readBuf {
+	return p.getSize(n * p.sizes[p.last.Load()])
+}
+
+// getSize returns a buffer holding size bytes, or of the largest class
+// if none does
+func (p *bufPool) getSize(size int) *readBuf {
+	return p.classes[p.classOf(size)].Get().(*readBuf)
+}
+
+// take reports whether the value read into buf is too large to pool, counting
+// the read as bypassed. buf is then the caller's, the pool won't see it again.
+func (p *bufPool) take(buf *readBuf) bool {
+	if len(buf.b) <= p.bypass {
+		return false
+	}
+	p.bypassed.Add(1)
+	return true
+}
+
+// put makes the class of what was read into buf the one of the next get, and
+// returns buf to the pool, in the class its capacity holds if the read grew
+// it. Buffers grown past maxSize, or holding a value past bypass, are dropped.
+func (p *bufPool) put(buf *readBuf) {
+	if p.take(buf) {
+		return
+	}
+	if len(buf.b) > 0 {
+		// stored only on change, reads of similar values don't contend on it
+		if class := p.classOf(len(buf.b)); p.last.Load() != class {
+			p.last.Store(class)
+		}
+	}
+	if size := cap(buf.b); size != buf.size {
+		p.overflows.Add(1)
+		if size > p.maxSize {
+			return
+		}
+		buf.size, buf.class = size, p.classHeld(size)
+	}
+	buf.b = buf.b[:0]
+	p.classes[buf.class].Put(buf)
+}
@@ -0,0 +1,373 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestClassOf 测试按大小选择 buffer 的 size class
+func TestClassOf(t *testing.T) {
+	p := newBufPool(bufClasses[0], 0, 0)
+	tests := []struct {
+		size int
+		want int32
+	}{
+		{0, 0},
+		{1024, 0},
+		{1025, 1},
+		{8 * 1024, 1},
+		{8*1024 + 1, 2},
+		{64 * 1024, 2},
+		{1 << 20, 2}, // 超出最大 class 时回退到最大 class
+	}
+	for _, tt := range tests {
+		if got := p.classOf(tt.size); got != tt.want {
+			t.Errorf("classOf(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+// TestBufPool_ClassBoundaries 测试跨越 size class 边界的 value 都能正确读出
+func TestBufPool_ClassBoundaries(t *testing.T) {
+	cache := NewCache(512*1024*1024, WithBigValues())
+	defer cache.Close()
+	ttl := NewCacheWithTTL(512*1024*1024, WithBigValues())
+	defer ttl.Close()
+
+	sizes := []int{0, 1, 1023, 1024, 1025, 8*1024 - 1, 8 * 1024, 8*1024 + 1, 60 * 1024, 64*1024 + 1, 200 * 1024}
+	values := make(map[string][]byte)
+	for _, size := range sizes {
+		key := fmt.Sprintf("key-%d", size)
+		values[key] = randomBytes(size)
+		cache.Set(key, values[key])
+		ttl.Set(key, values[key], time.Minute)
+	}
+
+	// 先大后小再大，每次读取时上一次的 size class 都不同
+	order := append(append([]int{}, sizes...), sizes...)
+	for i := len(sizes); i < len(order); i++ {
+		order[i] = sizes[len(order)-1-i]
+	}
+	for _, size := range order {
+		key := fmt.Sprintf("key-%d", size)
+		want := values[key]
+		if got, ok := cache.GetOK(key); !ok || !bytes.Equal(got, want) {
+			t.Errorf("GetOK(%s) returned %d bytes, %v, want the %d stored", key, len(got), ok, size)
+		}
+		if got, ok := ttl.GetOK(key); !ok || !bytes.Equal(got, want) {
+			t.Errorf("ttl GetOK(%s) returned %d bytes, %v, want the %d stored", key, len(got), ok, size)
+		}
+		if _, err := cache.GetFn(key, func(value []byte) error {
+			if !bytes.Equal(value, want) {
+				t.Errorf("GetFn(%s) saw %d bytes, want the %d stored", key, len(value), size)
+			}
+			return nil
+		}); err != nil {
+			t.Errorf("GetFn(%s): %v", key, err)
+		}
+		if !ttl.HasMulti([]string{key})[0] {
+			t.Errorf("ttl HasMulti(%s) = false, want true", key)
+		}
+	}
+
+	keys := make([]string, 0, len(sizes))
+	for _, size := range sizes {
+		keys = append(keys, fmt.Sprintf("key-%d", size))
+	}
+	for i, got := range cache.MGet(keys) {
+		if !bytes.Equal(got, values[keys[i]]) {
+			t.Errorf("MGet(%s) returned %d bytes, want the %d stored", keys[i], len(got), len(values[keys[i]]))
+		}
+	}
+}
+
+// TestBufPool_Stats 测试读取按上一个 value 的大小选择 buffer，溢出被计数
+func TestBufPool_Stats(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues(), WithMaxPooledBuffer(64*1024), WithPoolBypass(math.MaxInt))
+	defer cache.Close()
+
+	cache.Set("small", randomBytes(100))
+	cache.Set("large", randomBytes(50*1024))
+	cache.Set("huge", randomBytes(100*1024))
+
+	for i := 0; i < 10; i++ {
+		cache.Get("small")
+	}
+	if st := cache.Stats(); st.PoolOverflows != 0 || st.PoolAllocs == 0 {
+		t.Errorf("Stats after small reads = %+v, want allocs and no overflows", st)
+	}
+
+	// 第一次读取大 value 时 buffer 太小，之后按 64KB class 分配
+	for i := 0; i < 10; i++ {
+		cache.Get("large")
+	}
+	if got := cache.Stats().PoolOverflows; got != 1 {
+		t.Errorf("PoolOverflows after large reads = %d, want 1", got)
+	}
+
+	// 回到小 value 不再溢出
+	for i := 0; i < 10; i++ {
+		cache.Get("small")
+	}
+	if got := cache.Stats().PoolOverflows; got != 1 {
+		t.Errorf("PoolOverflows after small reads = %d, want 1", got)
+	}
+
+	// 超出 WithMaxPooledBuffer 的 value 每次都溢出，grown buffer 不放回 pool
+	for i := 0; i < 3; i++ {
+		if got := cache.Get("huge"); len(got) != 100*1024 {
+			t.Fatalf("Get(huge) returned %d bytes, want %d", len(got), 100*1024)
+		}
+	}
+	if got := cache.Stats().PoolOverflows; got != 4 {
+		t.Errorf("PoolOverflows after huge reads = %d, want 4", got)
+	}
+
+	cache.ResetStats()
+	if st := cache.Stats(); st.PoolAllocs != 0 || st.PoolOverflows != 0 {
+		t.Errorf("Stats after ResetStats = %+v, want zero pool counters", st)
+	}
+}
+
+// TestBufPool_Grown 测试读取撑大的 buffer 按容量放回对应 class，超出上限的被丢弃
+func TestBufPool_Grown(t *testing.T) {
+	// 不绕过 pool，只测试 buffer 的容量上限
+	p := newBufPool(bufClasses[0], 0, math.MaxInt)
+
+	buf := p.getSize(1)
+	buf.b = append(buf.b, randomBytes(100*1024)...)
+	grown := cap(buf.b)
+	p.put(buf)
+	if buf.size != grown || buf.class != 2 {
+		t.Errorf("grown buffer pooled with size %d in class %d, want %d in class 2", buf.size, buf.class, grown)
+	}
+	if got := p.last.Load(); got != 2 {
+		t.Errorf("class of the next get = %d, want 2", got)
+	}
+
+	buf = p.getSize(1)
+	buf.b = append(buf.b, randomBytes(5*1024)...)
+	grown = cap(buf.b)
+	p.put(buf)
+	if buf.size != grown || buf.class != 0 {
+		t.Errorf("grown buffer pooled with size %d in class %d, want %d in class 0", buf.size, buf.class, grown)
+	}
+	if got := p.overflows.Load(); got != 2 {
+		t.Errorf("overflows = %d, want 2", got)
+	}
+
+	// 超出上限的 buffer 被丢弃，不修改其 class
+	buf = p.getSize(1)
+	buf.b = append(buf.b, randomBytes(defaultMaxPooledBuffer+1)...)
+	p.put(buf)
+	if buf.class != 0 || p.overflows.Load() != 3 {
+		t.Errorf("dropped buffer in class %d after %d overflows, want class 0 after 3", buf.class, p.overflows.Load())
+	}
+}
+
+// TestPoolBufferSize 测试 WithPoolBufferSize 替换最小的 size class 并校验大小
+func TestPoolBufferSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{512, []int{512, 8 << 10, 64 << 10}},
+		{1024, []int{1024, 8 << 10, 64 << 10}},
+		{12 << 10, []int{12 << 10, 64 << 10}},
+		{maxKeyValueSize, []int{maxKeyValueSize, 64 << 10}},
+	}
+	for _, tt := range tests {
+		if got := poolClasses(tt.size); !slices.Equal(got, tt.want) {
+			t.Errorf("poolClasses(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+
+	cache := NewCacheWithTTL(1024*1024, WithPoolBufferSize(12*1024))
+	defer cache.Close()
+	value := randomBytes(10 * 1024)
+	cache.Set("key", value, time.Minute)
+	for i := 0; i < 10; i++ {
+		if got := cache.Get("key"); !bytes.Equal(got, value) {
+			t.Fatalf("Get returned %d bytes, want the %d stored", len(got), len(value))
+		}
+	}
+	// 12KB 的 buffer 足以容纳 value 和头部，首次读取也不会溢出
+	if got := cache.Stats().PoolOverflows; got != 0 {
+		t.Errorf("PoolOverflows = %d, want 0", got)
+	}
+
+	for _, size := range []int{0, -1, maxKeyValueSize + 1} {
+		if _, err := NewCacheE(1024, WithPoolBufferSize(size)); !errors.Is(err, ErrInvalidPoolBufferSize) {
+			t.Errorf("NewCacheE with WithPoolBufferSize(%d) = %v, want %v", size, err, ErrInvalidPoolBufferSize)
+		}
+		if _, err := NewCacheWithTTLE(1024, WithPoolBufferSize(size)); !errors.Is(err, ErrInvalidPoolBufferSize) {
+			t.Errorf("NewCacheWithTTLE with WithPoolBufferSize(%d) = %v, want %v", size, err, ErrInvalidPoolBufferSize)
+		}
+	}
+}
+
+// TestPoolBypass 测试超过阈值的读取不经过 pool，也不改变下次读取的 size class
+func TestPoolBypass(t *testing.T) {
+	cache := NewCache(64*1024*1024, WithBigValues())
+	defer cache.Close()
+	c := cache.(*Cache)
+
+	small, large, huge := randomBytes(100), randomBytes(60*1024), randomBytes(100*1024)
+	cache.Set("small", small)
+	cache.Set("large", large)
+	cache.Set("huge", huge)
+
+	cache.Get("small")
+	for i := 0; i < 3; i++ {
+		got := cache.Get("large")
+		if !bytes.Equal(got, large) {
+			t.Fatalf("Get(large) returned %d bytes, want the %d stored", len(got), len(large))
+		}
+		if cap(got) != len(got) {
+			t.Errorf("Get(large) cap = %d, want %d", cap(got), len(got))
+		}
+		if got := cache.Get("huge"); !bytes.Equal(got, huge) {
+			t.Fatalf("Get(huge) returned %d bytes, want the %d stored", len(got), len(huge))
+		}
+	}
+	if l, ok := cache.GetLease("large"); !ok || !bytes.Equal(l.Bytes(), large) {
+		t.Errorf("GetLease(large) = %d bytes, %v, want the %d stored", len(l.Bytes()), ok, len(large))
+	} else {
+		l.Release()
+	}
+	st := cache.Stats()
+	if st.PoolBypassed != 7 || st.PoolOverflows != 0 {
+		t.Errorf("Stats = %+v, want 7 bypassed reads and no overflows", st)
+	}
+	if got := c.pool.last.Load(); got != 0 {
+		t.Errorf("class of the next get = %d, want 0 for small values", got)
+	}
+
+	// 阈值可以调整，MGet 等复用 buffer 的读取不受影响
+	low := NewCache(1024*1024, WithPoolBypass(10))
+	defer low.Close()
+	low.Set("a", []byte("0123456789a"))
+	low.Set("b", []byte("b"))
+	if got := low.MGet([]string{"a", "b"}); !bytes.Equal(got[0], []byte("0123456789a")) || !bytes.Equal(got[1], []byte("b")) {
+		t.Errorf("MGet = %q, want the values stored", got)
+	}
+	if got := low.Get("a"); !bytes.Equal(got, []byte("0123456789a")) {
+		t.Errorf("Get = %q, want 0123456789a", got)
+	}
+	if got := low.Stats().PoolBypassed; got != 1 {
+		t.Errorf("PoolBypassed = %d, want 1", got)
+	}
+}
+
+// BenchmarkCache_Get32KB 基准测试重复读取 32KB 的 value，稳定后 buffer 不再增长
+func BenchmarkCache_Get32KB(b *testing.B) {
+	// 默认 32KB 的读取绕过 pool
+	cache := NewCache(100*1024*1024, WithPoolBypass(64*1024))
+	defer cache.Close()
+	cache.Set("key", randomBytes(32*1024))
+
+	run := func(b *testing.B, read func()) {
+		read()
+		cache.ResetStats()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			read()
+		}
+		b.ReportMetric(float64(cache.Stats().PoolOverflows)/float64(b.N), "overflows/op")
+	}
+	b.Run("Get", func(b *testing.B) {
+		run(b, func() { cache.Get("key") })
+	})
+	b.Run("GetFn", func(b *testing.B) {
+		fn := func([]byte) error { return nil }
+		run(b, func() { cache.GetFn("key", fn) })
+	})
+	b.Run("GetLease", func(b *testing.B) {
+		run(b, func() {
+			l, _ := cache.GetLease("key")
+			l.Release()
+		})
+	})
+}
+
+// BenchmarkCache_GetMixed 基准测试大小混合的 value 的 Get
+func BenchmarkCache_GetMixed(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+	cache.Set("small", randomBytes(100))
+	cache.Set("large", randomBytes(50*1024))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%8 == 0 {
+			cache.Get("large")
+		} else {
+			cache.Get("small")
+		}
+	}
+}
+
+// BenchmarkCache_PoolBufferSize 基准测试 12KB 的 value 在默认与匹配的 pool buffer 大小下的并发 Get
+func BenchmarkCache_PoolBufferSize(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"12KB", []Option{WithPoolBufferSize(12 * 1024)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCache(100*1024*1024, bc.opts...)
+			defer cache.Close()
+			cache.Set("key", randomBytes(12*1024-64))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				fn := func([]byte) error { return nil }
+				for pb.Next() {
+					cache.GetFn("key", fn)
+				}
+			})
+			st := cache.Stats()
+			b.ReportMetric(float64(st.PoolAllocs), "bufallocs")
+			b.ReportMetric(float64(st.PoolOverflows), "overflows")
+		})
+	}
+}
+
+// BenchmarkCache_GetPoolBypass 基准测试绕过 pool 的大 value 与小 value 混合读取
+func BenchmarkCache_GetPoolBypass(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"Pooled", []Option{WithPoolBypass(64 * 1024)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			cache := NewCache(100*1024*1024, bc.opts...)
+			defer cache.Close()
+			cache.Set("small", randomBytes(100))
+			cache.Set("large", randomBytes(60*1024))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i%16 == 0 {
+					cache.Get("large")
+				} else {
+					cache.Get("small")
+				}
+			}
+			b.ReportMetric(float64(cache.Stats().PoolBypassed)/float64(b.N), "bypassed/op")
+		})
+	}
+}
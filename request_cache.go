@@ -0,0 +1,107 @@
+package gcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestCache is a request-scoped view over an ICacheWithTTL that memoizes
+// Get results, misses included, until Release. It is not safe for concurrent
+// use: it belongs to the goroutine serving one request, and overlapping calls
+// from two goroutines panic.
+//
+// Slices returned by Get are shared by every Get of the same key in the
+// request, callers must not modify them.
+type RequestCache struct {
+	c    ICacheWithTTL
+	memo map[string]memoized
+	busy atomic.Bool
+}
+
+// memoized is the result of a Get, telling a miss from a stored nil
+type memoized struct {
+	value []byte
+	found bool
+}
+
+var requestCachePool = sync.Pool{
+	New: func() any {
+		return &RequestCache{memo: make(map[string]memoized)}
+	},
+}
+
+// ForRequest returns an empty RequestCache over c, call Release when the request is done.
+func ForRequest(c ICacheWithTTL) *RequestCache {
+	rc := requestCachePool.Get().(*RequestCache)
+	rc.c = c
+	return rc
+}
+
+func (rc *RequestCache) Has(key string) bool {
+	return rc.lookup(key).found
+}
+
+func (rc *RequestCache) Get(key string) []byte {
+	return rc.lookup(key).value
+}
+
+// lookup returns the memoized result for key, reading it from the cache once
+func (rc *RequestCache) lookup(key string) memoized {
+	rc.enter()
+	defer rc.leave()
+
+	if m, ok := rc.memo[key]; ok {
+		return m
+	}
+	v, ok := rc.c.GetOK(key)
+	m := memoized{value: v, found: ok}
+	rc.memo[key] = m
+	return m
+}
+
+// Set writes through to the cache and drops the memoized result for key.
+func (rc *RequestCache) Set(key string, value []byte, ttl time.Duration) error {
+	rc.enter()
+	defer rc.leave()
+
+	delete(rc.memo, key)
+	return rc.c.Set(key, value, ttl)
+}
+
+// Delete writes through to the cache and memoizes key as a miss.
+func (rc *RequestCache) Delete(key string) error {
+	rc.enter()
+	defer rc.leave()
+
+	if err := rc.c.Delete(key); err != nil {
+		delete(rc.memo, key)
+		return err
+	}
+	rc.memo[key] = memoized{}
+	return nil
+}
+
+// Release forgets every memoized result and returns rc to the pool,
+// rc must not be used afterwards.
+func (rc *RequestCache) Release() {
+	rc.enter()
+	clear(rc.memo)
+	rc.c = nil
+	rc.leave()
+	requestCachePool.Put(rc)
+}
+
+func (rc *RequestCache) enter() {
+	if !rc.busy.CompareAndSwap(false, true) {
+		panic("gcache: RequestCache used from multiple goroutines")
+	}
+	if rc.c == nil {
+		rc.busy.Store(false)
+		panic("gcache: RequestCache used after Release")
+	}
+}
+
+func (rc *RequestCache) leave() {
+	rc.busy.Store(false)
+}
@@ -0,0 +1,189 @@
+package gcache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// countingCache 统计对底层缓存的 GetOK 调用次数
+type countingCache struct {
+	ICacheWithTTL
+	gets    int
+	block   chan struct{} // 非 nil 时 GetOK 会阻塞直到 channel 关闭
+	entered chan struct{}
+}
+
+func (c *countingCache) GetOK(key string) ([]byte, bool) {
+	c.gets++
+	if c.block != nil {
+		close(c.entered)
+		<-c.block
+	}
+	return c.ICacheWithTTL.GetOK(key)
+}
+
+func newCountingCache() *countingCache {
+	return &countingCache{ICacheWithTTL: NewCacheWithTTL(1024 * 1024)}
+}
+
+// TestRequestCache_Memoize 测试重复 Get 命中 memo
+func TestRequestCache_Memoize(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+
+	value := []byte("test-value")
+	backend.Set("key", value, time.Second)
+
+	rc := ForRequest(backend)
+	defer rc.Release()
+
+	for i := 0; i < 5; i++ {
+		if got := rc.Get("key"); !bytes.Equal(got, value) {
+			t.Fatalf("Get returned %v, want %v", got, value)
+		}
+	}
+	// miss 也会被缓存
+	for i := 0; i < 5; i++ {
+		if rc.Get("missing") != nil {
+			t.Fatal("Get returned value for missing key")
+		}
+		if rc.Has("missing") {
+			t.Fatal("Has returned true for missing key")
+		}
+	}
+
+	if backend.gets != 2 {
+		t.Errorf("backend Get calls = %d, want 2", backend.gets)
+	}
+}
+
+// TestRequestCache_NilValue 测试存储的 nil 值对 Has 可见，与 miss 区分
+func TestRequestCache_NilValue(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+	backend.Set("nil", nil, time.Second)
+
+	rc := ForRequest(backend)
+	defer rc.Release()
+
+	for i := 0; i < 2; i++ {
+		if !rc.Has("nil") || rc.Get("nil") != nil {
+			t.Fatalf("Has, Get(nil) = %v, %q, want true, nil", rc.Has("nil"), rc.Get("nil"))
+		}
+		if rc.Has("missing") {
+			t.Fatal("Has returned true for missing key")
+		}
+	}
+	if backend.gets != 2 {
+		t.Errorf("backend GetOK calls = %d, want 2", backend.gets)
+	}
+}
+
+// TestRequestCache_WriteInvalidates 测试写操作更新 memo
+func TestRequestCache_WriteInvalidates(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+
+	rc := ForRequest(backend)
+	defer rc.Release()
+
+	if rc.Get("key") != nil {
+		t.Fatal("Get returned value for missing key")
+	}
+
+	// Set 后应该重新读取
+	value := []byte("new-value")
+	if err := rc.Set("key", value, time.Second); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := rc.Get("key"); !bytes.Equal(got, value) {
+		t.Errorf("Get after Set returned %v, want %v", got, value)
+	}
+	if !backend.Has("key") {
+		t.Error("Set did not write through")
+	}
+
+	// Delete 后直接从 memo 返回 miss
+	gets := backend.gets
+	if err := rc.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if rc.Get("key") != nil {
+		t.Error("Get returned value after Delete")
+	}
+	if backend.gets != gets {
+		t.Errorf("Get after Delete reached backend")
+	}
+	if backend.Has("key") {
+		t.Error("Delete did not write through")
+	}
+}
+
+// TestRequestCache_ReleaseReuse 测试 Release 后复用不会泄露之前的结果
+func TestRequestCache_ReleaseReuse(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+
+	backend.Set("key", []byte("old"), time.Second)
+
+	rc := ForRequest(backend)
+	rc.Get("key")
+	rc.Release()
+
+	backend.Set("key", []byte("new"), time.Second)
+
+	for i := 0; i < 10; i++ {
+		rc := ForRequest(backend)
+		if got := rc.Get("key"); !bytes.Equal(got, []byte("new")) {
+			t.Fatalf("Get returned %q after reuse, want %q", got, "new")
+		}
+		rc.Release()
+	}
+}
+
+// TestRequestCache_UseAfterRelease 测试 Release 后使用会 panic
+func TestRequestCache_UseAfterRelease(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+
+	rc := ForRequest(backend)
+	rc.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Get after Release did not panic")
+		}
+	}()
+	rc.Get("key")
+}
+
+// TestRequestCache_ConcurrentUse 测试多个 goroutine 同时使用会 panic
+func TestRequestCache_ConcurrentUse(t *testing.T) {
+	backend := newCountingCache()
+	defer backend.Close()
+	backend.block = make(chan struct{})
+	backend.entered = make(chan struct{})
+
+	rc := ForRequest(backend)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rc.Get("a")
+	}()
+	<-backend.entered
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("concurrent Get did not panic")
+			}
+		}()
+		rc.Get("b")
+	}()
+
+	close(backend.block)
+	<-done
+	rc.Release()
+}
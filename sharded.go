@@ -0,0 +1,315 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ErrInvalidShards is returned by NewShardedCacheE and NewShardedCacheWithTTLE
+// for a shard count that isn't a positive power of two.
+var ErrInvalidShards = errors.New("gcache: shard count must be a positive power of two")
+
+// ShardedCache spreads its keys over independent Caches by their xxhash, so
+// writes, Close and Reset of one shard don't hold up the others, and each
+// shard has its own buffer pool sized by its own reads.
+type ShardedCache struct {
+	shards []*Cache
+	shift  uint // see shardOf
+}
+
+// NewShardedCache creates a cache made of shards Caches of maxBytesPerShard
+// each, created with opts. It panics where NewShardedCacheE fails.
+func NewShardedCache(shards, maxBytesPerShard int, opts ...Option) ICache {
+	c, err := NewShardedCacheE(shards, maxBytesPerShard, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewShardedCacheE is NewShardedCache returning an error: ErrInvalidShards, or
+// an error of NewCacheE for maxBytesPerShard or opts.
+func NewShardedCacheE(shards, maxBytesPerShard int, opts ...Option) (ICache, error) {
+	shift, err := shardShift(shards)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMaxBytes(maxBytesPerShard); err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	if err := o.checkCache(); err != nil {
+		return nil, err
+	}
+	c := &ShardedCache{shards: make([]*Cache, shards), shift: shift}
+	for i := range c.shards {
+		c.shards[i] = newCache(maxBytesPerShard, o)
+	}
+	return c, nil
+}
+
+// shardShift returns the shift shardOf takes for n shards
+func shardShift(n int) (uint, error) {
+	if n <= 0 || n&(n-1) != 0 {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidShards, n)
+	}
+	return 64 - uint(bits.TrailingZeros(uint(n))), nil
+}
+
+// shardOf returns the shard of key. It takes the top bits of the hash: the
+// lock stripes and the key index of each shard use the bottom ones, which
+// would otherwise be the same for every key of a shard. A single shard
+// shifts by 64, which leaves 0.
+func shardOf(key string, shift uint) int {
+	return int(xxhash.Sum64String(key) >> shift)
+}
+
+// groupKeys returns the positions of keys by shard
+func groupKeys(keys []string, shards int, shift uint) [][]int {
+	groups := make([][]int, shards)
+	for i, key := range keys {
+		s := shardOf(key, shift)
+		groups[s] = append(groups[s], i)
+	}
+	return groups
+}
+
+// pick returns the keys at positions
+func pick(keys []string, positions []int) []string {
+	sub := make([]string, len(positions))
+	for i, pos := range positions {
+		sub[i] = keys[pos]
+	}
+	return sub
+}
+
+func (c *ShardedCache) shard(key string) *Cache {
+	return c.shards[shardOf(key, c.shift)]
+}
+
+// EffectiveMaxBytes returns the memory of all shards, see Cache.EffectiveMaxBytes.
+func (c *ShardedCache) EffectiveMaxBytes() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.EffectiveMaxBytes()
+	}
+	return n
+}
+
+func (c *ShardedCache) Has(key string) bool {
+	return c.shard(key).Has(key)
+}
+
+// HasMulti reports the presence of each key, in input order. Each shard
+// checks its keys in one go.
+func (c *ShardedCache) HasMulti(keys []string) []bool {
+	res := make([]bool, len(keys))
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		for j, has := range c.shards[i].HasMulti(pick(keys, positions)) {
+			res[positions[j]] = has
+		}
+	}
+	return res
+}
+
+func (c *ShardedCache) Get(key string) []byte {
+	return c.shard(key).Get(key)
+}
+
+func (c *ShardedCache) GetOK(key string) ([]byte, bool) {
+	return c.shard(key).GetOK(key)
+}
+
+func (c *ShardedCache) GetInto(dst []byte, key string) ([]byte, bool) {
+	return c.shard(key).GetInto(dst, key)
+}
+
+func (c *ShardedCache) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	return c.shard(key).GetFn(key, fn)
+}
+
+func (c *ShardedCache) GetLease(key string) (*Lease, bool) {
+	return c.shard(key).GetLease(key)
+}
+
+func (c *ShardedCache) GetOrDefault(key string, def []byte) []byte {
+	return c.shard(key).GetOrDefault(key, def)
+}
+
+func (c *ShardedCache) Peek(key string) []byte {
+	return c.shard(key).Peek(key)
+}
+
+// MGet returns the values of keys by position, nil for missing keys.
+func (c *ShardedCache) MGet(keys []string) [][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+	values, _ := c.mget(keys)
+	return values
+}
+
+// MGetMap returns the values of the keys found and the missing keys,
+// in input order without duplicates.
+func (c *ShardedCache) MGetMap(keys []string) (map[string][]byte, []string) {
+	values, found := c.mget(keys)
+	return splitHits(keys, values, found)
+}
+
+// mget looks keys up like Cache.mget, one batch per shard
+func (c *ShardedCache) mget(keys []string) (res [][]byte, found []bool) {
+	res = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		values, hits := c.shards[i].mget(pick(keys, positions), nil)
+		for j, pos := range positions {
+			res[pos], found[pos] = values[j], hits[j]
+		}
+	}
+	return res, found
+}
+
+func (c *ShardedCache) GetRange(key string, offset, length int) []byte {
+	return c.shard(key).GetRange(key, offset, length)
+}
+
+func (c *ShardedCache) Set(key string, value []byte) error {
+	return c.shard(key).Set(key, value)
+}
+
+// MSet writes every entry shard by shard, continuing past failures, which are
+// returned as a *BatchError sorted by key like those of Cache.MSet.
+func (c *ShardedCache) MSet(entries map[string][]byte) error {
+	groups := make([][]string, len(c.shards))
+	for key := range entries {
+		s := shardOf(key, c.shift)
+		groups[s] = append(groups[s], key)
+	}
+	var errs BatchError
+	for i, keys := range groups {
+		for _, key := range keys {
+			errs.add(key, c.shards[i].Set(key, entries[key]))
+		}
+	}
+	sort.Slice(errs.Errors, func(i, j int) bool {
+		return errs.Errors[i].Key < errs.Errors[j].Key
+	})
+	return errs.err()
+}
+
+func (c *ShardedCache) GetOrSet(key string, value []byte) (actual []byte, stored bool, err error) {
+	return c.shard(key).GetOrSet(key, value)
+}
+
+func (c *ShardedCache) SetNX(key string, value []byte) (bool, error) {
+	return c.shard(key).SetNX(key, value)
+}
+
+func (c *ShardedCache) SetXX(key string, value []byte) (bool, error) {
+	return c.shard(key).SetXX(key, value)
+}
+
+func (c *ShardedCache) SetReplaced(key string, value []byte) (bool, error) {
+	return c.shard(key).SetReplaced(key, value)
+}
+
+func (c *ShardedCache) Swap(key string, value []byte) (old []byte, existed bool, err error) {
+	return c.shard(key).Swap(key, value)
+}
+
+func (c *ShardedCache) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	return c.shard(key).CompareAndSwap(key, expected, value)
+}
+
+func (c *ShardedCache) Append(key string, data []byte) error {
+	return c.shard(key).Append(key, data)
+}
+
+func (c *ShardedCache) Incr(key string, delta int64) (int64, error) {
+	return c.shard(key).Incr(key, delta)
+}
+
+func (c *ShardedCache) Decr(key string, delta int64) (int64, error) {
+	return c.shard(key).Decr(key, delta)
+}
+
+func (c *ShardedCache) IncrFloat(key string, delta float64) (float64, error) {
+	return c.shard(key).IncrFloat(key, delta)
+}
+
+func (c *ShardedCache) Delete(key string) error {
+	return c.shard(key).Delete(key)
+}
+
+func (c *ShardedCache) GetAndDelete(key string) []byte {
+	return c.shard(key).GetAndDelete(key)
+}
+
+func (c *ShardedCache) CompareAndDelete(key string, expected []byte) (bool, error) {
+	return c.shard(key).CompareAndDelete(key, expected)
+}
+
+// MDelete deletes keys shard by shard and returns how many of them existed.
+func (c *ShardedCache) MDelete(keys ...string) (int, error) {
+	n := 0
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		deleted, err := c.shards[i].MDelete(pick(keys, positions)...)
+		n += deleted
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Stats returns the counters of all shards added up.
+func (c *ShardedCache) Stats() Stats {
+	var s Stats
+	for _, shard := range c.shards {
+		s.add(shard.Stats())
+	}
+	return s
+}
+
+// ResetStats zeroes the counters of every shard and returns the sum of the
+// Stats they were zeroed from.
+func (c *ShardedCache) ResetStats() Stats {
+	var s Stats
+	for _, shard := range c.shards {
+		s.add(shard.ResetStats())
+	}
+	return s
+}
+
+// Reset resets every shard like Cache.Reset, one at a time, so reads of a
+// shard not reset yet may still hit. It fails with ErrClosed on a closed cache.
+func (c *ShardedCache) Reset() error {
+	var first error
+	for _, s := range c.shards {
+		if err := s.Reset(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes every shard like Cache.Close.
+func (c *ShardedCache) Close() error {
+	for _, s := range c.shards {
+		s.Close()
+	}
+	return nil
+}
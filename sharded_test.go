@@ -0,0 +1,282 @@
+package gcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestNewShardedCacheE 测试非法分片数、容量和选项返回错误
+func TestNewShardedCacheE(t *testing.T) {
+	tests := []struct {
+		shards   int
+		maxBytes int
+		opts     []Option
+		want     error
+	}{
+		{0, 1024, nil, ErrInvalidShards},
+		{-4, 1024, nil, ErrInvalidShards},
+		{3, 1024, nil, ErrInvalidShards},
+		{4, 0, nil, ErrInvalidMaxBytes},
+		{4, 1024, []Option{WithKeyHashing(8)}, ErrInvalidKeyHashing},
+	}
+	for _, tt := range tests {
+		if c, err := NewShardedCacheE(tt.shards, tt.maxBytes, tt.opts...); !errors.Is(err, tt.want) || c != nil {
+			t.Errorf("NewShardedCacheE(%d, %d) = %v, %v, want %v", tt.shards, tt.maxBytes, c, err, tt.want)
+		}
+		if c, err := NewShardedCacheWithTTLE(tt.shards, tt.maxBytes, tt.opts...); !errors.Is(err, tt.want) || c != nil {
+			t.Errorf("NewShardedCacheWithTTLE(%d, %d) = %v, %v, want %v", tt.shards, tt.maxBytes, c, err, tt.want)
+		}
+	}
+	if _, err := NewShardedCacheWithTTLE(4, 1024, WithTTLJitter(1)); !errors.Is(err, ErrInvalidTTLJitter) {
+		t.Errorf("NewShardedCacheWithTTLE with an invalid jitter = %v, want ErrInvalidTTLJitter", err)
+	}
+
+	// 单个分片也合法
+	c := NewShardedCache(1, 1024)
+	defer c.Close()
+	c.Set("key", []byte("value"))
+	if got := c.Get("key"); !bytes.Equal(got, []byte("value")) {
+		t.Errorf("Get with one shard = %q, want value", got)
+	}
+}
+
+// TestShardedCache 测试 key 分布到各分片，批量操作保持输入顺序
+func TestShardedCache(t *testing.T) {
+	cache := NewShardedCache(4, 1024*1024)
+	defer cache.Close()
+	c := cache.(*ShardedCache)
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	entries := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		entries[key] = []byte("v-" + key)
+	}
+	if err := cache.MSet(entries); err != nil {
+		t.Fatalf("MSet = %v", err)
+	}
+
+	// 每个分片都有 key，且 key 只在自己的分片中
+	for i, s := range c.shards {
+		n := 0
+		for _, key := range keys {
+			if s.Has(key) {
+				n++
+				if shardOf(key, c.shift) != i {
+					t.Errorf("%s found in shard %d, want %d", key, i, shardOf(key, c.shift))
+				}
+			}
+		}
+		if n == 0 {
+			t.Errorf("shard %d holds no key", i)
+		}
+	}
+
+	query := []string{"key-3", "missing", "key-42", "key-3", "key-7"}
+	want := [][]byte{[]byte("v-key-3"), nil, []byte("v-key-42"), []byte("v-key-3"), []byte("v-key-7")}
+	if got := cache.MGet(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("MGet = %q, want %q", got, want)
+	}
+	if got := cache.HasMulti(query); !reflect.DeepEqual(got, []bool{true, false, true, true, true}) {
+		t.Errorf("HasMulti = %v", got)
+	}
+	hits, misses := cache.MGetMap(append(query, "missing"))
+	if len(hits) != 3 || !reflect.DeepEqual(misses, []string{"missing"}) {
+		t.Errorf("MGetMap = %d hits, misses %v, want 3, [missing]", len(hits), misses)
+	}
+
+	// 失败的 entry 按 key 排序
+	err := cache.MSet(map[string][]byte{
+		"ok": []byte("value"),
+		"b":  make([]byte, maxKeyValueSize),
+		"a":  make([]byte, maxKeyValueSize),
+	})
+	var be *BatchError
+	if !errors.As(err, &be) || !reflect.DeepEqual(be.Keys(), []string{"a", "b"}) {
+		t.Errorf("MSet error = %v, want a and b failing", err)
+	}
+
+	if n, err := cache.MDelete("key-1", "key-2", "missing", "key-99"); n != 3 || err != nil {
+		t.Errorf("MDelete = %d, %v, want 3, nil", n, err)
+	}
+	if got := cache.EffectiveMaxBytes(); got != 4*effectiveMaxBytes(1024*1024) {
+		t.Errorf("EffectiveMaxBytes = %d, want 4 shards worth", got)
+	}
+}
+
+// TestShardedCache_Stats 测试各分片的 Stats 汇总，Reset 和 Close 作用于所有分片
+func TestShardedCache_Stats(t *testing.T) {
+	cache := NewShardedCache(4, 1024*1024, WithSetDedup())
+	defer cache.Close()
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		cache.Set(key, []byte("value"))
+		cache.Set(key, []byte("value"))
+	}
+	if got := cache.Stats().SkippedWrites; got != int64(len(keys)) {
+		t.Errorf("SkippedWrites = %d, want %d", got, len(keys))
+	}
+	cache.ResetStats()
+	// fastcache 自己的统计不受 ResetStats 影响
+	got := cache.Stats()
+	if want := (Stats{EntriesCount: 8, BytesSize: got.BytesSize, Fastcache: got.Fastcache}); got != want {
+		t.Errorf("Stats after ResetStats = %+v, want zero", got)
+	}
+
+	if err := cache.Reset(); err != nil {
+		t.Fatalf("Reset = %v", err)
+	}
+	for _, key := range keys {
+		if cache.Has(key) {
+			t.Errorf("%s found after Reset", key)
+		}
+	}
+
+	cache.Close()
+	for _, key := range keys {
+		if err := cache.Set(key, []byte("value")); !errors.Is(err, ErrClosed) {
+			t.Errorf("Set(%s) after Close = %v, want ErrClosed", key, err)
+		}
+	}
+	if err := cache.Reset(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Reset after Close = %v, want ErrClosed", err)
+	}
+}
+
+// TestShardedCacheWithTTL 测试 TTL 分片缓存的过期、批量操作和汇总
+func TestShardedCacheWithTTL(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewShardedCacheWithTTL(4, 1024*1024, WithClock(clock), WithKeyIndex())
+	defer cache.Close()
+
+	var entries []TTLEntry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, TTLEntry{Key: fmt.Sprintf("key-%d", i), Value: []byte("value"), TTL: time.Minute})
+	}
+	entries = append(entries,
+		TTLEntry{Key: "z-big", Value: make([]byte, maxKeyValueSize), TTL: time.Minute},
+		TTLEntry{Key: "a-big", Value: make([]byte, maxKeyValueSize), TTL: time.Minute},
+		TTLEntry{Key: "short", Value: []byte("value"), TTL: time.Second},
+	)
+	// 失败的 entry 按输入顺序报告
+	var be *BatchError
+	if err := cache.MSet(entries); !errors.As(err, &be) || !reflect.DeepEqual(be.Keys(), []string{"z-big", "a-big"}) {
+		t.Fatalf("MSet error = %v, want z-big and a-big failing", err)
+	}
+
+	clock.Advance(2 * time.Second)
+	got := cache.MGet([]string{"key-1", "short", "key-2"})
+	if !reflect.DeepEqual(got, [][]byte{[]byte("value"), nil, []byte("value")}) {
+		t.Errorf("MGet = %q", got)
+	}
+	if cache.Has("short") {
+		t.Error("short should have expired")
+	}
+	// MGet 和 Has 都读到过期的 short，只有 Has 删除它
+	if got := cache.Stats().ExpiredReads; got != 2 || cache.LazyPurged() != 1 {
+		t.Errorf("ExpiredReads = %d, LazyPurged = %d, want 2, 1", got, cache.LazyPurged())
+	}
+
+	// loader 跨分片只调用一次，按输入顺序只收到未命中的 key
+	var calls int
+	var loaded []string
+	res, err := cache.MGetOrCompute([]string{"key-1", "new-1", "new-2", "new-3"}, time.Minute, func(missing []string) (map[string][]byte, error) {
+		calls++
+		loaded = append(loaded, missing...)
+		out := make(map[string][]byte)
+		for _, key := range missing {
+			out[key] = []byte("loaded")
+		}
+		return out, nil
+	})
+	if err != nil || len(res) != 4 || calls != 1 || !reflect.DeepEqual(loaded, []string{"new-1", "new-2", "new-3"}) {
+		t.Errorf("MGetOrCompute = %d values, %v, loaded %v in %d calls", len(res), err, loaded, calls)
+	}
+	if !cache.Has("new-2") {
+		t.Error("loaded values should be stored")
+	}
+
+	// 失败的 key 按输入顺序报告
+	fail := errors.New("upstream")
+	_, err = cache.MGetOrCompute([]string{"x-3", "x-1", "x-2"}, time.Minute, func(missing []string) (map[string][]byte, error) {
+		return nil, fail
+	})
+	if !errors.As(err, &be) || !reflect.DeepEqual(be.Keys(), []string{"x-3", "x-1", "x-2"}) || !errors.Is(err, fail) {
+		t.Errorf("MGetOrCompute error = %v, want x-3, x-1, x-2 failing", err)
+	}
+	// TTL 无法解析的分片同样按 key 报告，其余分片的命中照常返回
+	res, err = cache.MGetOrCompute([]string{"key-1", "y-1", "y-2"}, UseRuleTTL, func(missing []string) (map[string][]byte, error) {
+		t.Errorf("loader called with %v, want no key to load", missing)
+		return nil, nil
+	})
+	if !errors.As(err, &be) || !reflect.DeepEqual(be.Keys(), []string{"y-1", "y-2"}) || !errors.Is(err, ErrNoTTLRules) || len(res) != 1 {
+		t.Errorf("MGetOrCompute without rules = %d values, %v, want key-1 and y-1, y-2 failing", len(res), err)
+	}
+
+	report, err := cache.Compact()
+	if err != nil || report.Retained != 23 {
+		t.Errorf("Compact = %+v, %v, want 23 retained", report, err)
+	}
+
+	if err := cache.SetTTLRules([]TTLRule{{Prefix: "", TTL: -time.Second}}); err == nil {
+		t.Error("SetTTLRules with an invalid rule should fail")
+	}
+
+	// ICache 视图同样路由到分片
+	view := cache.AsICache(time.Minute)
+	view.Set("viewed", []byte("value"))
+	if got, ttl, ok := cache.GetWithTTL("viewed"); !ok || !bytes.Equal(got, []byte("value")) || ttl != time.Minute {
+		t.Errorf("GetWithTTL of a view write = %q, %v, %v", got, ttl, ok)
+	}
+
+	if err := cache.Reset(); err != nil || cache.Has("key-1") || cache.LazyPurged() != 0 {
+		t.Errorf("Reset = %v, key-1 found %v, LazyPurged %d", err, cache.Has("key-1"), cache.LazyPurged())
+	}
+}
+
+// TestShardedCacheWithTTL_LastSweep 测试 LastSweep 汇总各分片的清理结果
+func TestShardedCacheWithTTL_LastSweep(t *testing.T) {
+	cache := NewShardedCacheWithTTL(2, 1024*1024, WithCleanupInterval(10*time.Millisecond))
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("value"), time.Millisecond)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if res, ok := cache.LastSweep(); ok && res.TotalRemoved == 10 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	res, ok := cache.LastSweep()
+	t.Errorf("LastSweep = %+v, %v, want 10 removed", res, ok)
+}
+
+// BenchmarkShardedCache_Set 基准测试分片缓存的并发写入
+func BenchmarkShardedCache_Set(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := NewShardedCache(shards, 32*1024*1024)
+			defer cache.Close()
+			value := []byte("bench-value")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					cache.Set(fmt.Sprintf("key-%d", i%1024), value)
+					i++
+				}
+			})
+		})
+	}
+}
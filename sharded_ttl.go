@@ -0,0 +1,469 @@
+package gcache
+
+import (
+	"time"
+)
+
+// ShardedCacheWithTTL is ShardedCache for expiring entries: its keys are
+// spread over independent CacheWithTTLs, each with its own buffer pool, key
+// index and sweeper, if any.
+type ShardedCacheWithTTL struct {
+	shards []*CacheWithTTL
+	shift  uint // see shardOf
+}
+
+// NewShardedCacheWithTTL creates a cache made of shards CacheWithTTLs of
+// maxBytesPerShard each, created with opts. It panics where
+// NewShardedCacheWithTTLE fails.
+func NewShardedCacheWithTTL(shards, maxBytesPerShard int, opts ...Option) ICacheWithTTL {
+	c, err := NewShardedCacheWithTTLE(shards, maxBytesPerShard, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewShardedCacheWithTTLE is NewShardedCacheWithTTL returning an error:
+// ErrInvalidShards, or an error of NewCacheWithTTLE for maxBytesPerShard or opts.
+func NewShardedCacheWithTTLE(shards, maxBytesPerShard int, opts ...Option) (ICacheWithTTL, error) {
+	shift, err := shardShift(shards)
+	if err != nil {
+		return nil, err
+	}
+	c := &ShardedCacheWithTTL{shards: make([]*CacheWithTTL, 0, shards), shift: shift}
+	for range shards {
+		s, err := NewCacheWithTTLE(maxBytesPerShard, opts...)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.shards = append(c.shards, s.(*CacheWithTTL))
+	}
+	return c, nil
+}
+
+func (c *ShardedCacheWithTTL) shard(key string) *CacheWithTTL {
+	return c.shards[shardOf(key, c.shift)]
+}
+
+// AsICache returns a view of c as an ICache, see CacheWithTTL.AsICache.
+func (c *ShardedCacheWithTTL) AsICache(ttl time.Duration) ICache {
+	return &ttlView{c: c, ttl: ttl}
+}
+
+// EffectiveMaxBytes returns the memory of all shards, see Cache.EffectiveMaxBytes.
+func (c *ShardedCacheWithTTL) EffectiveMaxBytes() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.EffectiveMaxBytes()
+	}
+	return n
+}
+
+func (c *ShardedCacheWithTTL) Has(key string) bool {
+	return c.shard(key).Has(key)
+}
+
+// HasMulti reports whether each key holds a live entry, in input order.
+// Each shard checks its keys in one go.
+func (c *ShardedCacheWithTTL) HasMulti(keys []string) []bool {
+	res := make([]bool, len(keys))
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		for j, has := range c.shards[i].HasMulti(pick(keys, positions)) {
+			res[positions[j]] = has
+		}
+	}
+	return res
+}
+
+func (c *ShardedCacheWithTTL) Get(key string) []byte {
+	return c.shard(key).Get(key)
+}
+
+func (c *ShardedCacheWithTTL) GetOK(key string) ([]byte, bool) {
+	return c.shard(key).GetOK(key)
+}
+
+func (c *ShardedCacheWithTTL) GetE(key string) ([]byte, error) {
+	return c.shard(key).GetE(key)
+}
+
+func (c *ShardedCacheWithTTL) GetInto(dst []byte, key string) ([]byte, bool) {
+	return c.shard(key).GetInto(dst, key)
+}
+
+func (c *ShardedCacheWithTTL) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	return c.shard(key).GetFn(key, fn)
+}
+
+func (c *ShardedCacheWithTTL) GetLease(key string) (*Lease, bool) {
+	return c.shard(key).GetLease(key)
+}
+
+func (c *ShardedCacheWithTTL) GetOrDefault(key string, def []byte) []byte {
+	return c.shard(key).GetOrDefault(key, def)
+}
+
+func (c *ShardedCacheWithTTL) Peek(key string) []byte {
+	return c.shard(key).Peek(key)
+}
+
+// MGet returns the values of keys by position, nil for missing or expired keys.
+func (c *ShardedCacheWithTTL) MGet(keys []string) [][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+	values, _ := c.mget(keys)
+	return values
+}
+
+// MGetMap returns the live values of the keys found and the missing or
+// expired keys, in input order without duplicates.
+func (c *ShardedCacheWithTTL) MGetMap(keys []string) (map[string][]byte, []string) {
+	values, found := c.mget(keys)
+	return splitHits(keys, values, found)
+}
+
+// mget looks keys up like CacheWithTTL.MGet, one batch per shard
+func (c *ShardedCacheWithTTL) mget(keys []string) (res [][]byte, found []bool) {
+	res = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		s := c.shards[i]
+		values, hits := s.mget(pick(keys, positions))
+		for j, pos := range positions {
+			res[pos], found[pos] = values[j], hits[j]
+		}
+	}
+	return res, found
+}
+
+func (c *ShardedCacheWithTTL) GetRange(key string, offset, length int) []byte {
+	return c.shard(key).GetRange(key, offset, length)
+}
+
+func (c *ShardedCacheWithTTL) Set(key string, value []byte, ttl time.Duration) error {
+	return c.shard(key).Set(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) SetWithExpireAt(key string, value []byte, expireAt time.Time) error {
+	return c.shard(key).SetWithExpireAt(key, value, expireAt)
+}
+
+func (c *ShardedCacheWithTTL) SetWithSoftTTL(key string, value []byte, soft, hard time.Duration) error {
+	return c.shard(key).SetWithSoftTTL(key, value, soft, hard)
+}
+
+func (c *ShardedCacheWithTTL) SetWithTTI(key string, value []byte, ttl, tti time.Duration) error {
+	return c.shard(key).SetWithTTI(key, value, ttl, tti)
+}
+
+// MSet writes every entry shard by shard, continuing past failures, which are
+// returned as a *BatchError in the order of entries like those of
+// CacheWithTTL.MSet.
+func (c *ShardedCacheWithTTL) MSet(entries []TTLEntry) error {
+	var failed []error
+	for i, positions := range c.groupEntries(entries) {
+		for _, pos := range positions {
+			e := entries[pos]
+			if err := c.shards[i].Set(e.Key, e.Value, e.TTL); err != nil {
+				if failed == nil {
+					failed = make([]error, len(entries))
+				}
+				failed[pos] = err
+			}
+		}
+	}
+	var errs BatchError
+	for pos, err := range failed {
+		errs.add(entries[pos].Key, err)
+	}
+	return errs.err()
+}
+
+// SetMany is MSet, see CacheWithTTL.SetMany.
+func (c *ShardedCacheWithTTL) SetMany(entries []TTLEntry) error {
+	return c.MSet(entries)
+}
+
+// groupEntries returns the positions of entries by shard
+func (c *ShardedCacheWithTTL) groupEntries(entries []TTLEntry) [][]int {
+	groups := make([][]int, len(c.shards))
+	for i, e := range entries {
+		s := shardOf(e.Key, c.shift)
+		groups[s] = append(groups[s], i)
+	}
+	return groups
+}
+
+func (c *ShardedCacheWithTTL) GetOrSet(key string, value []byte, ttl time.Duration) (actual []byte, stored bool, err error) {
+	return c.shard(key).GetOrSet(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) GetOrCompute(key string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	return c.shard(key).GetOrCompute(key, ttl, loader)
+}
+
+// MGetOrCompute is CacheWithTTL.MGetOrCompute across the shards: loader is
+// called once with the keys that miss in any shard, and each value it returns
+// is stored in the shard of its key. Failed keys, including those of a shard
+// whose TTL can't be resolved, are reported in a *BatchError in the order of
+// keys, along with every value that was found.
+func (c *ShardedCacheWithTTL) MGetOrCompute(keys []string, ttl time.Duration, loader func(missing []string) (map[string][]byte, error)) (map[string][]byte, error) {
+	res := make(map[string][]byte, len(keys))
+	failed := make(map[string]error)
+	var batches []*computeBatch
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		found, misses := c.shards[i].MGetMap(pick(keys, positions))
+		for key, v := range found {
+			res[key] = v
+		}
+		if len(misses) == 0 {
+			continue
+		}
+		b, err := c.shards[i].computeBatch(misses, ttl)
+		if err != nil {
+			for _, key := range misses {
+				failed[key] = err
+			}
+			continue
+		}
+		batches = append(batches, b)
+	}
+	loadMany(keys, batches, loader)
+
+	for _, b := range batches {
+		var errs BatchError
+		b.wait(res, &errs)
+		for _, ke := range errs.Errors {
+			failed[ke.Key] = ke.Err
+		}
+	}
+	var errs BatchError
+	for _, key := range keys {
+		if err, ok := failed[key]; ok {
+			errs.add(key, err)
+			delete(failed, key)
+		}
+	}
+	return res, errs.err()
+}
+
+func (c *ShardedCacheWithTTL) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.shard(key).SetNX(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) SetXX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.shard(key).SetXX(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) SetReplaced(key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.shard(key).SetReplaced(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Swap(key string, value []byte, ttl time.Duration) (old []byte, existed bool, err error) {
+	return c.shard(key).Swap(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) CompareAndSwap(key string, expected, value []byte, ttl time.Duration) (bool, error) {
+	return c.shard(key).CompareAndSwap(key, expected, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Append(key string, data []byte, ttl time.Duration) error {
+	return c.shard(key).Append(key, data, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.shard(key).Incr(key, delta, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Decr(key string, delta int64, ttl time.Duration) (int64, error) {
+	return c.shard(key).Decr(key, delta, ttl)
+}
+
+func (c *ShardedCacheWithTTL) IncrFloat(key string, delta float64, ttl time.Duration) (float64, error) {
+	return c.shard(key).IncrFloat(key, delta, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Delete(key string) error {
+	return c.shard(key).Delete(key)
+}
+
+func (c *ShardedCacheWithTTL) GetAndDelete(key string) []byte {
+	return c.shard(key).GetAndDelete(key)
+}
+
+func (c *ShardedCacheWithTTL) CompareAndDelete(key string, expected []byte) (bool, error) {
+	return c.shard(key).CompareAndDelete(key, expected)
+}
+
+// MDelete deletes keys shard by shard and returns how many of them held a
+// live entry, see CacheWithTTL.MDelete.
+func (c *ShardedCacheWithTTL) MDelete(keys ...string) (int, error) {
+	n := 0
+	for i, positions := range groupKeys(keys, len(c.shards), c.shift) {
+		if len(positions) == 0 {
+			continue
+		}
+		deleted, err := c.shards[i].MDelete(pick(keys, positions)...)
+		n += deleted
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *ShardedCacheWithTTL) Inspect(key string) EntryState {
+	return c.shard(key).Inspect(key)
+}
+
+func (c *ShardedCacheWithTTL) TTL(key string) (time.Duration, bool) {
+	return c.shard(key).TTL(key)
+}
+
+func (c *ShardedCacheWithTTL) GetWithTTL(key string) ([]byte, time.Duration, bool) {
+	return c.shard(key).GetWithTTL(key)
+}
+
+func (c *ShardedCacheWithTTL) GetStale(key string) (value []byte, stale bool, ok bool) {
+	return c.shard(key).GetStale(key)
+}
+
+func (c *ShardedCacheWithTTL) Age(key string) (time.Duration, bool) {
+	return c.shard(key).Age(key)
+}
+
+func (c *ShardedCacheWithTTL) Expire(key string, ttl time.Duration) (bool, error) {
+	return c.shard(key).Expire(key, ttl)
+}
+
+func (c *ShardedCacheWithTTL) Persist(key string) (bool, error) {
+	return c.shard(key).Persist(key)
+}
+
+func (c *ShardedCacheWithTTL) Touch(key string) (bool, error) {
+	return c.shard(key).Touch(key)
+}
+
+// LazyPurged returns how many expired entries Get and Has have deleted
+// across all shards.
+//
+// Deprecated: use TTLStats().ExpiredPurged.
+func (c *ShardedCacheWithTTL) LazyPurged() int64 {
+	var n int64
+	for _, s := range c.shards {
+		n += s.LazyPurged()
+	}
+	return n
+}
+
+// LastSweep returns the latest sweep of each shard added up, At being the
+// most recent of them, false if no shard has swept yet.
+func (c *ShardedCacheWithTTL) LastSweep() (SweepResult, bool) {
+	var res SweepResult
+	swept := false
+	for _, s := range c.shards {
+		last, ok := s.LastSweep()
+		if !ok {
+			continue
+		}
+		swept = true
+		if last.At.After(res.At) {
+			res.At = last.At
+		}
+		res.Scanned += last.Scanned
+		res.Removed += last.Removed
+		res.TotalRemoved += last.TotalRemoved
+	}
+	return res, swept
+}
+
+// Stats returns the counters of all shards added up.
+func (c *ShardedCacheWithTTL) Stats() Stats {
+	var s Stats
+	for _, shard := range c.shards {
+		s.add(shard.Stats())
+	}
+	return s
+}
+
+// TTLStats returns the TTL counters of all shards added up.
+func (c *ShardedCacheWithTTL) TTLStats() TTLStats {
+	var s TTLStats
+	for _, shard := range c.shards {
+		s.add(shard.TTLStats())
+	}
+	return s
+}
+
+// ResetStats zeroes the counters of every shard and returns the sum of the
+// Stats they were zeroed from.
+func (c *ShardedCacheWithTTL) ResetStats() Stats {
+	var s Stats
+	for _, shard := range c.shards {
+		s.add(shard.ResetStats())
+	}
+	return s
+}
+
+// Compact compacts every shard in turn, see CacheWithTTL.Compact, and returns
+// their reports added up. It stops at the first shard that fails.
+func (c *ShardedCacheWithTTL) Compact() (CompactReport, error) {
+	var total CompactReport
+	for _, s := range c.shards {
+		r, err := s.Compact()
+		if err != nil {
+			return total, err
+		}
+		total.Retained += r.Retained
+		total.RetainedBytes += r.RetainedBytes
+		total.Dropped += r.Dropped
+		total.DroppedBytes += r.DroppedBytes
+	}
+	return total, nil
+}
+
+// SetTTLRules replaces the TTL rules of every shard, see CacheWithTTL.SetTTLRules.
+// Invalid rules leave every shard's rules unchanged.
+func (c *ShardedCacheWithTTL) SetTTLRules(rules []TTLRule) error {
+	if rules != nil {
+		if _, err := newTTLRules(rules); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.shards {
+		s.SetTTLRules(rules)
+	}
+	return nil
+}
+
+// Reset resets every shard like CacheWithTTL.Reset, one at a time, so reads
+// of a shard not reset yet may still hit. It fails with ErrClosed on a closed
+// cache.
+func (c *ShardedCacheWithTTL) Reset() error {
+	var first error
+	for _, s := range c.shards {
+		if err := s.Reset(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes every shard like CacheWithTTL.Close.
+func (c *ShardedCacheWithTTL) Close() error {
+	for _, s := range c.shards {
+		s.Close()
+	}
+	return nil
+}
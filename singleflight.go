@@ -0,0 +1,150 @@
+package gcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// flight is an in-progress or completed call of flightGroup.do
+type flight struct {
+	wg     sync.WaitGroup
+	val    []byte
+	err    error
+	absent bool // the batch loader of a claimed flight didn't return the key
+}
+
+// wait blocks until f is done and returns a copy of its value,
+// ok is false if the key was not loaded
+func (f *flight) wait() (val []byte, ok bool, err error) {
+	f.wg.Wait()
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	if f.absent {
+		return nil, false, nil
+	}
+	return append([]byte{}, f.val...), true, nil
+}
+
+// flightGroup runs at most one call per key at a time, later callers for the
+// same key wait for it and share its result.
+type flightGroup struct {
+	mu      sync.Mutex
+	m       map[string]*flight
+	spawned sync.WaitGroup // calls of spawn in progress
+	closed  bool           // spawn starts nothing after close
+}
+
+// do runs fn once per key across concurrent callers. The caller that ran fn
+// gets its value as is, the others get their own copy.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flight)
+	}
+	if f, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		val, ok, err := f.wait()
+		if err == nil && !ok {
+			// a batch loader didn't return key, load it ourselves
+			return g.do(key, fn)
+		}
+		return val, err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.m[key] = f
+	g.mu.Unlock()
+
+	var val []byte
+	defer func() {
+		if r := recover(); r != nil {
+			f.err = fmt.Errorf("gcache: loader for %q panicked: %v", key, r)
+			g.finish(key, f)
+			panic(r)
+		}
+		g.finish(key, f)
+	}()
+
+	val, f.err = fn()
+	if f.err == nil {
+		// waiters copy from a private copy, so the caller may modify val
+		f.val = append([]byte{}, val...)
+	}
+	return val, f.err
+}
+
+// claim starts a flight for each key nobody is loading yet and returns them
+// in own, the caller sets their results and ends each with finish. The flights
+// of other callers for the remaining keys are returned in others.
+func (g *flightGroup) claim(keys []string) (own, others map[string]*flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[string]*flight)
+	}
+	own = make(map[string]*flight, len(keys))
+	for _, key := range keys {
+		if f, ok := g.m[key]; ok {
+			if others == nil {
+				others = make(map[string]*flight)
+			}
+			others[key] = f
+			continue
+		}
+		f := &flight{}
+		f.wg.Add(1)
+		g.m[key] = f
+		own[key] = f
+	}
+	return own, others
+}
+
+// spawn runs fn in the background unless a call for key is already in flight,
+// do callers for key wait for it as for any other call. A panic in fn is
+// turned into the error of the call as there is no caller to propagate it to.
+func (g *flightGroup) spawn(key string, fn func() ([]byte, error)) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flight)
+	}
+	if _, ok := g.m[key]; ok || g.closed {
+		g.mu.Unlock()
+		return
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.m[key] = f
+	g.spawned.Add(1)
+	g.mu.Unlock()
+
+	go func() {
+		defer g.spawned.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				f.err = fmt.Errorf("gcache: loader for %q panicked: %v", key, r)
+			}
+			g.finish(key, f)
+		}()
+		val, err := fn()
+		f.err = err
+		if err == nil {
+			f.val = append([]byte{}, val...)
+		}
+	}()
+}
+
+// close stops spawn from starting calls and waits for those in progress
+func (g *flightGroup) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	g.spawned.Wait()
+}
+
+func (g *flightGroup) finish(key string, f *flight) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+	f.wg.Done()
+}
@@ -0,0 +1,318 @@
+package gcache
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+// Stats are the counters of a cache since it was created or its stats were
+// last reset.
+type Stats struct {
+	// GetCalls counts the reads of a value: the Get, GetOK, GetE, GetString,
+	// GetOrDefault, GetInto, GetFn, GetLease and GetOrCompute calls, and each
+	// key of MGet, MGetMap and MGetOrCompute. It is Hits plus Misses, reads of
+	// a CacheWithTTL finding an expired entry being misses. Has, Peek and the
+	// operations reading a value to update it aren't counted.
+	GetCalls int64
+	Hits     int64
+	Misses   int64
+	// SetCalls counts the calls of Set and its variants, of SetString, and
+	// the entries of MSet, including those that failed or were skipped.
+	SetCalls int64
+	// DelCalls counts the calls of Delete and the keys of MDelete.
+	DelCalls int64
+	// EntriesCount and BytesSize are those of Fastcache: the entries stored
+	// and the memory their chunks take.
+	EntriesCount uint64
+	BytesSize    uint64
+	// Fastcache holds the stats of the underlying fastcache instances, both
+	// of them WithBigValues, whose entries count every chunk of a big value.
+	// Its counters are fastcache's own: they count since the cache was
+	// created, last Reset or compacted, and ResetStats leaves them.
+	Fastcache fastcache.Stats
+	// ExpiredReads counts the reads of a CacheWithTTL that found an entry
+	// past its expiry: misses a longer TTL would have turned into hits,
+	// unlike those of keys never stored or evicted. It is TTLStats'
+	// MissesExpired, kept in Stats for caches used through ICache.
+	ExpiredReads int64
+	// ForeignReads counts the Get and Has calls of a CacheWithTTL that found
+	// a value it didn't write, see ErrNotTTLEntry.
+	ForeignReads int64
+	// CorruptReads counts the reads that found an entry failing its
+	// checksum, see WithChecksum. Such entries read as missing.
+	CorruptReads int64
+	// PoolAllocs counts the buffers the cache allocated because none of their
+	// size class was pooled. Reads and CacheWithTTL writes share them, reads
+	// are sized by the last value read, so a steady count means both are
+	// served from the pools.
+	PoolAllocs int64
+	// PoolOverflows counts the reads, and CacheWithTTL writes, whose entry
+	// outgrew the pooled buffer, allocating a larger one. It is pooled in turn
+	// unless past WithMaxPooledBuffer, so a steady count means entries that
+	// large are common enough to raise it.
+	PoolOverflows int64
+	// PoolBypassed counts the reads of values past WithPoolBypass, whose
+	// buffer was allocated for them rather than pooled.
+	PoolBypassed int64
+	// SkippedWrites counts the Set calls that found the value already stored
+	// and didn't write it, see WithSetDedup.
+	SkippedWrites int64
+	// FilterSkips counts the reads the negative lookup filter answered as
+	// misses without looking the key up, see WithNegativeLookupFilter.
+	FilterSkips int64
+	// FilterFalsePositives counts the lookups the filter let through that
+	// missed: its false positives, and keys evicted by fastcache.
+	FilterFalsePositives int64
+}
+
+// add adds the counters of o to s, for the caches made of several
+func (s *Stats) add(o Stats) {
+	s.GetCalls += o.GetCalls
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.SetCalls += o.SetCalls
+	s.DelCalls += o.DelCalls
+	s.EntriesCount += o.EntriesCount
+	s.BytesSize += o.BytesSize
+	addFastcacheStats(&s.Fastcache, o.Fastcache)
+	s.ExpiredReads += o.ExpiredReads
+	s.ForeignReads += o.ForeignReads
+	s.CorruptReads += o.CorruptReads
+	s.PoolAllocs += o.PoolAllocs
+	s.PoolOverflows += o.PoolOverflows
+	s.PoolBypassed += o.PoolBypassed
+	s.SkippedWrites += o.SkippedWrites
+	s.FilterSkips += o.FilterSkips
+	s.FilterFalsePositives += o.FilterFalsePositives
+}
+
+// addFastcacheStats adds the stats of o to s
+func addFastcacheStats(s *fastcache.Stats, o fastcache.Stats) {
+	s.GetCalls += o.GetCalls
+	s.SetCalls += o.SetCalls
+	s.Misses += o.Misses
+	s.Collisions += o.Collisions
+	s.Corruptions += o.Corruptions
+	s.EntriesCount += o.EntriesCount
+	s.BytesSize += o.BytesSize
+	s.MaxBytesSize += o.MaxBytesSize
+	s.GetBigCalls += o.GetBigCalls
+	s.SetBigCalls += o.SetBigCalls
+	s.TooBigKeyErrors += o.TooBigKeyErrors
+	s.InvalidMetavalueErrors += o.InvalidMetavalueErrors
+	s.InvalidValueLenErrors += o.InvalidValueLenErrors
+	s.InvalidValueHashErrors += o.InvalidValueHashErrors
+}
+
+// TTLStats are the counters a CacheWithTTL keeps on top of Stats, telling
+// the reads of keys never stored from those of keys that expired, to weigh a
+// longer TTL against more capacity. Unlike Stats.GetCalls they count Has and
+// HasMulti along with the reads of a value, Peek, GetStale and the other
+// inspections aside.
+type TTLStats struct {
+	Hits int64 // reads that found a live entry
+	// MissesAbsent counts the reads of keys never stored, deleted or evicted,
+	// and of keys holding a value the cache didn't write.
+	MissesAbsent int64
+	// MissesExpired counts the reads that found an entry past its expiry,
+	// also reported as Stats.ExpiredReads.
+	MissesExpired int64
+	Sets          int64 // see Stats.SetCalls
+	Deletes       int64 // see Stats.DelCalls
+	// ExpiredPurged counts the expired entries deleted by reads, the
+	// sweeper, the probes of WithExpireProbes and Compact, replacing
+	// LazyPurged.
+	ExpiredPurged int64
+}
+
+// add adds the counters of o to s, for the caches made of several
+func (s *TTLStats) add(o TTLStats) {
+	s.Hits += o.Hits
+	s.MissesAbsent += o.MissesAbsent
+	s.MissesExpired += o.MissesExpired
+	s.Sets += o.Sets
+	s.Deletes += o.Deletes
+	s.ExpiredPurged += o.ExpiredPurged
+}
+
+// the counters kept in a counterStripe
+const (
+	countHits = iota // Stats.Hits
+	countMisses
+	countSets
+	countDels
+	countTTLHits // TTLStats.Hits, like the counters below
+	countMissesAbsent
+	countMissesExpired
+	countExpiredPurged
+	numCounts
+)
+
+// counterStripe holds a copy of every counter, padded to its own pair of cache
+// lines so stripes don't share one, adjacent lines being prefetched together
+type counterStripe struct {
+	n [numCounts]atomic.Int64
+	_ [128 - numCounts*8]byte
+}
+
+// counters are the counters every read and write bumps, striped so
+// concurrent calls rarely add to the same word. A stripe is picked at random
+// for each add, from the per-thread generator math/rand/v2 uses, and loads
+// sum them all.
+type counters struct {
+	stripes []counterStripe
+	mask    uint32
+}
+
+// newCounters returns counters of a stripe per P, rounded up to a power of two
+func newCounters() counters {
+	n := 1 << bits.Len(uint(runtime.GOMAXPROCS(0)-1))
+	return counters{stripes: make([]counterStripe, n), mask: uint32(n - 1)}
+}
+
+func (c *counters) add(i int) {
+	c.addN(i, 1)
+}
+
+func (c *counters) addN(i int, n int64) {
+	c.stripes[rand.Uint32()&c.mask].n[i].Add(n)
+}
+
+func (c *counters) load(i int) int64 {
+	var n int64
+	for j := range c.stripes {
+		n += c.stripes[j].n[i].Load()
+	}
+	return n
+}
+
+// swap zeroes the counters and returns what they held, each add landing
+// either in the returned counts or in those after the swap
+func (c *counters) swap() [numCounts]int64 {
+	var n [numCounts]int64
+	for j := range c.stripes {
+		for i := range numCounts {
+			n[i] += c.stripes[j].n[i].Swap(0)
+		}
+	}
+	return n
+}
+
+// countGet counts a read of a value, see Stats.GetCalls
+func (c *Cache) countGet(hit bool) {
+	if hit {
+		c.counts.add(countHits)
+	} else {
+		c.counts.add(countMisses)
+	}
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() Stats {
+	// misses are loaded first so concurrent reads don't make GetCalls lag
+	// behind what Hits and Misses add up to
+	misses, hits := c.counts.load(countMisses), c.counts.load(countHits)
+	s := Stats{
+		GetCalls:      hits + misses,
+		Hits:          hits,
+		Misses:        misses,
+		SetCalls:      c.counts.load(countSets),
+		DelCalls:      c.counts.load(countDels),
+		CorruptReads:  c.corruptReads.Load(),
+		PoolAllocs:    c.pool.allocs.Load(),
+		PoolOverflows: c.pool.overflows.Load(),
+		PoolBypassed:  c.pool.bypassed.Load(),
+		SkippedWrites: c.skipped.Load(),
+	}
+	if c.filter != nil {
+		s.FilterSkips = c.filter.skips.Load()
+		s.FilterFalsePositives = c.filter.falsePositives.Load()
+	}
+	c.fastcacheStats(&s)
+	return s
+}
+
+// fastcacheStats sets the stats s takes from fastcache
+func (c *Cache) fastcacheStats(s *Stats) {
+	c.fc().UpdateStats(&s.Fastcache)
+	if c.big != nil {
+		c.big.UpdateStats(&s.Fastcache)
+	}
+	s.EntriesCount, s.BytesSize = s.Fastcache.EntriesCount, s.Fastcache.BytesSize
+}
+
+// ResetStats zeroes the counters returned by Stats and returns the Stats
+// they were zeroed from, so each call is counted either in them or in the
+// Stats that follow, none is lost.
+func (c *Cache) ResetStats() Stats {
+	s, _ := c.resetStats()
+	return s
+}
+
+// resetStats is ResetStats, also returning the counters it swapped out
+func (c *Cache) resetStats() (Stats, [numCounts]int64) {
+	counts := c.counts.swap()
+	s := Stats{
+		GetCalls:      counts[countHits] + counts[countMisses],
+		Hits:          counts[countHits],
+		Misses:        counts[countMisses],
+		SetCalls:      counts[countSets],
+		DelCalls:      counts[countDels],
+		CorruptReads:  c.corruptReads.Swap(0),
+		PoolAllocs:    c.pool.allocs.Swap(0),
+		PoolOverflows: c.pool.overflows.Swap(0),
+		PoolBypassed:  c.pool.bypassed.Swap(0),
+		SkippedWrites: c.skipped.Swap(0),
+	}
+	if c.filter != nil {
+		s.FilterSkips = c.filter.skips.Swap(0)
+		s.FilterFalsePositives = c.filter.falsePositives.Swap(0)
+	}
+	c.fastcacheStats(&s)
+	return s, counts
+}
+
+// Stats returns the cache's counters.
+func (c *CacheWithTTL) Stats() Stats {
+	s := c.cache.Stats()
+	s.ExpiredReads = c.cache.counts.load(countMissesExpired)
+	s.ForeignReads = c.foreignReads.Load()
+	return s
+}
+
+// TTLStats returns the cache's TTL counters, zeroed with those of Stats by
+// ResetStats.
+func (c *CacheWithTTL) TTLStats() TTLStats {
+	counts := &c.cache.counts
+	return TTLStats{
+		Hits:          counts.load(countTTLHits),
+		MissesAbsent:  counts.load(countMissesAbsent),
+		MissesExpired: counts.load(countMissesExpired),
+		Sets:          counts.load(countSets),
+		Deletes:       counts.load(countDels),
+		ExpiredPurged: counts.load(countExpiredPurged),
+	}
+}
+
+// countRead counts a read of a value started at start towards Stats and
+// TTLStats and reports it to the MetricsRecorder, read being the TTLStats
+// counter of its outcome
+func (c *CacheWithTTL) countRead(start time.Time, read int) {
+	c.cache.countGet(read == countTTLHits)
+	c.cache.counts.add(read)
+	c.cache.observeGet(start, read == countTTLHits)
+}
+
+// ResetStats zeroes the counters returned by Stats and TTLStats, and returns
+// the Stats they were zeroed from like Cache.ResetStats.
+func (c *CacheWithTTL) ResetStats() Stats {
+	s, counts := c.cache.resetStats()
+	s.ExpiredReads = counts[countMissesExpired]
+	s.ForeignReads = c.foreignReads.Swap(0)
+	return s
+}
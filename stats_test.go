@@ -0,0 +1,256 @@
+package gcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCache_Stats 测试一组固定操作后的读写计数和 fastcache 统计
+func TestCache_Stats(t *testing.T) {
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.SetString("c", "3")
+	cache.MSet(map[string][]byte{"d": []byte("4"), "e": []byte("5")})
+	cache.Get("a")
+	cache.Get("missing")
+	cache.GetString("c")
+	cache.GetInto(nil, "missing")
+	cache.MGet([]string{"a", "b", "missing"})
+	// Has 和 Peek 不计入读取
+	cache.Has("a")
+	cache.Peek("b")
+	cache.Delete("a")
+	cache.MDelete("b", "missing")
+
+	got := cache.Stats()
+	if got.GetCalls != 7 || got.Hits != 4 || got.Misses != 3 {
+		t.Errorf("GetCalls, Hits, Misses = %d, %d, %d, want 7, 4, 3", got.GetCalls, got.Hits, got.Misses)
+	}
+	if got.SetCalls != 5 || got.DelCalls != 3 {
+		t.Errorf("SetCalls, DelCalls = %d, %d, want 5, 3", got.SetCalls, got.DelCalls)
+	}
+	if got.EntriesCount != 3 || got.EntriesCount != got.Fastcache.EntriesCount {
+		t.Errorf("EntriesCount = %d, fastcache %d, want 3", got.EntriesCount, got.Fastcache.EntriesCount)
+	}
+	if got.BytesSize == 0 || got.BytesSize != got.Fastcache.BytesSize || got.Fastcache.MaxBytesSize == 0 {
+		t.Errorf("BytesSize = %d, fastcache %+v", got.BytesSize, got.Fastcache)
+	}
+	if got.Fastcache.SetCalls != 5 {
+		t.Errorf("Fastcache.SetCalls = %d, want 5", got.Fastcache.SetCalls)
+	}
+
+	// ResetStats 只清零本缓存的计数，并返回清零前的 Stats
+	if old := cache.ResetStats(); old.GetCalls != 7 || old.SetCalls != 5 || old.DelCalls != 3 || old.EntriesCount != 3 {
+		t.Errorf("ResetStats = %+v, want the Stats above", old)
+	}
+	got = cache.Stats()
+	if got.GetCalls != 0 || got.SetCalls != 0 || got.DelCalls != 0 || got.EntriesCount != 3 || got.Fastcache.SetCalls != 5 {
+		t.Errorf("Stats after ResetStats = %+v", got)
+	}
+}
+
+// TestCacheWithTTL_Stats 测试 TTL 缓存读到过期 entry 计为未命中
+func TestCacheWithTTL_Stats(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.Set("short", []byte("value"), time.Second)
+	cache.Set("long", []byte("value"), time.Minute)
+	cache.MSet([]TTLEntry{{Key: "batch", Value: []byte("value"), TTL: time.Minute}})
+	cache.Get("short")
+	clock.Advance(2 * time.Second)
+	cache.Get("short")
+	cache.GetInto(nil, "long")
+	cache.MGet([]string{"long", "batch", "missing"})
+	cache.Delete("long")
+
+	got := cache.Stats()
+	if got.GetCalls != 6 || got.Hits != 4 || got.Misses != 2 {
+		t.Errorf("GetCalls, Hits, Misses = %d, %d, %d, want 6, 4, 2", got.GetCalls, got.Hits, got.Misses)
+	}
+	if got.SetCalls != 3 || got.DelCalls != 1 || got.ExpiredReads != 1 {
+		t.Errorf("SetCalls, DelCalls, ExpiredReads = %d, %d, %d, want 3, 1, 1", got.SetCalls, got.DelCalls, got.ExpiredReads)
+	}
+	// 过期的 short 已被惰性删除
+	if got.EntriesCount != 1 {
+		t.Errorf("EntriesCount = %d, want 1", got.EntriesCount)
+	}
+}
+
+// TestCacheWithTTL_TTLStats 测试 TTL 统计区分不存在、过期和命中，Has 计入而 Peek 和 GetStale 不计入
+func TestCacheWithTTL_TTLStats(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithKeyIndex())
+	defer cache.Close()
+
+	cache.Set("a", []byte("value"), time.Second)
+	cache.Set("b", []byte("value"), time.Second)
+	cache.Set("c", []byte("value"), time.Second)
+	cache.Set("long", []byte("value"), time.Minute)
+	cache.Get("a")
+	cache.Has("long")
+	cache.Has("missing")
+	cache.HasMulti([]string{"long", "missing"})
+	clock.Advance(2 * time.Second)
+	// 过期的 a 被 Get 惰性删除，b 被 Has 删除，HasMulti 只计数不删除
+	cache.Get("a")
+	cache.Has("b")
+	cache.HasMulti([]string{"c"})
+	cache.MGet([]string{"long", "c", "missing"})
+	cache.Peek("long")
+	cache.GetStale("c")
+	cache.Delete("long")
+
+	want := TTLStats{Hits: 4, MissesAbsent: 3, MissesExpired: 4, Sets: 4, Deletes: 1, ExpiredPurged: 2}
+	if got := cache.TTLStats(); got != want {
+		t.Errorf("TTLStats = %+v, want %+v", got, want)
+	}
+	// Stats 只计入读取 value 的调用
+	if got := cache.Stats(); got.Hits != 2 || got.Misses != 3 {
+		t.Errorf("Stats Hits, Misses = %d, %d, want 2, 3", got.Hits, got.Misses)
+	}
+
+	// Compact 删除的过期 entry 同样计入，只剩下 c
+	report, err := cache.Compact()
+	if err != nil || report.Dropped != 1 {
+		t.Fatalf("Compact = %+v, %v, want c dropped", report, err)
+	}
+	if got := cache.TTLStats().ExpiredPurged; got != 3 {
+		t.Errorf("ExpiredPurged after Compact = %d, want 3", got)
+	}
+
+	cache.ResetStats()
+	if got := cache.TTLStats(); got != (TTLStats{}) {
+		t.Errorf("TTLStats after ResetStats = %+v, want zero", got)
+	}
+}
+
+// TestCacheWithTTL_GetOrComputeStats 测试 GetOrCompute 和 MGetOrCompute 与 Get 一样计入统计，每个 key 只计一次
+func TestCacheWithTTL_GetOrComputeStats(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	cache.Set("hit", []byte("value"), time.Minute)
+	cache.Set("short", []byte("value"), time.Second)
+	clock.Advance(2 * time.Second)
+	loader := func() ([]byte, error) { return []byte("loaded"), nil }
+	cache.GetOrCompute("hit", time.Minute, loader)
+	cache.GetOrCompute("short", time.Minute, loader)
+	cache.GetOrCompute("absent", time.Minute, loader)
+	cache.MGetOrCompute([]string{"hit", "new"}, time.Minute, func(keys []string) (map[string][]byte, error) {
+		return map[string][]byte{"new": []byte("loaded")}, nil
+	})
+
+	got := cache.TTLStats()
+	if got.Hits != 2 || got.MissesAbsent != 2 || got.MissesExpired != 1 {
+		t.Errorf("TTLStats Hits, MissesAbsent, MissesExpired = %d, %d, %d, want 2, 2, 1",
+			got.Hits, got.MissesAbsent, got.MissesExpired)
+	}
+	if s := cache.Stats(); s.GetCalls != 5 || s.Hits != 2 || s.Misses != 3 || s.ExpiredReads != 1 {
+		t.Errorf("Stats GetCalls, Hits, Misses, ExpiredReads = %d, %d, %d, %d, want 5, 2, 3, 1",
+			s.GetCalls, s.Hits, s.Misses, s.ExpiredReads)
+	}
+}
+
+// TestShardedCacheWithTTL_TTLStats 测试分片缓存的 MGet 和 MGetMap 与未分片缓存一样计入 TTL 统计
+func TestShardedCacheWithTTL_TTLStats(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewShardedCacheWithTTL(4, 1024*1024, WithClock(clock))
+	defer cache.Close()
+
+	cache.Set("a", []byte("value"), time.Minute)
+	cache.Set("short", []byte("value"), time.Second)
+	clock.Advance(2 * time.Second)
+	cache.MGet([]string{"a", "missing", "short"})
+	cache.MGetMap([]string{"a", "missing"})
+
+	want := TTLStats{Hits: 2, MissesAbsent: 2, MissesExpired: 1, Sets: 2}
+	if got := cache.TTLStats(); got != want {
+		t.Errorf("TTLStats = %+v, want %+v", got, want)
+	}
+}
+
+// TestCacheWithTTL_TTLStatsConcurrent 测试并发读写下计数不丢失
+func TestCacheWithTTL_TTLStatsConcurrent(t *testing.T) {
+	cache := NewShardedCacheWithTTL(4, 1024*1024)
+	defer cache.Close()
+	cache.Set("key", []byte("value"), time.Minute)
+
+	const workers, n = 8, 1000
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				cache.Get("key")
+				cache.Has("missing")
+				cache.Set("other", []byte("value"), time.Minute)
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := TTLStats{Hits: workers * n, MissesAbsent: workers * n, Sets: workers*n + 1}
+	if got := cache.TTLStats(); got != want {
+		t.Errorf("TTLStats = %+v, want %+v", got, want)
+	}
+}
+
+// TestCacheWithTTL_ResetStatsConcurrent 测试并发读取时 ResetStats 不丢失计数，每次读取要么在返回值中，要么在之后的 Stats 中
+func TestCacheWithTTL_ResetStatsConcurrent(t *testing.T) {
+	cache := NewShardedCacheWithTTL(4, 1024*1024)
+	defer cache.Close()
+	cache.Set("key", []byte("value"), time.Minute)
+
+	const workers, n = 8, 1000
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				cache.Get("key")
+				cache.Get("missing")
+			}
+		}()
+	}
+	var hits, misses int64
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		s := cache.ResetStats()
+		hits, misses = hits+s.Hits, misses+s.Misses
+	}
+	if hits != workers*n || misses != workers*n {
+		t.Errorf("Hits, Misses over ResetStats = %d, %d, want %d each", hits, misses, workers*n)
+	}
+}
+
+// BenchmarkCacheWithTTL_GetParallel 基准测试并发读取时的计数开销
+func BenchmarkCacheWithTTL_GetParallel(b *testing.B) {
+	cache := NewCacheWithTTL(32 * 1024 * 1024)
+	defer cache.Close()
+	cache.Set("bench-key", []byte("bench-value"), time.Hour)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		dst := make([]byte, 0, 64)
+		for pb.Next() {
+			dst, _ = cache.GetInto(dst[:0], "bench-key")
+		}
+	})
+}
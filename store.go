@@ -0,0 +1,163 @@
+package gcache
+
+// The helpers below are the only way Cache and CacheWithTTL reach fastcache
+// for a key. They pick the store, see WithBigValues, and the key, see
+// WithKeyHashing, and pack values with what the options add to them.
+
+// checkSize returns ErrValueTooLarge if a key and a value of size bytes don't
+// fit one entry and can't be stored as a big value either
+func (c *Cache) checkSize(key string, size int) error {
+	keyLen, size := c.storedSize(key, size)
+	if c.big != nil && keyLen <= maxBigKeySize {
+		return nil
+	}
+	return checkEntrySize(keyLen, size)
+}
+
+// storedSize returns the sizes of the key and value fastcache stores
+// for key and a value of size bytes
+func (c *Cache) storedSize(key string, size int) (int, int) {
+	keyLen := len(key)
+	if c.hashes(key) {
+		keyLen, size = keyHashSize, envelopeSize(key)+size
+	}
+	if c.checksum {
+		size += checksumSize
+	}
+	return keyLen, size
+}
+
+// pack returns the bytes fastcache stores for value under key
+func (c *Cache) pack(key string, value []byte) []byte {
+	if c.hashes(key) {
+		value = seal(key, value)
+	}
+	if c.checksum {
+		value = addChecksum(value)
+	}
+	return value
+}
+
+// unpack returns the value in stored, the bytes fastcache holds for key,
+// false if it fails its checksum or was written for another key
+func (c *Cache) unpack(stored []byte, key string) ([]byte, bool) {
+	value := stored
+	if c.checksum {
+		var ok bool
+		if value, ok = checkChecksum(value); !ok {
+			c.corruptReads.Add(1)
+			return nil, false
+		}
+	}
+	if c.hashes(key) {
+		return unseal(value, key)
+	}
+	return value, true
+}
+
+// packs reports whether values of key are stored packed, see pack
+func (c *Cache) packs(key string) bool {
+	return c.checksum || c.hashes(key)
+}
+
+// hasGet appends the value of key to dst, looking in the big values when the
+// small ones miss
+func (c *Cache) hasGet(dst []byte, key string) ([]byte, bool) {
+	skey := c.storeKey(key)
+	n := len(dst)
+	dst, has := c.fc().HasGet(dst, skey)
+	if !has && c.big != nil {
+		dst = c.big.GetBig(dst, skey)
+		has = len(dst) > n
+	}
+	if !has || !c.packs(key) {
+		return dst, has
+	}
+	value, ok := c.unpack(dst[n:], key)
+	if !ok {
+		return dst[:n], false
+	}
+	return dst[:n+copy(dst[n:], value)], true
+}
+
+// load reads the value of key into the pooled buf, keeping it there for put
+// to see its size
+func (c *Cache) load(buf *readBuf, key string) ([]byte, bool) {
+	var has bool
+	buf.b, has = c.hasGet(buf.b[:0], key)
+	return buf.b, has
+}
+
+// has reports whether key holds a value, big values only if all their chunks
+// are still there
+func (c *Cache) has(key string) bool {
+	if c.filtered(key) {
+		return false
+	}
+	if c.packs(key) {
+		buf := c.pool.get()
+		_, has := c.load(buf, key)
+		c.pool.put(buf)
+		c.passedFilter(has)
+		return has
+	}
+	has := c.hasUnpacked(key)
+	c.passedFilter(has)
+	return has
+}
+
+// hasUnpacked is has for a key whose value is stored as is, see packs
+func (c *Cache) hasUnpacked(key string) bool {
+	if c.fc().Has(keyBytes(key)) {
+		return true
+	}
+	if c.big == nil {
+		return false
+	}
+	var buf [bigMetaSize]byte
+	meta, ok := c.big.HasGet(buf[:0], keyBytes(key))
+	if !ok || len(meta) != bigMetaSize {
+		return false
+	}
+	var sub [bigMetaSize]byte
+	for i := range bigChunks(meta) {
+		if !c.big.Has(bigChunkKey(sub[:], meta, i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// put writes value for key to the store its size calls for, then removes the
+// key from the other one, so concurrent reads see the old or the new value. A
+// key new to the stores is counted in the filter before it is written.
+func (c *Cache) put(key string, value []byte) {
+	skey := c.storeKey(key)
+	if c.filter != nil && !c.stored(skey) {
+		c.filter.add(key)
+	}
+	value = c.pack(key, value)
+	if c.big == nil || len(skey)+len(value) <= maxKeyValueSize {
+		c.fc().Set(skey, value)
+		if c.big != nil {
+			delBig(c.big, skey)
+		}
+		return
+	}
+	setBig(c.big, skey, value)
+	c.fc().Del(skey)
+}
+
+// del deletes key from both stores, with all the chunks of a big value, and
+// counts it out of the filter if it was stored
+func (c *Cache) del(key string) {
+	skey := c.storeKey(key)
+	removed := c.filter != nil && c.stored(skey)
+	c.fc().Del(skey)
+	if c.big != nil {
+		delBig(c.big, skey)
+	}
+	if removed {
+		c.filter.remove(key)
+	}
+}
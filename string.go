@@ -0,0 +1,73 @@
+package gcache
+
+import (
+	"time"
+	"unsafe"
+)
+
+// stringBytes views s as a byte slice without copying, for writes that only
+// copy their value: fastcache copies it, and the caches copy it into the
+// entries they pack or encode. It is never nil, so "" is stored as the empty
+// value []byte("") is.
+func stringBytes(s string) []byte {
+	if s == "" {
+		return []byte{}
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// bytesString adopts b as a string without copying, b must not be used after
+func bytesString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// SetString stores value for key like Set, without converting it to a byte
+// slice first.
+func (c *Cache) SetString(key, value string) error {
+	return c.Set(key, stringBytes(value))
+}
+
+// GetString returns the value of key as a string like GetOK, without copying
+// the fresh value GetOK returns. A stored empty value reads as "", true.
+func (c *Cache) GetString(key string) (string, bool) {
+	value, ok := c.GetOK(key)
+	return bytesString(value), ok
+}
+
+// SetString stores value for key for ttl like Set, without converting it to a
+// byte slice first.
+func (c *CacheWithTTL) SetString(key, value string, ttl time.Duration) error {
+	return c.Set(key, stringBytes(value), ttl)
+}
+
+// GetString returns the live value of key as a string like GetOK, without
+// copying the fresh value GetOK returns. A stored empty or nil value reads as
+// "", true.
+func (c *CacheWithTTL) GetString(key string) (string, bool) {
+	value, ok := c.GetOK(key)
+	return bytesString(value), ok
+}
+
+func (c *ShardedCache) SetString(key, value string) error {
+	return c.shard(key).SetString(key, value)
+}
+
+func (c *ShardedCache) GetString(key string) (string, bool) {
+	return c.shard(key).GetString(key)
+}
+
+func (c *ShardedCacheWithTTL) SetString(key, value string, ttl time.Duration) error {
+	return c.shard(key).SetString(key, value, ttl)
+}
+
+func (c *ShardedCacheWithTTL) GetString(key string) (string, bool) {
+	return c.shard(key).GetString(key)
+}
+
+func (v *ttlView) SetString(key, value string) error {
+	return v.c.SetString(key, value, v.ttl)
+}
+
+func (v *ttlView) GetString(key string) (string, bool) {
+	return v.c.GetString(key)
+}
@@ -0,0 +1,126 @@
+package gcache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCache_String 测试 SetString/GetString 与字节 API 一致，包括空字符串
+func TestCache_String(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"checksum", []Option{WithChecksum()}},
+		{"key hashing", []Option{WithKeyHashing(16)}},
+		{"big values", []Option{WithBigValues()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := NewCache(1024*1024, tc.opts...)
+			defer cache.Close()
+
+			key := strings.Repeat("k", 20)
+			value := "<p>fragment</p>"
+			if err := cache.SetString(key, value); err != nil {
+				t.Fatalf("SetString = %v", err)
+			}
+			if got, ok := cache.GetString(key); !ok || got != value {
+				t.Errorf("GetString = %q, %v, want %q", got, ok, value)
+			}
+			if got := cache.Get(key); string(got) != value {
+				t.Errorf("Get of a SetString value = %q, want %q", got, value)
+			}
+
+			// 空字符串与 []byte("") 存储一致
+			cache.SetString("empty", "")
+			if got, ok := cache.GetString("empty"); !ok || got != "" {
+				t.Errorf("GetString(empty) = %q, %v, want \"\", true", got, ok)
+			}
+			if got, ok := cache.GetOK("empty"); !ok || got == nil || len(got) != 0 {
+				t.Errorf("GetOK(empty) = %v, %v, want an empty value", got, ok)
+			}
+			if got, ok := cache.GetString("missing"); ok || got != "" {
+				t.Errorf("GetString(missing) = %q, %v, want \"\", false", got, ok)
+			}
+
+			big := strings.Repeat("x", 80*1024)
+			err := cache.SetString("big", big)
+			if got, ok := cache.GetString("big"); (err == nil) != (ok && got == big) {
+				t.Errorf("SetString of 80KB = %v, then GetString found it %v", err, ok)
+			}
+		})
+	}
+
+	cache := NewCache(1024 * 1024)
+	defer cache.Close()
+	value := "value"
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.SetString("key", value)
+	})
+	if allocs != 0 {
+		t.Errorf("SetString allocs = %v, want 0", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		cache.GetString("key")
+	})
+	if allocs != 1 {
+		t.Errorf("GetString allocs = %v, want 1", allocs)
+	}
+}
+
+// TestCacheWithTTL_String 测试 TTL 缓存的 SetString/GetString
+func TestCacheWithTTL_String(t *testing.T) {
+	cache, clock := newFakeClockCache()
+	defer cache.Close()
+
+	if err := cache.SetString("key", `{"a":1}`, time.Second); err != nil {
+		t.Fatalf("SetString = %v", err)
+	}
+	if got, ok := cache.GetString("key"); !ok || got != `{"a":1}` {
+		t.Errorf("GetString = %q, %v, want {\"a\":1}", got, ok)
+	}
+	cache.SetString("empty", "", time.Second)
+	if got, ok := cache.GetOK("empty"); !ok || got == nil || len(got) != 0 {
+		t.Errorf("GetOK(empty) = %v, %v, want an empty value", got, ok)
+	}
+	if got, ok := cache.AsICache(time.Second).GetString("empty"); !ok || got != "" {
+		t.Errorf("view GetString(empty) = %q, %v, want \"\", true", got, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	if got, ok := cache.GetString("key"); ok || got != "" {
+		t.Errorf("GetString after expiry = %q, %v, want \"\", false", got, ok)
+	}
+
+	value := "value"
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.SetString("key", value, time.Minute)
+	})
+	if allocs != 0 {
+		t.Errorf("SetString allocs = %v, want 0", allocs)
+	}
+}
+
+// BenchmarkCache_String 基准测试 SetString/GetString 与经过 []byte 转换的 Set/Get
+func BenchmarkCache_String(b *testing.B) {
+	cache := NewCache(100 * 1024 * 1024)
+	defer cache.Close()
+	value := strings.Repeat("<li>item</li>", 64)
+
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cache.Set("bench-key", []byte(value))
+			_ = string(cache.Get("bench-key"))
+		}
+	})
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cache.SetString("bench-key", value)
+			_, _ = cache.GetString("bench-key")
+		}
+	})
+}
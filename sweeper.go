@@ -0,0 +1,180 @@
+package gcache
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSweepScan bounds the keys a sweep checks, so a tick never holds up
+// the cache for long. The next sweep carries on where it stopped.
+const maxSweepScan = 1024
+
+// SweepResult describes a pass of the background sweeper, see WithCleanupInterval.
+type SweepResult struct {
+	At           time.Time // when the sweep ran, by the cache's clock
+	Scanned      int       // indexed keys checked
+	Removed      int       // expired entries deleted
+	TotalRemoved int64     // expired entries deleted by all sweeps so far
+}
+
+// sweeper periodically deletes expired entries of a CacheWithTTL. It must not
+// reference the CacheWithTTL itself, so an unclosed cache can still become
+// unreachable and have its sweeper stopped by a cleanup.
+type sweeper struct {
+	cache *Cache
+	index *keyIndex
+	clock Clock
+	entryFormat
+
+	// cursor into the index and scratch space, used by the sweep goroutine only
+	shard, pos int
+	keys       []string
+
+	last    atomic.Pointer[SweepResult]
+	removed int64
+
+	// resets counts the calls of reset, seen those the sweep goroutine has
+	// caught up with. mu orders reset against publishing a sweep.
+	mu     sync.Mutex
+	resets atomic.Uint64
+	seen   uint64
+
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+	cleanup runtime.Cleanup
+}
+
+// startSweeper starts sweeping c every interval until c is closed or garbage collected
+func startSweeper(c *CacheWithTTL, interval time.Duration) *sweeper {
+	s := &sweeper{
+		cache:       c.cache,
+		index:       c.index,
+		clock:       c.clock,
+		entryFormat: c.entryFormat,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	s.cleanup = runtime.AddCleanup(c, (*sweeper).signal, s)
+	go s.run(interval)
+	return s
+}
+
+func (s *sweeper) run(interval time.Duration) {
+	defer close(s.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.publish(s.sweep(maxSweepScan))
+		}
+	}
+}
+
+// sweep checks up to max indexed keys from where the previous sweep stopped,
+// deleting expired entries and forgetting keys fastcache no longer holds
+func (s *sweeper) sweep(max int) SweepResult {
+	resets := s.resets.Load()
+	if resets != s.seen {
+		s.shard, s.pos, s.removed, s.seen = 0, 0, 0, resets
+	}
+	keys := s.keys[:0]
+	for range lockStripes {
+		keys, s.pos = s.index.collect(keys, s.shard, s.pos, max-len(keys))
+		if s.pos == 0 {
+			s.shard = (s.shard + 1) % lockStripes
+		}
+		if len(keys) == max {
+			break
+		}
+	}
+
+	now := s.clock.Now()
+	res := SweepResult{At: now, Scanned: len(keys)}
+	for i, key := range keys {
+		// keys collected before a reset are gone
+		if s.resets.Load() != resets {
+			clear(keys[i:])
+			break
+		}
+		if dropExpired(s.cache, s.index, key, s.entryFormat, now.UnixMilli()) {
+			res.Removed++
+		}
+		keys[i] = ""
+	}
+	s.keys = keys
+	s.removed += int64(res.Removed)
+	res.TotalRemoved = s.removed
+	return res
+}
+
+// reset makes the sweep goroutine start over from the first key with its
+// totals zeroed and forgets the last sweep, for CacheWithTTL.Reset. It is
+// safe to call on a nil sweeper.
+func (s *sweeper) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.resets.Add(1)
+	s.last.Store(nil)
+	s.mu.Unlock()
+}
+
+// publish makes res the last sweep unless the cache was reset during it
+func (s *sweeper) publish(res SweepResult) {
+	s.mu.Lock()
+	if s.resets.Load() == s.seen {
+		s.last.Store(&res)
+	}
+	s.mu.Unlock()
+}
+
+// signal tells the sweep goroutine to stop
+func (s *sweeper) signal() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// close stops the sweeper and waits for its goroutine to exit, it is safe
+// to call more than once and on a nil sweeper
+func (s *sweeper) close() {
+	if s == nil {
+		return
+	}
+	s.cleanup.Stop()
+	s.signal()
+	<-s.done
+}
+
+// dropExpired deletes key if it holds an entry past its hard expiry and
+// reports whether it did. Keys fastcache no longer holds are removed from
+// index. The entry is checked under the key's lock so a concurrent write is
+// never deleted.
+func dropExpired(c *Cache, index *keyIndex, key string, f entryFormat, now int64) bool {
+	mu, err := c.lockOpen(key)
+	if err != nil {
+		return false
+	}
+
+	var expired bool
+	has := c.view(key, func(data []byte) {
+		h, _, ok := f.decode(data)
+		expired = ok && isExpired(h.deadline(), now)
+	})
+	if expired {
+		c.del(key)
+	}
+	if expired || !has {
+		index.remove(key)
+	}
+	mu.Unlock()
+	if expired {
+		c.expiredPurged()
+	}
+	return expired
+}
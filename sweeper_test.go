@@ -0,0 +1,197 @@
+package gcache
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestSweeper 测试后台清理删除过期 entry
+func TestSweeper(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithCleanupInterval(5*time.Millisecond))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("short-%d", i), []byte("v"), time.Second)
+	}
+	cache.Set("long", []byte("v"), time.Hour)
+	clock.Advance(2 * time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.index.len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := c.index.len(); n != 1 {
+		t.Fatalf("index holds %d keys after sweeping, want 1", n)
+	}
+	if _, _, ok := cache.GetStale("short-0"); ok {
+		t.Error("expired entry should be deleted by the sweeper")
+	}
+	if !cache.Has("long") {
+		t.Error("live entry should be kept")
+	}
+
+	res, ok := cache.LastSweep()
+	if !ok || res.TotalRemoved != 100 {
+		t.Errorf("LastSweep = %+v, %v, want 100 removed in total", res, ok)
+	}
+}
+
+// TestSweeper_Bounded 测试每次清理检查的 key 数量有上限并从上次停下的位置继续
+func TestSweeper_Bounded(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithCleanupInterval(time.Hour))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("v"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	// 测试直接调用 sweep，后台 goroutine 一小时才运行一次
+	total := 0
+	for i := 0; i < 10; i++ {
+		res := c.sweeper.sweep(100)
+		if res.Scanned > 100 {
+			t.Fatalf("sweep scanned %d keys, want at most 100", res.Scanned)
+		}
+		total += res.Removed
+	}
+	if n := c.index.len(); total != 1000-n || n > 100 {
+		t.Errorf("10 sweeps of 100 removed %d, %d keys left, want about all of 1000", total, n)
+	}
+}
+
+// TestSweeper_Reset 测试 Reset 后清理从头开始并重新计数
+func TestSweeper_Reset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithCleanupInterval(time.Hour))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("v"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+	c.sweeper.publish(c.sweeper.sweep(100))
+	if res, ok := cache.LastSweep(); !ok || res.TotalRemoved == 0 {
+		t.Fatalf("LastSweep = %+v, %v, want some keys removed", res, ok)
+	}
+
+	if err := cache.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if _, ok := cache.LastSweep(); ok {
+		t.Error("LastSweep should report nothing after Reset")
+	}
+	cache.Set("new", []byte("v"), -time.Second)
+	res := c.sweeper.sweep(maxSweepScan)
+	if res.Scanned != 1 || res.Removed != 1 || res.TotalRemoved != 1 {
+		t.Errorf("sweep after Reset = %+v, want the new key scanned and removed", res)
+	}
+	if c.sweeper.shard != 0 || c.sweeper.pos != 0 {
+		t.Errorf("sweep cursor = %d, %d, want it back at the start", c.sweeper.shard, c.sweeper.pos)
+	}
+}
+
+// TestSweeper_Evicted 测试被 fastcache 淘汰或删除的 key 会从索引中移除
+func TestSweeper_Evicted(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithCleanupInterval(time.Hour))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	cache.Set("evicted", []byte("v"), time.Hour)
+	cache.Set("deleted", []byte("v"), time.Hour)
+	cache.Set("live", []byte("v"), time.Hour)
+	c.cache.fc().Del([]byte("evicted")) // 模拟淘汰
+	cache.Delete("deleted")
+	if n := c.index.len(); n != 2 {
+		t.Fatalf("index holds %d keys after Delete, want 2", n)
+	}
+
+	if res := c.sweeper.sweep(maxSweepScan); res.Removed != 0 {
+		t.Errorf("sweep removed %d, want 0", res.Removed)
+	}
+	if n := c.index.len(); n != 1 {
+		t.Errorf("index holds %d keys, want 1", n)
+	}
+}
+
+// TestSweeper_Close 测试关闭后清理 goroutine 退出且可重复关闭
+func TestSweeper_Close(t *testing.T) {
+	base := runtime.NumGoroutine()
+	cache := NewCacheWithTTL(1024*1024, WithCleanupInterval(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	cache.Close()
+	cache.Close()
+	if got := runtime.NumGoroutine(); got > base {
+		t.Errorf("goroutines after Close = %d, want <= %d", got, base)
+	}
+	if _, ok := NewCacheWithTTL(1024 * 1024).LastSweep(); ok {
+		t.Error("LastSweep should report nothing without a sweeper")
+	}
+}
+
+// TestExpireProbes 测试每次 Set 顺带清理随机抽样到的过期 entry
+func TestExpireProbes(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(16*1024*1024, WithClock(clock), WithExpireProbes(4))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	const junk = 2000
+	for i := 0; i < junk; i++ {
+		cache.Set(fmt.Sprintf("junk-%d", i), []byte("v"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	// 统计仍驻留的过期 entry
+	resident := func() int {
+		n := 0
+		for i := 0; i < junk; i++ {
+			if _, _, ok := cache.GetStale(fmt.Sprintf("junk-%d", i)); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	prev := resident()
+	if prev != junk {
+		t.Fatalf("resident expired entries = %d, want %d", prev, junk)
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 500; i++ {
+			cache.Set(fmt.Sprintf("live-%d-%d", round, i), []byte("v"), time.Hour)
+		}
+		n := resident()
+		if n >= prev {
+			t.Fatalf("round %d: resident expired entries = %d, want fewer than %d", round, n, prev)
+		}
+		prev = n
+	}
+	if live := 5 * 500; c.index.len() != live+prev {
+		t.Errorf("index holds %d keys, want %d", c.index.len(), live+prev)
+	}
+}
+
+// TestExpireProbes_Empty 测试索引为空时不做抽样
+func TestExpireProbes_Empty(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithExpireProbes(4))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	c.probe()
+	cache.Set("key", []byte("v"), time.Hour)
+	if !cache.Has("key") || c.index.len() != 1 {
+		t.Errorf("Has = %v, index len = %d, want true, 1", cache.Has("key"), c.index.len())
+	}
+	if NewCacheWithTTL(1024*1024).(*CacheWithTTL).index != nil {
+		t.Error("index should only be kept when an option needs it")
+	}
+}
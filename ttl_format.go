@@ -0,0 +1,355 @@
+package gcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Entries are stored as [2-byte entryMarker][version byte][header][payload].
+// The marker tells entries written by a CacheWithTTL from values something else
+// stored under the same keys, whose first bytes would otherwise be read as a
+// header. Each version appends a field to the header of the previous one:
+//
+// formatV1: [8-byte big-endian expireAt][uvarint ttl millis]
+// formatV2: formatV1 + [uvarint createdAt]
+// formatV3: formatV2 + [uvarint stale millis]
+//
+// formatCompact: [4-byte big-endian expiry in deciseconds since the cache's
+// epoch], written instead of formatV3 with WithCompactTTL. It has no room for
+// the other fields, which read as 0, so entries with a soft TTL are still
+// written as formatV3. Expiries are rounded up to the decisecond and
+// math.MaxUint32 stands for noExpiry.
+// formatCompactSec: formatCompact counting seconds, written with a
+// WithTTLPrecision of a second.
+// formatIdle: formatV3 + [uvarint tti millis][8-byte big-endian lastAccess],
+// written instead of formatV3 for entries with a time-to-idle, see SetWithTTI.
+// lastAccess is last so reads can patch it in place.
+// formatFlags: [flags byte][header of any other version], written in front of
+// the header of entries with a flag set, so others don't pay for it. flagNil
+// marks a nil value, stored with an empty payload, so reads return nil
+// rather than an empty slice.
+//
+// Times are unix millis. The ttl is what Touch re-arms the entry with, 0 for
+// entries written with an absolute expiry or made persistent. stale is the
+// window before expireAt in which the entry is past its soft TTL, see
+// SetWithSoftTTL. New entries are written as formatV3 or compact, older layouts
+// read with the fields they lack as 0.
+//
+// Entries written before the version byte was introduced are
+// [8-byte big-endian expireAt][payload]. The first byte of such an entry is the
+// top byte of its expiry: 0x00 for any timestamp between 1970 and the year
+// 2 million, 0x7f for noExpiry and 0xff for times before 1970. Versions are
+// numbered from 0x01 so an entry whose first byte isn't a known version is read
+// as legacy.
+//
+// Entries written before the marker was introduced have no marker and are read
+// as such with WithLegacyEntries only, see entryFormat.
+
+// entryMarker starts every entry. 0xc0 never appears in UTF-8, so text values
+// can't be mistaken for entries, nor can legacy ones whose first byte is a
+// version or the top byte of a timestamp.
+const entryMarker = "\xc0\xde"
+
+const (
+	formatV1 = 0x01
+	formatV2 = 0x02
+	formatV3 = 0x03
+
+	formatCompact    = 0x04
+	formatCompactSec = 0x05
+
+	formatIdle = 0x06
+
+	formatFlags = 0x07
+)
+
+// flags of a formatFlags header
+const flagNil = 0x01
+
+const (
+	// compactUnit and compactSecUnit are the resolutions in millis
+	// of formatCompact and formatCompactSec expiries
+	compactUnit    = 100
+	compactSecUnit = 1000
+	// compactNoExpiry is the compact expiry of persisted entries
+	compactNoExpiry = math.MaxUint32
+	// compactHeaderSize is the size of a compact header with its version byte
+	compactHeaderSize = 1 + 4
+)
+
+// noExpiry is the expiry of entries made persistent by Persist
+const noExpiry = math.MaxInt64
+
+// maxHeaderSize is the largest header put in front of the payload
+const maxHeaderSize = len(entryMarker) + 2 + 1 + 8 + 4*binary.MaxVarintLen64 + 8
+
+// header is the decoded metadata of an entry
+type header struct {
+	expireAt   int64
+	ttl        time.Duration
+	createdAt  int64         // 0 if unknown
+	stale      time.Duration // 0 without a soft TTL
+	tti        time.Duration // 0 without a time-to-idle
+	lastAccess int64
+	nilValue   bool // the value was nil rather than empty
+}
+
+// deadline is when the entry expires: its expireAt, or the end of its idle
+// time if that comes first
+func (h header) deadline() int64 {
+	if h.tti <= 0 {
+		return h.expireAt
+	}
+	return min(h.expireAt, h.lastAccess+h.tti.Milliseconds())
+}
+
+// softExpireAt is when the entry passes its soft TTL,
+// its deadline if it has none
+func (h header) softExpireAt() int64 {
+	d := h.deadline()
+	if h.stale <= 0 || d == noExpiry {
+		return d
+	}
+	return d - h.stale.Milliseconds()
+}
+
+// payload returns the value of the entry data with header h of size n,
+// nil for a nil value
+func (h header) payload(data []byte, n int) []byte {
+	if h.nilValue {
+		return nil
+	}
+	return data[n:]
+}
+
+// putHeader writes h as formatV3 into dst, or formatIdle if it has a tti, and
+// returns its size. Non-positive durations are stored as 0 and others rounded
+// up to the millisecond.
+func putHeader(dst []byte, h header) int {
+	if n := putFlags(dst, h); n > 0 {
+		h.nilValue = false
+		return n + putHeader(dst[n:], h)
+	}
+	dst[0] = formatV3
+	binary.BigEndian.PutUint64(dst[1:9], uint64(h.expireAt))
+	n := 9 + binary.PutUvarint(dst[9:], durationMillis(h.ttl))
+	n += binary.PutUvarint(dst[n:], uint64(h.createdAt))
+	n += binary.PutUvarint(dst[n:], durationMillis(h.stale))
+	if h.tti <= 0 {
+		return n
+	}
+	dst[0] = formatIdle
+	n += binary.PutUvarint(dst[n:], durationMillis(h.tti))
+	binary.BigEndian.PutUint64(dst[n:], uint64(h.lastAccess))
+	return n + 8
+}
+
+// putCompactHeader writes expireAt in the compact format version relative to
+// epoch into dst and returns its size. It fails with ErrTTLOutOfRange if
+// expireAt is too far past epoch, earlier expiries are stored as the epoch itself.
+func putCompactHeader(dst []byte, version byte, expireAt, epoch int64) (int, error) {
+	unit := compactUnitOf(version)
+	rel := uint64(compactNoExpiry)
+	if expireAt != noExpiry {
+		d := max(expireAt-epoch, 0)
+		rel = uint64((d + unit - 1) / unit)
+		if rel >= compactNoExpiry {
+			return 0, fmt.Errorf("%w: expiry is %v past the cache epoch, limit is %v", ErrTTLOutOfRange,
+				time.Duration(d)*time.Millisecond, time.Duration(compactNoExpiry-1)*time.Duration(unit)*time.Millisecond)
+		}
+	}
+	dst[0] = version
+	binary.BigEndian.PutUint32(dst[1:compactHeaderSize], uint32(rel))
+	return compactHeaderSize, nil
+}
+
+// copyPayload returns a copy of the value of the entry data with header h of
+// size n, nil for a nil value
+func copyPayload(h header, data []byte, n int) []byte {
+	if h.nilValue {
+		return nil
+	}
+	return append([]byte{}, data[n:]...)
+}
+
+// isIdle reports whether data is a formatIdle entry, behind flags or not
+func isIdle(data []byte) bool {
+	if marked(data) {
+		data = data[len(entryMarker):]
+	}
+	if len(data) > 2 && data[0] == formatFlags {
+		data = data[2:]
+	}
+	return len(data) > 0 && data[0] == formatIdle
+}
+
+// clearNil drops the formatFlags prefix of the entry data in place, for a value
+// that is no longer nil: flagNil is its only flag
+func clearNil(data []byte) []byte {
+	i := 0
+	if marked(data) {
+		i = len(entryMarker)
+	}
+	if len(data) > i+2 && data[i] == formatFlags {
+		return append(data[:i], data[i+2:]...)
+	}
+	return data
+}
+
+// putFlags writes the formatFlags prefix of h into dst and returns its size,
+// 0 if h has no flag to write
+func putFlags(dst []byte, h header) int {
+	if !h.nilValue {
+		return 0
+	}
+	dst[0], dst[1] = formatFlags, flagNil
+	return 2
+}
+
+// compactUnitOf returns the resolution in millis of a compact format version
+func compactUnitOf(version byte) int64 {
+	if version == formatCompactSec {
+		return compactSecUnit
+	}
+	return compactUnit
+}
+
+// roundUp rounds the unix millis t up to a multiple of unit
+func roundUp(t, unit int64) int64 {
+	if t == noExpiry || unit <= 1 {
+		return t
+	}
+	q := t / unit
+	if t%unit > 0 {
+		q++
+	}
+	return q * unit
+}
+
+func durationMillis(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// decodeHeader reads the header of any layout and its size n including the
+// version byte, false if data is too short to carry one. Compact expiries are
+// read relative to epoch.
+func decodeHeader(data []byte, epoch int64) (h header, n int, ok bool) {
+	if len(data) == 0 {
+		return header{}, 0, false
+	}
+	switch version := data[0]; version {
+	case formatFlags:
+		// flags prefix a header of another version, never a second set of flags
+		if len(data) < 3 || data[2] == formatFlags {
+			return header{}, 0, false
+		}
+		h, n, ok = decodeHeader(data[2:], epoch)
+		h.nilValue = data[1]&flagNil != 0
+		return h, n + 2, ok
+	case formatV1, formatV2, formatV3, formatIdle:
+		if len(data) < 9 {
+			return header{}, 0, false
+		}
+		h.expireAt = int64(binary.BigEndian.Uint64(data[1:9]))
+		n = 9
+		// the varint fields in the order the versions added them
+		var fields [4]uint64
+		count := int(version)
+		if version == formatIdle {
+			count = 4
+		}
+		for i := range count {
+			v, m := binary.Uvarint(data[n:])
+			if m <= 0 {
+				return header{}, 0, false
+			}
+			fields[i] = v
+			n += m
+		}
+		h.ttl = time.Duration(fields[0]) * time.Millisecond
+		h.createdAt = int64(fields[1])
+		h.stale = time.Duration(fields[2]) * time.Millisecond
+		h.tti = time.Duration(fields[3]) * time.Millisecond
+		if version == formatIdle {
+			if len(data) < n+8 {
+				return header{}, 0, false
+			}
+			h.lastAccess = int64(binary.BigEndian.Uint64(data[n : n+8]))
+			n += 8
+		}
+		return h, n, true
+	case formatCompact, formatCompactSec:
+		if len(data) < compactHeaderSize {
+			return header{}, 0, false
+		}
+		h.expireAt = noExpiry
+		if rel := binary.BigEndian.Uint32(data[1:compactHeaderSize]); rel != compactNoExpiry {
+			h.expireAt = epoch + int64(rel)*compactUnitOf(version)
+		}
+		return h, compactHeaderSize, true
+	default:
+		if len(data) < 8 {
+			return header{}, 0, false
+		}
+		return header{expireAt: int64(binary.BigEndian.Uint64(data[:8]))}, 8, true
+	}
+}
+
+// marked reports whether data starts with entryMarker
+func marked(data []byte) bool {
+	return len(data) >= len(entryMarker) && string(data[:len(entryMarker)]) == entryMarker
+}
+
+// entryFormat is how a CacheWithTTL reads its entries, kept apart from the
+// cache for the sweeper, which must not reference it
+type entryFormat struct {
+	epoch  int64 // unix millis compact expiries count from
+	legacy bool  // read unmarked entries, see WithLegacyEntries
+}
+
+// decode reads the header of an entry and its size n including the marker,
+// false if data isn't one, see decodeHeader
+func (f entryFormat) decode(data []byte) (header, int, bool) {
+	if !marked(data) {
+		if !f.legacy {
+			return header{}, 0, false
+		}
+		return decodeHeader(data, f.epoch)
+	}
+	h, n, ok := decodeHeader(data[len(entryMarker):], f.epoch)
+	if !ok {
+		return header{}, 0, false
+	}
+	return h, n + len(entryMarker), true
+}
+
+// foreign reports whether the stored value data wasn't written by a
+// CacheWithTTL, rather than being an entry too short to decode
+func (f entryFormat) foreign(data []byte) bool {
+	return !f.legacy && !marked(data)
+}
+
+// decodeExpireAt reads the deadline from the header of an entry
+func (f entryFormat) decodeExpireAt(data []byte) (int64, bool) {
+	h, _, ok := f.decode(data)
+	return h.deadline(), ok
+}
+
+func isExpired(expireAt, now int64) bool {
+	return expireAt != noExpiry && now >= expireAt
+}
+
+// remaining returns the time left until a live expireAt, rounded up to the
+// millisecond. Persisted entries report the largest Duration.
+func remaining(expireAt int64, now time.Time) time.Duration {
+	if expireAt == noExpiry {
+		return math.MaxInt64
+	}
+	d := time.UnixMilli(expireAt).Sub(now)
+	return (d + time.Millisecond - 1).Truncate(time.Millisecond)
+}
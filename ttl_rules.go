@@ -0,0 +1,60 @@
+package gcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UseRuleTTL passed as the ttl of CacheWithTTL.Set picks the ttl from the
+// configured TTL rules instead.
+const UseRuleTTL time.Duration = math.MinInt64
+
+// ErrNoTTLRules is returned by the writes of a CacheWithTTL passed UseRuleTTL
+// when it has no TTL rules, see WithTTLRules.
+var ErrNoTTLRules = errors.New("gcache: UseRuleTTL passed but no TTL rules are configured")
+
+// TTLRule gives every key starting with Prefix the given TTL.
+// The rule with an empty Prefix is the default and is required.
+type TTLRule struct {
+	Prefix string
+	TTL    time.Duration
+}
+
+// ttlRules is sorted longest prefix first, so the first match wins
+type ttlRules []TTLRule
+
+func newTTLRules(rules []TTLRule) (*ttlRules, error) {
+	sorted := make(ttlRules, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	seen := make(map[string]struct{}, len(sorted))
+	for _, rule := range sorted {
+		if rule.TTL <= 0 {
+			return nil, fmt.Errorf("gcache: TTL rule %q has non-positive ttl %v", rule.Prefix, rule.TTL)
+		}
+		if _, ok := seen[rule.Prefix]; ok {
+			return nil, fmt.Errorf("gcache: duplicate TTL rule %q", rule.Prefix)
+		}
+		seen[rule.Prefix] = struct{}{}
+	}
+	if _, ok := seen[""]; !ok {
+		return nil, errors.New("gcache: TTL rules need a default rule with an empty prefix")
+	}
+	return &sorted, nil
+}
+
+func (r ttlRules) lookup(key string) time.Duration {
+	for _, rule := range r {
+		if strings.HasPrefix(key, rule.Prefix) {
+			return rule.TTL
+		}
+	}
+	return 0 // unreachable, the default rule matches everything
+}
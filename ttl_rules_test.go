@@ -0,0 +1,367 @@
+package gcache
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remainingTTL 直接读取 header 计算剩余时间
+func remainingTTL(t *testing.T, cache ICacheWithTTL, key string) time.Duration {
+	t.Helper()
+	c := cache.(*CacheWithTTL)
+	expireAt, ok := c.decodeExpireAt(c.cache.Get(key))
+	if !ok {
+		t.Fatalf("key %q not stored", key)
+	}
+	return time.UnixMilli(expireAt).Sub(c.clock.Now())
+}
+
+// assertTTL 检查剩余时间在 want 附近
+func assertTTL(t *testing.T, cache ICacheWithTTL, key string, want time.Duration) {
+	t.Helper()
+	got := remainingTTL(t, cache, key)
+	if got > want || got < want-time.Second {
+		t.Errorf("ttl of %q = %v, want about %v", key, got, want)
+	}
+}
+
+var testTTLRules = []TTLRule{
+	{Prefix: "", TTL: time.Hour},
+	{Prefix: "profile:", TTL: 10 * time.Minute},
+	{Prefix: "profile:vip:", TTL: 30 * time.Minute},
+	{Prefix: "flags:", TTL: 30 * time.Second},
+}
+
+// TestTTLRules_Precedence 测试最长前缀优先
+func TestTTLRules_Precedence(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithTTLRules(testTTLRules))
+	defer cache.Close()
+
+	testCases := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"profile:1", 10 * time.Minute},
+		{"profile:vip:1", 30 * time.Minute},
+		{"flags:dark-mode", 30 * time.Second},
+		{"search:q", time.Hour},
+		{"", time.Hour},
+	}
+
+	for _, tc := range testCases {
+		if err := cache.Set(tc.key, []byte("value"), UseRuleTTL); err != nil {
+			t.Fatalf("Set(%q) failed: %v", tc.key, err)
+		}
+		assertTTL(t, cache, tc.key, tc.want)
+	}
+}
+
+// TestTTLRules_ExplicitOverride 测试显式 TTL 优先于规则
+func TestTTLRules_ExplicitOverride(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithTTLRules(testTTLRules))
+	defer cache.Close()
+
+	if err := cache.Set("flags:x", []byte("value"), 5*time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	assertTTL(t, cache, "flags:x", 5*time.Minute)
+
+	// 负 TTL 仍然立即过期
+	if err := cache.Set("flags:y", []byte("value"), -time.Second); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if cache.Has("flags:y") {
+		t.Error("negative TTL should still expire immediately")
+	}
+}
+
+// TestTTLRules_NoRules 测试未配置规则时使用 UseRuleTTL 返回错误
+func TestTTLRules_NoRules(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	err := cache.Set("key", []byte("value"), UseRuleTTL)
+	if !errors.Is(err, ErrNoTTLRules) {
+		t.Errorf("Set returned %v, want %v", err, ErrNoTTLRules)
+	}
+	if cache.Has("key") {
+		t.Error("key should not be stored when the ttl can't be resolved")
+	}
+}
+
+// TestTTLRules_Invalid 测试非法规则
+func TestTTLRules_Invalid(t *testing.T) {
+	cache := NewCacheWithTTL(1024 * 1024)
+	defer cache.Close()
+
+	testCases := []struct {
+		name  string
+		rules []TTLRule
+	}{
+		{"empty", []TTLRule{}},
+		{"no default", []TTLRule{{Prefix: "a:", TTL: time.Second}}},
+		{"zero ttl", []TTLRule{{Prefix: "", TTL: 0}}},
+		{"sentinel ttl", []TTLRule{{Prefix: "", TTL: UseRuleTTL}}},
+		{"duplicate", []TTLRule{{Prefix: "", TTL: time.Second}, {Prefix: "", TTL: time.Minute}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := cache.SetTTLRules(tc.rules); err == nil {
+				t.Error("SetTTLRules accepted invalid rules")
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewCacheWithTTL did not panic on invalid rules")
+		}
+	}()
+	NewCacheWithTTL(1024*1024, WithTTLRules([]TTLRule{{Prefix: "a:", TTL: time.Second}}))
+}
+
+// TestTTLRules_Swap 测试运行时替换规则
+func TestTTLRules_Swap(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithTTLRules(testTTLRules))
+	defer cache.Close()
+
+	// 调用方修改传入的 slice 不影响已生效的规则
+	rules := []TTLRule{{Prefix: "", TTL: time.Minute}}
+	if err := cache.SetTTLRules(rules); err != nil {
+		t.Fatalf("SetTTLRules failed: %v", err)
+	}
+	rules[0].TTL = time.Hour
+
+	cache.Set("profile:1", []byte("value"), UseRuleTTL)
+	assertTTL(t, cache, "profile:1", time.Minute)
+
+	// 移除规则
+	if err := cache.SetTTLRules(nil); err != nil {
+		t.Fatalf("SetTTLRules(nil) failed: %v", err)
+	}
+	if err := cache.Set("key", []byte("value"), UseRuleTTL); !errors.Is(err, ErrNoTTLRules) {
+		t.Errorf("Set returned %v, want %v", err, ErrNoTTLRules)
+	}
+}
+
+// TestTTLRules_SwapUnderLoad 测试并发写入时替换规则
+func TestTTLRules_SwapUnderLoad(t *testing.T) {
+	cache := NewCacheWithTTL(10*1024*1024, WithTTLRules([]TTLRule{{Prefix: "", TTL: time.Minute}}))
+	defer cache.Close()
+
+	const numGoroutines = 20
+	const numKeys = 500
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines + 1)
+
+	for i := 0; i < numGoroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < numKeys; j++ {
+				key := string(rune(id*numKeys + j))
+				if err := cache.Set(key, []byte("value"), UseRuleTTL); err != nil {
+					t.Errorf("Set failed: %v", err)
+				}
+			}
+		}(i)
+	}
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ttl := time.Minute
+			if i%2 == 1 {
+				ttl = time.Hour
+			}
+			if err := cache.SetTTLRules([]TTLRule{{Prefix: "", TTL: ttl}}); err != nil {
+				t.Errorf("SetTTLRules failed: %v", err)
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	// 每个 key 的 TTL 都来自某一版完整的规则
+	for i := 0; i < numGoroutines*numKeys; i++ {
+		got := remainingTTL(t, cache, string(rune(i)))
+		if !(got > time.Minute-2*time.Second && got <= time.Minute) &&
+			!(got > time.Hour-2*time.Second && got <= time.Hour) {
+			t.Fatalf("ttl of key %d = %v, want about 1m or 1h", i, got)
+		}
+	}
+}
+
+// TestDefaultTTL 测试配置默认 TTL 后零值 TTL 使用默认值
+func TestDefaultTTL(t *testing.T) {
+	cache := NewCacheWithTTL(1024*1024, WithDefaultTTL(5*time.Minute))
+	defer cache.Close()
+
+	if err := cache.Set("key", []byte("value"), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	assertTTL(t, cache, "key", 5*time.Minute)
+
+	// 显式 TTL 不受影响，负 TTL 仍然立即过期
+	cache.Set("explicit", []byte("value"), time.Minute)
+	assertTTL(t, cache, "explicit", time.Minute)
+	cache.Set("negative", []byte("value"), -time.Second)
+	if cache.Has("negative") {
+		t.Error("negative TTL should still expire immediately")
+	}
+
+	// 其他写入路径同样使用默认值
+	cache.SetNX("nx", []byte("value"), 0)
+	assertTTL(t, cache, "nx", 5*time.Minute)
+	cache.Incr("counter", 1, 0)
+	assertTTL(t, cache, "counter", 5*time.Minute)
+}
+
+// TestDefaultTTL_Unset 测试未配置默认 TTL 时零值 TTL 立即过期
+func TestDefaultTTL_Unset(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithDefaultTTL(0)}} {
+		cache := NewCacheWithTTL(1024*1024, opts...)
+		cache.Set("key", []byte("value"), 0)
+		if cache.Has("key") {
+			t.Error("zero TTL without a default should expire immediately")
+		}
+		cache.Close()
+	}
+
+	defer func() {
+		if r := recover(); r != ErrInvalidDefaultTTL {
+			t.Errorf("NewCacheWithTTL panicked with %v, want %v", r, ErrInvalidDefaultTTL)
+		}
+	}()
+	NewCacheWithTTL(1024*1024, WithDefaultTTL(-time.Second))
+}
+
+// TestTTLJitter 测试 TTL 在 ±fraction 范围内随机分布
+func TestTTLJitter(t *testing.T) {
+	cache := NewCacheWithTTL(10*1024*1024, WithTTLJitter(0.1))
+	defer cache.Close()
+
+	const numKeys = 1000
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < numKeys; i++ {
+		key := string(rune(i))
+		cache.Set(key, []byte("value"), 10*time.Minute)
+		ttl, ok := cache.TTL(key)
+		if !ok || ttl < 9*time.Minute-time.Second || ttl > 11*time.Minute {
+			t.Fatalf("TTL(%d) = %v, %v, want within 9m..11m", i, ttl, ok)
+		}
+		seen[ttl.Truncate(time.Second)] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("only %d distinct TTLs across %d keys, jitter not applied", len(seen), numKeys)
+	}
+
+	// 负 TTL 不受影响
+	cache.Set("negative", []byte("value"), -time.Second)
+	if cache.Has("negative") {
+		t.Error("negative TTL should still expire immediately")
+	}
+	// 正 TTL 不会变成非正数
+	for i := 0; i < 100; i++ {
+		if d := cache.(*CacheWithTTL).jittered(1); d <= 0 {
+			t.Fatalf("jittered(1) = %v, want > 0", d)
+		}
+	}
+}
+
+// TestTTLJitter_Invalid 测试非法的 jitter 比例
+func TestTTLJitter_Invalid(t *testing.T) {
+	for _, fraction := range []float64{-0.1, 1, 2, math.NaN()} {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrInvalidTTLJitter {
+					t.Errorf("WithTTLJitter(%v) panicked with %v, want %v", fraction, r, ErrInvalidTTLJitter)
+				}
+			}()
+			NewCacheWithTTL(1024*1024, WithTTLJitter(fraction))
+		}()
+	}
+}
+
+// TestTTLPrecision 测试秒级精度下过期时间向上取整
+func TestTTLPrecision(t *testing.T) {
+	clock := NewFakeClock(time.UnixMilli(1_700_000_000_250))
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithTTLPrecision(time.Second))
+	defer cache.Close()
+
+	cache.Set("key", []byte("value"), 100*time.Millisecond)
+	c := cache.(*CacheWithTTL)
+	if expireAt, _ := c.decodeExpireAt(c.cache.Get("key")); expireAt%1000 != 0 {
+		t.Errorf("expireAt = %d, want whole seconds", expireAt)
+	}
+
+	// 取整只会延后过期，不会提前
+	clock.Advance(100*time.Millisecond - time.Millisecond)
+	if !cache.Has("key") {
+		t.Error("key should live at least its ttl")
+	}
+	clock.Advance(time.Second)
+	if cache.Has("key") {
+		t.Error("key should expire within a second past its ttl")
+	}
+
+	// 绝对时间同样向上取整，持久化不受影响
+	cache.SetWithExpireAt("abs", []byte("v"), clock.Now().Add(10*time.Millisecond))
+	if ttl, ok := cache.TTL("abs"); !ok || ttl < 10*time.Millisecond || ttl > time.Second {
+		t.Errorf("TTL(abs) = %v, %v, want within a second", ttl, ok)
+	}
+	cache.Persist("abs")
+	if ttl, _ := cache.TTL("abs"); ttl != math.MaxInt64 {
+		t.Errorf("TTL after Persist = %v, want persistent", ttl)
+	}
+}
+
+// TestTTLPrecision_Compact 测试秒级精度的紧凑格式及与其他精度 entry 共存
+func TestTTLPrecision_Compact(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	cache := NewCacheWithTTL(1024*1024, WithClock(clock), WithCompactTTL(), WithTTLPrecision(time.Second))
+	defer cache.Close()
+	c := cache.(*CacheWithTTL)
+
+	// 秒级精度可以表示超过 13 年的 TTL
+	if err := cache.Set("long", []byte("v"), 20*365*24*time.Hour); err != nil {
+		t.Fatalf("Set(20 years) = %v, want nil", err)
+	}
+	if raw := c.cache.Get("long"); version(raw) != formatCompactSec {
+		t.Errorf("version byte = %#x, want %#x", version(raw), formatCompactSec)
+	}
+
+	// 以分秒精度写入的 entry 仍按自身精度读取
+	var hdr [compactHeaderSize]byte
+	putCompactHeader(hdr[:], formatCompact, clock.Now().Add(1500*time.Millisecond).UnixMilli(), c.epoch)
+	c.cache.Set("deci", append([]byte(entryMarker+string(hdr[:])), "v"...))
+	clock.Advance(1400 * time.Millisecond)
+	if !cache.Has("deci") {
+		t.Error("decisecond entry should still be live")
+	}
+	clock.Advance(200 * time.Millisecond)
+	if cache.Has("deci") {
+		t.Error("decisecond entry should expire at its own precision")
+	}
+	if !cache.Has("long") {
+		t.Error("second entry should still be live")
+	}
+}
+
+// TestTTLPrecision_Invalid 测试非法的精度
+func TestTTLPrecision_Invalid(t *testing.T) {
+	for _, p := range []time.Duration{-time.Second, time.Microsecond, 100 * time.Millisecond, time.Minute} {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrInvalidTTLPrecision {
+					t.Errorf("WithTTLPrecision(%v) panicked with %v, want %v", p, r, ErrInvalidTTLPrecision)
+				}
+			}()
+			NewCacheWithTTL(1024*1024, WithTTLPrecision(p))
+		}()
+	}
+}
@@ -0,0 +1,170 @@
+package gcache
+
+import (
+	"sort"
+	"time"
+)
+
+// ttlView is a CacheWithTTL, or a ShardedCacheWithTTL, seen as an ICache,
+// writing every entry for a fixed ttl. It holds no state of its own, so it is
+// as safe for concurrent use as the cache and can be mixed freely with direct
+// calls on it.
+type ttlView struct {
+	c   ICacheWithTTL
+	ttl time.Duration
+}
+
+// AsICache returns a view of c as an ICache for code that doesn't know about
+// TTLs. Its writes store entries for ttl, resolved like the ttl of Set, and
+// its reads see only live entries. Closing the view leaves c open.
+func (c *CacheWithTTL) AsICache(ttl time.Duration) ICache {
+	return &ttlView{c: c, ttl: ttl}
+}
+
+func (v *ttlView) Has(key string) bool {
+	return v.c.Has(key)
+}
+
+func (v *ttlView) HasMulti(keys []string) []bool {
+	return v.c.HasMulti(keys)
+}
+
+func (v *ttlView) Get(key string) []byte {
+	return v.c.Get(key)
+}
+
+func (v *ttlView) GetOK(key string) ([]byte, bool) {
+	return v.c.GetOK(key)
+}
+
+func (v *ttlView) GetInto(dst []byte, key string) ([]byte, bool) {
+	return v.c.GetInto(dst, key)
+}
+
+func (v *ttlView) GetFn(key string, fn func(value []byte) error) (bool, error) {
+	return v.c.GetFn(key, fn)
+}
+
+func (v *ttlView) GetLease(key string) (*Lease, bool) {
+	return v.c.GetLease(key)
+}
+
+func (v *ttlView) GetOrDefault(key string, def []byte) []byte {
+	return v.c.GetOrDefault(key, def)
+}
+
+func (v *ttlView) Peek(key string) []byte {
+	return v.c.Peek(key)
+}
+
+func (v *ttlView) MGet(keys []string) [][]byte {
+	return v.c.MGet(keys)
+}
+
+func (v *ttlView) MGetMap(keys []string) (map[string][]byte, []string) {
+	return v.c.MGetMap(keys)
+}
+
+func (v *ttlView) GetRange(key string, offset, length int) []byte {
+	return v.c.GetRange(key, offset, length)
+}
+
+func (v *ttlView) Set(key string, value []byte) error {
+	return v.c.Set(key, value, v.ttl)
+}
+
+// MSet writes every entry like Set, failures are returned as a *BatchError
+// sorted by key like those of Cache.MSet.
+func (v *ttlView) MSet(entries map[string][]byte) error {
+	var errs BatchError
+	for key, value := range entries {
+		errs.add(key, v.c.Set(key, value, v.ttl))
+	}
+	sort.Slice(errs.Errors, func(i, j int) bool {
+		return errs.Errors[i].Key < errs.Errors[j].Key
+	})
+	return errs.err()
+}
+
+func (v *ttlView) GetOrSet(key string, value []byte) (actual []byte, stored bool, err error) {
+	return v.c.GetOrSet(key, value, v.ttl)
+}
+
+func (v *ttlView) SetNX(key string, value []byte) (bool, error) {
+	return v.c.SetNX(key, value, v.ttl)
+}
+
+func (v *ttlView) SetXX(key string, value []byte) (bool, error) {
+	return v.c.SetXX(key, value, v.ttl)
+}
+
+func (v *ttlView) SetReplaced(key string, value []byte) (bool, error) {
+	return v.c.SetReplaced(key, value, v.ttl)
+}
+
+func (v *ttlView) Swap(key string, value []byte) (old []byte, existed bool, err error) {
+	return v.c.Swap(key, value, v.ttl)
+}
+
+func (v *ttlView) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	return v.c.CompareAndSwap(key, expected, value, v.ttl)
+}
+
+func (v *ttlView) Append(key string, data []byte) error {
+	return v.c.Append(key, data, v.ttl)
+}
+
+func (v *ttlView) Incr(key string, delta int64) (int64, error) {
+	return v.c.Incr(key, delta, v.ttl)
+}
+
+func (v *ttlView) Decr(key string, delta int64) (int64, error) {
+	return v.c.Decr(key, delta, v.ttl)
+}
+
+func (v *ttlView) IncrFloat(key string, delta float64) (float64, error) {
+	return v.c.IncrFloat(key, delta, v.ttl)
+}
+
+func (v *ttlView) Delete(key string) error {
+	return v.c.Delete(key)
+}
+
+func (v *ttlView) GetAndDelete(key string) []byte {
+	return v.c.GetAndDelete(key)
+}
+
+func (v *ttlView) CompareAndDelete(key string, expected []byte) (bool, error) {
+	return v.c.CompareAndDelete(key, expected)
+}
+
+func (v *ttlView) MDelete(keys ...string) (int, error) {
+	return v.c.MDelete(keys...)
+}
+
+func (v *ttlView) Stats() Stats {
+	return v.c.Stats()
+}
+
+// ResetStats resets the counters of the underlying cache.
+func (v *ttlView) ResetStats() Stats {
+	return v.c.ResetStats()
+}
+
+func (v *ttlView) EffectiveMaxBytes() int {
+	return v.c.EffectiveMaxBytes()
+}
+
+func (v *ttlView) HotKeys() []HotKey {
+	return v.c.HotKeys()
+}
+
+// Reset removes every entry of the underlying cache, see CacheWithTTL.Reset.
+func (v *ttlView) Reset() error {
+	return v.c.Reset()
+}
+
+// Close does nothing, the underlying cache is closed on its own.
+func (v *ttlView) Close() error {
+	return nil
+}